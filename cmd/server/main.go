@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
@@ -10,19 +12,31 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
-	"database/sql"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/attrschema"
+	"github.com/hex-zero/MaxwellGoSpine/internal/auth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
 	"github.com/hex-zero/MaxwellGoSpine/internal/cache"
 	"github.com/hex-zero/MaxwellGoSpine/internal/config"
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
 	routerpkg "github.com/hex-zero/MaxwellGoSpine/internal/http/router"
+	"github.com/hex-zero/MaxwellGoSpine/internal/idempotency"
+	"github.com/hex-zero/MaxwellGoSpine/internal/jwtauth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
 	applog "github.com/hex-zero/MaxwellGoSpine/internal/log"
+	"github.com/hex-zero/MaxwellGoSpine/internal/mailer"
 	"github.com/hex-zero/MaxwellGoSpine/internal/metrics"
+	appmw "github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+	"github.com/hex-zero/MaxwellGoSpine/internal/outbox"
+	"github.com/hex-zero/MaxwellGoSpine/internal/reqsign"
+	"github.com/hex-zero/MaxwellGoSpine/internal/servertls"
 	"github.com/hex-zero/MaxwellGoSpine/internal/storage/postgres"
+	"github.com/hex-zero/MaxwellGoSpine/internal/webhook"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -46,14 +60,27 @@ func main() {
 	defer logger.Sync() //nolint:errcheck
 
 	logger.Info("starting server", zap.String("version", version), zap.String("commit", commit), zap.String("date", date))
+	if unscoped := cfg.UnscopedAPIKeys(); len(unscoped) > 0 {
+		ids := make([]string, len(unscoped))
+		for i, k := range unscoped {
+			ids[i] = appmw.KeyID(k)
+		}
+		logger.Warn("API_KEY_SCOPES does not list these keys; they authenticate but have no scopes", zap.Strings("keys", ids))
+	}
 
 	var (
-		db       *sql.DB // nil in memory mode
-		userRepo core.UserRepository
+		db           *sql.DB // nil in memory mode
+		userRepo     core.UserRepository
+		outboxStore  outbox.Store
+		webhookStore webhook.Store
+		apiKeyStore  apikey.Store
 	)
 	if cfg.InMemory {
 		logger.Warn("starting in-memory mode (no external Postgres, data not persisted)")
-		userRepo = core.NewInMemoryUserRepo()
+		memRepo := core.NewInMemoryUserRepo()
+		userRepo, outboxStore = memRepo, memRepo
+		webhookStore = webhook.NewMemoryStore()
+		apiKeyStore = apikey.NewMemoryStore()
 	} else {
 		db, err = postgres.Open(ctx, cfg.DBDSN)
 		if err != nil {
@@ -61,8 +88,69 @@ func main() {
 		}
 		defer db.Close()
 		userRepo = postgres.NewUserRepo(db)
+		outboxStore = postgres.NewOutboxStore(db)
+		webhookStore = postgres.NewWebhookStore(db)
+		apiKeyStore = postgres.NewAPIKeyStore(db)
+	}
+	eventsEnabled := cfg.OutboxPublisher != "" || cfg.WebhooksEnabled
+	// In-process fan-out of committed changes to live streams (/v1/users/events)
+	events := broker.New(broker.Options{ReplaySize: cfg.EventsReplaySize})
+	svcOpts := core.UserServiceOptions{Events: eventsEnabled, Audit: cfg.AuditLog, Notifier: events}
+	if cfg.AttributesSchema != "" {
+		schema, err := attrschema.Load(cfg.AttributesSchema)
+		if err != nil {
+			logger.Fatal("attributes schema", zap.Error(err))
+		}
+		svcOpts.Attributes = schema
+	}
+	// Email verification: a token is mailed on create and on every email change
+	mail, err := newMailer(cfg, logger)
+	if err != nil {
+		logger.Fatal("mailer", zap.Error(err))
+	}
+	userMailer := mailer.NewUserMailer(mail, logger.Named("mailer"), mailer.UserMailOptions{
+		VerifyURL: cfg.EmailVerifyURL,
+		ResetURL:  cfg.PasswordResetURL,
+	})
+	svcOpts.Verification = core.NewVerificationTokens(secretOrRandom("EMAIL_VERIFY_SECRET", cfg.EmailVerifySecret, logger), cfg.EmailVerifyTTL)
+	svcOpts.VerificationSender = userMailer
+	baseUserSvc := core.NewUserServiceWithOpts(userRepo, svcOpts)
+
+	// Webhooks: the outbox fans events out into the delivery queue, a worker sends them
+	var webhookSvc webhook.Service
+	if cfg.WebhooksEnabled {
+		webhookSvc = webhook.NewService(webhookStore)
+		workerCtx, stopWorker := context.WithCancel(ctx)
+		defer stopWorker()
+		go webhook.NewWorker(webhookStore, logger.Named("webhooks"), webhook.WorkerOptions{
+			MaxAttempts:  cfg.WebhookMaxAttempts,
+			Timeout:      cfg.WebhookTimeout,
+			AllowPrivate: cfg.WebhookAllowPrivate,
+		}).Run(workerCtx)
+	}
+
+	// Outbox dispatcher: delivers user events committed alongside each mutation
+	if eventsEnabled {
+		var pubs []outbox.Publisher
+		if cfg.OutboxPublisher != "" {
+			pub, err := newPublisher(cfg, logger)
+			if err != nil {
+				logger.Fatal("outbox publisher", zap.Error(err))
+			}
+			pubs = append(pubs, pub)
+		}
+		if cfg.WebhooksEnabled {
+			pubs = append(pubs, webhook.NewPublisher(webhookStore))
+		}
+		dispatchCtx, stopDispatch := context.WithCancel(ctx)
+		defer stopDispatch()
+		d := outbox.NewDispatcher(outboxStore, outbox.Multi(pubs...), logger.Named("outbox"), outbox.DispatcherOptions{
+			PollInterval: cfg.OutboxPollInterval,
+			BatchSize:    cfg.OutboxBatchSize,
+		})
+		go d.Run(dispatchCtx)
+		logger.Info("user event outbox enabled", zap.String("publisher", cfg.OutboxPublisher), zap.Bool("webhooks", cfg.WebhooksEnabled))
 	}
-	baseUserSvc := core.NewUserService(userRepo)
 
 	// Layered cache (local + optional Redis)
 	var rdb *redis.Client
@@ -84,19 +172,98 @@ func main() {
 		logger.Warn("cache init failed", zap.Error(err))
 	}
 	userSvc := core.NewCachedUserService(baseUserSvc, layeredCache)
+	var idemStore idempotency.Store // nil: the router keeps Idempotency-Key responses in memory
+	var sessions auth.SessionStore = auth.NewMemorySessionStore()
+	if rdb != nil {
+		idemStore = idempotency.NewRedisStore(rdb)
+		sessions = auth.NewRedisSessionStore(rdb)
+	}
+	// End-user sign-in: password hashes live beside the users, sessions in Redis or memory
+	creds, ok := userRepo.(core.CredentialRepository)
+	if !ok {
+		logger.Fatal("user repository cannot store passwords")
+	}
+	authSvc := auth.NewService(userSvc, creds, sessions, auth.Options{
+		SessionTTL:  cfg.SessionTTL,
+		ResetSecret: secretOrRandom("PASSWORD_RESET_SECRET", cfg.PasswordResetSecret, logger),
+		ResetTTL:    cfg.PasswordResetTTL,
+		ResetSender: userMailer,
+		Policy:      auth.PasswordPolicy{MinLength: cfg.PasswordMinLength},
+	})
+
+	// Bearer JWTs from an external identity provider, as an alternative to API keys
+	var jwtVerifier *jwtauth.Verifier
+	if cfg.JWTJWKS != "" {
+		jwksCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		keys, err := jwtauth.NewJWKS(jwksCtx, cfg.JWTJWKS, jwtauth.JWKSOptions{RefreshInterval: cfg.JWKSRefreshInterval, Logger: logger})
+		cancel()
+		if err != nil {
+			logger.Fatal("jwks", zap.Error(err))
+		}
+		jwtVerifier = jwtauth.NewVerifier(keys, jwtauth.VerifierOptions{
+			Issuer:      cfg.JWTIssuer,
+			Audience:    cfg.JWTAudience,
+			Leeway:      cfg.JWTLeeway,
+			TenantClaim: cfg.JWTTenantClaim,
+		})
+	}
+
+	// Managed API keys: minted through /v1/admin/keys and stored hashed; the env-var keys keep working
+	var apiKeySvc apikey.Service
+	if cfg.APIKeysManaged {
+		apiKeySvc = apikey.NewService(apiKeyStore, apikey.Options{CacheTTL: cfg.APIKeyCacheTTL, SigningKEK: cfg.APIKeySigningKEK})
+	}
+
+	// Signed requests: nonces are shared through Redis, or only remembered by this instance without it
+	var nonces reqsign.NonceStore
+	if cfg.RequestSigning {
+		if rdb != nil {
+			nonces = reqsign.NewRedisNonceStore(rdb)
+		} else {
+			logger.Warn("REQUEST_SIGNING without redis: replayed requests are only detected by the instance that saw them first")
+			nonces = reqsign.NewMemoryNonceStore()
+		}
+	}
 
 	reg := metrics.NewRegistry()
 
+	// Per-key usage: counted in memory, flushed to Redis when available so every instance adds to the same totals
+	var usageTracker *keyusage.Tracker
+	if cfg.APIKeyUsage {
+		var usageStore keyusage.Store = keyusage.NewMemoryStore()
+		switch {
+		case rdb != nil:
+			usageStore = keyusage.NewRedisStore(rdb)
+		case db != nil:
+			usageStore = postgres.NewKeyUsageStore(db)
+		}
+		usageTracker = keyusage.NewTracker(usageStore, logger.Named("keyusage"), keyusage.Options{
+			FlushInterval: cfg.APIKeyUsageFlushInterval,
+			Metrics:       reg,
+		})
+		usageCtx, stopUsage := context.WithCancel(ctx)
+		defer stopUsage()
+		go usageTracker.Run(usageCtx)
+	}
+
 	r := chi.NewRouter()
 	apiRouter := routerpkg.New(routerpkg.Deps{
-		Logger:    logger,
-		UserSvc:   userSvc,
-		CFG:       cfg,
-		Registry:  reg,
-		Version:   version,
-		Commit:    commit,
-		BuildDate: date,
-	DB:        db,
+		Logger:      logger,
+		UserSvc:     userSvc,
+		CFG:         cfg,
+		Registry:    reg,
+		Version:     version,
+		Commit:      commit,
+		BuildDate:   date,
+		DB:          db,
+		Webhooks:    webhookSvc,
+		Events:      events,
+		Idempotency: idemStore,
+		Auth:        authSvc,
+		JWT:         jwtVerifier,
+		APIKeys:     apiKeySvc,
+		KeyUsage:    usageTracker,
+		Nonces:      nonces,
 	})
 
 	r.Mount("/", apiRouter)
@@ -112,10 +279,46 @@ func main() {
 		IdleTimeout:       60 * time.Second,
 		ErrorLog:          zap.NewStdLog(logger.Named("http_error")),
 	}
+	srv.RegisterOnShutdown(events.Close) // end live streams so Shutdown is not held up by them
+
+	// In-process TLS: certificates are reloaded when their files change and on SIGHUP, without dropping connections
+	var certs *servertls.Reloader
+	if cfg.TLSCertFile != "" {
+		certs, err = servertls.New(servertls.Options{
+			CertFile:          cfg.TLSCertFile,
+			KeyFile:           cfg.TLSKeyFile,
+			ClientCAFile:      cfg.TLSClientCAFile,
+			RequireClientCert: cfg.TLSClientAuth == "require",
+		})
+		if err != nil {
+			logger.Fatal("tls", zap.Error(err))
+		}
+		srv.TLSConfig = certs.TLSConfig()
+		tlsCtx, stopTLS := context.WithCancel(ctx)
+		defer stopTLS()
+		go certs.Watch(tlsCtx, cfg.TLSReloadInterval, logger.Named("tls"))
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := certs.Reload(); err != nil {
+					logger.Error("tls reload on SIGHUP failed; keeping the loaded certificate", zap.Error(err))
+					continue
+				}
+				logger.Info("tls certificate reloaded on SIGHUP", zap.Time("not_after", certs.Certificate().NotAfter))
+			}
+		}()
+	}
 
 	go func() {
-		logger.Info("http server listening", zap.Int("port", cfg.HTTPPort))
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Info("http server listening", zap.Int("port", cfg.HTTPPort), zap.Bool("tls", certs != nil))
+		var err error
+		if certs != nil {
+			err = srv.ListenAndServeTLS("", "") // certificates come from srv.TLSConfig
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Fatal("server error", zap.Error(err))
 		}
 	}()
@@ -130,5 +333,52 @@ func main() {
 		logger.Error("graceful shutdown failed", zap.Error(err))
 		_ = srv.Close()
 	}
+	userMailer.Wait()
+	if usageTracker != nil { // counts of the last requests
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := usageTracker.Flush(flushCtx); err != nil {
+			logger.Warn("api key usage flush failed", zap.Error(err))
+		}
+		cancelFlush()
+	}
 	logger.Info("server stopped")
 }
+
+// secretOrRandom returns value, or a random secret (with a warning) when the variable name is unset. Tokens
+// signed with a random secret stop working on restart and are not accepted by other replicas.
+func secretOrRandom(name, value string, logger *zap.Logger) []byte {
+	if value != "" {
+		return []byte(value)
+	}
+	logger.Warn(name + " not set; tokens signed with it will not survive a restart")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		logger.Fatal("random secret", zap.Error(err))
+	}
+	return secret
+}
+
+// newMailer builds the mailer selected by MAILER.
+func newMailer(cfg *config.Config, logger *zap.Logger) (mailer.Mailer, error) {
+	switch cfg.Mailer {
+	case "file":
+		return mailer.NewFileMailer(cfg.MailerFile)
+	case "smtp":
+		return mailer.NewSMTPMailer(mailer.SMTPOptions{Addr: cfg.SMTPAddr, From: cfg.SMTPFrom,
+			Username: cfg.SMTPUsername, Password: cfg.SMTPPassword})
+	default:
+		return mailer.NewLogMailer(logger.Named("mail")), nil
+	}
+}
+
+// newPublisher builds the outbox publisher selected by OUTBOX_PUBLISHER.
+func newPublisher(cfg *config.Config, logger *zap.Logger) (outbox.Publisher, error) {
+	switch cfg.OutboxPublisher {
+	case "file":
+		return outbox.NewFilePublisher(cfg.OutboxFile)
+	case "memory":
+		return outbox.NewMemoryPublisher(), nil
+	default:
+		return outbox.NewLogPublisher(logger.Named("events")), nil
+	}
+}
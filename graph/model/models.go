@@ -10,4 +10,12 @@ type User struct {
 	CreatedAt string  `json:"createdAt"`
 	UpdatedAt string  `json:"updatedAt"`
 	DeletedAt *string `json:"deletedAt"`
+	Version   int     `json:"version"`
+	Cursor    string  `json:"cursor"`
+	// Attributes is never nil, so the non-null GraphQL field always resolves.
+	Attributes      map[string]any `json:"attributes"`
+	Status          UserStatus     `json:"status"`
+	StatusChangedAt string         `json:"statusChangedAt"`
+	StatusReason    *string        `json:"statusReason"`
+	EmailVerifiedAt *string        `json:"emailVerifiedAt"`
 }
@@ -2,8 +2,373 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type AttributeFilter struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type AuditEntry struct {
+	ID string `json:"id"`
+	// created, updated, deleted, restored or purged
+	Action string `json:"action"`
+	// API key identity (apikey:<hash>), anonymous, or system
+	Actor      string  `json:"actor"`
+	RequestID  *string `json:"requestId,omitempty"`
+	OccurredAt string  `json:"occurredAt"`
+	// Empty for restores and purges
+	Changes []FieldChange `json:"changes"`
+}
+
+// A failed batch item, shaped like the REST Problem Details.
+type BatchItemError struct {
+	Status  int     `json:"status"`
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Field   *string `json:"field,omitempty"`
+}
+
+type BatchUserResult struct {
+	// Position of the item in the request
+	Index int `json:"index"`
+	// The created user; null for deletes and failed items
+	User  *User           `json:"user,omitempty"`
+	Error *BatchItemError `json:"error,omitempty"`
+}
+
+type CreateUserInput struct {
+	Name       string                 `json:"name"`
+	Email      string                 `json:"email"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// One field of a before/after diff; null means the field had no value on that side.
+type FieldChange struct {
+	Field  string  `json:"field"`
+	Before *string `json:"before,omitempty"`
+	After  *string `json:"after,omitempty"`
+}
+
 type Mutation struct {
 }
 
 type Query struct {
 }
+
+type Subscription struct {
+}
+
+type UserChangeEvent struct {
+	// Event id, shared with the outbox CloudEvent and the SSE stream
+	ID     string     `json:"id"`
+	Kind   ChangeKind `json:"kind"`
+	UserID string     `json:"userId"`
+	// State after the change; null for deletes and purges
+	User       *User  `json:"user,omitempty"`
+	OccurredAt string `json:"occurredAt"`
+}
+
+type UserFilter struct {
+	Deleted     *DeletedMode `json:"deleted,omitempty"`
+	NamePrefix  *string      `json:"namePrefix,omitempty"`
+	EmailDomain *string      `json:"emailDomain,omitempty"`
+	// RFC3339; inclusive
+	CreatedAfter *string `json:"createdAfter,omitempty"`
+	// RFC3339; exclusive
+	CreatedBefore *string `json:"createdBefore,omitempty"`
+	// RFC3339; inclusive
+	UpdatedAfter *string `json:"updatedAfter,omitempty"`
+	// RFC3339; exclusive
+	UpdatedBefore *string `json:"updatedBefore,omitempty"`
+	// Users whose top-level attribute equals the value, compared as text (all must match).
+	Attributes []AttributeFilter `json:"attributes,omitempty"`
+	// Users in any of these statuses
+	Status []UserStatus `json:"status,omitempty"`
+}
+
+type UserSearchResult struct {
+	User *User `json:"user"`
+	// Relevance; higher is better
+	Score float64 `json:"score"`
+}
+
+type UserSort struct {
+	Field     UserSortField  `json:"field"`
+	Direction *SortDirection `json:"direction,omitempty"`
+}
+
+type BatchMode string
+
+const (
+	// All-or-nothing in one transaction; the first failing item aborts the batch with an error carrying its index
+	BatchModeAtomic BatchMode = "ATOMIC"
+	// Apply every item that succeeds and report failures per item
+	BatchModePartial BatchMode = "PARTIAL"
+)
+
+var AllBatchMode = []BatchMode{
+	BatchModeAtomic,
+	BatchModePartial,
+}
+
+func (e BatchMode) IsValid() bool {
+	switch e {
+	case BatchModeAtomic, BatchModePartial:
+		return true
+	}
+	return false
+}
+
+func (e BatchMode) String() string {
+	return string(e)
+}
+
+func (e *BatchMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = BatchMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid BatchMode", str)
+	}
+	return nil
+}
+
+func (e BatchMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ChangeKind string
+
+const (
+	ChangeKindCreated       ChangeKind = "CREATED"
+	ChangeKindUpdated       ChangeKind = "UPDATED"
+	ChangeKindDeleted       ChangeKind = "DELETED"
+	ChangeKindRestored      ChangeKind = "RESTORED"
+	ChangeKindPurged        ChangeKind = "PURGED"
+	ChangeKindStatusChanged ChangeKind = "STATUS_CHANGED"
+)
+
+var AllChangeKind = []ChangeKind{
+	ChangeKindCreated,
+	ChangeKindUpdated,
+	ChangeKindDeleted,
+	ChangeKindRestored,
+	ChangeKindPurged,
+	ChangeKindStatusChanged,
+}
+
+func (e ChangeKind) IsValid() bool {
+	switch e {
+	case ChangeKindCreated, ChangeKindUpdated, ChangeKindDeleted, ChangeKindRestored, ChangeKindPurged, ChangeKindStatusChanged:
+		return true
+	}
+	return false
+}
+
+func (e ChangeKind) String() string {
+	return string(e)
+}
+
+func (e *ChangeKind) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ChangeKind(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ChangeKind", str)
+	}
+	return nil
+}
+
+func (e ChangeKind) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type DeletedMode string
+
+const (
+	// Live users only (default)
+	DeletedModeExclude DeletedMode = "EXCLUDE"
+	// Live and soft-deleted users
+	DeletedModeInclude DeletedMode = "INCLUDE"
+	// Soft-deleted users only
+	DeletedModeOnly DeletedMode = "ONLY"
+)
+
+var AllDeletedMode = []DeletedMode{
+	DeletedModeExclude,
+	DeletedModeInclude,
+	DeletedModeOnly,
+}
+
+func (e DeletedMode) IsValid() bool {
+	switch e {
+	case DeletedModeExclude, DeletedModeInclude, DeletedModeOnly:
+		return true
+	}
+	return false
+}
+
+func (e DeletedMode) String() string {
+	return string(e)
+}
+
+func (e *DeletedMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DeletedMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DeletedMode", str)
+	}
+	return nil
+}
+
+func (e DeletedMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UserSortField string
+
+const (
+	UserSortFieldCreatedAt UserSortField = "CREATED_AT"
+	UserSortFieldUpdatedAt UserSortField = "UPDATED_AT"
+	UserSortFieldName      UserSortField = "NAME"
+	UserSortFieldEmail     UserSortField = "EMAIL"
+)
+
+var AllUserSortField = []UserSortField{
+	UserSortFieldCreatedAt,
+	UserSortFieldUpdatedAt,
+	UserSortFieldName,
+	UserSortFieldEmail,
+}
+
+func (e UserSortField) IsValid() bool {
+	switch e {
+	case UserSortFieldCreatedAt, UserSortFieldUpdatedAt, UserSortFieldName, UserSortFieldEmail:
+		return true
+	}
+	return false
+}
+
+func (e UserSortField) String() string {
+	return string(e)
+}
+
+func (e *UserSortField) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserSortField", str)
+	}
+	return nil
+}
+
+func (e UserSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+// Lifecycle status. Allowed transitions: INVITED to ACTIVE or SUSPENDED, ACTIVE to SUSPENDED or LOCKED,
+// SUSPENDED to ACTIVE, LOCKED to ACTIVE or SUSPENDED.
+type UserStatus string
+
+const (
+	UserStatusInvited   UserStatus = "INVITED"
+	UserStatusActive    UserStatus = "ACTIVE"
+	UserStatusSuspended UserStatus = "SUSPENDED"
+	UserStatusLocked    UserStatus = "LOCKED"
+)
+
+var AllUserStatus = []UserStatus{
+	UserStatusInvited,
+	UserStatusActive,
+	UserStatusSuspended,
+	UserStatusLocked,
+}
+
+func (e UserStatus) IsValid() bool {
+	switch e {
+	case UserStatusInvited, UserStatusActive, UserStatusSuspended, UserStatusLocked:
+		return true
+	}
+	return false
+}
+
+func (e UserStatus) String() string {
+	return string(e)
+}
+
+func (e *UserStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserStatus", str)
+	}
+	return nil
+}
+
+func (e UserStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -1,12 +1,12 @@
 package resolver
 
-import "github.com/hex-zero/MaxwellGoSpine/internal/core"
+import (
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
 
 // Resolver serves as dependency injection for your app, add services here.
 type Resolver struct {
 	UserService core.UserService
+	Events      *broker.Broker // feeds subscriptions; nil disables them
 }
-
-// Root objects for gqlgen default layout
-type Query struct{ *Resolver }
-type Mutation struct{ *Resolver }
@@ -8,33 +8,262 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/hex-zero/MaxwellGoSpine/graph/generated"
 	"github.com/hex-zero/MaxwellGoSpine/graph/model"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
 )
 
 // CreateUser is the resolver for the createUser field.
-func (r *mutationResolver) CreateUser(ctx context.Context, name string, email string) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: CreateUser - createUser"))
+func (r *mutationResolver) CreateUser(ctx context.Context, name string, email string, attributes map[string]interface{}) (*model.User, error) {
+	u, err := r.UserService.Create(ctx, name, email, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u), nil
 }
 
 // UpdateUser is the resolver for the updateUser field.
-func (r *mutationResolver) UpdateUser(ctx context.Context, id string, name *string, email *string) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: UpdateUser - updateUser"))
+func (r *mutationResolver) UpdateUser(ctx context.Context, id string, name *string, email *string, attributes map[string]interface{}, expectedVersion *int) (*model.User, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	u, err := r.UserService.Update(ctx, uid, name, email, attributes, versionArg(expectedVersion))
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u), nil
 }
 
 // DeleteUser is the resolver for the deleteUser field.
-func (r *mutationResolver) DeleteUser(ctx context.Context, id string) (bool, error) {
-	panic(fmt.Errorf("not implemented: DeleteUser - deleteUser"))
+func (r *mutationResolver) DeleteUser(ctx context.Context, id string, expectedVersion *int) (bool, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return false, err
+	}
+	if err := r.UserService.Delete(ctx, uid, versionArg(expectedVersion)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RestoreUser is the resolver for the restoreUser field.
+func (r *mutationResolver) RestoreUser(ctx context.Context, id string) (*model.User, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	u, err := r.UserService.Restore(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u), nil
+}
+
+// InviteUser is the resolver for the inviteUser field.
+func (r *mutationResolver) InviteUser(ctx context.Context, name string, email string, attributes map[string]interface{}) (*model.User, error) {
+	u, err := r.UserService.Invite(ctx, name, email, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u), nil
+}
+
+// TransitionUser is the resolver for the transitionUser field.
+func (r *mutationResolver) TransitionUser(ctx context.Context, id string, to model.UserStatus, reason *string) (*model.User, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	var why string
+	if reason != nil {
+		why = *reason
+	}
+	u, err := r.UserService.Transition(ctx, uid, statusArg(to), why)
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u), nil
+}
+
+// PurgeUser is the resolver for the purgeUser field.
+func (r *mutationResolver) PurgeUser(ctx context.Context, id string) (bool, error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return false, err
+	}
+	if err := r.UserService.Purge(ctx, uid); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateUsers is the resolver for the createUsers field.
+func (r *mutationResolver) CreateUsers(ctx context.Context, input []model.CreateUserInput, mode *model.BatchMode) ([]model.BatchUserResult, error) {
+	ops := make([]core.BatchOp, len(input))
+	for i := range input {
+		ops[i] = core.BatchOp{Kind: core.BatchCreate, Name: &input[i].Name, Email: &input[i].Email, Attributes: input[i].Attributes}
+	}
+	results, err := r.UserService.Batch(ctx, ops, batchModeArg(mode))
+	if err != nil {
+		return nil, err
+	}
+	return convertBatchResults(results), nil
+}
+
+// DeleteUsers is the resolver for the deleteUsers field.
+func (r *mutationResolver) DeleteUsers(ctx context.Context, ids []string, mode *model.BatchMode) ([]model.BatchUserResult, error) {
+	ops := make([]core.BatchOp, len(ids))
+	for i, id := range ids {
+		uid, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("ids[%d]: invalid id: %w", i, core.ErrValidation)
+		}
+		ops[i] = core.BatchOp{Kind: core.BatchDelete, ID: uid}
+	}
+	results, err := r.UserService.Batch(ctx, ops, batchModeArg(mode))
+	if err != nil {
+		return nil, err
+	}
+	return convertBatchResults(results), nil
+}
+
+// VerifyEmail is the resolver for the verifyEmail field.
+func (r *mutationResolver) VerifyEmail(ctx context.Context, token string) (*model.User, error) {
+	u, err := r.UserService.VerifyEmail(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u), nil
 }
 
 // Users is the resolver for the users field.
-func (r *queryResolver) Users(ctx context.Context, page *int, pageSize *int) ([]model.User, error) {
-	panic(fmt.Errorf("not implemented: Users - users"))
+func (r *queryResolver) Users(ctx context.Context, page *int, pageSize *int, cursor *string, limit *int, filter *model.UserFilter, sort *model.UserSort) ([]model.User, error) {
+	f, err := toCoreFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	s := toCoreSort(sort)
+	if cursor != nil || limit != nil {
+		var c string
+		l := 20
+		if cursor != nil {
+			c = *cursor
+		}
+		if limit != nil {
+			l = *limit
+		}
+		users, _, err := r.UserService.ListAfter(ctx, f, s, c, l)
+		if err != nil {
+			return nil, err
+		}
+		return convertUsers(users, s), nil
+	}
+	p := 1
+	ps := 20
+	if page != nil {
+		p = *page
+	}
+	if pageSize != nil {
+		ps = *pageSize
+	}
+	users, _, err := r.UserService.List(ctx, f, s, p, ps)
+	if err != nil {
+		return nil, err
+	}
+	return convertUsers(users, s), nil
 }
 
 // User is the resolver for the user field.
 func (r *queryResolver) User(ctx context.Context, id string) (*model.User, error) {
-	panic(fmt.Errorf("not implemented: User - user"))
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	u, err := r.UserService.Get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return convertUser(u), nil
+}
+
+// SearchUsers is the resolver for the searchUsers field.
+func (r *queryResolver) SearchUsers(ctx context.Context, query string, limit *int) ([]model.UserSearchResult, error) {
+	l := 20
+	if limit != nil {
+		l = *limit
+	}
+	hits, err := r.UserService.Search(ctx, query, l)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]model.UserSearchResult, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, model.UserSearchResult{User: convertUser(h.User), Score: h.Score})
+	}
+	return out, nil
+}
+
+// UserChanged is the resolver for the userChanged field.
+func (r *subscriptionResolver) UserChanged(ctx context.Context, id *string, kinds []model.ChangeKind) (<-chan *model.UserChangeEvent, error) {
+	if r.Events == nil {
+		return nil, fmt.Errorf("subscriptions are not enabled")
+	}
+	var only uuid.UUID
+	if id != nil {
+		var err error
+		if only, err = uuid.Parse(*id); err != nil {
+			return nil, fmt.Errorf("invalid id: %w", core.ErrValidation)
+		}
+	}
+	release, err := acquireSubscription(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sub, _, _ := r.Events.Subscribe(core.TenantFrom(ctx), changeKindArg(kinds), 0)
+	out := make(chan *model.UserChangeEvent, 1)
+	go func() {
+		defer release()
+		defer sub.Close()
+		defer close(out) // completes the subscription, also when the broker drops it as too slow
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if only != uuid.Nil && ev.UserID != only {
+					continue
+				}
+				select {
+				case out <- convertChangeEvent(ev):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// History is the resolver for the history field.
+func (r *userResolver) History(ctx context.Context, obj *model.User, limit *int) ([]model.AuditEntry, error) {
+	uid, err := uuid.Parse(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+	l := 20
+	if limit != nil {
+		l = *limit
+	}
+	entries, err := r.UserService.History(ctx, uid, l)
+	if err != nil {
+		return nil, err
+	}
+	return convertAuditEntries(entries), nil
 }
 
 // Mutation returns generated.MutationResolver implementation.
@@ -43,5 +272,13 @@ func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResol
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
+// User returns generated.UserResolver implementation.
+func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
+
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,58 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/graph/model"
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// subscriptionSlots caps the concurrent subscriptions of one WebSocket connection.
+type subscriptionSlots struct {
+	max    int32
+	active atomic.Int32
+}
+
+type slotsKey struct{}
+
+// WithSubscriptionLimit is applied once per connection, from the WebSocket init, to cap its concurrent
+// subscriptions at max.
+func WithSubscriptionLimit(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, slotsKey{}, &subscriptionSlots{max: int32(max)})
+}
+
+// acquireSubscription takes a slot on the connection in ctx; release must be called when the subscription ends.
+func acquireSubscription(ctx context.Context) (release func(), err error) {
+	slots, ok := ctx.Value(slotsKey{}).(*subscriptionSlots)
+	if !ok {
+		return func() {}, nil
+	}
+	if slots.active.Add(1) > slots.max {
+		slots.active.Add(-1)
+		return nil, fmt.Errorf("at most %d concurrent subscriptions per connection: %w", slots.max, core.ErrLimitExceeded)
+	}
+	return func() { slots.active.Add(-1) }, nil
+}
+
+func changeKindArg(kinds []model.ChangeKind) []core.UserEventType {
+	types := make([]core.UserEventType, 0, len(kinds))
+	for _, k := range kinds {
+		types = append(types, core.UserEventType("user."+strings.ToLower(string(k))))
+	}
+	return types
+}
+
+func convertChangeEvent(ev broker.Event) *model.UserChangeEvent {
+	return &model.UserChangeEvent{
+		ID:         ev.ID.String(),
+		Kind:       model.ChangeKind(strings.ToUpper(strings.TrimPrefix(string(ev.Type), "user."))),
+		UserID:     ev.UserID.String(),
+		User:       convertUser(ev.User),
+		OccurredAt: ev.OccurredAt.Format(time.RFC3339Nano),
+	}
+}
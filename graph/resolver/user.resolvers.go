@@ -1,95 +1,191 @@
 package resolver
 
 import (
-	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/hex-zero/MaxwellGoSpine/graph/model"
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
 )
 
-// Query resolvers
-func (q *Query) Users(ctx context.Context, page *int, pageSize *int) ([]*model.User, error) {
-	p := 1
-	ps := 20
-	if page != nil {
-		p = *page
+// Helpers
+func convertUser(u *core.User) *model.User { return convertSortedUser(u, core.DefaultUserSort) }
+
+// convertSortedUser sets the keyset cursor for the ordering the user was listed in.
+func convertSortedUser(u *core.User, s core.UserSort) *model.User {
+	if u == nil {
+		return nil
 	}
-	if pageSize != nil {
-		ps = *pageSize
+	var del *string
+	if u.DeletedAt != nil {
+		s := u.DeletedAt.Format(time.RFC3339)
+		del = &s
 	}
-	users, _, err := q.UserService.List(ctx, p, ps)
-	if err != nil {
-		return nil, err
+	attrs := u.Attributes
+	if attrs == nil {
+		attrs = core.Attributes{}
 	}
-	out := make([]*model.User, 0, len(users))
-	for _, u := range users {
-		out = append(out, convertUser(u))
+	var reason *string
+	if u.StatusReason != "" {
+		reason = &u.StatusReason
 	}
-	return out, nil
+	var verified *string
+	if u.EmailVerifiedAt != nil {
+		s := u.EmailVerifiedAt.Format(time.RFC3339)
+		verified = &s
+	}
+	return &model.User{
+		ID:              u.ID.String(),
+		Name:            u.Name,
+		Email:           u.Email,
+		CreatedAt:       u.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       u.UpdatedAt.Format(time.RFC3339),
+		DeletedAt:       del,
+		Version:         int(u.Version),
+		Cursor:          core.EncodeCursor(core.CursorFor(u, s)),
+		Attributes:      attrs,
+		Status:          model.UserStatus(strings.ToUpper(string(u.Status))),
+		StatusChangedAt: u.StatusChangedAt.Format(time.RFC3339),
+		StatusReason:    reason,
+		EmailVerifiedAt: verified,
+	}
+}
+
+// statusArg maps a GraphQL status onto the core one; the enums share their names.
+func statusArg(s model.UserStatus) core.UserStatus {
+	return core.UserStatus(strings.ToLower(string(s)))
 }
 
-func (q *Query) User(ctx context.Context, id string) (*model.User, error) {
-	uid, err := uuid.Parse(id)
-	if err != nil {
-		return nil, err
+func convertUsers(users []*core.User, s core.UserSort) []model.User {
+	out := make([]model.User, 0, len(users))
+	for _, u := range users {
+		out = append(out, *convertSortedUser(u, s))
 	}
-	u, err := q.UserService.Get(ctx, uid)
-	if err != nil {
-		return nil, err
+	return out
+}
+
+// versionArg maps an optional GraphQL expectedVersion onto the service's 0 = unconditional convention.
+func versionArg(v *int) int64 {
+	if v == nil {
+		return 0
 	}
-	return convertUser(u), nil
+	return int64(*v)
 }
 
-// Mutation resolvers
-func (m *Mutation) CreateUser(ctx context.Context, name string, email string) (*model.User, error) {
-	u, err := m.UserService.Create(ctx, name, email)
-	if err != nil {
-		return nil, err
+func batchModeArg(m *model.BatchMode) core.BatchMode {
+	if m != nil && *m == model.BatchModePartial {
+		return core.BatchPartial
 	}
-	return convertUser(u), nil
+	return core.BatchAtomic
 }
 
-func (m *Mutation) UpdateUser(ctx context.Context, id string, name *string, email *string) (*model.User, error) {
-	uid, err := uuid.Parse(id)
-	if err != nil {
-		return nil, err
+// convertBatchResults reports failed items with the status and code the REST batch endpoint would use.
+func convertBatchResults(results []core.BatchResult) []model.BatchUserResult {
+	out := make([]model.BatchUserResult, len(results))
+	for i, res := range results {
+		out[i] = model.BatchUserResult{Index: i, User: convertUser(res.User)}
+		if res.Err == nil {
+			continue
+		}
+		status := errs.HTTPStatus(res.Err)
+		e := &model.BatchItemError{Status: status, Code: errs.Code(status), Message: res.Err.Error()}
+		var conflict *core.ConflictError
+		if errors.As(res.Err, &conflict) && conflict.Field != "" {
+			e.Field = &conflict.Field
+		}
+		out[i].Error = e
 	}
-	u, err := m.UserService.Update(ctx, uid, name, email)
-	if err != nil {
-		return nil, err
+	return out
+}
+
+func convertAuditEntries(entries []core.AuditEntry) []model.AuditEntry {
+	out := make([]model.AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		ae := model.AuditEntry{
+			ID:         e.ID.String(),
+			Action:     string(e.Action),
+			Actor:      e.Actor,
+			OccurredAt: e.OccurredAt.Format(time.RFC3339Nano),
+			Changes:    make([]model.FieldChange, 0, len(e.Changes)),
+		}
+		if e.RequestID != "" {
+			ae.RequestID = &e.RequestID
+		}
+		for _, c := range e.Changes {
+			ae.Changes = append(ae.Changes, model.FieldChange{Field: c.Field, Before: c.Before, After: c.After})
+		}
+		out = append(out, ae)
 	}
-	return convertUser(u), nil
+	return out
 }
 
-func (m *Mutation) DeleteUser(ctx context.Context, id string) (bool, error) {
-	uid, err := uuid.Parse(id)
-	if err != nil {
-		return false, err
+func toCoreFilter(in *model.UserFilter) (core.UserFilter, error) {
+	var f core.UserFilter
+	if in == nil {
+		return f, nil
+	}
+	if in.Deleted != nil {
+		switch *in.Deleted {
+		case model.DeletedModeInclude:
+			f.Deleted = core.DeletedInclude
+		case model.DeletedModeOnly:
+			f.Deleted = core.DeletedOnly
+		}
+	}
+	if in.NamePrefix != nil {
+		f.NamePrefix = *in.NamePrefix
 	}
-	if err := m.UserService.Delete(ctx, uid); err != nil {
-		return false, err
+	if in.EmailDomain != nil {
+		f.EmailDomain = *in.EmailDomain
 	}
-	return true, nil
+	for _, s := range in.Status {
+		f.Statuses = append(f.Statuses, statusArg(s))
+	}
+	for _, a := range in.Attributes {
+		if f.Attributes == nil {
+			f.Attributes = map[string]string{}
+		}
+		f.Attributes[a.Key] = a.Value
+	}
+	for _, b := range []struct {
+		name string
+		src  *string
+		dst  **time.Time
+	}{
+		{"createdAfter", in.CreatedAfter, &f.CreatedAfter},
+		{"createdBefore", in.CreatedBefore, &f.CreatedBefore},
+		{"updatedAfter", in.UpdatedAfter, &f.UpdatedAfter},
+		{"updatedBefore", in.UpdatedBefore, &f.UpdatedBefore},
+	} {
+		if b.src == nil {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, *b.src)
+		if err != nil {
+			return core.UserFilter{}, fmt.Errorf("%s: expected RFC3339 timestamp: %w", b.name, core.ErrValidation)
+		}
+		*b.dst = &ts
+	}
+	return f, nil
 }
 
-// Helpers
-func convertUser(u *core.User) *model.User {
-	if u == nil {
-		return nil
-	}
-	var del *string
-	if u.DeletedAt != nil {
-		s := u.DeletedAt.Format(time.RFC3339)
-		del = &s
+func toCoreSort(in *model.UserSort) core.UserSort {
+	if in == nil {
+		return core.DefaultUserSort
 	}
-	return &model.User{
-		ID:        u.ID.String(),
-		Name:      u.Name,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: u.UpdatedAt.Format(time.RFC3339),
-		DeletedAt: del,
+	s := core.UserSort{Desc: in.Direction != nil && *in.Direction == model.SortDirectionDesc}
+	switch in.Field {
+	case model.UserSortFieldUpdatedAt:
+		s.Field = core.SortByUpdatedAt
+	case model.UserSortFieldName:
+		s.Field = core.SortByName
+	case model.UserSortFieldEmail:
+		s.Field = core.SortByEmail
+	default:
+		s.Field = core.SortByCreatedAt
 	}
+	return s
 }
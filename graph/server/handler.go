@@ -1,18 +1,159 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gorilla/websocket"
 	"github.com/hex-zero/MaxwellGoSpine/graph/generated"
 	"github.com/hex-zero/MaxwellGoSpine/graph/resolver"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 // NewServer builds a gqlgen handler server with provided root resolver deps.
 func NewExecutableSchema(r *resolver.Resolver) *handler.Server {
-	cfg := generated.Config{Resolvers: r}
-	return handler.NewDefaultServer(generated.NewExecutableSchema(cfg))
+	return NewExecutableSchemaWithOpts(r, Options{})
+}
+
+type Options struct {
+	// APIKeys authenticates WebSocket connections by the key in their connection_init payload; when neither
+	// keys nor Bearer are configured every connection is accepted, as with the HTTP middleware.
+	APIKeys          middleware.APIKeyOptions
+	Bearer           middleware.TokenVerifier // also accepts bearer JWTs in the payload; nil accepts keys only
+	AllowedOrigins   []string                 // WebSocket origins; empty allows all, like CORS
+	KeepAlive        time.Duration            // server ping interval (default 25s)
+	InitTimeout      time.Duration            // time allowed for connection_init (default 10s)
+	MaxSubscriptions int                      // concurrent subscriptions per connection (default 10)
+}
+
+// NewExecutableSchemaWithOpts serves queries and mutations over HTTP, and subscriptions (as well as any
+// other operation) over WebSocket with the graphql-transport-ws or legacy graphql-ws protocol.
+func NewExecutableSchemaWithOpts(r *resolver.Resolver, opts Options) *handler.Server {
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 25 * time.Second
+	}
+	if opts.InitTimeout <= 0 {
+		opts.InitTimeout = 10 * time.Second
+	}
+	if opts.MaxSubscriptions <= 0 {
+		opts.MaxSubscriptions = 10
+	}
+	srv := handler.New(generated.NewExecutableSchema(generated.Config{
+		Resolvers:  r,
+		Directives: generated.DirectiveRoot{HasScope: hasScope},
+	}))
+	srv.AddTransport(transport.Websocket{
+		Upgrader:              websocket.Upgrader{CheckOrigin: checkOrigin(opts.AllowedOrigins)},
+		InitFunc:              wsInit(opts),
+		InitTimeout:           opts.InitTimeout,
+		KeepAlivePingInterval: opts.KeepAlive, // graphql-ws "ka" messages
+		PingPongInterval:      opts.KeepAlive, // graphql-transport-ws ping/pong; a silent peer is dropped after 2 intervals
+	})
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.AddTransport(transport.MultipartForm{})
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New[string](100)})
+	srv.SetErrorPresenter(presentError)
+	return srv
+}
+
+// wsInit authenticates a WebSocket connection from its init payload ({"apiKey": ...}, {"X-API-Key": ...},
+// {"Authorization": "ApiKey ..."} or, with opts.Bearer, {"Authorization": "Bearer <jwt>"}) and sets up what
+// the HTTP middlewares would: caller identity and tenant, audit attribution and the connection's
+// subscription limit.
+func wsInit(opts Options) transport.WebsocketInitFunc {
+	authRequired := opts.APIKeys.Enabled() || opts.Bearer != nil
+	return func(ctx context.Context, p transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		switch auth := p.Authorization(); {
+		case opts.Bearer != nil && len(auth) > 7 && strings.EqualFold(auth[:7], "bearer "):
+			authed, err := middleware.AuthenticateBearer(ctx, opts.Bearer, strings.TrimSpace(auth[7:]))
+			if err != nil {
+				return nil, nil, errors.New("unauthorized")
+			}
+			ctx = authed
+		case authRequired:
+			key := p.GetString("apiKey")
+			if key == "" {
+				key = p.GetString("X-API-Key")
+			}
+			if key == "" && strings.HasPrefix(strings.ToLower(auth), "apikey ") {
+				key = strings.TrimSpace(auth[7:])
+			}
+			authed, ok, err := opts.APIKeys.Authenticate(ctx, key)
+			if err != nil || !ok {
+				return nil, nil, errors.New("unauthorized")
+			}
+			ctx = authed
+		}
+		ctx = middleware.WithAudit(ctx)
+		return resolver.WithSubscriptionLimit(ctx, opts.MaxSubscriptions), nil, nil
+	}
+}
+
+// hasScope implements @hasScope: the field resolves only for callers holding the scope (see core.RequireScope).
+func hasScope(ctx context.Context, _ any, next graphql.Resolver, scope string) (any, error) {
+	if err := core.RequireScope(ctx, core.Scope(scope)); err != nil {
+		return nil, err
+	}
+	return next(ctx)
+}
+
+func checkOrigin(allowed []string) func(*http.Request) bool {
+	set := map[string]bool{}
+	for _, o := range allowed {
+		set[strings.TrimSpace(o)] = true
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return len(set) == 0 || origin == "" || set[origin]
+	}
 }
 
 func PlaygroundHandler() http.Handler { return playground.Handler("GraphQL", "/v1/graphql") }
+
+// presentError tags domain errors with the HTTP status the REST API would use, so clients can treat both alike.
+func presentError(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	status := errs.HTTPStatus(err)
+	if status == http.StatusInternalServerError {
+		return gqlErr
+	}
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = map[string]any{}
+	}
+	gqlErr.Extensions["status"] = status
+	gqlErr.Extensions["code"] = errs.Code(status)
+	var conflict *core.ConflictError
+	if errors.As(err, &conflict) && conflict.Field != "" {
+		gqlErr.Extensions["field"] = conflict.Field
+	}
+	var attrErr *core.AttributeError
+	if errors.As(err, &attrErr) {
+		gqlErr.Extensions["problems"] = attrErr.Problems
+	}
+	var scopeErr *core.ScopeError
+	if errors.As(err, &scopeErr) {
+		gqlErr.Extensions["scope"] = scopeErr.Scope
+	}
+	var item *core.BatchItemError
+	if errors.As(err, &item) {
+		gqlErr.Extensions["index"] = item.Index
+	}
+	return gqlErr
+}
@@ -0,0 +1,118 @@
+// Package apikey manages API keys minted at runtime. A key's secret is shown once, when the key is minted or
+// rotated; only its prefix and a SHA-256 of it are stored in the clear, neither of which authenticates a
+// request. The secret's request signing key is stored too, but only encrypted with Options.SigningKEK.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// secretPrefix starts every minted secret, so leaked keys are easy to recognise (e.g. by secret scanners).
+const secretPrefix = "mxk_"
+
+const prefixLen = 8 // hex characters after secretPrefix that identify the key in storage
+
+// Key is a managed API key of a tenant.
+type Key struct {
+	ID       uuid.UUID
+	TenantID string
+	Name     string
+	Owner    string // free-form contact for the client using the key
+	Prefix   string // public lookup handle, unique across tenants
+	Hash     string // hex SHA-256 of the secret, for lookups; it cannot sign requests
+	Scopes   []core.Scope
+	// CreatedAt and the optional ExpiresAt (exclusive) bound the key's validity; RevokedAt ends it at once.
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	// ReplacedBy is the key that rotated this one out; until ExpiresAt the key still works, but is deprecated.
+	ReplacedBy *uuid.UUID
+	// SealedSigningKey is the request signing key of the secret (see reqsign.SigningKey), encrypted with
+	// Options.SigningKEK; empty for keys minted without one, which cannot sign requests.
+	SealedSigningKey []byte
+}
+
+// Active reports whether the key authenticates requests at now.
+func (k *Key) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Deprecated reports whether the key was rotated out and should no longer be used.
+func (k *Key) Deprecated() bool { return k.ReplacedBy != nil }
+
+// UsageID is the identity middleware.KeyID gives the key's secret, under which its requests are audited and
+// counted.
+func (k *Key) UsageID() string { return "apikey:" + k.Hash[:12] }
+
+// Status is "revoked", "expired" or "active" at now.
+func (k *Key) Status(now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return "revoked"
+	case !k.Active(now):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+func (k *Key) clone() *Key {
+	c := *k
+	c.Scopes = append([]core.Scope(nil), k.Scopes...)
+	return &c
+}
+
+// Store persists keys for every tenant; lookups of unknown keys return core.ErrNotFound. Service confines
+// callers to the keys of the tenant in their context.
+type Store interface {
+	// Create adds k; a prefix already in use is a core.ErrConflict.
+	Create(ctx context.Context, k *Key) error
+	Get(ctx context.Context, id uuid.UUID) (*Key, error)
+	GetByPrefix(ctx context.Context, prefix string) (*Key, error)
+	// List returns the tenant's keys, oldest first.
+	List(ctx context.Context, tenant string) ([]*Key, error)
+	// Update saves k's expiry, revocation and replacement.
+	Update(ctx context.Context, k *Key) error
+	// Rotate creates next and saves old (now replaced by next) atomically.
+	Rotate(ctx context.Context, old, next *Key) error
+	// Touch records that the key was used at t.
+	Touch(ctx context.Context, id uuid.UUID, t time.Time) error
+}
+
+// hashSecret is the stored form of a secret. Secrets carry 256 random bits, so a fast unsalted hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecret returns a random secret ("mxk_<prefix>_<43 base64url chars>") and its prefix.
+func newSecret() (secret, prefix string, err error) {
+	b := make([]byte, prefixLen/2+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(b[:prefixLen/2])
+	return secretPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[prefixLen/2:]), prefix, nil
+}
+
+// parsePrefix returns the prefix of a minted secret, or "" for anything else (such as an env-var key).
+func parsePrefix(secret string) string {
+	rest, ok := strings.CutPrefix(secret, secretPrefix)
+	if !ok || len(rest) < prefixLen+1 || rest[prefixLen] != '_' {
+		return ""
+	}
+	if _, err := hex.DecodeString(rest[:prefixLen]); err != nil {
+		return ""
+	}
+	return rest[:prefixLen]
+}
@@ -0,0 +1,109 @@
+package apikey
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// MemoryStore is the in-memory Store used without Postgres; minted keys do not survive restarts.
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[uuid.UUID]*Key
+}
+
+func NewMemoryStore() *MemoryStore { return &MemoryStore{keys: map[uuid.UUID]*Key{}} }
+
+func (m *MemoryStore) Create(_ context.Context, k *Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.create(k)
+}
+
+func (m *MemoryStore) create(k *Key) error {
+	for _, other := range m.keys {
+		if other.Prefix == k.Prefix {
+			return &core.ConflictError{Field: "prefix", Value: k.Prefix}
+		}
+	}
+	m.keys[k.ID] = k.clone()
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id uuid.UUID) (*Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[id]
+	if !ok {
+		return nil, core.ErrNotFound
+	}
+	return k.clone(), nil
+}
+
+func (m *MemoryStore) GetByPrefix(_ context.Context, prefix string) (*Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.keys {
+		if k.Prefix == prefix {
+			return k.clone(), nil
+		}
+	}
+	return nil, core.ErrNotFound
+}
+
+func (m *MemoryStore) List(_ context.Context, tenant string) ([]*Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []*Key{}
+	for _, k := range m.keys {
+		if k.TenantID == tenant {
+			out = append(out, k.clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *MemoryStore) Update(_ context.Context, k *Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.update(k)
+}
+
+func (m *MemoryStore) update(k *Key) error {
+	cur, ok := m.keys[k.ID]
+	if !ok {
+		return core.ErrNotFound
+	}
+	cur.ExpiresAt, cur.RevokedAt, cur.ReplacedBy = k.ExpiresAt, k.RevokedAt, k.ReplacedBy
+	return nil
+}
+
+func (m *MemoryStore) Rotate(_ context.Context, old, next *Key) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[old.ID]; !ok {
+		return core.ErrNotFound
+	}
+	if err := m.create(next); err != nil {
+		return err
+	}
+	return m.update(old)
+}
+
+func (m *MemoryStore) Touch(_ context.Context, id uuid.UUID, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[id]
+	if !ok {
+		return core.ErrNotFound
+	}
+	k.LastUsedAt = &t
+	return nil
+}
+
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,298 @@
+package apikey
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/reqsign"
+)
+
+// MintRequest describes a new key. Scopes must name at least one known scope.
+type MintRequest struct {
+	Name      string
+	Owner     string
+	Scopes    []core.Scope
+	ExpiresAt *time.Time
+}
+
+// Service manages the keys of the tenant in ctx, and resolves presented secrets for the auth middleware.
+type Service interface {
+	// Mint creates a key and returns it with its secret, which is not stored and cannot be shown again.
+	Mint(ctx context.Context, req MintRequest) (*Key, string, error)
+	List(ctx context.Context) ([]*Key, error)
+	Get(ctx context.Context, id uuid.UUID) (*Key, error)
+	// Revoke ends the key at once; revoking a revoked key changes nothing.
+	Revoke(ctx context.Context, id uuid.UUID) (*Key, error)
+	// Rotate mints a successor with the same name, owner and scopes, and lets the old key expire after grace
+	// (or at its own expiry, if sooner). expiresAt bounds the successor.
+	Rotate(ctx context.Context, id uuid.UUID, grace time.Duration, expiresAt *time.Time) (*Key, string, error)
+	// LookupKey returns the active key with secret, of any tenant, or nil. Results are cached for
+	// Options.CacheTTL, so revocations reach other instances within that time.
+	LookupKey(ctx context.Context, secret string) (*Key, error)
+	// LookupPrefix returns the active key with prefix, of any tenant, or nil, for signed requests that name
+	// the key without carrying its secret. It is cached like LookupKey.
+	LookupPrefix(ctx context.Context, prefix string) (*Key, error)
+	// SigningKey opens the request signing key of k; ErrCannotSign if it has none.
+	SigningKey(k *Key) ([]byte, error)
+}
+
+type Options struct {
+	CacheTTL time.Duration // default 30s
+	// TouchInterval limits LastUsedAt writes per key (default 1m).
+	TouchInterval time.Duration
+	// SigningKEK is the 32-byte AES key sealing the signing keys of minted keys, so a copy of the table alone
+	// cannot sign requests; without it keys are minted unable to sign.
+	SigningKEK []byte
+}
+
+func NewService(store Store, opts Options) Service {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = 30 * time.Second
+	}
+	if opts.TouchInterval <= 0 {
+		opts.TouchInterval = time.Minute
+	}
+	return &service{store: store, opts: opts, now: time.Now, cache: map[string]cacheEntry{}}
+}
+
+// maxCacheEntries bounds the lookup cache; unknown secrets are cached too, so a flood of them cannot grow it
+// without limit.
+const maxCacheEntries = 10_000
+
+type cacheEntry struct {
+	key   *Key // nil for an unknown secret
+	until time.Time
+}
+
+type service struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry // by secret hash, or "prefix:" and prefix
+}
+
+func validateMint(req MintRequest, now time.Time) error {
+	if name := strings.TrimSpace(req.Name); name == "" || len(name) > 100 {
+		return fmt.Errorf("name must be 1-100 characters: %w", core.ErrValidation)
+	}
+	if len(req.Owner) > 200 {
+		return fmt.Errorf("owner must be at most 200 characters: %w", core.ErrValidation)
+	}
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("at least one scope required: %w", core.ErrValidation)
+	}
+	for _, s := range req.Scopes {
+		if !core.ValidScope(string(s)) {
+			return fmt.Errorf("unknown scope %q: %w", s, core.ErrValidation)
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return fmt.Errorf("expires_at must be in the future: %w", core.ErrValidation)
+	}
+	return nil
+}
+
+func (s *service) Mint(ctx context.Context, req MintRequest) (*Key, string, error) {
+	now := s.now().UTC()
+	if err := validateMint(req, now); err != nil {
+		return nil, "", err
+	}
+	for attempt := 0; ; attempt++ {
+		k, secret, err := s.newKey(ctx, req, now)
+		if err != nil {
+			return nil, "", err
+		}
+		err = s.store.Create(ctx, k)
+		if errors.Is(err, core.ErrConflict) && attempt < 3 { // prefix collision
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return k, secret, nil
+	}
+}
+
+func (s *service) newKey(ctx context.Context, req MintRequest, now time.Time) (*Key, string, error) {
+	secret, prefix, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	k := &Key{
+		ID: uuid.New(), TenantID: core.TenantFrom(ctx), Name: strings.TrimSpace(req.Name), Owner: req.Owner,
+		Prefix: prefix, Hash: hashSecret(secret), Scopes: req.Scopes, CreatedAt: now, ExpiresAt: req.ExpiresAt,
+	}
+	if s.opts.SigningKEK != nil {
+		if k.SealedSigningKey, err = sealSigningKey(s.opts.SigningKEK, k.ID, reqsign.SigningKey(secret)); err != nil {
+			return nil, "", err
+		}
+	}
+	return k, secret, nil
+}
+
+func (s *service) List(ctx context.Context) ([]*Key, error) {
+	return s.store.List(ctx, core.TenantFrom(ctx))
+}
+
+// Get treats keys of other tenants as missing.
+func (s *service) Get(ctx context.Context, id uuid.UUID) (*Key, error) {
+	k, err := s.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if k.TenantID != core.TenantFrom(ctx) {
+		return nil, core.ErrNotFound
+	}
+	return k, nil
+}
+
+func (s *service) Revoke(ctx context.Context, id uuid.UUID) (*Key, error) {
+	k, err := s.Get(ctx, id)
+	if err != nil || k.RevokedAt != nil {
+		return k, err
+	}
+	now := s.now().UTC()
+	k.RevokedAt = &now
+	if err := s.store.Update(ctx, k); err != nil {
+		return nil, err
+	}
+	s.forget(k.ID)
+	return k, nil
+}
+
+func (s *service) Rotate(ctx context.Context, id uuid.UUID, grace time.Duration, expiresAt *time.Time) (*Key, string, error) {
+	if grace < 0 {
+		return nil, "", fmt.Errorf("grace must not be negative: %w", core.ErrValidation)
+	}
+	old, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	now := s.now().UTC()
+	if !old.Active(now) || old.Deprecated() {
+		return nil, "", fmt.Errorf("only an active key that was not rotated yet can be rotated: %w", core.ErrConflict)
+	}
+	req := MintRequest{Name: old.Name, Owner: old.Owner, Scopes: old.Scopes, ExpiresAt: expiresAt}
+	if err := validateMint(req, now); err != nil {
+		return nil, "", err
+	}
+	next, secret, err := s.newKey(ctx, req, now)
+	if err != nil {
+		return nil, "", err
+	}
+	if end := now.Add(grace); old.ExpiresAt == nil || end.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &end
+	}
+	old.ReplacedBy = &next.ID
+	if err := s.store.Rotate(ctx, old, next); err != nil {
+		return nil, "", err
+	}
+	s.forget(old.ID)
+	return next, secret, nil
+}
+
+func (s *service) LookupKey(ctx context.Context, secret string) (*Key, error) {
+	prefix := parsePrefix(secret)
+	if prefix == "" {
+		return nil, nil
+	}
+	hash := hashSecret(secret)
+	return s.lookup(ctx, hash, prefix, func(k *Key) bool {
+		return subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) == 1
+	})
+}
+
+func (s *service) LookupPrefix(ctx context.Context, prefix string) (*Key, error) {
+	if len(prefix) != prefixLen {
+		return nil, nil
+	}
+	return s.lookup(ctx, "prefix:"+prefix, prefix, func(*Key) bool { return true })
+}
+
+func (s *service) SigningKey(k *Key) ([]byte, error) {
+	return openSigningKey(s.opts.SigningKEK, k)
+}
+
+// lookup resolves the key with prefix through the cache entry named cacheKey; match rejects a stored key
+// that does not fit what the caller presented.
+func (s *service) lookup(ctx context.Context, cacheKey, prefix string, match func(*Key) bool) (*Key, error) {
+	now := s.now()
+	s.mu.Lock()
+	e, ok := s.cache[cacheKey]
+	s.mu.Unlock()
+	if !ok || !now.Before(e.until) {
+		k, err := s.store.GetByPrefix(ctx, prefix)
+		if errors.Is(err, core.ErrNotFound) {
+			k, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if k != nil && !match(k) {
+			k = nil
+		}
+		e = cacheEntry{key: k, until: now.Add(s.opts.CacheTTL)}
+		s.remember(cacheKey, e, now)
+	}
+	if e.key == nil || !e.key.Active(now) {
+		return nil, nil
+	}
+	return s.touch(e.key, now), nil
+}
+
+// touch records use of k at most once per TouchInterval, in the background so requests do not wait for it,
+// and returns a copy of k for the caller.
+func (s *service) touch(k *Key, now time.Time) *Key {
+	s.mu.Lock()
+	due := k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= s.opts.TouchInterval
+	if due {
+		t := now.UTC()
+		k.LastUsedAt = &t
+	}
+	out := k.clone()
+	s.mu.Unlock()
+	if due {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = s.store.Touch(ctx, out.ID, *out.LastUsedAt)
+		}()
+	}
+	return out
+}
+
+func (s *service) remember(cacheKey string, e cacheEntry, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= maxCacheEntries {
+		for h, old := range s.cache {
+			if old.key == nil || !now.Before(old.until) {
+				delete(s.cache, h)
+			}
+		}
+		if len(s.cache) >= maxCacheEntries {
+			clear(s.cache)
+		}
+	}
+	s.cache[cacheKey] = e
+}
+
+// forget drops the cached lookup of a key changed on this instance, so the change applies here at once.
+func (s *service) forget(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h, e := range s.cache {
+		if e.key != nil && e.key.ID == id {
+			delete(s.cache, h)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package apikey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrCannotSign is returned for keys minted without Options.SigningKEK, whose signing key was never kept.
+var ErrCannotSign = errors.New("api key cannot sign requests")
+
+// sealSigningKey encrypts signingKey under kek with AES-GCM, bound to the key's id so a sealed value copied
+// to another row does not open there.
+func sealSigningKey(kek []byte, id uuid.UUID, signingKey []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(signingKey)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, signingKey, id[:]), nil
+}
+
+func openSigningKey(kek []byte, k *Key) ([]byte, error) {
+	if len(k.SealedSigningKey) == 0 || kek == nil {
+		return nil, ErrCannotSign
+	}
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.SealedSigningKey) < aead.NonceSize() {
+		return nil, errors.New("apikey: sealed signing key too short")
+	}
+	nonce, sealed := k.SealedSigningKey[:aead.NonceSize()], k.SealedSigningKey[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, k.ID[:])
+}
+
+func newAEAD(kek []byte) (cipher.AEAD, error) {
+	if len(kek) != 32 {
+		return nil, errors.New("apikey: signing key-encryption key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,79 @@
+// Package attrschema enforces a JSON Schema on user attributes.
+package attrschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Validator implements core.AttributeValidator. Schemas default to draft 2020-12 unless they declare $schema.
+type Validator struct{ schema *jsonschema.Schema }
+
+var _ core.AttributeValidator = (*Validator)(nil)
+
+// New compiles schema, a JSON Schema document describing the attributes object. Remote $refs are not followed.
+func New(schema []byte) (*Validator, error) {
+	const url = "mem://attributes.schema.json"
+	c := jsonschema.NewCompiler()
+	c.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("attribute schema may not reference %s", s)
+	}
+	if err := c.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return nil, fmt.Errorf("parse attribute schema: %w", err)
+	}
+	s, err := c.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("compile attribute schema: %w", err)
+	}
+	return &Validator{schema: s}, nil
+}
+
+// Load reads and compiles the schema at path.
+func Load(path string) (*Validator, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read attribute schema: %w", err)
+	}
+	return New(b)
+}
+
+// Validate reports every violation as a *core.AttributeError.
+func (v *Validator) Validate(attrs core.Attributes) error {
+	// round-trip through JSON so numbers reach the validator as json.Number, whatever the caller built
+	b, err := json.Marshal(attrs)
+	if err != nil {
+		return fmt.Errorf("attributes are not JSON: %w", core.ErrValidation)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("attributes are not JSON: %w", core.ErrValidation)
+	}
+	err = v.schema.Validate(doc)
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	ae := &core.AttributeError{}
+	collect(ve, ae)
+	return ae
+}
+
+// collect keeps the leaves of the error tree; inner nodes only say that a subschema failed.
+func collect(ve *jsonschema.ValidationError, ae *core.AttributeError) {
+	if len(ve.Causes) == 0 {
+		ae.Problems = append(ae.Problems, core.AttributeProblem{Path: ve.InstanceLocation, Message: ve.Message})
+		return
+	}
+	for _, c := range ve.Causes {
+		collect(c, ae)
+	}
+}
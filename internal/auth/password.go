@@ -0,0 +1,114 @@
+// Package auth signs end users in with a password: hashing, the password policy, sessions and reset tokens.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// argon2id parameters, following the OWASP baseline (19 MiB, 2 passes, 1 lane). They are stored in every
+// hash, so raising them later only affects new hashes.
+const (
+	argonMemory  = 19 * 1024 // KiB
+	argonTime    = 2
+	argonThreads = 1
+	argonSaltLen = 16
+	argonKeyLen  = 32
+)
+
+// HashPassword returns an argon2id hash in the PHC string format ($argon2id$v=19$m=...,t=...,p=...$salt$key).
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads,
+		enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// CheckPassword reports whether password matches hash; a malformed hash matches nothing.
+func CheckPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false
+	}
+	var (
+		memory, passes uint32
+		threads        uint8
+	)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &passes, &threads); err != nil || passes == 0 || threads == 0 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[5])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, passes, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// dummyHash is checked against when there is no real hash, so a login for an unknown email takes as long as
+// one with a wrong password.
+var dummyHash, _ = HashPassword("not a real password")
+
+// PasswordPolicy is checked whenever a password is set. Lengths count characters, not bytes.
+type PasswordPolicy struct {
+	MinLength int // default 12
+	MaxLength int // default 128; bounds the hashing work a request can cause
+}
+
+// commonPasswords are rejected outright, as are passwords that merely repeat them.
+var commonPasswords = []string{"password", "123456", "qwerty", "letmein", "welcome", "iloveyou", "admin", "abc123", "111111"}
+
+// Check rejects a password that is too short or long, has fewer than 5 distinct characters, is built from a
+// common password, or contains the user's name or the local part of their email. Failures wrap
+// core.ErrValidation.
+func (p PasswordPolicy) Check(password string, u *core.User) error {
+	if p.MinLength <= 0 {
+		p.MinLength = 12
+	}
+	if p.MaxLength <= 0 {
+		p.MaxLength = 128
+	}
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength || n > p.MaxLength {
+		return fmt.Errorf("password must have %d to %d characters: %w", p.MinLength, p.MaxLength, core.ErrValidation)
+	}
+	distinct := map[rune]bool{}
+	for _, r := range password {
+		distinct[r] = true
+	}
+	if len(distinct) < 5 {
+		return fmt.Errorf("password must use at least 5 different characters: %w", core.ErrValidation)
+	}
+	lower := strings.ToLower(password)
+	for _, c := range commonPasswords {
+		if strings.Trim(strings.ReplaceAll(lower, c, ""), "0123456789!?.") == "" {
+			return fmt.Errorf("password is too common: %w", core.ErrValidation)
+		}
+	}
+	if u != nil {
+		local, _, _ := strings.Cut(strings.ToLower(u.Email), "@")
+		for _, personal := range append(strings.Fields(strings.ToLower(u.Name)), local) {
+			if utf8.RuneCountInString(personal) >= 4 && strings.Contains(lower, personal) {
+				return fmt.Errorf("password must not contain your name or email: %w", core.ErrValidation)
+			}
+		}
+	}
+	return nil
+}
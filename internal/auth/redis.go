@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSessionStore shares sessions between every instance using the same Redis. Each session is a key
+// expiring with it; a per-user set of session ids lets DeleteUser find them all.
+type RedisSessionStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisSessionStore(rdb *redis.Client) *RedisSessionStore { return &RedisSessionStore{rdb: rdb} }
+
+func sessionKey(id string) string { return "session:" + id }
+
+func userSessionsKey(tenant string, userID uuid.UUID) string {
+	return "session:user:" + tenant + ":" + userID.String()
+}
+
+func (s *RedisSessionStore) Create(ctx context.Context, id string, sess Session) error {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return errors.New("session already expired")
+	}
+	set := userSessionsKey(sess.Tenant, sess.UserID)
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, sessionKey(id), b, ttl)
+	pipe.SAdd(ctx, set, id)
+	// the set outlives its newest session; ids of expired sessions in it are harmless
+	pipe.ExpireGT(ctx, set, ttl)
+	pipe.ExpireNX(ctx, set, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (s *RedisSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	raw, err := s.rdb.Get(ctx, sessionKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal(raw, &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *RedisSessionStore) Delete(ctx context.Context, id string) error {
+	return s.rdb.Del(ctx, sessionKey(id)).Err()
+}
+
+func (s *RedisSessionStore) DeleteUser(ctx context.Context, tenant string, userID uuid.UUID) error {
+	set := userSessionsKey(tenant, userID)
+	ids, err := s.rdb.SMembers(ctx, set).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{set}
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	return s.rdb.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+var (
+	// ErrInvalidCredentials is returned for an unknown email, a user without a password and a wrong password
+	// alike, so a login attempt cannot tell which emails exist.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrAccountDisabled refuses a correct login for a suspended or locked user.
+	ErrAccountDisabled = errors.New("account disabled")
+	// ErrInvalidSession rejects a session token that is unknown, expired, from another tenant, or whose user
+	// is gone or disabled.
+	ErrInvalidSession = errors.New("session invalid or expired")
+	// ErrInvalidResetToken rejects a reset token that is malformed, forged, expired, from another tenant, or
+	// already used. It matches core.ErrValidation.
+	ErrInvalidResetToken = fmt.Errorf("password reset token invalid or expired: %w", core.ErrValidation)
+)
+
+// Service signs end users in and out and manages their passwords. All calls act on the tenant in ctx.
+type Service interface {
+	// Login checks the password of the live user with email and starts a session. The token is returned
+	// only here.
+	Login(ctx context.Context, email, password string) (token string, s *Session, u *core.User, err error)
+	Logout(ctx context.Context, token string) error
+	// Authenticate resolves a session token of the tenant in ctx.
+	Authenticate(ctx context.Context, token string) (*Session, error)
+	// SetPassword sets the user's password without knowing the old one (an administrative action) and ends
+	// their sessions.
+	SetPassword(ctx context.Context, id uuid.UUID, password string) error
+	// ChangePassword sets the user's password after checking the current one and ends their sessions.
+	ChangePassword(ctx context.Context, id uuid.UUID, current, password string) error
+	// RequestPasswordReset sends a reset token to the live user with email. Unknown emails are ignored
+	// without an error, so the call cannot be used to probe for accounts.
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword consumes a reset token, sets the password and ends the user's sessions.
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+// ResetSender delivers a password reset token to the user's email address. It must not block on delivery.
+type ResetSender interface {
+	SendPasswordReset(ctx context.Context, u *core.User, token string, expires time.Time)
+}
+
+type Options struct {
+	SessionTTL time.Duration // default 24h
+	// ResetSecret signs reset tokens; ResetTTL bounds their lifetime (default 1h).
+	ResetSecret []byte
+	ResetTTL    time.Duration
+	ResetSender ResetSender // nil disables RequestPasswordReset
+	Policy      PasswordPolicy
+}
+
+// NewService keeps password hashes in creds (usually the user repository) and sessions in sessions. Users
+// are read through users, so status changes and deletes end sessions at once.
+func NewService(users core.UserService, creds core.CredentialRepository, sessions SessionStore, opts Options) Service {
+	if opts.SessionTTL <= 0 {
+		opts.SessionTTL = 24 * time.Hour
+	}
+	if opts.ResetTTL <= 0 {
+		opts.ResetTTL = time.Hour
+	}
+	return &service{users: users, creds: creds, sessions: sessions, opts: opts, now: time.Now}
+}
+
+type service struct {
+	users    core.UserService
+	creds    core.CredentialRepository
+	sessions SessionStore
+	opts     Options
+	now      func() time.Time
+}
+
+func disabled(u *core.User) bool {
+	return u.Status == core.StatusSuspended || u.Status == core.StatusLocked
+}
+
+func (s *service) Login(ctx context.Context, email, password string) (string, *Session, *core.User, error) {
+	u, hash, err := s.userByEmail(ctx, email)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if hash == "" {
+		CheckPassword(dummyHash, password)
+		return "", nil, nil, ErrInvalidCredentials
+	}
+	if !CheckPassword(hash, password) {
+		return "", nil, nil, ErrInvalidCredentials
+	}
+	if disabled(u) {
+		return "", nil, nil, ErrAccountDisabled
+	}
+	token, id, err := newSessionToken()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	now := s.now().UTC()
+	sess := &Session{UserID: u.ID, Tenant: core.TenantFrom(ctx), CreatedAt: now, ExpiresAt: now.Add(s.opts.SessionTTL)}
+	if err := s.sessions.Create(ctx, id, *sess); err != nil {
+		return "", nil, nil, fmt.Errorf("store session: %w", err)
+	}
+	return token, sess, u, nil
+}
+
+// userByEmail returns the live user with email and their hash; no user yields an empty hash.
+func (s *service) userByEmail(ctx context.Context, email string) (*core.User, string, error) {
+	u, err := s.creds.GetByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if errors.Is(err, core.ErrNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	hash, err := s.creds.PasswordHash(ctx, u.ID)
+	if errors.Is(err, core.ErrNotFound) { // deleted in the meantime
+		return nil, "", nil
+	}
+	return u, hash, err
+}
+
+func (s *service) Logout(ctx context.Context, token string) error {
+	return s.sessions.Delete(ctx, SessionID(token))
+}
+
+func (s *service) Authenticate(ctx context.Context, token string) (*Session, error) {
+	id := SessionID(token)
+	sess, err := s.sessions.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil || sess.Tenant != core.TenantFrom(ctx) || !s.now().Before(sess.ExpiresAt) {
+		return nil, ErrInvalidSession
+	}
+	u, err := s.users.Get(ctx, sess.UserID)
+	if errors.Is(err, core.ErrNotFound) || (err == nil && disabled(u)) {
+		_ = s.sessions.Delete(ctx, id)
+		return nil, ErrInvalidSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (s *service) SetPassword(ctx context.Context, id uuid.UUID, password string) error {
+	u, err := s.users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.setPassword(ctx, u, password)
+}
+
+func (s *service) ChangePassword(ctx context.Context, id uuid.UUID, current, password string) error {
+	u, err := s.users.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	hash, err := s.creds.PasswordHash(ctx, id)
+	if err != nil {
+		return err
+	}
+	if hash == "" || !CheckPassword(hash, current) {
+		return ErrInvalidCredentials
+	}
+	return s.setPassword(ctx, u, password)
+}
+
+func (s *service) setPassword(ctx context.Context, u *core.User, password string) error {
+	if err := s.opts.Policy.Check(password, u); err != nil {
+		return err
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := s.creds.SetPasswordHash(ctx, u.ID, hash); err != nil {
+		return err
+	}
+	if err := s.sessions.DeleteUser(ctx, core.TenantFrom(ctx), u.ID); err != nil {
+		return fmt.Errorf("end sessions: %w", err)
+	}
+	return nil
+}
+
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+	if s.opts.ResetSender == nil {
+		return fmt.Errorf("password reset is not enabled: %w", core.ErrValidation)
+	}
+	u, hash, err := s.userByEmail(ctx, email)
+	if err != nil || u == nil || disabled(u) {
+		return err
+	}
+	token, exp := s.issueReset(core.TenantFrom(ctx), u.ID, hash)
+	s.opts.ResetSender.SendPasswordReset(ctx, u, token, exp)
+	return nil
+}
+
+func (s *service) ResetPassword(ctx context.Context, token, password string) error {
+	c, err := s.parseReset(token, core.TenantFrom(ctx))
+	if err != nil {
+		return err
+	}
+	u, err := s.users.Get(ctx, c.UserID)
+	if errors.Is(err, core.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	hash, err := s.creds.PasswordHash(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(c.Fingerprint), []byte(fingerprint(hash))) {
+		return ErrInvalidResetToken // the password changed since the token was issued, e.g. by this token
+	}
+	return s.setPassword(ctx, u, password)
+}
+
+// resetClaims bind a reset token to the password hash current at issue time, so the token stops working once
+// any new password is set, without anything being stored.
+type resetClaims struct {
+	Tenant      string    `json:"t"`
+	UserID      uuid.UUID `json:"u"`
+	Fingerprint string    `json:"f"`
+	Expires     int64     `json:"x"` // unix seconds
+}
+
+// fingerprint identifies a hash without revealing it; tokens are read by the user, and the hash is secret.
+func fingerprint(hash string) string {
+	sum := sha256.Sum256([]byte("password-reset\n" + hash))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func (s *service) issueReset(tenant string, id uuid.UUID, hash string) (string, time.Time) {
+	exp := s.now().Add(s.opts.ResetTTL).Truncate(time.Second)
+	payload, _ := json.Marshal(resetClaims{Tenant: tenant, UserID: id, Fingerprint: fingerprint(hash), Expires: exp.Unix()})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.signReset(payload)), exp
+}
+
+func (s *service) parseReset(token, tenant string) (resetClaims, error) {
+	var c resetClaims
+	enc := base64.RawURLEncoding
+	p, sig, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok {
+		return c, ErrInvalidResetToken
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return c, ErrInvalidResetToken
+	}
+	mac, err := enc.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.signReset(payload)) {
+		return c, ErrInvalidResetToken
+	}
+	if json.Unmarshal(payload, &c) != nil || c.Tenant != tenant || !s.now().Before(time.Unix(c.Expires, 0)) {
+		return c, ErrInvalidResetToken
+	}
+	return c, nil
+}
+
+func (s *service) signReset(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.opts.ResetSecret)
+	m.Write([]byte("password-reset\n")) // keeps these MACs distinct from any other use of the secret
+	m.Write(payload)
+	return m.Sum(nil)
+}
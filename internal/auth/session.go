@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a signed-in end user. The token that names it is only ever handed to the client; stores key
+// sessions by its SHA-256 (SessionID), so a leaked store dump cannot be replayed.
+type Session struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Tenant    string    `json:"tenant"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionStore keeps sessions until they expire or are deleted.
+type SessionStore interface {
+	// Create stores s under id until s.ExpiresAt.
+	Create(ctx context.Context, id string, s Session) error
+	// Get returns the live session stored under id, or nil.
+	Get(ctx context.Context, id string) (*Session, error)
+	Delete(ctx context.Context, id string) error
+	// DeleteUser ends every session of the user, e.g. after a password change.
+	DeleteUser(ctx context.Context, tenant string, userID uuid.UUID) error
+}
+
+// newSessionToken returns a random token for the client and the id it is stored under.
+func newSessionToken() (token, id string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, SessionID(token), nil
+}
+
+// SessionID is the store key of token.
+func SessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemorySessionStore is the local SessionStore used without Redis. Sessions only work on the instance that
+// created them and end on restart.
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]Session
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}, now: time.Now}
+}
+
+func (m *MemorySessionStore) Create(_ context.Context, id string, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(m.now())
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *MemorySessionStore) Get(_ context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || !m.now().Before(s.ExpiresAt) {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (m *MemorySessionStore) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *MemorySessionStore) DeleteUser(_ context.Context, tenant string, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if s.Tenant == tenant && s.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+// sweep drops expired sessions, at most once a minute so Create stays cheap.
+func (m *MemorySessionStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for id, s := range m.sessions {
+		if !now.Before(s.ExpiresAt) {
+			delete(m.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package broker fans committed user events out to in-process subscribers such as live event streams.
+package broker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// Event is a user event with its position in this process's stream.
+type Event struct {
+	Seq uint64
+	core.UserEvent
+}
+
+type Options struct {
+	ReplaySize       int // minimum number of events kept for resuming subscribers (default 1024)
+	SubscriberBuffer int // events queued per subscriber before it is dropped as too slow (default 64)
+}
+
+// Broker implements core.UserEventNotifier. Sequence numbers start at the boot time in microseconds, so they
+// keep increasing across restarts and a position from an earlier process is detected as a gap.
+type Broker struct {
+	mu   sync.Mutex
+	opts Options
+	seq  uint64
+	ring []Event // replay buffer, oldest first
+	subs map[*Subscription]struct{}
+	done bool
+}
+
+func New(opts Options) *Broker {
+	if opts.ReplaySize <= 0 {
+		opts.ReplaySize = 1024
+	}
+	if opts.SubscriberBuffer <= 0 {
+		opts.SubscriberBuffer = 64
+	}
+	return &Broker{opts: opts, seq: uint64(time.Now().UnixMicro()), subs: map[*Subscription]struct{}{}}
+}
+
+// Notify sequences the events, buffers them for replay and hands them to matching subscribers without
+// blocking: a subscriber whose queue is full is dropped and must resubscribe from its last position.
+func (b *Broker) Notify(events ...core.UserEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range events {
+		b.seq++
+		ev := Event{Seq: b.seq, UserEvent: e}
+		if len(b.ring) == 2*b.opts.ReplaySize {
+			// trim in halves so the copy is amortized; the buffer holds ReplaySize to 2×ReplaySize events
+			b.ring = append(b.ring[:0], b.ring[b.opts.ReplaySize:]...)
+		}
+		b.ring = append(b.ring, ev)
+		for s := range b.subs {
+			if !s.wants(e) {
+				continue
+			}
+			select {
+			case s.ch <- ev:
+			default:
+				b.remove(s)
+			}
+		}
+	}
+}
+
+// Subscription receives events on C until Close is called or the broker drops it; either way C is closed.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	tenant string
+	types  map[core.UserEventType]bool // nil = all
+	b      *Broker
+}
+
+// wants matches events of the subscriber's tenant and types; events without a tenant belong to the default one.
+func (s *Subscription) wants(e core.UserEvent) bool {
+	tenant := e.TenantID
+	if tenant == "" {
+		tenant = core.DefaultTenant
+	}
+	return tenant == s.tenant && (s.types == nil || s.types[e.Type])
+}
+
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.remove(s)
+}
+
+// remove unregisters s and closes its channel once. Caller holds b.mu.
+func (b *Broker) remove(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Subscribe registers for the tenant's events of the given types (all when empty). With after > 0 it also returns the
+// buffered matching events past that position; complete is false when events past it have already left the
+// buffer or the position is unknown, in which case the client should resync instead of trusting the replay.
+func (b *Broker) Subscribe(tenant string, types []core.UserEventType, after uint64) (sub *Subscription, replay []Event, complete bool) {
+	ch := make(chan Event, b.opts.SubscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, tenant: tenant, b: b}
+	if len(types) > 0 {
+		sub.types = make(map[core.UserEventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done {
+		close(ch)
+		return sub, nil, true
+	}
+	b.subs[sub] = struct{}{}
+	if after == 0 {
+		return sub, nil, true
+	}
+	oldest := b.seq + 1
+	if len(b.ring) > 0 {
+		oldest = b.ring[0].Seq
+	}
+	complete = after <= b.seq && after+1 >= oldest
+	for _, ev := range b.ring {
+		if ev.Seq > after && sub.wants(ev.UserEvent) {
+			replay = append(replay, ev)
+		}
+	}
+	return sub, replay, complete
+}
+
+// Close ends every subscription and makes new ones end immediately, e.g. so streams let a graceful
+// shutdown finish. Notify keeps buffering.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = true
+	for s := range b.subs {
+		b.remove(s)
+	}
+}
+
+// Subscribers reports the number of active subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+var _ core.UserEventNotifier = (*Broker)(nil)
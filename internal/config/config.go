@@ -1,12 +1,17 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
 )
 
 type Config struct {
@@ -22,13 +27,82 @@ type Config struct {
 	PprofEnabled     bool
 	APIKeys          []string
 	OldAPIKeys       []string
-	APIKeyExpiries   map[string]time.Time // key -> expiry (exclusive); expired keys rejected
+	APIKeyExpiries   map[string]time.Time    // key -> expiry (exclusive); expired keys rejected
+	APIKeyTenants    map[string]string       // key -> tenant; unlisted keys belong to core.DefaultTenant
+	APIKeyScopes     map[string][]core.Scope // key -> scopes it is limited to; once set, unlisted keys get none
 	CacheMaxCost     int64
 	CacheNumCounters int64
 	CacheBufferItems int64
 	RedisAddr        string
 	RedisPassword    string
 	RedisDB          int
+	RequireIfMatch   bool   // reject PATCH/DELETE on users without If-Match (428)
+	AuditLog         bool   // record an audit_log entry per user mutation (default on)
+	AttributesSchema string // path to a JSON Schema for user attributes; empty accepts any object
+	// Transactional outbox for user events; empty OutboxPublisher disables it
+	OutboxPublisher    string // log|file|memory
+	OutboxFile         string
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	// Outgoing webhooks (/v1/webhooks); enabling them also enables the outbox
+	WebhooksEnabled     bool
+	WebhookMaxAttempts  int
+	WebhookTimeout      time.Duration
+	WebhookAllowPrivate bool // deliveries may reach loopback and private addresses (local development)
+	// Live event stream (/v1/users/events)
+	EventsReplaySize int
+	EventsKeepalive  time.Duration
+	// GraphQL subscriptions over WebSocket
+	GraphQLWSKeepalive        time.Duration
+	GraphQLWSMaxSubscriptions int
+	// Idempotency-Key replay window for /v1 mutations
+	IdempotencyTTL     time.Duration
+	IdempotencyMaxBody int64 // larger request bodies carrying an Idempotency-Key are refused
+	// Bulk export/import (/v1/users/export, /v1/users/import)
+	BulkTimeout    time.Duration
+	ImportMaxBytes int64
+	// Email verification (/v1/users/verify); an empty secret uses a random one per process
+	EmailVerifySecret string
+	EmailVerifyTTL    time.Duration
+	EmailVerifyURL    string // link mailed with the token; empty mails the bare token
+	Mailer            string // log|file|smtp
+	MailerFile        string
+	SMTPAddr          string
+	SMTPUsername      string
+	SMTPPassword      string
+	SMTPFrom          string
+	// End-user password sign-in (/v1/auth); sessions live in Redis when REDIS_ADDR is set
+	SessionTTL          time.Duration
+	PasswordResetSecret string // empty uses a random one per process
+	PasswordResetTTL    time.Duration
+	PasswordResetURL    string
+	PasswordMinLength   int
+	// Bearer JWTs on /v1, verified against a JWKS file or URL; an empty JWTJWKS disables them
+	JWTJWKS             string
+	JWTIssuer           string
+	JWTAudience         []string
+	JWTLeeway           time.Duration
+	JWTTenantClaim      string
+	JWKSRefreshInterval time.Duration
+	// Keys minted through /v1/admin/keys, beside the env-var keys above, which bootstrap access
+	APIKeysManaged   bool
+	APIKeyCacheTTL   time.Duration
+	APIKeySigningKEK []byte // seals the request signing keys of minted keys (32 bytes, base64 in the env var)
+	// Per-key usage counts, flushed to Redis when REDIS_ADDR is set and to Postgres otherwise (default on)
+	APIKeyUsage               bool
+	APIKeyUsageFlushInterval  time.Duration
+	APIKeyUsageExpiringWithin time.Duration // keys expiring this soon are flagged in /v1/admin/keys/usage
+	// HMAC-signed requests on /v1; nonces live in Redis when REDIS_ADDR is set
+	RequestSigning        bool
+	RequestSigningSkew    time.Duration
+	RequestSigningMaxBody int64
+	// In-process TLS, reloaded when the files change or on SIGHUP; an empty TLSCertFile serves plain HTTP
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSReloadInterval   time.Duration
+	TLSClientCAFile     string            // verifies client certificates (mTLS); empty disables them
+	TLSClientAuth       string            // optional|require
+	TLSClientIdentities map[string]string // certificate name (URI:…, DNS:…, EMAIL:…, CN:…) -> api key credential
 }
 
 func Load() (*Config, error) {
@@ -87,18 +161,57 @@ func Load() (*Config, error) {
 		pairs := strings.Split(v, ",")
 		for _, pair := range pairs {
 			pair = strings.TrimSpace(pair)
-			if pair == "" || !strings.Contains(pair, ":") { continue }
+			if pair == "" || !strings.Contains(pair, ":") {
+				continue
+			}
 			kv := strings.SplitN(pair, ":", 2)
 			key := strings.TrimSpace(kv[0])
 			dateStr := strings.TrimSpace(kv[1])
-			if key == "" || dateStr == "" { continue }
+			if key == "" || dateStr == "" {
+				continue
+			}
 			if ts, err := time.Parse("2006-01-02", dateStr); err == nil {
 				cfg.APIKeyExpiries[key] = ts
 			}
 		}
 	}
+	if v := os.Getenv("API_KEY_TENANTS"); v != "" { // format key:tenant[,key:tenant]
+		cfg.APIKeyTenants = map[string]string{}
+		for _, pair := range strings.Split(v, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			key, tenant, _ := strings.Cut(pair, ":")
+			key, tenant = strings.TrimSpace(key), strings.TrimSpace(tenant)
+			if key == "" || !core.ValidTenantID(tenant) {
+				return nil, fmt.Errorf("invalid API_KEY_TENANTS entry for key %q: tenant must be 1-63 of [a-z0-9_-]", key)
+			}
+			cfg.APIKeyTenants[key] = tenant
+		}
+	}
+	if v := os.Getenv("API_KEY_SCOPES"); v != "" { // JSON object: {"key": ["users:read", ...], ...}
+		var raw map[string][]string
+		if err := json.Unmarshal([]byte(v), &raw); err != nil {
+			return nil, fmt.Errorf("invalid API_KEY_SCOPES: want a JSON object of key to scope list: %w", err)
+		}
+		cfg.APIKeyScopes = make(map[string][]core.Scope, len(raw))
+		for key, scopes := range raw {
+			list := []core.Scope{} // an empty list is a key that can do nothing, not an unrestricted one
+			for _, s := range scopes {
+				if !core.ValidScope(s) {
+					return nil, fmt.Errorf("invalid API_KEY_SCOPES: unknown scope %q (want users:read, users:write, users:delete or admin)", s)
+				}
+				list = append(list, core.Scope(s))
+			}
+			cfg.APIKeyScopes[key] = list
+		}
+	}
 	cfg.LogLevel = getEnvDefault("LOG_LEVEL", "info")
 	cfg.PprofEnabled = os.Getenv("PPROF_ENABLED") == "1"
+	cfg.RequireIfMatch = os.Getenv("REQUIRE_IF_MATCH") == "1"
+	cfg.AuditLog = os.Getenv("AUDIT_LOG") != "0"
+	cfg.AttributesSchema = os.Getenv("ATTRIBUTES_SCHEMA")
 
 	// Cache defaults
 	cfg.CacheMaxCost = parseInt64Env("CACHE_MAX_COST", 10_000)
@@ -112,6 +225,141 @@ func Load() (*Config, error) {
 		}
 	}
 
+	cfg.OutboxPublisher = strings.ToLower(os.Getenv("OUTBOX_PUBLISHER"))
+	cfg.OutboxFile = getEnvDefault("OUTBOX_FILE", "user_events.ndjson")
+	poll, err := time.ParseDuration(getEnvDefault("OUTBOX_POLL_INTERVAL", "1s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTBOX_POLL_INTERVAL: %w", err)
+	}
+	cfg.OutboxPollInterval = poll
+	cfg.OutboxBatchSize = int(parseInt64Env("OUTBOX_BATCH_SIZE", 100))
+	cfg.WebhooksEnabled = os.Getenv("WEBHOOKS_ENABLED") == "1"
+	cfg.WebhookMaxAttempts = int(parseInt64Env("WEBHOOK_MAX_ATTEMPTS", 8))
+	whTimeout, err := time.ParseDuration(getEnvDefault("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+	}
+	cfg.WebhookTimeout = whTimeout
+	cfg.WebhookAllowPrivate = os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "1"
+	cfg.EventsReplaySize = int(parseInt64Env("EVENTS_REPLAY_SIZE", 1024))
+	keepalive, err := time.ParseDuration(getEnvDefault("EVENTS_KEEPALIVE", "15s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EVENTS_KEEPALIVE: %w", err)
+	}
+	cfg.EventsKeepalive = keepalive
+	wsKeepalive, err := time.ParseDuration(getEnvDefault("GRAPHQL_WS_KEEPALIVE", "25s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GRAPHQL_WS_KEEPALIVE: %w", err)
+	}
+	cfg.GraphQLWSKeepalive = wsKeepalive
+	cfg.GraphQLWSMaxSubscriptions = int(parseInt64Env("GRAPHQL_WS_MAX_SUBSCRIPTIONS", 10))
+	idemTTL, err := time.ParseDuration(getEnvDefault("IDEMPOTENCY_TTL", "24h"))
+	if err != nil || idemTTL <= 0 {
+		return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: %q", os.Getenv("IDEMPOTENCY_TTL"))
+	}
+	cfg.IdempotencyTTL = idemTTL
+	cfg.IdempotencyMaxBody = parseInt64Env("IDEMPOTENCY_MAX_BODY", 1<<20)
+	bulkTimeout, err := time.ParseDuration(getEnvDefault("BULK_TIMEOUT", "10m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid BULK_TIMEOUT: %w", err)
+	}
+	cfg.BulkTimeout = bulkTimeout
+	cfg.ImportMaxBytes = parseInt64Env("IMPORT_MAX_BYTES", 64<<20)
+	cfg.EmailVerifySecret = os.Getenv("EMAIL_VERIFY_SECRET")
+	verifyTTL, err := time.ParseDuration(getEnvDefault("EMAIL_VERIFY_TTL", "48h"))
+	if err != nil || verifyTTL <= 0 {
+		return nil, fmt.Errorf("invalid EMAIL_VERIFY_TTL: %q", os.Getenv("EMAIL_VERIFY_TTL"))
+	}
+	cfg.EmailVerifyTTL = verifyTTL
+	cfg.EmailVerifyURL = os.Getenv("EMAIL_VERIFY_URL")
+	cfg.Mailer = strings.ToLower(getEnvDefault("MAILER", "log"))
+	cfg.MailerFile = getEnvDefault("MAILER_FILE", "mail.log")
+	cfg.SMTPAddr = os.Getenv("SMTP_ADDR")
+	cfg.SMTPUsername = os.Getenv("SMTP_USERNAME")
+	cfg.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	cfg.SMTPFrom = getEnvDefault("SMTP_FROM", "no-reply@localhost")
+	sessionTTL, err := time.ParseDuration(getEnvDefault("SESSION_TTL", "24h"))
+	if err != nil || sessionTTL <= 0 {
+		return nil, fmt.Errorf("invalid SESSION_TTL: %q", os.Getenv("SESSION_TTL"))
+	}
+	cfg.SessionTTL = sessionTTL
+	cfg.PasswordResetSecret = os.Getenv("PASSWORD_RESET_SECRET")
+	resetTTL, err := time.ParseDuration(getEnvDefault("PASSWORD_RESET_TTL", "1h"))
+	if err != nil || resetTTL <= 0 {
+		return nil, fmt.Errorf("invalid PASSWORD_RESET_TTL: %q", os.Getenv("PASSWORD_RESET_TTL"))
+	}
+	cfg.PasswordResetTTL = resetTTL
+	cfg.PasswordResetURL = os.Getenv("PASSWORD_RESET_URL")
+	cfg.PasswordMinLength = int(parseInt64Env("PASSWORD_MIN_LENGTH", 12))
+	cfg.JWTJWKS = os.Getenv("JWT_JWKS")
+	cfg.JWTIssuer = os.Getenv("JWT_ISSUER")
+	for _, a := range strings.Split(os.Getenv("JWT_AUDIENCE"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			cfg.JWTAudience = append(cfg.JWTAudience, a)
+		}
+	}
+	leeway, err := time.ParseDuration(getEnvDefault("JWT_LEEWAY", "60s"))
+	if err != nil || leeway <= 0 {
+		return nil, fmt.Errorf("invalid JWT_LEEWAY: %q", os.Getenv("JWT_LEEWAY"))
+	}
+	cfg.JWTLeeway = leeway
+	cfg.JWTTenantClaim = getEnvDefault("JWT_TENANT_CLAIM", "tenant")
+	jwksRefresh, err := time.ParseDuration(getEnvDefault("JWKS_REFRESH_INTERVAL", "1h"))
+	if err != nil || jwksRefresh <= 0 {
+		return nil, fmt.Errorf("invalid JWKS_REFRESH_INTERVAL: %q", os.Getenv("JWKS_REFRESH_INTERVAL"))
+	}
+	cfg.JWKSRefreshInterval = jwksRefresh
+	cfg.APIKeysManaged = os.Getenv("API_KEYS_MANAGED") == "1"
+	keyCacheTTL, err := time.ParseDuration(getEnvDefault("API_KEY_CACHE_TTL", "30s"))
+	if err != nil || keyCacheTTL <= 0 {
+		return nil, fmt.Errorf("invalid API_KEY_CACHE_TTL: %q", os.Getenv("API_KEY_CACHE_TTL"))
+	}
+	cfg.APIKeyCacheTTL = keyCacheTTL
+	if v := os.Getenv("API_KEY_SIGNING_KEK"); v != "" {
+		kek, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(kek) != 32 {
+			return nil, errors.New("invalid API_KEY_SIGNING_KEK: want 32 bytes, base64-encoded")
+		}
+		cfg.APIKeySigningKEK = kek
+	}
+	cfg.APIKeyUsage = os.Getenv("API_KEY_USAGE") != "0"
+	usageFlush, err := time.ParseDuration(getEnvDefault("API_KEY_USAGE_FLUSH_INTERVAL", "10s"))
+	if err != nil || usageFlush <= 0 {
+		return nil, fmt.Errorf("invalid API_KEY_USAGE_FLUSH_INTERVAL: %q", os.Getenv("API_KEY_USAGE_FLUSH_INTERVAL"))
+	}
+	cfg.APIKeyUsageFlushInterval = usageFlush
+	expiringWithin, err := time.ParseDuration(getEnvDefault("API_KEY_EXPIRING_WITHIN", "168h"))
+	if err != nil || expiringWithin <= 0 {
+		return nil, fmt.Errorf("invalid API_KEY_EXPIRING_WITHIN: %q", os.Getenv("API_KEY_EXPIRING_WITHIN"))
+	}
+	cfg.APIKeyUsageExpiringWithin = expiringWithin
+	cfg.RequestSigning = os.Getenv("REQUEST_SIGNING") == "1"
+	skew, err := time.ParseDuration(getEnvDefault("REQUEST_SIGNING_SKEW", "5m"))
+	if err != nil || skew <= 0 {
+		return nil, fmt.Errorf("invalid REQUEST_SIGNING_SKEW: %q", os.Getenv("REQUEST_SIGNING_SKEW"))
+	}
+	cfg.RequestSigningSkew = skew
+	cfg.RequestSigningMaxBody = parseInt64Env("REQUEST_SIGNING_MAX_BODY", 10<<20)
+	cfg.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	tlsReload, err := time.ParseDuration(getEnvDefault("TLS_RELOAD_INTERVAL", "10s"))
+	if err != nil || tlsReload <= 0 {
+		return nil, fmt.Errorf("invalid TLS_RELOAD_INTERVAL: %q", os.Getenv("TLS_RELOAD_INTERVAL"))
+	}
+	cfg.TLSReloadInterval = tlsReload
+	cfg.TLSClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+	cfg.TLSClientAuth = getEnvDefault("TLS_CLIENT_AUTH", "optional")
+	if v := os.Getenv("TLS_CLIENT_IDENTITIES"); v != "" { // JSON object: {"DNS:billing.internal": "apikey:3f2a9c1d0b7e", ...}
+		if err := json.Unmarshal([]byte(v), &cfg.TLSClientIdentities); err != nil {
+			return nil, fmt.Errorf("invalid TLS_CLIENT_IDENTITIES: want a JSON object of certificate name to api key credential: %w", err)
+		}
+		for name, credential := range cfg.TLSClientIdentities {
+			if !strings.HasPrefix(credential, "apikey:") && !strings.HasPrefix(credential, "mxk_") {
+				return nil, fmt.Errorf("invalid TLS_CLIENT_IDENTITIES: %q must map to an apikey:<id> or mxk_<prefix> credential", name)
+			}
+		}
+	}
+
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -125,9 +373,65 @@ func (c *Config) Validate() error {
 	if c.Env != "dev" && c.Env != "prod" {
 		return fmt.Errorf("ENV must be dev or prod")
 	}
+	switch c.OutboxPublisher {
+	case "", "log", "file", "memory":
+	default:
+		return fmt.Errorf("OUTBOX_PUBLISHER must be log, file or memory")
+	}
+	switch c.Mailer {
+	case "log", "file":
+	case "smtp":
+		if c.SMTPAddr == "" {
+			return errors.New("SMTP_ADDR required when MAILER=smtp")
+		}
+	default:
+		return fmt.Errorf("MAILER must be log, file or smtp")
+	}
+	if c.JWTJWKS != "" && (c.JWTIssuer == "" || len(c.JWTAudience) == 0) {
+		return errors.New("JWT_ISSUER and JWT_AUDIENCE required when JWT_JWKS is set")
+	}
+	// Without a bootstrap credential nobody could mint the first key
+	if c.APIKeysManaged && len(c.APIKeys) == 0 && c.JWTJWKS == "" {
+		return errors.New("API_KEYS or JWT_JWKS required when API_KEYS_MANAGED=1")
+	}
+	if c.RequestSigning && len(c.APIKeys) == 0 && len(c.OldAPIKeys) == 0 && !c.APIKeysManaged {
+		return errors.New("API_KEYS or API_KEYS_MANAGED=1 required when REQUEST_SIGNING=1")
+	}
+	// Minted keys keep their signing keys only when sealed, so without a KEK none of them could sign
+	if c.RequestSigning && c.APIKeysManaged && c.APIKeySigningKEK == nil {
+		return errors.New("API_KEY_SIGNING_KEK required when REQUEST_SIGNING=1 and API_KEYS_MANAGED=1")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		return errors.New("TLS_CERT_FILE required when TLS_CLIENT_CA_FILE is set")
+	}
+	if (len(c.TLSClientIdentities) > 0 || c.TLSClientAuth == "require") && c.TLSClientCAFile == "" {
+		return errors.New("TLS_CLIENT_CA_FILE required when TLS_CLIENT_IDENTITIES is set or TLS_CLIENT_AUTH=require")
+	}
+	switch c.TLSClientAuth {
+	case "", "optional", "require":
+	default:
+		return fmt.Errorf("TLS_CLIENT_AUTH must be optional or require")
+	}
 	return nil
 }
 
+// UnscopedAPIKeys lists the env-var keys API_KEY_SCOPES leaves out, which may do nothing once it is set.
+func (c *Config) UnscopedAPIKeys() []string {
+	if c.APIKeyScopes == nil {
+		return nil
+	}
+	var out []string
+	for _, k := range append(slices.Clone(c.APIKeys), c.OldAPIKeys...) {
+		if _, ok := c.APIKeyScopes[k]; !ok {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
 func getEnvDefault(k, def string) string {
 	v := os.Getenv(k)
 	if v == "" {
@@ -2,20 +2,25 @@ package core
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/hex-zero/MaxwellGoSpine/internal/cache"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// cachedUserService decorates UserService with layered cache and invalidation.
+// cachedUserService decorates UserService with layered cache and invalidation. Every key is namespaced by
+// the tenant in the context, so one tenant's reads can never be served from another's entries.
 type cachedUserService struct {
-	base    UserService
-	cache   *cache.Layered
-	listVer atomic.Uint64
-	ttl     time.Duration
+	base     UserService
+	cache    *cache.Layered
+	listVers sync.Map // tenant -> *atomic.Uint64; bumping a tenant's version orphans its cached lists
+	ttl      time.Duration
 }
 
 func NewCachedUserService(base UserService, c *cache.Layered) UserService {
@@ -26,18 +31,49 @@ func NewCachedUserService(base UserService, c *cache.Layered) UserService {
 	return s
 }
 
-func (s *cachedUserService) cacheKeyUser(id uuid.UUID) string { return "user:get:" + id.String() }
-func (s *cachedUserService) cacheKeyList(page, size int) string {
-	return fmt.Sprintf("user:list:v%d:%d:%d", s.listVer.Load(), page, size)
+func (s *cachedUserService) cacheKeyUser(ctx context.Context, id uuid.UUID) string {
+	return "t:" + TenantFrom(ctx) + ":user:get:" + id.String()
+}
+func (s *cachedUserService) cacheKeyList(ctx context.Context, f UserFilter, sort UserSort, page, size int) string {
+	return fmt.Sprintf("t:%s:user:list:v%d:%s:%d:%d", TenantFrom(ctx), s.listVer(ctx).Load(), listQueryHash(f, sort), page, size)
+}
+func (s *cachedUserService) cacheKeyListAfter(ctx context.Context, f UserFilter, sort UserSort, cursor string, limit int) string {
+	return fmt.Sprintf("t:%s:user:list:v%d:%s:after:%s:%d", TenantFrom(ctx), s.listVer(ctx).Load(), listQueryHash(f, sort), cursor, limit)
+}
+
+// listVer is the list cache version of the tenant in ctx.
+func (s *cachedUserService) listVer(ctx context.Context) *atomic.Uint64 {
+	v, _ := s.listVers.LoadOrStore(TenantFrom(ctx), new(atomic.Uint64))
+	return v.(*atomic.Uint64)
+}
+
+// listQueryHash condenses filter and sort into a short, stable cache key segment.
+func listQueryHash(f UserFilter, sort UserSort) string {
+	b, _ := json.Marshal(struct {
+		F UserFilter `json:"f"`
+		S UserSort   `json:"s"`
+	}{f.Normalize(), sort.Normalize()})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
 }
 
 // Create invalidates list caches by version bump and caches new user.
-func (s *cachedUserService) Create(ctx context.Context, name, email string) (*User, error) {
-	u, err := s.base.Create(ctx, name, email)
+func (s *cachedUserService) Create(ctx context.Context, name, email string, attrs Attributes) (*User, error) {
+	u, err := s.base.Create(ctx, name, email, attrs)
+	if err != nil {
+		return nil, err
+	}
+	s.listVer(ctx).Add(1)
+	s.setUser(ctx, u)
+	return u, nil
+}
+
+func (s *cachedUserService) Invite(ctx context.Context, name, email string, attrs Attributes) (*User, error) {
+	u, err := s.base.Invite(ctx, name, email, attrs)
 	if err != nil {
 		return nil, err
 	}
-	s.listVer.Add(1)
+	s.listVer(ctx).Add(1)
 	s.setUser(ctx, u)
 	return u, nil
 }
@@ -54,28 +90,78 @@ func (s *cachedUserService) Get(ctx context.Context, id uuid.UUID) (*User, error
 	return u, nil
 }
 
-func (s *cachedUserService) Update(ctx context.Context, id uuid.UUID, name *string, email *string) (*User, error) {
-	u, err := s.base.Update(ctx, id, name, email)
+func (s *cachedUserService) Update(ctx context.Context, id uuid.UUID, name *string, email *string, attrs Attributes, expectedVersion int64) (*User, error) {
+	u, err := s.base.Update(ctx, id, name, email, attrs, expectedVersion)
 	if err != nil {
+		if errors.Is(err, ErrStaleVersion) {
+			s.delUser(ctx, id) // our cached copy may be the stale one
+		}
 		return nil, err
 	}
 	s.delUser(ctx, id)
-	s.listVer.Add(1)
+	s.listVer(ctx).Add(1)
 	s.setUser(ctx, u)
 	return u, nil
 }
 
-func (s *cachedUserService) Delete(ctx context.Context, id uuid.UUID) error {
-	if err := s.base.Delete(ctx, id); err != nil {
+func (s *cachedUserService) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	if err := s.base.Delete(ctx, id, expectedVersion); err != nil {
+		if errors.Is(err, ErrStaleVersion) {
+			s.delUser(ctx, id) // our cached copy may be the stale one
+		}
 		return err
 	}
 	s.delUser(ctx, id)
-	s.listVer.Add(1)
+	s.listVer(ctx).Add(1)
 	return nil
 }
 
-func (s *cachedUserService) List(ctx context.Context, page, pageSize int) ([]*User, int, error) {
-	key := s.cacheKeyList(page, pageSize)
+// Transition drops the cached copy on an illegal transition too: it may be what made the caller try.
+func (s *cachedUserService) Transition(ctx context.Context, id uuid.UUID, to UserStatus, reason string) (*User, error) {
+	u, err := s.base.Transition(ctx, id, to, reason)
+	if err != nil {
+		var illegal *IllegalTransitionError
+		if errors.As(err, &illegal) || errors.Is(err, ErrStaleVersion) {
+			s.delUser(ctx, id)
+		}
+		return nil, err
+	}
+	s.listVer(ctx).Add(1)
+	s.setUser(ctx, u)
+	return u, nil
+}
+
+func (s *cachedUserService) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	u, err := s.base.VerifyEmail(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	s.listVer(ctx).Add(1)
+	s.setUser(ctx, u)
+	return u, nil
+}
+
+func (s *cachedUserService) Restore(ctx context.Context, id uuid.UUID) (*User, error) {
+	u, err := s.base.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.listVer(ctx).Add(1)
+	s.setUser(ctx, u)
+	return u, nil
+}
+
+func (s *cachedUserService) Purge(ctx context.Context, id uuid.UUID) error {
+	if err := s.base.Purge(ctx, id); err != nil {
+		return err
+	}
+	s.delUser(ctx, id)
+	s.listVer(ctx).Add(1)
+	return nil
+}
+
+func (s *cachedUserService) List(ctx context.Context, f UserFilter, sort UserSort, page, pageSize int) ([]*User, int, error) {
+	key := s.cacheKeyList(ctx, f, sort, page, pageSize)
 	if b, ok, _ := s.cache.Get(ctx, key); ok {
 		var wrap struct {
 			Users []*User `json:"u"`
@@ -85,7 +171,7 @@ func (s *cachedUserService) List(ctx context.Context, page, pageSize int) ([]*Us
 			return wrap.Users, wrap.Total, nil
 		}
 	}
-	users, total, err := s.base.List(ctx, page, pageSize)
+	users, total, err := s.base.List(ctx, f, sort, page, pageSize)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -97,13 +183,88 @@ func (s *cachedUserService) List(ctx context.Context, page, pageSize int) ([]*Us
 	return users, total, nil
 }
 
+func (s *cachedUserService) ListAfter(ctx context.Context, f UserFilter, sort UserSort, cursor string, limit int) ([]*User, string, error) {
+	key := s.cacheKeyListAfter(ctx, f, sort, cursor, limit)
+	if b, ok, _ := s.cache.Get(ctx, key); ok {
+		var wrap struct {
+			Users []*User `json:"u"`
+			Next  string  `json:"n"`
+		}
+		if err := json.Unmarshal(b, &wrap); err == nil {
+			return wrap.Users, wrap.Next, nil
+		}
+	}
+	users, next, err := s.base.ListAfter(ctx, f, sort, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	payload, _ := json.Marshal(struct {
+		Users []*User `json:"u"`
+		Next  string  `json:"n"`
+	}{users, next})
+	s.cache.Set(ctx, key, payload)
+	return users, next, nil
+}
+
+// Batch drops the cached copy of every touched user and, if anything was written, bumps the list version.
+func (s *cachedUserService) Batch(ctx context.Context, ops []BatchOp, mode BatchMode) ([]BatchResult, error) {
+	results, err := s.base.Batch(ctx, ops, mode)
+	if err != nil {
+		return nil, err
+	}
+	written := false
+	for i, res := range results {
+		if ops[i].ID != uuid.Nil {
+			s.delUser(ctx, ops[i].ID) // also clears copies a stale-version failure proved outdated
+		}
+		if res.Err != nil {
+			continue
+		}
+		written = true
+		if res.User != nil {
+			s.setUser(ctx, res.User)
+		}
+	}
+	if written {
+		s.listVer(ctx).Add(1)
+	}
+	return results, nil
+}
+
+// Export is not cached: it reads every matching user once.
+func (s *cachedUserService) Export(ctx context.Context, f UserFilter, sort UserSort, fn func(*User) error) error {
+	return s.base.Export(ctx, f, sort, fn)
+}
+
+// Import drops the cached copy of every user a committed import wrote and bumps the list version.
+func (s *cachedUserService) Import(ctx context.Context, rows ImportSource, opts ImportOptions) (*ImportReport, error) {
+	report, err := s.base.Import(ctx, rows, opts)
+	if report != nil && len(report.touched) > 0 {
+		for _, id := range report.touched {
+			s.delUser(ctx, id)
+		}
+		s.listVer(ctx).Add(1)
+	}
+	return report, err
+}
+
+// Search is not cached: queries are too varied to get useful hit rates.
+func (s *cachedUserService) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	return s.base.Search(ctx, query, limit)
+}
+
+// History is not cached: it must reflect the latest write immediately.
+func (s *cachedUserService) History(ctx context.Context, id uuid.UUID, limit int) ([]AuditEntry, error) {
+	return s.base.History(ctx, id, limit)
+}
+
 func (s *cachedUserService) WithTx(ctx context.Context, fn func(context.Context, UnitOfWork) error) error {
 	return s.base.WithTx(ctx, fn)
 }
 
 // helpers
 func (s *cachedUserService) getUser(ctx context.Context, id uuid.UUID) *User {
-	key := s.cacheKeyUser(id)
+	key := s.cacheKeyUser(ctx, id)
 	if b, ok, _ := s.cache.Get(ctx, key); ok {
 		var u User
 		if json.Unmarshal(b, &u) == nil {
@@ -114,8 +275,8 @@ func (s *cachedUserService) getUser(ctx context.Context, id uuid.UUID) *User {
 }
 func (s *cachedUserService) setUser(ctx context.Context, u *User) {
 	b, _ := json.Marshal(u)
-	s.cache.Set(ctx, s.cacheKeyUser(u.ID), b)
+	s.cache.Set(ctx, s.cacheKeyUser(ctx, u.ID), b)
 }
 func (s *cachedUserService) delUser(ctx context.Context, id uuid.UUID) {
-	s.cache.Delete(ctx, s.cacheKeyUser(id))
+	s.cache.Delete(ctx, s.cacheKeyUser(ctx, id))
 }
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// CredentialRepository is implemented by user repositories that keep password hashes. A hash belongs to a
+// live user of the tenant in ctx and is never part of a User, so it cannot leak through the API, caches or
+// events.
+type CredentialRepository interface {
+	EmailFinder
+	// PasswordHash returns the stored hash, "" if the user has no password, or ErrNotFound.
+	PasswordHash(ctx context.Context, id uuid.UUID) (string, error)
+	// SetPasswordHash replaces the hash; ErrNotFound if there is no such live user.
+	SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) error
+}
+
+type endUserCtxKey struct{}
+
+// WithEndUser records the end user a request acts for (e.g. from a session token), as opposed to the
+// application that holds the API key.
+func WithEndUser(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, endUserCtxKey{}, id)
+}
+
+// EndUserFrom returns the end user recorded by WithEndUser, if any.
+func EndUserFrom(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(endUserCtxKey{}).(uuid.UUID)
+	return id, ok
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Cursor is a keyset position in a (sort column, id) user ordering.
+// Clients only ever see it in its encoded, opaque form.
+type Cursor struct {
+	Sort UserSort  `json:"s"`
+	Key  string    `json:"k"` // sort column value of the last row (RFC3339Nano for timestamps)
+	ID   uuid.UUID `json:"id"`
+}
+
+// CursorFor returns the cursor positioned right after u in the given ordering.
+func CursorFor(u *User, s UserSort) *Cursor {
+	s = s.Normalize()
+	return &Cursor{Sort: s, Key: s.sortKey(u), ID: u.ID}
+}
+
+// Precedes reports whether u sorts strictly after the cursor position, i.e. belongs on the next page.
+func (c *Cursor) Precedes(u *User) bool {
+	cmp := c.Sort.compareKey(u, c.Key)
+	if cmp == 0 {
+		cmp = compareUUID(u.ID, c.ID)
+	}
+	if c.Sort.Desc {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// KeyValue returns the cursor key typed for its sort column (time.Time or string), for use as a query argument.
+func (c *Cursor) KeyValue() any {
+	switch c.Sort.Field {
+	case SortByName, SortByEmail:
+		return c.Key
+	}
+	ts, _ := time.Parse(time.RFC3339Nano, c.Key)
+	return ts
+}
+
+func EncodeCursor(c *Cursor) string {
+	if c == nil {
+		return ""
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses an opaque cursor; an empty string yields a nil cursor (first page).
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", ErrValidation)
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == uuid.Nil || c.Sort.Validate() != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", ErrValidation)
+	}
+	if _, ok := c.KeyValue().(time.Time); ok {
+		if _, err := time.Parse(time.RFC3339Nano, c.Key); err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", ErrValidation)
+		}
+	}
+	return &c, nil
+}
+
+// compareUUID orders UUIDs bytewise, matching Postgres uuid comparison.
+func compareUUID(a, b uuid.UUID) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -1,9 +1,27 @@
 package core
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrNotFound   = errors.New("not found")
 	ErrConflict   = errors.New("conflict")
 	ErrValidation = errors.New("validation error")
+	// ErrForbidden refuses an authenticated caller an operation it lacks the permission for.
+	ErrForbidden = errors.New("forbidden")
+	// ErrLimitExceeded rejects work beyond a configured quota (e.g. subscriptions per connection).
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrStaleVersion is a conflict caused by a version mismatch (lost-update protection).
+	ErrStaleVersion = fmt.Errorf("stale version: %w", ErrConflict)
 )
+
+// ConflictError is a uniqueness violation on a single field; it matches ErrConflict via errors.Is.
+type ConflictError struct {
+	Field string
+	Value string // the clashing value when the store reports it; used to pin batch failures to an item
+}
+
+func (e *ConflictError) Error() string { return e.Field + " already in use" }
+func (e *ConflictError) Unwrap() error { return ErrConflict }
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"slices"
+)
+
+// Scope is a permission granted to a caller (an API key or bearer token).
+type Scope string
+
+const (
+	ScopeUsersRead   Scope = "users:read"
+	ScopeUsersWrite  Scope = "users:write"
+	ScopeUsersDelete Scope = "users:delete"
+	// ScopeAdmin grants every other scope, plus operations that need it alone (purges, webhook management).
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes lists every scope a caller can be granted.
+var Scopes = []Scope{ScopeUsersRead, ScopeUsersWrite, ScopeUsersDelete, ScopeAdmin}
+
+// ValidScope reports whether s names a known scope.
+func ValidScope(s string) bool { return slices.Contains(Scopes, Scope(s)) }
+
+// ScopeError refuses an operation the caller has no scope for; it matches ErrForbidden via errors.Is.
+type ScopeError struct {
+	Scope Scope
+}
+
+func (e *ScopeError) Error() string { return "missing scope " + string(e.Scope) }
+func (e *ScopeError) Unwrap() error { return ErrForbidden }
+
+type scopesCtxKey struct{}
+
+// WithScopes restricts the caller to scopes. Without it a context is unrestricted: auth is off, or the
+// API key predates scopes.
+func WithScopes(ctx context.Context, scopes []Scope) context.Context {
+	return context.WithValue(ctx, scopesCtxKey{}, slices.Clone(scopes))
+}
+
+// ScopesFrom returns the caller's scopes; restricted is false when WithScopes was never applied.
+func ScopesFrom(ctx context.Context) (scopes []Scope, restricted bool) {
+	scopes, restricted = ctx.Value(scopesCtxKey{}).([]Scope)
+	return scopes, restricted
+}
+
+// RequireScope returns a *ScopeError unless the caller holds scope or ScopeAdmin.
+func RequireScope(ctx context.Context, scope Scope) error {
+	scopes, restricted := ScopesFrom(ctx)
+	if !restricted || slices.Contains(scopes, scope) || slices.Contains(scopes, ScopeAdmin) {
+		return nil
+	}
+	return &ScopeError{Scope: scope}
+}
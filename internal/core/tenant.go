@@ -0,0 +1,31 @@
+package core
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultTenant owns everything done without a tenant in context: single-tenant deployments, API keys not
+// bound to a tenant, background jobs and the rows that predate tenancy (migration 0011 backfills it).
+const DefaultTenant = "default"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenantID reports whether id can name a tenant: 1-63 lower-case letters, digits, '_' or '-'.
+func ValidTenantID(id string) bool { return tenantIDPattern.MatchString(id) }
+
+type tenantCtxKey struct{}
+
+// WithTenant scopes every repository call made with the returned context to tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFrom returns the tenant stored in ctx, defaulting to DefaultTenant. Repositories read it on every
+// query, so a tenant can neither see nor change another tenant's users.
+func TenantFrom(ctx context.Context) string {
+	if t, _ := ctx.Value(tenantCtxKey{}).(string); t != "" {
+		return t
+	}
+	return DefaultTenant
+}
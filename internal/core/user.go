@@ -7,9 +7,20 @@ import (
 
 type User struct {
 	ID        uuid.UUID
+	TenantID  string // stamped from the context by the repository on create; never changes
 	Name      string
 	Email     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt *time.Time
+	Version   int64 // incremented on every write; basis for ETags and optimistic locking
+	// Attributes are caller-defined fields, validated against the configured schema; never nil once stored.
+	Attributes Attributes
+	// Status only changes through UserService.Transition, which stamps StatusChangedAt and keeps the reason.
+	Status          UserStatus
+	StatusChangedAt time.Time
+	StatusReason    string
+	// EmailVerifiedAt is set when a verification token for the current email is consumed; changing the
+	// email clears it.
+	EmailVerifiedAt *time.Time
 }
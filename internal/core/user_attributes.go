@@ -0,0 +1,113 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Attributes are caller-defined fields stored with a user as one JSON object (department, cost center, ...).
+// Values are what encoding/json produces: string, float64, bool, nil, []any or map[string]any.
+type Attributes map[string]any
+
+// AttributeValidator enforces the deployment's attribute schema; failures should be *AttributeError.
+type AttributeValidator interface {
+	Validate(attrs Attributes) error
+}
+
+// AttributeProblem is one schema violation; Path is a JSON pointer into the attributes ("" is the object itself).
+type AttributeProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// AttributeError lists every way the attributes break the schema; it matches ErrValidation via errors.Is.
+type AttributeError struct {
+	Problems []AttributeProblem
+}
+
+func (e *AttributeError) Error() string {
+	parts := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		path := p.Path
+		if path == "" {
+			path = "/"
+		}
+		parts = append(parts, path+": "+p.Message)
+	}
+	return "invalid attributes: " + strings.Join(parts, "; ")
+}
+
+func (e *AttributeError) Unwrap() error { return ErrValidation }
+
+// MergeAttributes applies patch to target as a JSON merge patch (RFC 7396): null removes a key, objects merge
+// recursively and anything else replaces. Neither argument is modified; the result is never nil.
+func MergeAttributes(target, patch Attributes) Attributes {
+	return mergeObject(target, patch)
+}
+
+func mergeObject(target, patch map[string]any) map[string]any {
+	out := make(map[string]any, len(target)+len(patch))
+	for k, v := range target {
+		out[k] = v
+	}
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(out, k)
+		case map[string]any:
+			tv, _ := out[k].(map[string]any)
+			out[k] = mergeObject(tv, pv)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// attributeText renders a top-level attribute value the way Postgres' ->> operator does, so equality
+// filters behave the same in every store. ok is false for missing keys and JSON null.
+func attributeText(attrs Attributes, key string) (s string, ok bool) {
+	switch v := attrs[key].(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+}
+
+// validateAttributes checks attrs with v, if any. A nil map is stored as an empty object.
+func validateAttributes(v AttributeValidator, attrs Attributes) (Attributes, error) {
+	if attrs == nil {
+		attrs = Attributes{}
+	}
+	if v != nil {
+		if err := v.Validate(attrs); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, nil
+}
+
+// maxAttributeFilters bounds the attribute equality filters of one listing.
+const maxAttributeFilters = 10
+
+func validateAttributeFilters(f map[string]string) error {
+	if len(f) > maxAttributeFilters {
+		return fmt.Errorf("at most %d attribute filters: %w", maxAttributeFilters, ErrValidation)
+	}
+	for k := range f {
+		if k == "" {
+			return fmt.Errorf("attribute filter needs a key: %w", ErrValidation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// AuditAction names what happened to the user: created, updated, deleted, restored, purged or status_changed.
+type AuditAction string
+
+// FieldChange is one field of a before/after diff; nil means the field had no value on that side.
+type FieldChange struct {
+	Field  string  `json:"field"`
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
+
+// AuditEntry records who changed a user, when, under which request, and how.
+// Restores and purges are recorded without a diff.
+type AuditEntry struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	TenantID   string
+	Action     AuditAction
+	Actor      string
+	RequestID  string
+	OccurredAt time.Time
+	Changes    []FieldChange
+}
+
+// Auditor stores the audit trail. History returns a user's entries newest first, limited to the tenant in
+// ctx, and keeps working after the user is purged.
+type Auditor interface {
+	Record(ctx context.Context, entries ...AuditEntry) error
+	History(ctx context.Context, userID uuid.UUID, limit int) ([]AuditEntry, error)
+}
+
+// SystemActor is recorded for changes made outside a request, e.g. by seeding or background jobs.
+const SystemActor = "system"
+
+// AuditContext is the request-scoped attribution the transport layer hands to the service.
+type AuditContext struct {
+	Actor     string
+	RequestID string
+}
+
+type auditCtxKey struct{}
+
+func WithAuditContext(ctx context.Context, ac AuditContext) context.Context {
+	return context.WithValue(ctx, auditCtxKey{}, ac)
+}
+
+// AuditContextFrom returns the attribution stored in ctx, defaulting the actor to SystemActor.
+func AuditContextFrom(ctx context.Context) AuditContext {
+	ac, _ := ctx.Value(auditCtxKey{}).(AuditContext)
+	if ac.Actor == "" {
+		ac.Actor = SystemActor
+	}
+	return ac
+}
+
+// NewAuditEntry attributes a change from ctx and diffs the user's state before and after it
+// (before is nil for creates).
+func NewAuditEntry(ctx context.Context, t UserEventType, id uuid.UUID, before, after *User) AuditEntry {
+	ac := AuditContextFrom(ctx)
+	e := AuditEntry{
+		ID:         uuid.New(),
+		UserID:     id,
+		TenantID:   TenantFrom(ctx),
+		Action:     AuditAction(strings.TrimPrefix(string(t), "user.")),
+		Actor:      ac.Actor,
+		RequestID:  ac.RequestID,
+		OccurredAt: time.Now().UTC(),
+	}
+	if t != UserRestored && t != UserPurged {
+		e.Changes = DiffUsers(before, after)
+	}
+	return e
+}
+
+// DiffUsers lists the user-visible fields that differ between before and after; either may be nil.
+// Attributes are compared as a whole JSON object. Status changes are paired with their reason.
+// Bookkeeping fields (version, updated_at) are left out.
+func DiffUsers(before, after *User) []FieldChange {
+	changes := []FieldChange{}
+	add := func(field string, b, a *string) {
+		if (b == nil) != (a == nil) || (b != nil && *b != *a) {
+			changes = append(changes, FieldChange{Field: field, Before: b, After: a})
+		}
+	}
+	add("name", userField(before, func(u *User) string { return u.Name }), userField(after, func(u *User) string { return u.Name }))
+	add("email", userField(before, func(u *User) string { return u.Email }), userField(after, func(u *User) string { return u.Email }))
+	add("deleted_at", deletedAt(before), deletedAt(after))
+	add("attributes", attributesJSON(before), attributesJSON(after))
+	add("status", userField(before, func(u *User) string { return string(u.Status) }), userField(after, func(u *User) string { return string(u.Status) }))
+	add("status_reason", statusReason(before), statusReason(after))
+	add("email_verified_at", emailVerifiedAt(before), emailVerifiedAt(after))
+	return changes
+}
+
+func userField(u *User, get func(*User) string) *string {
+	if u == nil {
+		return nil
+	}
+	v := get(u)
+	return &v
+}
+
+// attributesJSON renders non-empty attributes as JSON with sorted keys, so equal maps compare equal.
+func attributesJSON(u *User) *string {
+	if u == nil || len(u.Attributes) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(u.Attributes)
+	v := string(b)
+	return &v
+}
+
+func statusReason(u *User) *string {
+	if u == nil || u.StatusReason == "" {
+		return nil
+	}
+	return &u.StatusReason
+}
+
+func emailVerifiedAt(u *User) *string {
+	if u == nil || u.EmailVerifiedAt == nil {
+		return nil
+	}
+	v := u.EmailVerifiedAt.UTC().Format(time.RFC3339Nano)
+	return &v
+}
+
+func deletedAt(u *User) *string {
+	if u == nil || u.DeletedAt == nil {
+		return nil
+	}
+	v := u.DeletedAt.UTC().Format(time.RFC3339Nano)
+	return &v
+}
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// MaxBatchSize bounds the number of operations accepted by UserService.Batch.
+const MaxBatchSize = 1000
+
+type BatchOpKind string
+
+const (
+	BatchCreate BatchOpKind = "create"
+	BatchUpdate BatchOpKind = "update"
+	BatchDelete BatchOpKind = "delete"
+)
+
+// BatchOp is one item of a batch. Create uses Name/Email/Attributes; update uses ID and the optional
+// Name/Email/Attributes (a merge patch); update and delete honour ExpectedVersion like their single-item counterparts.
+type BatchOp struct {
+	Kind            BatchOpKind
+	ID              uuid.UUID
+	Name            *string
+	Email           *string
+	Attributes      Attributes
+	ExpectedVersion int64
+}
+
+type BatchMode string
+
+const (
+	BatchAtomic  BatchMode = "atomic"  // all-or-nothing in one transaction (default)
+	BatchPartial BatchMode = "partial" // apply what succeeds, report per-item errors
+)
+
+// BatchResult is the outcome of the op at the same index; User is nil for deletes and failed items.
+type BatchResult struct {
+	User *User
+	Err  error
+}
+
+// BatchItemError locates the item that aborted an atomic batch; it unwraps to the item's error.
+type BatchItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchItemError) Error() string { return fmt.Sprintf("batch item %d: %v", e.Index, e.Err) }
+func (e *BatchItemError) Unwrap() error { return e.Err }
+
+// BatchCreator is implemented by repositories that can insert many users in one round trip.
+// A failing call must store none of the users.
+type BatchCreator interface {
+	CreateMany(ctx context.Context, users []*User) error
+}
+
+func (s *userService) Batch(ctx context.Context, ops []BatchOp, mode BatchMode) ([]BatchResult, error) {
+	if len(ops) == 0 || len(ops) > MaxBatchSize {
+		return nil, fmt.Errorf("batch must contain 1 to %d operations: %w", MaxBatchSize, ErrValidation)
+	}
+	switch mode {
+	case "", BatchAtomic:
+		var (
+			results []BatchResult
+			changes []userChange
+			events  []UserEvent
+		)
+		err := s.WithTx(ctx, func(ctx context.Context, uow UnitOfWork) error {
+			var err error
+			if results, changes, err = s.applyBatch(ctx, uow.UserRepo(), ops); err != nil {
+				return err
+			}
+			events = changeEvents(ctx, changes)
+			return s.record(ctx, uow, changes, events)
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.committed(ctx, changes, events)
+		return results, nil
+	case BatchPartial:
+		results := make([]BatchResult, len(ops))
+		for start := 0; start < len(ops); {
+			// a run of creates is inserted together; updates and deletes go one at a time
+			end := start + 1
+			for ops[start].Kind == BatchCreate && end < len(ops) && ops[end].Kind == BatchCreate {
+				end++
+			}
+			if err := s.applyUnit(ctx, ops, results, start, end); err != nil && end-start > 1 {
+				// nothing was stored; retry one by one to find out which items are at fault
+				for i := start; i < end; i++ {
+					_ = s.applyUnit(ctx, ops, results, i, i+1)
+				}
+			}
+			start = end
+		}
+		return results, nil
+	default:
+		return nil, fmt.Errorf("unsupported batch mode %q: %w", mode, ErrValidation)
+	}
+}
+
+// applyUnit applies ops[start:end] all-or-nothing and records the outcome in results[start:end].
+func (s *userService) applyUnit(ctx context.Context, ops []BatchOp, results []BatchResult, start, end int) error {
+	unit := ops[start:end]
+	var res []BatchResult
+	err := s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		var (
+			changes []userChange
+			err     error
+		)
+		res, changes, err = s.applyBatch(ctx, repo, unit)
+		return changes, err
+	})
+	if err != nil {
+		var item *BatchItemError
+		if errors.As(err, &item) {
+			err = item.Err
+		}
+		for i := start; i < end; i++ {
+			results[i] = BatchResult{Err: err}
+		}
+		return err
+	}
+	copy(results[start:end], res)
+	return nil
+}
+
+// applyBatch runs ops in order against repo and stops at the first failure, returned as *BatchItemError.
+// Consecutive creates are buffered and inserted together; the buffer is flushed before any update or delete
+// so ops still observe their predecessors. The changes are in op order; auditing loads the before state of deletes.
+func (s *userService) applyBatch(ctx context.Context, repo UserRepository, ops []BatchOp) ([]BatchResult, []userChange, error) {
+	results := make([]BatchResult, len(ops))
+	changes := make([]userChange, len(ops))
+	var pending []int // indexes of validated creates not yet stored
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		defer func() { pending = pending[:0] }()
+		users := make([]*User, len(pending))
+		for i, idx := range pending {
+			users[i] = results[idx].User
+		}
+		if bc, ok := repo.(BatchCreator); ok {
+			if err := bc.CreateMany(ctx, users); err != nil {
+				return &BatchItemError{Index: failedCreate(pending, users, err), Err: err}
+			}
+			return nil
+		}
+		for i, u := range users {
+			if err := repo.Create(ctx, u); err != nil {
+				return &BatchItemError{Index: pending[i], Err: err}
+			}
+		}
+		return nil
+	}
+	for i, op := range ops {
+		var err error
+		switch op.Kind {
+		case BatchCreate:
+			var u *User
+			if op.Name == nil || op.Email == nil {
+				err = fmt.Errorf("create requires name and email: %w", ErrValidation)
+			} else if u, err = s.newUser(*op.Name, *op.Email, op.Attributes); err == nil {
+				results[i].User = u
+				pending = append(pending, i)
+			}
+		case BatchUpdate, BatchDelete:
+			if err := flush(); err != nil {
+				return nil, nil, err
+			}
+			if op.ID == uuid.Nil {
+				err = fmt.Errorf("%s requires id: %w", op.Kind, ErrValidation)
+			} else if op.Kind == BatchUpdate {
+				var before *User
+				if before, results[i].User, err = s.updateUser(ctx, repo, op.ID, op.Name, op.Email, op.Attributes, op.ExpectedVersion); err == nil {
+					changes[i] = userChange{typ: UserUpdated, id: op.ID, before: before, after: results[i].User}
+				}
+			} else {
+				changes[i], err = deleteUser(ctx, repo, op.ID, op.ExpectedVersion, s.opts.Audit)
+			}
+		default:
+			err = fmt.Errorf("unsupported batch op %q: %w", op.Kind, ErrValidation)
+		}
+		if err != nil {
+			return nil, nil, &BatchItemError{Index: i, Err: err}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, nil, err
+	}
+	for i, op := range ops {
+		if op.Kind == BatchCreate {
+			changes[i] = userChange{typ: UserCreated, id: results[i].User.ID, after: results[i].User}
+		}
+	}
+	return results, changes, nil
+}
+
+// failedCreate pins a multi-row insert failure to an item via the conflicting value, falling back to the first item.
+// The search runs backwards because within a batch it is the later of two equal emails that clashes.
+func failedCreate(pending []int, users []*User, err error) int {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) && conflict.Value != "" {
+		for i := len(users) - 1; i >= 0; i-- {
+			u := users[i]
+			if strings.EqualFold(u.Email, conflict.Value) {
+				return pending[i]
+			}
+		}
+	}
+	return pending[0]
+}
@@ -0,0 +1,261 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// exportChunk is how many users Export reads per round trip when the repository cannot stream.
+const exportChunk = 500
+
+// MaxImportErrors bounds the line errors kept in an ImportReport; later failures are only counted.
+const MaxImportErrors = 1000
+
+// UserStreamer is implemented by repositories that can read a whole listing in constant memory, e.g. through a
+// database cursor. fn is called once per user in s order; an error from fn stops the stream and is returned.
+type UserStreamer interface {
+	StreamUsers(ctx context.Context, f UserFilter, s UserSort, fn func(*User) error) error
+}
+
+// EmailFinder is implemented by repositories that can look up a live user by (normalized) email; import
+// needs it to upsert.
+type EmailFinder interface {
+	GetByEmail(ctx context.Context, email string) (*User, error)
+}
+
+// ImportRow is one parsed input line. Err reports a line the parser could not read; it is recorded as that
+// line's failure without touching the other fields.
+type ImportRow struct {
+	Line       int
+	Name       string
+	Email      string
+	Attributes Attributes
+	Err        error
+}
+
+// ImportSource yields the rows of an import in order and io.EOF after the last one. Any other error aborts
+// the import.
+type ImportSource func() (ImportRow, error)
+
+type ImportOptions struct {
+	// Mode is BatchAtomic (default: nothing is stored unless every row succeeds) or BatchPartial (every
+	// row that succeeds is stored).
+	Mode BatchMode
+	// DryRun validates every row, including email clashes, and then discards the writes.
+	DryRun bool
+	// Upsert updates the live user with the row's email instead of failing with a conflict; the row's
+	// attributes are merged into the stored ones.
+	Upsert bool
+}
+
+// ImportError is the failure of one input line.
+type ImportError struct {
+	Line int
+	Err  error
+}
+
+// ImportReport summarizes an import. Created and Updated count rows that were (or, in a dry run or a
+// rolled back atomic import, would have been) applied.
+type ImportReport struct {
+	Mode      BatchMode
+	DryRun    bool
+	Committed bool // whether the changes were stored
+	Rows      int
+	Created   int
+	Updated   int
+	Failed    int
+	Errors    []ImportError // the first MaxImportErrors failures, in line order
+	touched   []uuid.UUID   // users written by a committed import, for cache invalidation
+}
+
+func (r *ImportReport) fail(line int, err error) {
+	r.Failed++
+	if len(r.Errors) < MaxImportErrors {
+		r.Errors = append(r.Errors, ImportError{Line: line, Err: err})
+	}
+}
+
+func (r *ImportReport) applied(c userChange) {
+	if c.typ == UserCreated {
+		r.Created++
+	} else {
+		r.Updated++
+	}
+	r.touched = append(r.touched, c.id)
+}
+
+func (s *userService) Export(ctx context.Context, f UserFilter, sort UserSort, fn func(*User) error) error {
+	sort = sort.Normalize()
+	if err := sort.Validate(); err != nil {
+		return err
+	}
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	f = f.Normalize()
+	if st, ok := s.repo.(UserStreamer); ok {
+		return st.StreamUsers(ctx, f, sort, fn)
+	}
+	// keyset pages keep memory bounded for repositories without a cursor
+	var after *Cursor
+	for {
+		users, err := s.repo.ListAfter(ctx, f, sort, after, exportChunk)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if len(users) < exportChunk {
+			return nil
+		}
+		after = CursorFor(users[len(users)-1], sort)
+	}
+}
+
+// errImportRolledBack ends the transaction of a dry run or of a failed atomic import.
+var errImportRolledBack = errors.New("import rolled back")
+
+// Import applies rows through the same validation as Create and Update. Atomic imports and dry runs run in one
+// transaction; a row that fails validation or clashes on email is reported and the remaining rows are still
+// checked, but a failed write ends the import there, as the transaction can no longer be used.
+func (s *userService) Import(ctx context.Context, next ImportSource, opts ImportOptions) (*ImportReport, error) {
+	switch opts.Mode {
+	case "":
+		opts.Mode = BatchAtomic
+	case BatchAtomic, BatchPartial:
+	default:
+		return nil, fmt.Errorf("unsupported import mode %q: %w", opts.Mode, ErrValidation)
+	}
+	report := &ImportReport{Mode: opts.Mode, DryRun: opts.DryRun}
+	if opts.Mode == BatchPartial && !opts.DryRun {
+		err := s.eachImportRow(next, report, func(row ImportRow) error {
+			var c userChange
+			err := s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+				var err error
+				if c, err = s.importRow(ctx, repo, row, opts.Upsert); err != nil {
+					return nil, err
+				}
+				return []userChange{c}, nil
+			})
+			if err == nil {
+				report.applied(c)
+			}
+			return err
+		}, func(error) bool { return true })
+		report.Committed = report.Created+report.Updated > 0
+		return report, err
+	}
+
+	var (
+		changes []userChange
+		events  []UserEvent
+	)
+	err := s.WithTx(ctx, func(ctx context.Context, uow UnitOfWork) error {
+		repo := uow.UserRepo()
+		err := s.eachImportRow(next, report, func(row ImportRow) error {
+			c, err := s.importRow(ctx, repo, row, opts.Upsert)
+			if err != nil {
+				return err
+			}
+			report.applied(c)
+			changes = append(changes, c)
+			return nil
+		}, isRowError)
+		if err != nil {
+			return err
+		}
+		if opts.DryRun || report.Failed > 0 {
+			return errImportRolledBack
+		}
+		events = changeEvents(ctx, changes)
+		return s.record(ctx, uow, changes, events)
+	})
+	switch {
+	case errors.Is(err, errImportRolledBack):
+		report.touched = nil
+		return report, nil
+	case err != nil:
+		report.touched = nil
+		return report, err
+	}
+	report.Committed = true
+	s.committed(ctx, changes, events)
+	return report, nil
+}
+
+// eachImportRow feeds the rows of next to apply, recording failures in report. A failure for which
+// keepGoing is false stops the import after being recorded.
+func (s *userService) eachImportRow(next ImportSource, report *ImportReport, apply func(ImportRow) error, keepGoing func(error) bool) error {
+	for {
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		report.Rows++
+		if row.Err != nil {
+			report.fail(row.Line, row.Err)
+			continue
+		}
+		if err := apply(row); err != nil {
+			report.fail(row.Line, err)
+			if !keepGoing(err) {
+				return nil
+			}
+		}
+	}
+}
+
+// isRowError reports whether err was found before anything was written, leaving the transaction usable.
+func isRowError(err error) bool {
+	return errors.Is(err, ErrValidation) || errors.Is(err, ErrConflict)
+}
+
+// importRow creates the row's user or, with upsert, updates the live user holding its email. The email is
+// checked up front so a clash is reported without a failed write.
+func (s *userService) importRow(ctx context.Context, repo UserRepository, row ImportRow, upsert bool) (userChange, error) {
+	email, err := normalizeEmail(row.Email)
+	if err != nil {
+		return userChange{}, err
+	}
+	var existing *User
+	if finder, ok := repo.(EmailFinder); ok {
+		existing, err = finder.GetByEmail(ctx, email)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return userChange{}, err
+		}
+	} else if upsert {
+		return userChange{}, errors.New("upsert not supported by the user repository")
+	}
+	if existing == nil {
+		u, err := s.newUser(row.Name, email, row.Attributes)
+		if err != nil {
+			return userChange{}, err
+		}
+		if err := repo.Create(ctx, u); err != nil {
+			return userChange{}, err
+		}
+		return userChange{typ: UserCreated, id: u.ID, after: u}, nil
+	}
+	if !upsert {
+		return userChange{}, &ConflictError{Field: "email", Value: email}
+	}
+	if strings.TrimSpace(row.Name) == "" {
+		return userChange{}, fmt.Errorf("name empty: %w", ErrValidation)
+	}
+	before, after, err := s.updateUser(ctx, repo, existing.ID, &row.Name, nil, row.Attributes, existing.Version)
+	if err != nil {
+		return userChange{}, err
+	}
+	return userChange{typ: UserUpdated, id: existing.ID, before: before, after: after}, nil
+}
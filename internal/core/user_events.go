@@ -0,0 +1,63 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+type UserEventType string
+
+const (
+	UserCreated  UserEventType = "user.created"
+	UserUpdated  UserEventType = "user.updated"
+	UserDeleted  UserEventType = "user.deleted"
+	UserRestored UserEventType = "user.restored"
+	UserPurged   UserEventType = "user.purged"
+	// UserStatusChanged is a lifecycle transition (see UserService.Transition).
+	UserStatusChanged UserEventType = "user.status_changed"
+)
+
+// ParseUserEventType accepts a full type ("user.created") or its short form ("created").
+func ParseUserEventType(s string) (UserEventType, error) {
+	t := UserEventType(strings.TrimSpace(s))
+	if !strings.HasPrefix(string(t), "user.") {
+		t = "user." + t
+	}
+	switch t {
+	case UserCreated, UserUpdated, UserDeleted, UserRestored, UserPurged, UserStatusChanged:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown event type %q: %w", s, ErrValidation)
+}
+
+// UserEvent is a domain event recorded in the outbox alongside the mutation that caused it.
+type UserEvent struct {
+	ID         uuid.UUID
+	Type       UserEventType
+	UserID     uuid.UUID
+	TenantID   string
+	User       *User // state after the change; nil for deletes and purges
+	OccurredAt time.Time
+}
+
+func NewUserEvent(t UserEventType, id uuid.UUID, u *User) UserEvent {
+	if u != nil {
+		cpy := *u
+		u = &cpy
+	}
+	return UserEvent{ID: uuid.New(), Type: t, UserID: id, User: u, OccurredAt: time.Now().UTC()}
+}
+
+// EventOutbox records events inside the caller's unit of work; they become visible to dispatchers on commit.
+type EventOutbox interface {
+	Append(ctx context.Context, events ...UserEvent) error
+}
+
+// UserEventNotifier is told about events after their change is committed, for in-process fan-out.
+// Notify is called on the request path and must not block.
+type UserEventNotifier interface {
+	Notify(events ...UserEvent)
+}
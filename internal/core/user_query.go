@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DeletedMode selects how soft-deleted users take part in a listing.
+type DeletedMode string
+
+const (
+	DeletedExclude DeletedMode = ""        // live users only (default)
+	DeletedInclude DeletedMode = "include" // live and soft-deleted users
+	DeletedOnly    DeletedMode = "only"    // soft-deleted users only
+)
+
+// UserFilter narrows user listings; the zero value matches every live user.
+// After bounds are inclusive and Before bounds exclusive.
+type UserFilter struct {
+	Deleted       DeletedMode `json:"dm,omitempty"`
+	NamePrefix    string      `json:"np,omitempty"`
+	EmailDomain   string      `json:"ed,omitempty"`
+	CreatedAfter  *time.Time  `json:"ca,omitempty"`
+	CreatedBefore *time.Time  `json:"cb,omitempty"`
+	UpdatedAfter  *time.Time  `json:"ua,omitempty"`
+	UpdatedBefore *time.Time  `json:"ub,omitempty"`
+	// Attributes match users whose top-level attribute equals the value, compared as text.
+	Attributes map[string]string `json:"at,omitempty"`
+	// Statuses matches users in any of the listed statuses; empty matches all.
+	Statuses []UserStatus `json:"st,omitempty"`
+}
+
+// Normalize trims and lower-cases the text predicates to match stored (normalized) emails.
+func (f UserFilter) Normalize() UserFilter {
+	f.NamePrefix = strings.TrimSpace(f.NamePrefix)
+	f.EmailDomain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(f.EmailDomain)), "@")
+	return f
+}
+
+func (f UserFilter) Validate() error {
+	switch f.Deleted {
+	case DeletedExclude, DeletedInclude, DeletedOnly:
+	default:
+		return fmt.Errorf("unsupported deleted mode %q: %w", f.Deleted, ErrValidation)
+	}
+	for _, st := range f.Statuses {
+		if _, ok := statusTransitions[st]; !ok {
+			return fmt.Errorf("unknown status %q: %w", st, ErrValidation)
+		}
+	}
+	return validateAttributeFilters(f.Attributes)
+}
+
+// Matches reports whether u satisfies every predicate in f.
+func (f UserFilter) Matches(u *User) bool {
+	switch f.Deleted {
+	case DeletedInclude:
+	case DeletedOnly:
+		if u.DeletedAt == nil {
+			return false
+		}
+	default:
+		if u.DeletedAt != nil {
+			return false
+		}
+	}
+	if f.NamePrefix != "" && !strings.HasPrefix(strings.ToLower(u.Name), strings.ToLower(f.NamePrefix)) {
+		return false
+	}
+	if f.EmailDomain != "" && !strings.HasSuffix(u.Email, "@"+f.EmailDomain) {
+		return false
+	}
+	if f.CreatedAfter != nil && u.CreatedAt.Before(*f.CreatedAfter) {
+		return false
+	}
+	if f.CreatedBefore != nil && !u.CreatedAt.Before(*f.CreatedBefore) {
+		return false
+	}
+	if f.UpdatedAfter != nil && u.UpdatedAt.Before(*f.UpdatedAfter) {
+		return false
+	}
+	if f.UpdatedBefore != nil && !u.UpdatedAt.Before(*f.UpdatedBefore) {
+		return false
+	}
+	for k, v := range f.Attributes {
+		if s, ok := attributeText(u.Attributes, k); !ok || s != v {
+			return false
+		}
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, u.Status) {
+		return false
+	}
+	return true
+}
+
+type UserSortField string
+
+const (
+	SortByCreatedAt UserSortField = "created_at"
+	SortByUpdatedAt UserSortField = "updated_at"
+	SortByName      UserSortField = "name"
+	SortByEmail     UserSortField = "email"
+)
+
+// UserSort orders listings; ties are always broken by id in the same direction.
+// The zero value means the default created_at DESC.
+type UserSort struct {
+	Field UserSortField `json:"f,omitempty"`
+	Desc  bool          `json:"d,omitempty"`
+}
+
+// DefaultUserSort is the historical listing order.
+var DefaultUserSort = UserSort{Field: SortByCreatedAt, Desc: true}
+
+// ParseUserSort parses "field" (ascending) or "-field" (descending); empty yields DefaultUserSort.
+func ParseUserSort(s string) (UserSort, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultUserSort, nil
+	}
+	out := UserSort{Field: UserSortField(strings.TrimPrefix(s, "-")), Desc: strings.HasPrefix(s, "-")}
+	if err := out.Validate(); err != nil {
+		return UserSort{}, err
+	}
+	return out, nil
+}
+
+func (s UserSort) Validate() error {
+	switch s.Field {
+	case SortByCreatedAt, SortByUpdatedAt, SortByName, SortByEmail:
+		return nil
+	default:
+		return fmt.Errorf("unsupported sort field %q: %w", s.Field, ErrValidation)
+	}
+}
+
+// Normalize maps the zero value to DefaultUserSort.
+func (s UserSort) Normalize() UserSort {
+	if s.Field == "" {
+		return DefaultUserSort
+	}
+	return s
+}
+
+func (s UserSort) String() string {
+	if s.Desc {
+		return "-" + string(s.Field)
+	}
+	return string(s.Field)
+}
+
+// sortKey renders the sort column of u in the form stored inside cursors.
+func (s UserSort) sortKey(u *User) string {
+	switch s.Field {
+	case SortByUpdatedAt:
+		return u.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case SortByName:
+		return u.Name
+	case SortByEmail:
+		return u.Email
+	default:
+		return u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// compareKey compares the sort column of u against a cursor key (-1, 0, 1), ignoring direction.
+func (s UserSort) compareKey(u *User, key string) int {
+	switch s.Field {
+	case SortByName, SortByEmail:
+		return strings.Compare(s.sortKey(u), key)
+	}
+	ts, _ := time.Parse(time.RFC3339Nano, key)
+	v := u.CreatedAt
+	if s.Field == SortByUpdatedAt {
+		v = u.UpdatedAt
+	}
+	return v.Compare(ts)
+}
+
+// Less reports whether a is listed before b under s.
+func (s UserSort) Less(a, b *User) bool {
+	return CursorFor(a, s).Precedes(b)
+}
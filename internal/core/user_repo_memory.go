@@ -1,86 +1,427 @@
 package core
 
 import (
-    "context"
-    "errors"
-    "sort"
-    "sync"
-    "time"
-    "github.com/google/uuid"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 // InMemoryUserRepo is a concurrency-safe in-memory implementation of UserRepository for local dev/testing without Postgres.
+// Like the Postgres repository it scopes every call to the tenant in the context.
 type InMemoryUserRepo struct {
-    mu    sync.RWMutex
-    users map[uuid.UUID]*User
+	mu    sync.RWMutex
+	users map[uuid.UUID]*User
+	order []*User // same pointers as users, kept in (created_at DESC, id DESC) list order
+	gen   uint64  // bumped on every write; lets BeginTx detect concurrent writers at commit
+
+	txMu       sync.Mutex           // serializes transactions so they never conflict with each other
+	events     []UserEvent          // outbox: committed, undelivered events, oldest first
+	dispatchMu sync.Mutex           // one ProcessEvents at a time, so delivery stays in order
+	audit      []AuditEntry         // audit log, oldest first
+	passwords  map[uuid.UUID]string // password hashes by user, outside the transactional snapshot
 }
 
 func NewInMemoryUserRepo() *InMemoryUserRepo {
-    return &InMemoryUserRepo{users: make(map[uuid.UUID]*User)}
-}
-
-func (r *InMemoryUserRepo) Create(_ context.Context, u *User) error {
-    r.mu.Lock(); defer r.mu.Unlock()
-    if _, exists := r.users[u.ID]; exists {
-        return errors.New("duplicate id")
-    }
-    // copy to avoid external mutation
-    cpy := *u
-    r.users[u.ID] = &cpy
-    return nil
-}
-
-func (r *InMemoryUserRepo) Get(_ context.Context, id uuid.UUID) (*User, error) {
-    r.mu.RLock(); defer r.mu.RUnlock()
-    u, ok := r.users[id]
-    if !ok || u.DeletedAt != nil {
-        return nil, ErrNotFound
-    }
-    cpy := *u
-    return &cpy, nil
-}
-
-func (r *InMemoryUserRepo) Update(_ context.Context, u *User) error {
-    r.mu.Lock(); defer r.mu.Unlock()
-    existing, ok := r.users[u.ID]
-    if !ok || existing.DeletedAt != nil {
-        return ErrNotFound
-    }
-    cpy := *u
-    r.users[u.ID] = &cpy
-    return nil
-}
-
-func (r *InMemoryUserRepo) Delete(_ context.Context, id uuid.UUID) error {
-    r.mu.Lock(); defer r.mu.Unlock()
-    u, ok := r.users[id]
-    if !ok || u.DeletedAt != nil {
-        return ErrNotFound
-    }
-    now := time.Now().UTC()
-    u.DeletedAt = &now
-    return nil
-}
-
-func (r *InMemoryUserRepo) List(_ context.Context, page, pageSize int) ([]*User, int, error) {
-    r.mu.RLock(); defer r.mu.RUnlock()
-    var list []*User
-    for _, u := range r.users {
-        if u.DeletedAt == nil {
-            cpy := *u
-            list = append(list, &cpy)
-        }
-    }
-    sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
-    total := len(list)
-    if pageSize <= 0 { pageSize = 50 }
-    if page <= 0 { page = 1 }
-    start := (page - 1) * pageSize
-    if start >= total { return []*User{}, total, nil }
-    end := start + pageSize
-    if end > total { end = total }
-    return list[start:end], total, nil
+	return &InMemoryUserRepo{users: make(map[uuid.UUID]*User)}
+}
+
+func (r *InMemoryUserRepo) Create(ctx context.Context, u *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.users[u.ID]; exists {
+		return errors.New("duplicate id")
+	}
+	u.TenantID = TenantFrom(ctx)
+	if err := r.checkEmailFree(u.TenantID, u.ID, u.Email); err != nil {
+		return err
+	}
+	r.insert(u)
+	r.gen++
+	return nil
+}
+
+// CreateMany implements BatchCreator: every user is checked before any is stored, so a failure writes nothing.
+func (r *InMemoryUserRepo) CreateMany(ctx context.Context, users []*User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant := TenantFrom(ctx)
+	seen := make(map[string]bool, len(users))
+	for _, u := range users {
+		if _, exists := r.users[u.ID]; exists {
+			return errors.New("duplicate id")
+		}
+		email := strings.ToLower(u.Email)
+		if seen[email] {
+			return &ConflictError{Field: "email", Value: u.Email}
+		}
+		seen[email] = true
+		if err := r.checkEmailFree(tenant, u.ID, u.Email); err != nil {
+			return err
+		}
+	}
+	for _, u := range users {
+		u.TenantID = tenant
+		r.insert(u)
+	}
+	r.gen++
+	return nil
+}
+
+func (r *InMemoryUserRepo) Get(ctx context.Context, id uuid.UUID) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	u, ok := r.lookup(ctx, id)
+	if !ok || u.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	cpy := *u
+	return &cpy, nil
+}
+
+func (r *InMemoryUserRepo) Update(ctx context.Context, u *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.lookup(ctx, u.ID)
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if existing.Version != u.Version {
+		return ErrStaleVersion
+	}
+	if err := r.checkEmailFree(existing.TenantID, u.ID, u.Email); err != nil {
+		return err
+	}
+	u.TenantID = existing.TenantID
+	u.Version++
+	// overwrite in place so the pointer held in order stays valid
+	*existing = *u
+	r.gen++
+	return nil
+}
+
+func (r *InMemoryUserRepo) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.lookup(ctx, id)
+	if !ok || u.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if expectedVersion != 0 && u.Version != expectedVersion {
+		return ErrStaleVersion
+	}
+	now := time.Now().UTC()
+	u.DeletedAt = &now
+	u.Version++
+	r.gen++
+	return nil
+}
+
+func (r *InMemoryUserRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.lookup(ctx, id)
+	if !ok || u.DeletedAt == nil {
+		return ErrNotFound
+	}
+	if err := r.checkEmailFree(u.TenantID, u.ID, u.Email); err != nil {
+		return err
+	}
+	u.DeletedAt = nil
+	u.UpdatedAt = time.Now().UTC()
+	u.Version++
+	r.gen++
+	return nil
+}
+
+func (r *InMemoryUserRepo) Purge(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.lookup(ctx, id)
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+	delete(r.passwords, id)
+	for i, o := range r.order {
+		if o == u {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	r.gen++
+	return nil
+}
+
+func (r *InMemoryUserRepo) List(ctx context.Context, f UserFilter, s UserSort, page, pageSize int) ([]*User, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+	if page <= 0 {
+		page = 1
+	}
+	list := r.matching(TenantFrom(ctx), f, s)
+	total := len(list)
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*User{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return copyUsers(list[start:end]), total, nil
+}
+
+func (r *InMemoryUserRepo) ListAfter(ctx context.Context, f UserFilter, s UserSort, after *Cursor, limit int) ([]*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if limit <= 0 {
+		limit = 20
+	}
+	list := r.matching(TenantFrom(ctx), f, s)
+	start := 0
+	if after != nil {
+		start = sort.Search(len(list), func(i int) bool { return after.Precedes(list[i]) })
+	}
+	end := start + limit
+	if end > len(list) {
+		end = len(list)
+	}
+	return copyUsers(list[start:end]), nil
+}
+
+// GetByEmail implements EmailFinder; email must be normalized.
+func (r *InMemoryUserRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant := TenantFrom(ctx)
+	for _, u := range r.users {
+		if u.TenantID == tenant && u.DeletedAt == nil && u.Email == email {
+			cpy := *u
+			return &cpy, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// PasswordHash implements CredentialRepository.
+func (r *InMemoryUserRepo) PasswordHash(ctx context.Context, id uuid.UUID) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if u, ok := r.lookup(ctx, id); !ok || u.DeletedAt != nil {
+		return "", ErrNotFound
+	}
+	return r.passwords[id], nil
+}
+
+// SetPasswordHash implements CredentialRepository.
+func (r *InMemoryUserRepo) SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.lookup(ctx, id); !ok || u.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if r.passwords == nil {
+		r.passwords = map[uuid.UUID]string{}
+	}
+	r.passwords[id] = hash
+	return nil
+}
+
+func (r *InMemoryUserRepo) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant := TenantFrom(ctx)
+	hits := []SearchHit{}
+	for _, u := range r.order {
+		if u.TenantID != tenant || u.DeletedAt != nil {
+			continue
+		}
+		if score := scoreUser(u, query); score > 0 {
+			cpy := *u
+			hits = append(hits, SearchHit{User: &cpy, Score: score})
+		}
+	}
+	rankHits(hits)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// matching returns the tenant's users satisfying f in list order; only non-default sorts pay for a re-sort.
+// Caller holds r.mu.
+func (r *InMemoryUserRepo) matching(tenant string, f UserFilter, s UserSort) []*User {
+	var list []*User
+	for _, u := range r.order {
+		if u.TenantID == tenant && f.Matches(u) {
+			list = append(list, u)
+		}
+	}
+	if s = s.Normalize(); s != DefaultUserSort {
+		sort.SliceStable(list, func(i, j int) bool { return s.Less(list[i], list[j]) })
+	}
+	return list
+}
+
+// lookup finds a user of the tenant in ctx, live or deleted. Caller holds r.mu.
+func (r *InMemoryUserRepo) lookup(ctx context.Context, id uuid.UUID) (*User, bool) {
+	u, ok := r.users[id]
+	if !ok || u.TenantID != TenantFrom(ctx) {
+		return nil, false
+	}
+	return u, true
+}
+
+// insert stores a copy of u (guarding against external mutation) at its list position. Caller holds r.mu.
+func (r *InMemoryUserRepo) insert(u *User) {
+	cpy := *u
+	if cpy.Status == "" {
+		cpy.Status, cpy.StatusChangedAt = StatusActive, cpy.CreatedAt // mirrors the column defaults
+	}
+	r.users[u.ID] = &cpy
+	i := sort.Search(len(r.order), func(i int) bool { return DefaultUserSort.Less(&cpy, r.order[i]) })
+	r.order = append(r.order, nil)
+	copy(r.order[i+1:], r.order[i:])
+	r.order[i] = &cpy
+}
+
+// checkEmailFree mirrors uq_users_tenant_email_live: emails are unique case-insensitively among a tenant's
+// live users. Caller holds r.mu.
+func (r *InMemoryUserRepo) checkEmailFree(tenant string, self uuid.UUID, email string) error {
+	for _, o := range r.users {
+		if o.TenantID == tenant && o.ID != self && o.DeletedAt == nil && strings.EqualFold(o.Email, email) {
+			return &ConflictError{Field: "email", Value: email}
+		}
+	}
+	return nil
+}
+
+func copyUsers(src []*User) []*User {
+	out := make([]*User, 0, len(src))
+	for _, u := range src {
+		cpy := *u
+		out = append(out, &cpy)
+	}
+	return out
+}
+
+// BeginTx implements TxStarter. Transactions are serialized and work on a private copy; Commit installs it
+// only if no write outside a transaction happened in the meantime (else ErrConflict).
+func (r *InMemoryUserRepo) BeginTx(_ context.Context) (UnitOfWork, error) {
+	r.txMu.Lock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	// the snapshot shares the audit log's backing array; the clipped capacity makes its first append copy
+	snap := &InMemoryUserRepo{users: make(map[uuid.UUID]*User, len(r.users)), order: make([]*User, 0, len(r.order)),
+		audit: r.audit[:len(r.audit):len(r.audit)]}
+	for _, u := range r.order {
+		cpy := *u
+		snap.users[cpy.ID] = &cpy
+		snap.order = append(snap.order, &cpy)
+	}
+	return &memUnitOfWork{parent: r, snap: snap, gen: r.gen}, nil
+}
+
+type memUnitOfWork struct {
+	parent, snap *InMemoryUserRepo
+	gen          uint64
+	done         bool
+}
+
+func (t *memUnitOfWork) UserRepo() UserRepository { return t.snap }
+func (t *memUnitOfWork) Outbox() EventOutbox      { return memOutbox{t.snap} }
+func (t *memUnitOfWork) Auditor() Auditor         { return t.snap }
+
+func (t *memUnitOfWork) Commit() error {
+	if t.done {
+		return errors.New("transaction already finished")
+	}
+	t.done = true
+	defer t.parent.txMu.Unlock()
+	t.parent.mu.Lock()
+	defer t.parent.mu.Unlock()
+	if t.parent.gen != t.gen {
+		return fmt.Errorf("concurrent modification: %w", ErrConflict)
+	}
+	t.snap.mu.Lock()
+	defer t.snap.mu.Unlock()
+	t.parent.users, t.parent.order = t.snap.users, t.snap.order
+	t.parent.events = append(t.parent.events, t.snap.events...)
+	t.parent.audit = t.snap.audit
+	t.parent.gen++
+	return nil
+}
+
+func (t *memUnitOfWork) Rollback() error {
+	if !t.done {
+		t.done = true
+		t.parent.txMu.Unlock()
+	}
+	return nil
+}
+
+// memOutbox buffers events on the transaction's snapshot until commit.
+type memOutbox struct{ snap *InMemoryUserRepo }
+
+func (o memOutbox) Append(_ context.Context, events ...UserEvent) error {
+	o.snap.mu.Lock()
+	defer o.snap.mu.Unlock()
+	o.snap.events = append(o.snap.events, events...)
+	return nil
+}
+
+// ProcessEvents hands up to limit undelivered events to fn, oldest first, and drops the first n that fn
+// reports delivered. fn runs without holding the repository lock.
+func (r *InMemoryUserRepo) ProcessEvents(ctx context.Context, limit int, fn func(context.Context, []UserEvent) (int, error)) (int, error) {
+	r.dispatchMu.Lock()
+	defer r.dispatchMu.Unlock()
+	r.mu.RLock()
+	batch := append([]UserEvent(nil), r.events[:min(limit, len(r.events))]...)
+	r.mu.RUnlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	n, err := fn(ctx, batch)
+	r.mu.Lock()
+	r.events = r.events[n:]
+	r.mu.Unlock()
+	return n, err
+}
+
+// Record implements Auditor. Inside a transaction it writes to the snapshot, installed on commit.
+func (r *InMemoryUserRepo) Record(_ context.Context, entries ...AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.audit = append(r.audit, entries...)
+	r.gen++
+	return nil
+}
+
+func (r *InMemoryUserRepo) History(ctx context.Context, userID uuid.UUID, limit int) ([]AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant := TenantFrom(ctx)
+	out := []AuditEntry{}
+	for i := len(r.audit) - 1; i >= 0 && (limit <= 0 || len(out) < limit); i-- {
+		if r.audit[i].UserID == userID && r.audit[i].TenantID == tenant {
+			out = append(out, r.audit[i])
+		}
+	}
+	return out, nil
 }
 
 // Ensure interface compliance
-var _ UserRepository = (*InMemoryUserRepo)(nil)
+var (
+	_ UserRepository = (*InMemoryUserRepo)(nil)
+	_ BatchCreator   = (*InMemoryUserRepo)(nil)
+	_ TxStarter      = (*InMemoryUserRepo)(nil)
+	_ Auditor        = (*InMemoryUserRepo)(nil)
+)
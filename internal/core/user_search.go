@@ -0,0 +1,92 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchHit is a ranked search match; higher scores rank first.
+type SearchHit struct {
+	User  *User   `json:"u"`
+	Score float64 `json:"s"`
+}
+
+// minSimilarity is the fuzzy cut-off; looser than pg_trgm's word_similarity_threshold (0.6) since single words are compared.
+const minSimilarity = 0.3
+
+// scoreUser is the in-memory stand-in for the Postgres ts_rank + trigram ranking.
+// Exact and prefix hits outrank substring hits, which outrank fuzzy (trigram) hits.
+func scoreUser(u *User, query string) float64 {
+	q := strings.ToLower(strings.TrimSpace(query))
+	best := 0.0
+	for _, field := range []string{strings.ToLower(u.Name), u.Email} {
+		var s float64
+		switch {
+		case field == q:
+			s = 1
+		case strings.HasPrefix(field, q):
+			s = 0.9
+		case strings.Contains(field, q):
+			s = 0.7
+		default:
+			if sim := wordSimilarity(q, field); sim >= minSimilarity {
+				s = sim * 0.7
+			}
+		}
+		if s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+func rankHits(hits []SearchHit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].User.Name < hits[j].User.Name
+	})
+}
+
+// wordSimilarity approximates pg_trgm word_similarity(): the best similarity between q and any single word of field.
+func wordSimilarity(q, field string) float64 {
+	best := 0.0
+	for _, w := range strings.FieldsFunc(field, isWordSep) {
+		if sim := trigramSimilarity(q, w); sim > best {
+			best = sim
+		}
+	}
+	return best
+}
+
+func isWordSep(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+
+// trigramSimilarity approximates pg_trgm similarity(): shared trigrams over the union of both sets.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// trigrams splits on non-alphanumerics and pads each word like pg_trgm ("  w" ... "d ").
+func trigrams(s string) map[string]struct{} {
+	out := map[string]struct{}{}
+	words := strings.FieldsFunc(strings.ToLower(s), isWordSep)
+	for _, w := range words {
+		rs := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(rs); i++ {
+			out[string(rs[i:i+3])] = struct{}{}
+		}
+	}
+	return out
+}
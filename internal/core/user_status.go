@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserStatus is where a user is in its lifecycle. It is independent of soft deletion: a deleted user keeps
+// its status and gets it back on restore.
+type UserStatus string
+
+const (
+	StatusInvited   UserStatus = "invited"   // created by an invite, not yet accepted
+	StatusActive    UserStatus = "active"    // the default for created users
+	StatusSuspended UserStatus = "suspended" // disabled by an operator
+	StatusLocked    UserStatus = "locked"    // disabled automatically, e.g. after failed logins
+)
+
+// statusTransitions lists the statuses each status may move to; anything else is an IllegalTransitionError.
+var statusTransitions = map[UserStatus][]UserStatus{
+	StatusInvited:   {StatusActive, StatusSuspended},
+	StatusActive:    {StatusSuspended, StatusLocked},
+	StatusSuspended: {StatusActive},
+	StatusLocked:    {StatusActive, StatusSuspended},
+}
+
+// ParseUserStatus validates s (case-insensitive).
+func ParseUserStatus(s string) (UserStatus, error) {
+	st := UserStatus(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := statusTransitions[st]; !ok {
+		return "", fmt.Errorf("unknown status %q: %w", s, ErrValidation)
+	}
+	return st, nil
+}
+
+// CanTransition reports whether a user in status from may move to status to.
+func CanTransition(from, to UserStatus) bool {
+	return slices.Contains(statusTransitions[from], to)
+}
+
+// IllegalTransitionError rejects a status change the state machine does not allow; it matches ErrConflict
+// via errors.Is, as the request conflicts with the user's current state.
+type IllegalTransitionError struct {
+	From, To UserStatus
+}
+
+func (e *IllegalTransitionError) Error() string {
+	return fmt.Sprintf("cannot move user from %s to %s", e.From, e.To)
+}
+
+func (e *IllegalTransitionError) Unwrap() error { return ErrConflict }
+
+// maxStatusReason bounds the free-text reason stored with a status change.
+const maxStatusReason = 500
+
+func (s *userService) Transition(ctx context.Context, id uuid.UUID, to UserStatus, reason string) (*User, error) {
+	if _, ok := statusTransitions[to]; !ok {
+		return nil, fmt.Errorf("unknown status %q: %w", to, ErrValidation)
+	}
+	reason = strings.TrimSpace(reason)
+	if len([]rune(reason)) > maxStatusReason {
+		return nil, fmt.Errorf("reason longer than %d characters: %w", maxStatusReason, ErrValidation)
+	}
+	var u *User
+	err := s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		var err error
+		if u, err = repo.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		if !CanTransition(u.Status, to) {
+			return nil, &IllegalTransitionError{From: u.Status, To: to}
+		}
+		before := *u
+		now := time.Now().UTC()
+		u.Status, u.StatusReason, u.StatusChangedAt = to, reason, now
+		u.UpdatedAt = now
+		if err := repo.Update(ctx, u); err != nil {
+			return nil, err
+		}
+		return []userChange{{typ: UserStatusChanged, id: id, before: &before, after: u}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (s *userService) Invite(ctx context.Context, name, email string, attrs Attributes) (*User, error) {
+	u, err := s.newUser(name, email, attrs)
+	if err != nil {
+		return nil, err
+	}
+	u.Status = StatusInvited
+	err = s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		if err := repo.Create(ctx, u); err != nil {
+			return nil, err
+		}
+		return []userChange{{typ: UserCreated, id: u.ID, after: u}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
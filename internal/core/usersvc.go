@@ -9,26 +9,169 @@ import (
 	"time"
 )
 
+// UserRepository implementations scope every call to the tenant in ctx (see TenantFrom): users of other
+// tenants behave as if they did not exist, and email uniqueness holds per tenant.
 type UserRepository interface {
 	Create(ctx context.Context, u *User) error
 	Get(ctx context.Context, id uuid.UUID) (*User, error)
+	// Update writes u only if the stored version still equals u.Version (else ErrStaleVersion) and increments u.Version.
 	Update(ctx context.Context, u *User) error
-	Delete(ctx context.Context, id uuid.UUID) error
-	List(ctx context.Context, page, pageSize int) ([]*User, int, error)
+	// Delete soft-deletes; a non-zero expectedVersion must match the stored version (else ErrStaleVersion).
+	Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error
+	// Restore clears deleted_at on a soft-deleted user; ErrNotFound unless the user exists and is deleted.
+	Restore(ctx context.Context, id uuid.UUID) error
+	// Purge permanently removes the user row, live or soft-deleted.
+	Purge(ctx context.Context, id uuid.UUID) error
+	List(ctx context.Context, f UserFilter, s UserSort, page, pageSize int) ([]*User, int, error)
+	// ListAfter returns up to limit users matching f in (sort column, id) order, starting after the cursor (nil = first page).
+	ListAfter(ctx context.Context, f UserFilter, s UserSort, after *Cursor, limit int) ([]*User, error)
+	// Search returns live users matching query by name or email, best match first.
+	Search(ctx context.Context, query string, limit int) ([]SearchHit, error)
 }
 
 type UserService interface {
-	Create(ctx context.Context, name, email string) (*User, error)
+	Create(ctx context.Context, name, email string, attrs Attributes) (*User, error)
 	Get(ctx context.Context, id uuid.UUID) (*User, error)
-	Update(ctx context.Context, id uuid.UUID, name *string, email *string) (*User, error)
-	Delete(ctx context.Context, id uuid.UUID) error
-	List(ctx context.Context, page, pageSize int) ([]*User, int, error)
+	// Update and Delete take the version the caller last saw; 0 skips the precondition.
+	// A concurrent write is still detected and reported as ErrStaleVersion.
+	// attrs is a merge patch (see MergeAttributes); nil leaves the attributes alone.
+	Update(ctx context.Context, id uuid.UUID, name *string, email *string, attrs Attributes, expectedVersion int64) (*User, error)
+	Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error
+	Restore(ctx context.Context, id uuid.UUID) (*User, error)
+	Purge(ctx context.Context, id uuid.UUID) error
+	List(ctx context.Context, f UserFilter, s UserSort, page, pageSize int) ([]*User, int, error)
+	// ListAfter pages with an opaque cursor; the returned next cursor is empty on the last page.
+	ListAfter(ctx context.Context, f UserFilter, s UserSort, cursor string, limit int) ([]*User, string, error)
+	Search(ctx context.Context, query string, limit int) ([]SearchHit, error)
+	// Batch applies up to MaxBatchSize operations. Atomic batches run in one transaction and stop at the first
+	// failing item (reported as *BatchItemError); partial batches apply every item they can and report each outcome.
+	Batch(ctx context.Context, ops []BatchOp, mode BatchMode) ([]BatchResult, error)
+	// Invite creates a user in the invited status; Create makes active users.
+	Invite(ctx context.Context, name, email string, attrs Attributes) (*User, error)
+	// Transition moves a live user to another status if the state machine allows it (see CanTransition);
+	// otherwise it fails with *IllegalTransitionError.
+	Transition(ctx context.Context, id uuid.UUID, to UserStatus, reason string) (*User, error)
+	// Export calls fn for every user matching f in sort order, streaming from the repository when it
+	// implements UserStreamer and paging through ListAfter otherwise.
+	Export(ctx context.Context, f UserFilter, sort UserSort, fn func(*User) error) error
+	// Import creates (or, with Upsert, updates) a user per row and reports the failing lines; see ImportOptions.
+	// The repository must implement TxStarter unless the import is partial and not a dry run.
+	Import(ctx context.Context, rows ImportSource, opts ImportOptions) (*ImportReport, error)
+	// VerifyEmail consumes a token sent on create or email change and stamps EmailVerifiedAt; a token for an
+	// address the user no longer has is ErrInvalidVerificationToken.
+	VerifyEmail(ctx context.Context, token string) (*User, error)
+	// History returns the user's audit trail, newest first; the repository must implement Auditor.
+	History(ctx context.Context, id uuid.UUID, limit int) ([]AuditEntry, error)
 	WithTx(ctx context.Context, fn func(context.Context, UnitOfWork) error) error
 }
 
-func NewUserService(r UserRepository) UserService { return &userService{repo: r} }
+func NewUserService(r UserRepository) UserService {
+	return NewUserServiceWithOpts(r, UserServiceOptions{})
+}
+
+type UserServiceOptions struct {
+	// Events writes a UserEvent to the outbox in the same transaction as every mutation.
+	// The repository must implement TxStarter.
+	Events bool
+	// Audit records an AuditEntry for every mutation in the same transaction. The repository must
+	// implement TxStarter, and its units of work an Auditor.
+	Audit bool
+	// Notifier, if set, is told about every committed change, e.g. to feed live event streams.
+	Notifier UserEventNotifier
+	// Attributes, if set, validates the attributes of every created or updated user.
+	Attributes AttributeValidator
+	// Verification, with VerificationSender, sends a verification token for every created user and changed
+	// email; VerifyEmail consumes it. Without it VerifyEmail fails.
+	Verification       *VerificationTokens
+	VerificationSender VerificationSender
+}
 
-type userService struct{ repo UserRepository }
+func NewUserServiceWithOpts(r UserRepository, opts UserServiceOptions) UserService {
+	return &userService{repo: r, opts: opts}
+}
+
+type userService struct {
+	repo UserRepository
+	opts UserServiceOptions
+}
+
+// userChange is one applied mutation; it yields both the outbox event and the audit entry.
+type userChange struct {
+	typ           UserEventType
+	id            uuid.UUID
+	before, after *User // after is nil for purges; before only needs to be loaded when auditing
+}
+
+// mutate runs fn against the repository and, with events or auditing enabled, records the changes it
+// returns atomically with its writes. Committed changes are then handed to committed.
+func (s *userService) mutate(ctx context.Context, fn func(context.Context, UserRepository) ([]userChange, error)) error {
+	var (
+		changes []userChange
+		events  []UserEvent
+	)
+	if !s.opts.Events && !s.opts.Audit {
+		var err error
+		if changes, err = fn(ctx, s.repo); err != nil {
+			return err
+		}
+		events = changeEvents(ctx, changes)
+	} else {
+		err := s.WithTx(ctx, func(ctx context.Context, uow UnitOfWork) error {
+			var err error
+			if changes, err = fn(ctx, uow.UserRepo()); err != nil {
+				return err
+			}
+			events = changeEvents(ctx, changes)
+			return s.record(ctx, uow, changes, events)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	s.committed(ctx, changes, events)
+	return nil
+}
+
+// changeEvents derives the event of each change; the same events go to the outbox and the notifier.
+func changeEvents(ctx context.Context, changes []userChange) []UserEvent {
+	tenant := TenantFrom(ctx)
+	events := make([]UserEvent, 0, len(changes))
+	for _, c := range changes {
+		u := c.after
+		if c.typ == UserDeleted {
+			u = nil
+		}
+		e := NewUserEvent(c.typ, c.id, u)
+		e.TenantID = tenant
+		events = append(events, e)
+	}
+	return events
+}
+
+// record appends the outbox events and audit entries for changes to the unit of work, as configured.
+func (s *userService) record(ctx context.Context, uow UnitOfWork, changes []userChange, events []UserEvent) error {
+	if s.opts.Events {
+		if err := uow.Outbox().Append(ctx, events...); err != nil {
+			return err
+		}
+	}
+	if s.opts.Audit {
+		entries := make([]AuditEntry, 0, len(changes))
+		for _, c := range changes {
+			entries = append(entries, NewAuditEntry(ctx, c.typ, c.id, c.before, c.after))
+		}
+		return uow.Auditor().Record(ctx, entries...)
+	}
+	return nil
+}
+
+// committed runs the side effects of changes once they are stored: live notifications and verification mails.
+func (s *userService) committed(ctx context.Context, changes []userChange, events []UserEvent) {
+	if s.opts.Notifier != nil && len(events) > 0 {
+		s.opts.Notifier.Notify(events...)
+	}
+	s.sendVerifications(ctx, changes)
+}
 
 func normalizeEmail(e string) (string, error) {
 	e = strings.TrimSpace(strings.ToLower(e))
@@ -41,7 +184,25 @@ func normalizeEmail(e string) (string, error) {
 	return e, nil
 }
 
-func (s *userService) Create(ctx context.Context, name, email string) (*User, error) {
+func (s *userService) Create(ctx context.Context, name, email string, attrs Attributes) (*User, error) {
+	u, err := s.newUser(name, email, attrs)
+	if err != nil {
+		return nil, err
+	}
+	err = s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		if err := repo.Create(ctx, u); err != nil {
+			return nil, err
+		}
+		return []userChange{{typ: UserCreated, id: u.ID, after: u}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// newUser validates and normalizes the input of a create without storing anything.
+func (s *userService) newUser(name, email string, attrs Attributes) (*User, error) {
 	if strings.TrimSpace(name) == "" {
 		return nil, fmt.Errorf("name empty: %w", ErrValidation)
 	}
@@ -49,47 +210,191 @@ func (s *userService) Create(ctx context.Context, name, email string) (*User, er
 	if err != nil {
 		return nil, err
 	}
-	now := time.Now().UTC()
-	u := &User{ID: uuid.New(), Name: strings.TrimSpace(name), Email: ne, CreatedAt: now, UpdatedAt: now}
-	if err := s.repo.Create(ctx, u); err != nil {
+	if attrs, err = validateAttributes(s.opts.Attributes, attrs); err != nil {
 		return nil, err
 	}
-	return u, nil
+	now := time.Now().UTC()
+	return &User{ID: uuid.New(), Name: strings.TrimSpace(name), Email: ne, CreatedAt: now, UpdatedAt: now, Version: 1, Attributes: attrs,
+		Status: StatusActive, StatusChangedAt: now}, nil
 }
 
 func (s *userService) Get(ctx context.Context, id uuid.UUID) (*User, error) {
 	return s.repo.Get(ctx, id)
 }
 
-func (s *userService) Update(ctx context.Context, id uuid.UUID, name *string, email *string) (*User, error) {
-	u, err := s.repo.Get(ctx, id)
+func (s *userService) Update(ctx context.Context, id uuid.UUID, name *string, email *string, attrs Attributes, expectedVersion int64) (*User, error) {
+	var u *User
+	err := s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		var (
+			before *User
+			err    error
+		)
+		if before, u, err = s.updateUser(ctx, repo, id, name, email, attrs, expectedVersion); err != nil {
+			return nil, err
+		}
+		return []userChange{{typ: UserUpdated, id: u.ID, before: before, after: u}}, nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return u, nil
+}
+
+// updateUser is Update against an explicit repository so batches can run it inside a unit of work.
+// It returns the user as it was before the update and after it.
+func (s *userService) updateUser(ctx context.Context, repo UserRepository, id uuid.UUID, name *string, email *string, attrs Attributes, expectedVersion int64) (*User, *User, error) {
+	u, err := repo.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if expectedVersion != 0 && u.Version != expectedVersion {
+		return nil, nil, ErrStaleVersion
+	}
+	before := *u
 	if name != nil {
 		if strings.TrimSpace(*name) == "" {
-			return nil, fmt.Errorf("name empty: %w", ErrValidation)
+			return nil, nil, fmt.Errorf("name empty: %w", ErrValidation)
 		}
 		u.Name = strings.TrimSpace(*name)
 	}
 	if email != nil {
 		ne, err := normalizeEmail(*email)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if ne != u.Email {
+			u.EmailVerifiedAt = nil // the new address is unconfirmed
 		}
 		u.Email = ne
 	}
+	if attrs != nil {
+		if u.Attributes, err = validateAttributes(s.opts.Attributes, MergeAttributes(u.Attributes, attrs)); err != nil {
+			return nil, nil, err
+		}
+	}
 	u.UpdatedAt = time.Now().UTC()
-	if err := s.repo.Update(ctx, u); err != nil {
+	if err := repo.Update(ctx, u); err != nil {
+		return nil, nil, err
+	}
+	return &before, u, nil
+}
+
+// deleteUser is Delete against an explicit repository. With loadBefore the user is read first so the
+// change carries a before/after pair for the audit diff.
+func deleteUser(ctx context.Context, repo UserRepository, id uuid.UUID, expectedVersion int64, loadBefore bool) (userChange, error) {
+	c := userChange{typ: UserDeleted, id: id}
+	if loadBefore {
+		before, err := repo.Get(ctx, id)
+		if err != nil {
+			return c, err
+		}
+		after := *before
+		now := time.Now().UTC()
+		after.DeletedAt = &now
+		c.before, c.after = before, &after
+	}
+	return c, repo.Delete(ctx, id, expectedVersion)
+}
+
+func (s *userService) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	return s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		c, err := deleteUser(ctx, repo, id, expectedVersion, s.opts.Audit)
+		if err != nil {
+			return nil, err
+		}
+		return []userChange{c}, nil
+	})
+}
+
+func (s *userService) Restore(ctx context.Context, id uuid.UUID) (*User, error) {
+	var u *User
+	err := s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		if err := repo.Restore(ctx, id); err != nil {
+			return nil, err
+		}
+		var err error
+		if u, err = repo.Get(ctx, id); err != nil {
+			return nil, err
+		}
+		return []userChange{{typ: UserRestored, id: id, after: u}}, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	return u, nil
 }
 
-func (s *userService) Delete(ctx context.Context, id uuid.UUID) error { return s.repo.Delete(ctx, id) }
+func (s *userService) Purge(ctx context.Context, id uuid.UUID) error {
+	return s.mutate(ctx, func(ctx context.Context, repo UserRepository) ([]userChange, error) {
+		if err := repo.Purge(ctx, id); err != nil {
+			return nil, err
+		}
+		return []userChange{{typ: UserPurged, id: id}}, nil
+	})
+}
+
+func (s *userService) List(ctx context.Context, f UserFilter, sort UserSort, page, pageSize int) ([]*User, int, error) {
+	sort = sort.Normalize()
+	if err := sort.Validate(); err != nil {
+		return nil, 0, err
+	}
+	if err := f.Validate(); err != nil {
+		return nil, 0, err
+	}
+	return s.repo.List(ctx, f.Normalize(), sort, page, pageSize)
+}
+
+func (s *userService) ListAfter(ctx context.Context, f UserFilter, sort UserSort, cursor string, limit int) ([]*User, string, error) {
+	sort = sort.Normalize()
+	if err := sort.Validate(); err != nil {
+		return nil, "", err
+	}
+	if err := f.Validate(); err != nil {
+		return nil, "", err
+	}
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if after != nil && after.Sort != sort {
+		return nil, "", fmt.Errorf("cursor was issued for sort %q: %w", after.Sort, ErrValidation)
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	// fetch one extra row to learn whether another page exists
+	users, err := s.repo.ListAfter(ctx, f.Normalize(), sort, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	var next string
+	if len(users) > limit {
+		users = users[:limit]
+		next = EncodeCursor(CursorFor(users[limit-1], sort))
+	}
+	return users, next, nil
+}
+
+func (s *userService) Search(ctx context.Context, query string, limit int) ([]SearchHit, error) {
+	query = strings.TrimSpace(query)
+	if len([]rune(query)) < 2 {
+		return nil, fmt.Errorf("search query must be at least 2 characters: %w", ErrValidation)
+	}
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	return s.repo.Search(ctx, query, limit)
+}
 
-func (s *userService) List(ctx context.Context, page, pageSize int) ([]*User, int, error) {
-	return s.repo.List(ctx, page, pageSize)
+func (s *userService) History(ctx context.Context, id uuid.UUID, limit int) ([]AuditEntry, error) {
+	a, ok := s.repo.(Auditor)
+	if !ok {
+		return nil, fmt.Errorf("audit log not supported")
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return a.History(ctx, id, limit)
 }
 
 func (s *userService) WithTx(ctx context.Context, fn func(context.Context, UnitOfWork) error) error {
@@ -119,6 +424,8 @@ func (s *userService) WithTx(ctx context.Context, fn func(context.Context, UnitO
 
 type UnitOfWork interface {
 	UserRepo() UserRepository
+	Outbox() EventOutbox
+	Auditor() Auditor
 	Commit() error
 	Rollback() error
 }
@@ -14,7 +14,29 @@ func HTTPStatus(err error) int {
 		return http.StatusConflict
 	case errors.Is(err, core.ErrValidation):
 		return http.StatusBadRequest
+	case errors.Is(err, core.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, core.ErrLimitExceeded):
+		return http.StatusTooManyRequests
 	default:
 		return http.StatusInternalServerError
 	}
 }
+
+// Code is a stable machine-readable name for a status, used where no HTTP status line exists (GraphQL errors).
+func Code(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusConflict:
+		return "CONFLICT"
+	case http.StatusBadRequest:
+		return "BAD_REQUEST"
+	case http.StatusForbidden:
+		return "FORBIDDEN"
+	case http.StatusTooManyRequests:
+		return "TOO_MANY_REQUESTS"
+	default:
+		return "INTERNAL"
+	}
+}
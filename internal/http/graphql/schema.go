@@ -41,7 +41,7 @@ func BuildSchema(userSvc core.UserService) (graphql.Schema, error) {
 					if pageSize == 0 {
 						pageSize = 20
 					}
-					users, _, err := userSvc.List(p.Context, page, pageSize)
+					users, _, err := userSvc.List(p.Context, core.UserFilter{}, core.UserSort{}, page, pageSize)
 					if err != nil {
 						return nil, err
 					}
@@ -86,7 +86,7 @@ func BuildSchema(userSvc core.UserService) (graphql.Schema, error) {
 				Resolve: func(p graphql.ResolveParams) (any, error) {
 					name := p.Args["name"].(string)
 					email := p.Args["email"].(string)
-					u, err := userSvc.Create(p.Context, name, email)
+					u, err := userSvc.Create(p.Context, name, email, nil)
 					if err != nil {
 						return nil, err
 					}
@@ -113,7 +113,7 @@ func BuildSchema(userSvc core.UserService) (graphql.Schema, error) {
 					if v, ok := p.Args["email"].(string); ok {
 						emailPtr = &v
 					}
-					u, err := userSvc.Update(p.Context, uid, namePtr, emailPtr)
+					u, err := userSvc.Update(p.Context, uid, namePtr, emailPtr, nil, 0)
 					if err != nil {
 						return nil, err
 					}
@@ -131,7 +131,7 @@ func BuildSchema(userSvc core.UserService) (graphql.Schema, error) {
 					if err != nil {
 						return nil, err
 					}
-					if err := userSvc.Delete(p.Context, uid); err != nil {
+					if err := userSvc.Delete(p.Context, uid, 0); err != nil {
 						return nil, err
 					}
 					return true, nil
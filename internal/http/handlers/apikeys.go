@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+// defaultRotateGrace is how long a rotated-out key keeps working when the request names no grace.
+const defaultRotateGrace = 24 * time.Hour
+
+type APIKeyHandler struct{ svc apikey.Service }
+
+func NewAPIKeyHandler(svc apikey.Service) *APIKeyHandler { return &APIKeyHandler{svc: svc} }
+
+// Register mounts the key management routes under /admin; they need the admin scope.
+func (h *APIKeyHandler) Register(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireScope(core.ScopeAdmin))
+		r.Get("/admin/keys", h.list)
+		r.Post("/admin/keys", h.mint)
+		r.Get("/admin/keys/{id}", h.get)
+		r.Post("/admin/keys/{id}:revoke", h.revoke)
+		r.Post("/admin/keys/{id}:rotate", h.rotate)
+	})
+}
+
+// apiKeyDTO never includes the secret except in the mint and rotate responses.
+type apiKeyDTO struct {
+	ID         uuid.UUID    `json:"id"`
+	Name       string       `json:"name"`
+	Owner      string       `json:"owner,omitempty"`
+	Prefix     string       `json:"prefix"`
+	Secret     string       `json:"secret,omitempty"`
+	Scopes     []core.Scope `json:"scopes"`
+	Status     string       `json:"status"`
+	Deprecated bool         `json:"deprecated"`
+	CreatedAt  string       `json:"created_at"`
+	ExpiresAt  *string      `json:"expires_at,omitempty"`
+	RevokedAt  *string      `json:"revoked_at,omitempty"`
+	LastUsedAt *string      `json:"last_used_at,omitempty"`
+	ReplacedBy *uuid.UUID   `json:"replaced_by,omitempty"`
+}
+
+type mintKeyReq struct {
+	Name      string       `json:"name"`
+	Owner     string       `json:"owner"`
+	Scopes    []core.Scope `json:"scopes"`
+	ExpiresAt *time.Time   `json:"expires_at"`
+}
+
+type rotateKeyReq struct {
+	Grace     string     `json:"grace"` // Go duration, default 24h
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (h *APIKeyHandler) mint(w http.ResponseWriter, r *http.Request) {
+	var req mintKeyReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	k, secret, err := h.svc.Mint(r.Context(), apikey.MintRequest{Name: req.Name, Owner: req.Owner, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt})
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Mint Failed", err.Error())
+		return
+	}
+	writeSecretKey(w, r, k, secret)
+}
+
+func (h *APIKeyHandler) list(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.svc.List(r.Context())
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "List Failed", err.Error())
+		return
+	}
+	now := time.Now()
+	out := make([]apiKeyDTO, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, toAPIKeyDTO(k, now))
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"data": out})
+}
+
+func (h *APIKeyHandler) get(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	k, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Get Failed", err.Error())
+		return
+	}
+	render.JSON(w, r, http.StatusOK, toAPIKeyDTO(k, time.Now()))
+}
+
+func (h *APIKeyHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	k, err := h.svc.Revoke(r.Context(), id)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Revoke Failed", err.Error())
+		return
+	}
+	render.JSON(w, r, http.StatusOK, toAPIKeyDTO(k, time.Now()))
+}
+
+// rotate mints the successor of a key; the body is optional.
+func (h *APIKeyHandler) rotate(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	var req rotateKeyReq
+	if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	grace := defaultRotateGrace
+	if req.Grace != "" {
+		if grace, err = time.ParseDuration(req.Grace); err != nil {
+			render.Problem(w, r, http.StatusBadRequest, "Invalid Grace", fmt.Sprintf("grace: %v", err))
+			return
+		}
+	}
+	k, secret, err := h.svc.Rotate(r.Context(), id, grace, req.ExpiresAt)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Rotate Failed", err.Error())
+		return
+	}
+	writeSecretKey(w, r, k, secret)
+}
+
+// writeSecretKey answers 201 with the key and its secret, which must not be cached anywhere on the way.
+func writeSecretKey(w http.ResponseWriter, r *http.Request, k *apikey.Key, secret string) {
+	dto := toAPIKeyDTO(k, time.Now())
+	dto.Secret = secret
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, r, http.StatusCreated, dto)
+}
+
+func toAPIKeyDTO(k *apikey.Key, now time.Time) apiKeyDTO {
+	scopes := k.Scopes
+	if scopes == nil {
+		scopes = []core.Scope{}
+	}
+	return apiKeyDTO{ID: k.ID, Name: k.Name, Owner: k.Owner, Prefix: k.Prefix, Scopes: scopes, Status: k.Status(now),
+		Deprecated: k.Deprecated(), CreatedAt: k.CreatedAt.Format(time.RFC3339), ExpiresAt: formatTimePtr(k.ExpiresAt),
+		RevokedAt: formatTimePtr(k.RevokedAt), LastUsedAt: formatTimePtr(k.LastUsedAt), ReplacedBy: k.ReplacedBy}
+}
+
+func formatTimePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/auth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+// AuthHandler serves password sign-in for end users. Session-bound routes need the token in
+// middleware.SessionHeader, which middleware.SessionAuth resolves to the end user.
+type AuthHandler struct {
+	svc      auth.Service
+	users    core.UserService
+	validate *validator.Validate
+}
+
+func NewAuthHandler(svc auth.Service, users core.UserService) *AuthHandler {
+	return &AuthHandler{svc: svc, users: users, validate: validator.New()}
+}
+
+func (h *AuthHandler) Register(r chi.Router) {
+	// signing in and reading the user only need read access; anything that sets a password needs write
+	read := r.With(middleware.RequireScope(core.ScopeUsersRead))
+	write := r.With(middleware.RequireScope(core.ScopeUsersWrite))
+	read.Post("/auth/login", h.login)
+	read.Post("/auth/logout", h.logout)
+	read.Get("/auth/me", h.me)
+	write.Post("/auth/password", h.changePassword)
+	write.Post("/auth/password-reset", h.requestReset)
+	write.Post("/auth/password-reset/confirm", h.confirmReset)
+	write.Put("/users/{id}/password", h.setPassword)
+}
+
+type loginReq struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type loginResp struct {
+	Token     string  `json:"token"`
+	ExpiresAt string  `json:"expires_at"`
+	User      userDTO `json:"user"`
+}
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+type setPasswordReq struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type resetRequestReq struct {
+	Email string `json:"email" validate:"required"`
+}
+
+type resetConfirmReq struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// authStatus maps sign-in failures onto 401/403 and everything else as usual.
+func authStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrAccountDisabled):
+		return http.StatusForbidden
+	default:
+		return errs.HTTPStatus(err)
+	}
+}
+
+// decode reads and validates a JSON body; on failure the problem has been written and ok is false.
+func (h *AuthHandler) decode(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := decodeJSON(w, r, dst); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Invalid JSON", err.Error())
+		return false
+	}
+	if err := h.validate.Struct(dst); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Validation Error", err.Error())
+		return false
+	}
+	return true
+}
+
+// endUser returns the signed-in end user; without a session it writes a 401 and ok is false.
+func endUser(w http.ResponseWriter, r *http.Request) (id uuid.UUID, ok bool) {
+	id, ok = core.EndUserFrom(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Session realm=api")
+		render.Problem(w, r, http.StatusUnauthorized, "Not Signed In", "send a session token in "+middleware.SessionHeader)
+	}
+	return id, ok
+}
+
+func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
+	var req loginReq
+	if !h.decode(w, r, &req) {
+		return
+	}
+	token, sess, u, err := h.svc.Login(r.Context(), req.Email, req.Password)
+	if err != nil {
+		render.Problem(w, r, authStatus(err), "Login Failed", err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, r, http.StatusOK, loginResp{Token: token, ExpiresAt: sess.ExpiresAt.Format(time.RFC3339), User: toDTO(u)})
+}
+
+func (h *AuthHandler) logout(w http.ResponseWriter, r *http.Request) {
+	if _, ok := endUser(w, r); !ok {
+		return
+	}
+	if err := h.svc.Logout(r.Context(), r.Header.Get(middleware.SessionHeader)); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Logout Failed", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) me(w http.ResponseWriter, r *http.Request) {
+	id, ok := endUser(w, r)
+	if !ok {
+		return
+	}
+	u, err := h.users.Get(r.Context(), id)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Get Failed", err.Error())
+		return
+	}
+	w.Header().Set("ETag", userETag(u))
+	render.JSON(w, r, http.StatusOK, toDTO(u))
+}
+
+// changePassword sets the signed-in user's password; every session of theirs ends, this one included.
+func (h *AuthHandler) changePassword(w http.ResponseWriter, r *http.Request) {
+	id, ok := endUser(w, r)
+	if !ok {
+		return
+	}
+	var req changePasswordReq
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if err := h.svc.ChangePassword(r.Context(), id, req.CurrentPassword, req.NewPassword); err != nil {
+		render.Problem(w, r, authStatus(err), "Password Change Failed", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setPassword lets the application set any user's password; a signed-in end user may only set their own.
+func (h *AuthHandler) setPassword(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	if caller, ok := core.EndUserFrom(r.Context()); ok && caller != id {
+		render.Problem(w, r, http.StatusForbidden, "Forbidden", "end users can only set their own password; use /v1/auth/password")
+		return
+	}
+	var req setPasswordReq
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if err := h.svc.SetPassword(r.Context(), id, req.Password); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Password Change Failed", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestReset always answers 202, whether or not the email belongs to a user.
+func (h *AuthHandler) requestReset(w http.ResponseWriter, r *http.Request) {
+	var req resetRequestReq
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if err := h.svc.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Password Reset Failed", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AuthHandler) confirmReset(w http.ResponseWriter, r *http.Request) {
+	var req resetConfirmReq
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if err := h.svc.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Password Reset Failed", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
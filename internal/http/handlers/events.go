@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+	"github.com/hex-zero/MaxwellGoSpine/internal/outbox"
+)
+
+// EventSource is the CloudEvents source of streamed events, matching the outbox dispatcher's default.
+const EventSource = "/maxwell/users"
+
+// EventsHandler serves the live user change stream as Server-Sent Events.
+type EventsHandler struct {
+	broker *broker.Broker
+	opts   EventsHandlerOptions
+}
+
+type EventsHandlerOptions struct {
+	Keepalive time.Duration // interval of comment lines that keep idle connections open (default 15s)
+}
+
+func NewEventsHandler(b *broker.Broker) *EventsHandler {
+	return NewEventsHandlerWithOpts(b, EventsHandlerOptions{})
+}
+
+func NewEventsHandlerWithOpts(b *broker.Broker, opts EventsHandlerOptions) *EventsHandler {
+	if opts.Keepalive <= 0 {
+		opts.Keepalive = 15 * time.Second
+	}
+	return &EventsHandler{broker: b, opts: opts}
+}
+
+func (h *EventsHandler) Register(r chi.Router) {
+	r.With(middleware.RequireScope(core.ScopeUsersRead)).Get("/users/events", h.stream)
+}
+
+// stream sends each committed user change as an SSE message: id is the broker sequence, event the type and
+// data the CloudEvent JSON; only changes of the caller's tenant are sent. ?types= filters by type (short or full names, comma separated). A client resuming
+// with Last-Event-ID gets the buffered events it missed; if some are gone it first receives a "reset" event
+// and should refetch its state.
+func (h *EventsHandler) stream(w http.ResponseWriter, r *http.Request) {
+	if !middleware.AcceptsEventStream(r) {
+		render.Problem(w, r, http.StatusNotAcceptable, "Not Acceptable", "send Accept: text/event-stream")
+		return
+	}
+	var types []core.UserEventType
+	if v := r.URL.Query().Get("types"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			t, err := core.ParseUserEventType(s)
+			if err != nil {
+				render.Problem(w, r, http.StatusBadRequest, "Invalid Types", err.Error())
+				return
+			}
+			types = append(types, t)
+		}
+	}
+	var after uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		var err error
+		if after, err = strconv.ParseUint(v, 10, 64); err != nil {
+			render.Problem(w, r, http.StatusBadRequest, "Invalid Last-Event-ID", err.Error())
+			return
+		}
+	}
+
+	sub, replay, complete := h.broker.Subscribe(core.TenantFrom(r.Context()), types, after)
+	defer sub.Close()
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{}) // the server's WriteTimeout would otherwise cut the stream
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, "retry: 3000\n\n")
+	if !complete {
+		_, _ = io.WriteString(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, ev := range replay {
+		writeSSE(w, ev)
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(h.opts.Keepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				return // dropped as too slow; the client reconnects with Last-Event-ID
+			}
+			writeSSE(w, ev)
+		case <-keepalive.C:
+			_, _ = io.WriteString(w, ": keepalive\n\n")
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w io.Writer, ev broker.Event) {
+	data, _ := json.Marshal(outbox.NewCloudEvent(EventSource, ev.UserEvent))
+	_, _ = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+}
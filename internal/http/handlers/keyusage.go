@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+type KeyUsageHandlerOptions struct {
+	// StaticKeys describe the env-var keys; each is reported to the tenant it is bound to.
+	StaticKeys []keyusage.KeyInfo
+	// Managed lists minted keys; nil reports env-var keys only.
+	Managed apikey.Service
+	// ExpiringWithin flags keys expiring that soon (default 7 days); ?expiring_within overrides it.
+	ExpiringWithin time.Duration
+}
+
+type KeyUsageHandler struct {
+	usage *keyusage.Tracker
+	opts  KeyUsageHandlerOptions
+}
+
+func NewKeyUsageHandler(usage *keyusage.Tracker, opts KeyUsageHandlerOptions) *KeyUsageHandler {
+	if opts.ExpiringWithin <= 0 {
+		opts.ExpiringWithin = 7 * 24 * time.Hour
+	}
+	return &KeyUsageHandler{usage: usage, opts: opts}
+}
+
+// Register mounts the usage report; it needs the admin scope.
+func (h *KeyUsageHandler) Register(r chi.Router) {
+	r.With(middleware.RequireScope(core.ScopeAdmin)).Get("/admin/keys/usage", h.report)
+}
+
+type keyUsageDTO struct {
+	KeyID         string           `json:"key_id"`
+	Name          string           `json:"name,omitempty"`
+	Source        string           `json:"source"` // env, managed or unknown
+	Deprecated    bool             `json:"deprecated"`
+	Revoked       bool             `json:"revoked,omitempty"`
+	ExpiresAt     *string          `json:"expires_at,omitempty"`
+	ExpiringSoon  bool             `json:"expiring_soon"`
+	Attention     bool             `json:"attention"`
+	Requests      int64            `json:"requests"`
+	Errors        int64            `json:"errors"`
+	LastUsedAt    *string          `json:"last_used_at,omitempty"`
+	LastIP        string           `json:"last_ip,omitempty"`
+	LastUserAgent string           `json:"last_user_agent,omitempty"`
+	Routes        map[string]int64 `json:"routes"`
+}
+
+// report lists every key of the tenant with its usage, keys that are deprecated or expire soon first.
+func (h *KeyUsageHandler) report(w http.ResponseWriter, r *http.Request) {
+	within := h.opts.ExpiringWithin
+	if v := r.URL.Query().Get("expiring_within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			render.Problem(w, r, http.StatusBadRequest, "Invalid Query", fmt.Sprintf("expiring_within: expected a duration, got %q", v))
+			return
+		}
+		within = d
+	}
+	ctx := r.Context()
+	keys, err := h.knownKeys(r)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Report Failed", err.Error())
+		return
+	}
+	usage, err := h.usage.Usage(ctx, core.TenantFrom(ctx))
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Report Failed", err.Error())
+		return
+	}
+	entries := keyusage.BuildReport(usage, keys, time.Now(), within)
+	out := make([]keyUsageDTO, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, toKeyUsageDTO(e))
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"data": out, "expiring_within": within.String()})
+}
+
+func (h *KeyUsageHandler) knownKeys(r *http.Request) ([]keyusage.KeyInfo, error) {
+	tenant := core.TenantFrom(r.Context())
+	var keys []keyusage.KeyInfo
+	for _, k := range h.opts.StaticKeys {
+		if k.TenantID == tenant {
+			keys = append(keys, k)
+		}
+	}
+	if h.opts.Managed == nil {
+		return keys, nil
+	}
+	managed, err := h.opts.Managed.List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range managed {
+		keys = append(keys, keyusage.KeyInfo{ID: k.UsageID(), TenantID: k.TenantID, Name: k.Name, Source: "managed",
+			Deprecated: k.Deprecated(), Revoked: k.RevokedAt != nil, ExpiresAt: k.ExpiresAt})
+	}
+	return keys, nil
+}
+
+func toKeyUsageDTO(e keyusage.ReportEntry) keyUsageDTO {
+	dto := keyUsageDTO{KeyID: e.KeyID, Source: "unknown", ExpiringSoon: e.ExpiringSoon, Attention: e.Attention(),
+		Requests: e.Requests, Errors: e.Errors, LastIP: e.LastIP, LastUserAgent: e.LastUserAgent, Routes: e.Routes}
+	if dto.Routes == nil {
+		dto.Routes = map[string]int64{}
+	}
+	if !e.LastUsedAt.IsZero() {
+		dto.LastUsedAt = formatTimePtr(&e.LastUsedAt)
+	}
+	if k := e.Key; k != nil {
+		dto.Name, dto.Source, dto.Deprecated, dto.Revoked = k.Name, k.Source, k.Deprecated, k.Revoked
+		dto.ExpiresAt = formatTimePtr(k.ExpiresAt)
+	}
+	return dto
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+)
+
+// exportFlushEvery is how many exported users are written between flushes to the client.
+const exportFlushEvery = 500
+
+// exportColumns is the CSV export layout; import reads name, email and attributes back from it.
+var exportColumns = []string{"id", "name", "email", "status", "attributes", "created_at", "updated_at", "deleted_at", "version"}
+
+type importReportDTO struct {
+	Mode      core.BatchMode   `json:"mode"`
+	DryRun    bool             `json:"dry_run"`
+	Committed bool             `json:"committed"`
+	Rows      int              `json:"rows"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Failed    int              `json:"failed"`
+	Errors    []importErrorDTO `json:"errors"`
+}
+
+type importErrorDTO struct {
+	Line   int    `json:"line"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// export streams every user matching the listing filters and sort as CSV or NDJSON (the default). Rows are
+// flushed as they are read, so the response starts at once and memory stays flat however many users match.
+func (h *UserHandler) export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "ndjson"
+	}
+	if format != "csv" && format != "ndjson" {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid Format", "format must be csv or ndjson")
+		return
+	}
+	f, sort, err := parseListQuery(r)
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid Query", err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.opts.BulkTimeout)
+	defer cancel()
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(h.opts.BulkTimeout)) // the server's WriteTimeout is meant for single pages
+
+	var (
+		cw      *csv.Writer
+		enc     *json.Encoder
+		started bool
+		n       int
+	)
+	start := func() error {
+		started = true
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+			cw = csv.NewWriter(w)
+			return cw.Write(exportColumns)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="users.ndjson"`)
+		enc = json.NewEncoder(w)
+		return nil
+	}
+	flush := func() error {
+		if cw != nil {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+		}
+		return rc.Flush()
+	}
+	err = h.svc.Export(ctx, f, sort, func(u *core.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if cw != nil {
+			if err := cw.Write(exportRecord(u)); err != nil {
+				return err
+			}
+		} else if err := enc.Encode(toDTO(u)); err != nil {
+			return err
+		}
+		if n++; n%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	switch {
+	case err != nil && !started:
+		render.Problem(w, r, errs.HTTPStatus(err), "Export Failed", err.Error())
+	case err != nil:
+		// the status line is gone; cut the connection so the client cannot mistake the file for complete
+		panic(http.ErrAbortHandler)
+	default:
+		if !started {
+			_ = start()
+		}
+		_ = flush()
+	}
+}
+
+func exportRecord(u *core.User) []string {
+	dto := toDTO(u)
+	attrs, _ := json.Marshal(dto.Attributes)
+	deleted := ""
+	if dto.DeletedAt != nil {
+		deleted = *dto.DeletedAt
+	}
+	return []string{dto.ID.String(), dto.Name, dto.Email, string(dto.Status), string(attrs), dto.CreatedAt, dto.UpdatedAt, deleted,
+		strconv.FormatInt(dto.Version, 10)}
+}
+
+// importUsers reads CSV (header row with name and email, optionally attributes as a JSON object) or NDJSON
+// (objects with name, email and attributes) and answers with a per-line report. query: format (else taken
+// from the Content-Type), mode (atomic or partial), dry_run, upsert. An atomic import with failing lines
+// stores nothing and answers 422.
+func (h *UserHandler) importUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		switch mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			format = "ndjson"
+		}
+	}
+	opts := core.ImportOptions{Mode: core.BatchMode(q.Get("mode"))}
+	var err error
+	if opts.DryRun, err = parseBoolParam(q.Get("dry_run")); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid Query", "dry_run: "+err.Error())
+		return
+	}
+	if opts.Upsert, err = parseBoolParam(q.Get("upsert")); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid Query", "upsert: "+err.Error())
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, h.opts.ImportMaxBytes)
+	var rows core.ImportSource
+	switch format {
+	case "csv":
+		rows = csvImportSource(body)
+	case "ndjson":
+		rows = ndjsonImportSource(body)
+	default:
+		render.Problem(w, r, http.StatusUnsupportedMediaType, "Unsupported Format",
+			"send text/csv or application/x-ndjson, or set format=csv|ndjson")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), h.opts.BulkTimeout)
+	defer cancel()
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(h.opts.BulkTimeout))
+	_ = rc.SetWriteDeadline(time.Now().Add(h.opts.BulkTimeout))
+
+	report, err := h.svc.Import(ctx, rows, opts)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			render.Problem(w, r, http.StatusRequestEntityTooLarge, "Import Too Large",
+				fmt.Sprintf("the body exceeds %d bytes; split the file", tooLarge.Limit))
+			return
+		}
+		render.Problem(w, r, errs.HTTPStatus(err), "Import Failed", err.Error())
+		return
+	}
+	status := http.StatusOK
+	if report.Mode == core.BatchAtomic && !report.DryRun && report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	render.JSON(w, r, status, toImportReportDTO(report))
+}
+
+func toImportReportDTO(rep *core.ImportReport) importReportDTO {
+	dto := importReportDTO{Mode: rep.Mode, DryRun: rep.DryRun, Committed: rep.Committed, Rows: rep.Rows,
+		Created: rep.Created, Updated: rep.Updated, Failed: rep.Failed, Errors: make([]importErrorDTO, 0, len(rep.Errors))}
+	for _, e := range rep.Errors {
+		dto.Errors = append(dto.Errors, importErrorDTO{Line: e.Line, Status: errs.HTTPStatus(e.Err), Detail: e.Err.Error()})
+	}
+	return dto
+}
+
+func parseBoolParam(v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// csvImportSource reads rows by header name, so columns may come in any order and extra ones (such as
+// those of an export) are ignored.
+func csvImportSource(body io.Reader) core.ImportSource {
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1 // short rows are reported per line instead of failing the whole file
+	var cols map[string]int
+	return func() (core.ImportRow, error) {
+		if cols == nil {
+			header, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				return core.ImportRow{}, fmt.Errorf("empty CSV: %w", core.ErrValidation)
+			}
+			if err != nil {
+				return core.ImportRow{}, csvError(err)
+			}
+			cols = map[string]int{}
+			for i, name := range header {
+				if i == 0 {
+					name = strings.TrimPrefix(name, "\ufeff") // spreadsheet exports often start with a BOM
+				}
+				cols[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			for _, required := range []string{"name", "email"} {
+				if _, ok := cols[required]; !ok {
+					return core.ImportRow{}, fmt.Errorf("CSV header lacks a %s column: %w", required, core.ErrValidation)
+				}
+			}
+		}
+		rec, err := cr.Read()
+		var perr *csv.ParseError
+		if errors.As(err, &perr) { // the reader resumes after the malformed record
+			return core.ImportRow{Line: perr.StartLine, Err: fmt.Errorf("%v: %w", perr.Err, core.ErrValidation)}, nil
+		}
+		if err != nil {
+			return core.ImportRow{}, csvError(err)
+		}
+		line, _ := cr.FieldPos(0)
+		row := core.ImportRow{Line: line}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return rec[i]
+			}
+			return ""
+		}
+		row.Name, row.Email = field("name"), field("email")
+		if raw := strings.TrimSpace(field("attributes")); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &row.Attributes); err != nil {
+				row.Err = fmt.Errorf("attributes must be a JSON object: %w", core.ErrValidation)
+			}
+		}
+		return row, nil
+	}
+}
+
+// csvError marks malformed CSV as a validation failure; I/O errors (such as an oversized body) pass through.
+func csvError(err error) error {
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return fmt.Errorf("%v: %w", err, core.ErrValidation)
+	}
+	return err
+}
+
+type importLine struct {
+	Name       string          `json:"name"`
+	Email      string          `json:"email"`
+	Attributes core.Attributes `json:"attributes"`
+}
+
+// ndjsonImportSource reads one JSON object per line; blank lines are skipped and unknown fields ignored,
+// so an NDJSON export can be imported as is.
+func ndjsonImportSource(body io.Reader) core.ImportSource {
+	br := bufio.NewReader(body)
+	line := 0
+	return func() (core.ImportRow, error) {
+		for {
+			b, err := br.ReadBytes('\n')
+			if len(b) == 0 && err != nil {
+				return core.ImportRow{}, err
+			}
+			line++
+			b = bytes.TrimSpace(b)
+			if len(b) == 0 {
+				continue
+			}
+			var in importLine
+			if err := json.Unmarshal(b, &in); err != nil {
+				return core.ImportRow{Line: line, Err: fmt.Errorf("invalid JSON: %w", core.ErrValidation)}, nil
+			}
+			return core.ImportRow{Line: line, Name: in.Name, Email: in.Email, Attributes: in.Attributes}, nil
+		}
+	}
+}
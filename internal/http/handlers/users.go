@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -9,27 +10,65 @@ import (
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
 	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
 	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type UserHandler struct {
 	svc      core.UserService
 	validate *validator.Validate
+	opts     UserHandlerOptions
+}
+
+type UserHandlerOptions struct {
+	// RequireIfMatch rejects PATCH/DELETE without an If-Match header (428 Precondition Required).
+	RequireIfMatch bool
+	// BulkTimeout bounds an export or import, replacing the server's read and write timeouts (default 10m).
+	BulkTimeout time.Duration
+	// ImportMaxBytes caps the import body (default 64 MiB).
+	ImportMaxBytes int64
 }
 
 func NewUserHandler(svc core.UserService) *UserHandler {
-	return &UserHandler{svc: svc, validate: validator.New()}
+	return NewUserHandlerWithOpts(svc, UserHandlerOptions{})
+}
+
+func NewUserHandlerWithOpts(svc core.UserService, opts UserHandlerOptions) *UserHandler {
+	if opts.BulkTimeout <= 0 {
+		opts.BulkTimeout = 10 * time.Minute
+	}
+	if opts.ImportMaxBytes <= 0 {
+		opts.ImportMaxBytes = 64 << 20
+	}
+	return &UserHandler{svc: svc, validate: validator.New(), opts: opts}
 }
 
 func (h *UserHandler) Register(r chi.Router) {
-	r.Get("/users", h.list)
-	r.Post("/users", h.create)
-	r.Get("/users/{id}", h.get)
-	r.Patch("/users/{id}", h.update)
-	r.Delete("/users/{id}", h.delete)
+	// each route declares the scope a restricted caller needs; batch deletes and purges check more inside
+	read := r.With(middleware.RequireScope(core.ScopeUsersRead))
+	write := r.With(middleware.RequireScope(core.ScopeUsersWrite))
+	del := r.With(middleware.RequireScope(core.ScopeUsersDelete))
+	read.Get("/users", h.list)
+	write.Post("/users", h.create)
+	write.Post("/users:batch", h.batch)
+	read.Get("/users/export", h.export)
+	write.Post("/users/import", h.importUsers)
+	read.Get("/users/search", h.search)
+	read.Get("/users/{id}", h.get)
+	write.Patch("/users/{id}", h.update)
+	del.Delete("/users/{id}", h.delete)
+	write.Post("/users/{id}:restore", h.restore)
+	write.Post("/users:invite", h.invite)
+	write.Post("/users/verify", h.verifyEmail)
+	write.Post("/users/{id}:activate", h.transition(core.StatusActive))
+	write.Post("/users/{id}:suspend", h.transition(core.StatusSuspended))
+	write.Post("/users/{id}:lock", h.transition(core.StatusLocked))
+	read.Get("/users/{id}/history", h.history)
 }
 
 type userDTO struct {
@@ -38,16 +77,110 @@ type userDTO struct {
 	Email     string    `json:"email"`
 	CreatedAt string    `json:"created_at"`
 	UpdatedAt string    `json:"updated_at"`
+	DeletedAt *string   `json:"deleted_at,omitempty"`
+	Version   int64     `json:"version"`
+	// Attributes is always an object, empty when none are set.
+	Attributes      core.Attributes `json:"attributes"`
+	Status          core.UserStatus `json:"status"`
+	StatusChangedAt string          `json:"status_changed_at"`
+	StatusReason    string          `json:"status_reason,omitempty"`
+	EmailVerifiedAt *string         `json:"email_verified_at,omitempty"`
+}
+
+type searchHitDTO struct {
+	userDTO
+	Score float64 `json:"score"`
 }
 
 type createUserReq struct {
-	Name  string `json:"name" validate:"required"`
-	Email string `json:"email" validate:"required,email"`
+	Name       string          `json:"name" validate:"required"`
+	Email      string          `json:"email" validate:"required,email"`
+	Attributes core.Attributes `json:"attributes"`
 }
 
 type updateUserReq struct {
 	Name  *string `json:"name"`
 	Email *string `json:"email"`
+	// Attributes is merged into the stored attributes (RFC 7396); a key set to null is removed.
+	Attributes json.RawMessage `json:"attributes"`
+}
+
+type transitionReq struct {
+	Reason string `json:"reason"`
+}
+
+type verifyEmailReq struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type batchReq struct {
+	// Mode is "atomic" (default, all-or-nothing) or "partial".
+	Mode       core.BatchMode `json:"mode"`
+	Operations []batchOpReq   `json:"operations"`
+}
+
+type batchOpReq struct {
+	Op         core.BatchOpKind `json:"op"`
+	ID         uuid.UUID        `json:"id"`
+	Name       *string          `json:"name"`
+	Email      *string          `json:"email"`
+	Attributes core.Attributes  `json:"attributes"` // merge patch for update
+	Version    int64            `json:"version"`    // expected version for update/delete; 0 = unconditional
+}
+
+type batchItemDTO struct {
+	Index  int                    `json:"index"`
+	Status int                    `json:"status"`
+	Data   *userDTO               `json:"data,omitempty"`
+	Error  *render.ProblemDetails `json:"error,omitempty"`
+}
+
+// batch applies creates, updates and deletes in one call. Atomic batches answer a failure with a single problem
+// naming the item; partial batches always answer 200 with a status (and problem, if any) per item.
+func (h *UserHandler) batch(w http.ResponseWriter, r *http.Request) {
+	var req batchReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	ops := make([]core.BatchOp, len(req.Operations))
+	for i, op := range req.Operations {
+		ops[i] = core.BatchOp{Kind: op.Op, ID: op.ID, Name: op.Name, Email: op.Email, Attributes: op.Attributes, ExpectedVersion: op.Version}
+		if op.Op == core.BatchDelete {
+			if err := core.RequireScope(r.Context(), core.ScopeUsersDelete); err != nil {
+				middleware.ScopeProblem(w, r, err)
+				return
+			}
+		}
+	}
+	results, err := h.svc.Batch(r.Context(), ops, req.Mode)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Batch Failed", err.Error())
+		return
+	}
+	out := make([]batchItemDTO, len(results))
+	failed := 0
+	for i, res := range results {
+		item := batchItemDTO{Index: i}
+		switch {
+		case res.Err != nil:
+			failed++
+			item.Status = errs.HTTPStatus(res.Err)
+			item.Error = &render.ProblemDetails{Title: "Item Failed", Status: item.Status, Detail: res.Err.Error()}
+		case ops[i].Kind == core.BatchCreate:
+			item.Status = http.StatusCreated
+		case ops[i].Kind == core.BatchDelete:
+			item.Status = http.StatusNoContent
+		default:
+			item.Status = http.StatusOK
+		}
+		if res.User != nil {
+			dto := toDTO(res.User)
+			item.Data = &dto
+		}
+		out[i] = item
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"results": out, "failed": failed})
 }
 
 func (h *UserHandler) create(w http.ResponseWriter, r *http.Request) {
@@ -60,14 +193,81 @@ func (h *UserHandler) create(w http.ResponseWriter, r *http.Request) {
 		render.Problem(w, r, http.StatusBadRequest, "Validation Error", err.Error())
 		return
 	}
-	u, err := h.svc.Create(r.Context(), req.Name, req.Email)
+	u, err := h.svc.Create(r.Context(), req.Name, req.Email, req.Attributes)
 	if err != nil {
 		render.Problem(w, r, errs.HTTPStatus(err), "Create Failed", err.Error())
 		return
 	}
+	w.Header().Set("ETag", userETag(u))
 	render.JSON(w, r, http.StatusCreated, toDTO(u))
 }
 
+// invite creates a user in the invited status; it takes the same body as create.
+func (h *UserHandler) invite(w http.ResponseWriter, r *http.Request) {
+	var req createUserReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Invalid JSON", err.Error())
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	u, err := h.svc.Invite(r.Context(), req.Name, req.Email, req.Attributes)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Invite Failed", err.Error())
+		return
+	}
+	w.Header().Set("ETag", userETag(u))
+	render.JSON(w, r, http.StatusCreated, toDTO(u))
+}
+
+// verifyEmail consumes a verification token sent on create or email change. Verifying twice is not an error.
+func (h *UserHandler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Invalid JSON", err.Error())
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	u, err := h.svc.VerifyEmail(r.Context(), req.Token)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Verification Failed", err.Error())
+		return
+	}
+	w.Header().Set("ETag", userETag(u))
+	render.JSON(w, r, http.StatusOK, toDTO(u))
+}
+
+// transition serves the status actions; the body ({"reason": ...}) is optional. A transition the state
+// machine forbids is a 409.
+func (h *UserHandler) transition(to core.UserStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := parseUUIDParam(r, "id")
+		if err != nil {
+			render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+			return
+		}
+		var req transitionReq
+		if r.ContentLength != 0 {
+			if err := decodeJSON(w, r, &req); err != nil && !errors.Is(err, io.EOF) {
+				render.Problem(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+				return
+			}
+		}
+		u, err := h.svc.Transition(r.Context(), id, to, req.Reason)
+		if err != nil {
+			render.Problem(w, r, errs.HTTPStatus(err), "Transition Failed", err.Error())
+			return
+		}
+		w.Header().Set("ETag", userETag(u))
+		render.JSON(w, r, http.StatusOK, toDTO(u))
+	}
+}
+
 func (h *UserHandler) get(w http.ResponseWriter, r *http.Request) {
 	id, err := parseUUIDParam(r, "id")
 	if err != nil {
@@ -79,12 +279,22 @@ func (h *UserHandler) get(w http.ResponseWriter, r *http.Request) {
 		render.Problem(w, r, errs.HTTPStatus(err), "Get Failed", err.Error())
 		return
 	}
+	w.Header().Set("ETag", userETag(u))
 	render.JSON(w, r, http.StatusOK, toDTO(u))
 }
 
 func (h *UserHandler) list(w http.ResponseWriter, r *http.Request) {
+	f, sort, err := parseListQuery(r)
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid Query", err.Error())
+		return
+	}
+	if q := r.URL.Query(); q.Has("cursor") || q.Has("limit") {
+		h.listAfter(w, r, f, sort)
+		return
+	}
 	page, pageSize := parsePagination(r)
-	users, total, err := h.svc.List(r.Context(), page, pageSize)
+	users, total, err := h.svc.List(r.Context(), f, sort, page, pageSize)
 	if err != nil {
 		render.Problem(w, r, errs.HTTPStatus(err), "List Failed", err.Error())
 		return
@@ -96,14 +306,52 @@ func (h *UserHandler) list(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, http.StatusOK, map[string]any{"data": out, "total": total, "page": page, "page_size": pageSize})
 }
 
+// listAfter serves keyset pagination (?cursor=&limit=); next_cursor is null on the last page.
+func (h *UserHandler) listAfter(w http.ResponseWriter, r *http.Request, f core.UserFilter, sort core.UserSort) {
+	cursor, limit := parseCursorPagination(r)
+	users, next, err := h.svc.ListAfter(r.Context(), f, sort, cursor, limit)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "List Failed", err.Error())
+		return
+	}
+	out := make([]userDTO, 0, len(users))
+	for _, u := range users {
+		out = append(out, toDTO(u))
+	}
+	var nextCursor *string
+	if next != "" {
+		nextCursor = &next
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"data": out, "limit": limit, "next_cursor": nextCursor})
+}
+
+func (h *UserHandler) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	hits, err := h.svc.Search(r.Context(), q.Get("q"), limit)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Search Failed", err.Error())
+		return
+	}
+	out := make([]searchHitDTO, 0, len(hits))
+	for _, hit := range hits {
+		out = append(out, searchHitDTO{userDTO: toDTO(hit.User), Score: hit.Score})
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"data": out, "query": q.Get("q")})
+}
+
 func (h *UserHandler) update(w http.ResponseWriter, r *http.Request) {
 	id, err := parseUUIDParam(r, "id")
 	if err != nil {
 		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
 		return
 	}
+	expected, ok := h.ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
 	var req updateUserReq
-	if r.Header.Get("Content-Type") == "application/merge-patch+json" {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/merge-patch+json" {
 		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
 		if err != nil {
 			render.Problem(w, r, http.StatusBadRequest, "Read Error", err.Error())
@@ -119,27 +367,153 @@ func (h *UserHandler) update(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	u, err := h.svc.Update(r.Context(), id, req.Name, req.Email)
+	attrs, err := attributesPatch(req.Attributes)
 	if err != nil {
-		render.Problem(w, r, errs.HTTPStatus(err), "Update Failed", err.Error())
+		render.Problem(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
 		return
 	}
+	u, err := h.svc.Update(r.Context(), id, req.Name, req.Email, attrs, expected)
+	if err != nil {
+		render.Problem(w, r, preconditionStatus(err, expected), "Update Failed", err.Error())
+		return
+	}
+	w.Header().Set("ETag", userETag(u))
 	render.JSON(w, r, http.StatusOK, toDTO(u))
 }
 
+// attributesPatch decodes the attributes member of a PATCH body; nil means it was absent. The attributes
+// object itself cannot be removed, only its keys.
+func attributesPatch(raw json.RawMessage) (core.Attributes, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var attrs core.Attributes
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		return nil, fmt.Errorf("attributes: expected an object")
+	}
+	if attrs == nil {
+		return nil, fmt.Errorf("attributes cannot be null; set individual keys to null to remove them")
+	}
+	return attrs, nil
+}
+
 func (h *UserHandler) delete(w http.ResponseWriter, r *http.Request) {
 	id, err := parseUUIDParam(r, "id")
 	if err != nil {
 		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
 		return
 	}
-	if err := h.svc.Delete(r.Context(), id); err != nil {
-		render.Problem(w, r, errs.HTTPStatus(err), "Delete Failed", err.Error())
+	if hard, _ := strconv.ParseBool(r.URL.Query().Get("hard")); hard {
+		if err := core.RequireScope(r.Context(), core.ScopeAdmin); err != nil {
+			middleware.ScopeProblem(w, r, err)
+			return
+		}
+		if err := h.svc.Purge(r.Context(), id); err != nil {
+			render.Problem(w, r, errs.HTTPStatus(err), "Delete Failed", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	expected, ok := h.ifMatchVersion(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.Delete(r.Context(), id, expected); err != nil {
+		render.Problem(w, r, preconditionStatus(err, expected), "Delete Failed", err.Error())
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *UserHandler) restore(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	u, err := h.svc.Restore(r.Context(), id)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Restore Failed", err.Error())
+		return
+	}
+	w.Header().Set("ETag", userETag(u))
+	render.JSON(w, r, http.StatusOK, toDTO(u))
+}
+
+type auditEntryDTO struct {
+	ID         uuid.UUID          `json:"id"`
+	Action     core.AuditAction   `json:"action"`
+	Actor      string             `json:"actor"`
+	RequestID  string             `json:"request_id,omitempty"`
+	OccurredAt string             `json:"occurred_at"`
+	Changes    []core.FieldChange `json:"changes"`
+}
+
+// history lists the user's audit trail, newest first; it stays available after a delete or purge.
+func (h *UserHandler) history(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	entries, err := h.svc.History(r.Context(), id, limit)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "History Failed", err.Error())
+		return
+	}
+	out := make([]auditEntryDTO, 0, len(entries))
+	for _, e := range entries {
+		changes := e.Changes
+		if changes == nil {
+			changes = []core.FieldChange{}
+		}
+		out = append(out, auditEntryDTO{ID: e.ID, Action: e.Action, Actor: e.Actor, RequestID: e.RequestID,
+			OccurredAt: e.OccurredAt.Format(time.RFC3339Nano), Changes: changes})
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"data": out})
+}
+
+// userETag is a strong validator derived from the row version.
+func userETag(u *core.User) string { return fmt.Sprintf(`"v%d"`, u.Version) }
+
+// ifMatchVersion reads the expected version from If-Match. An absent header (unless required) or "*" yields 0,
+// meaning unconditional. On failure the 412/428 problem has already been written and ok is false.
+func (h *UserHandler) ifMatchVersion(w http.ResponseWriter, r *http.Request) (version int64, ok bool) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" {
+		if h.opts.RequireIfMatch {
+			render.Problem(w, r, http.StatusPreconditionRequired, "Precondition Required", "If-Match header with the user's ETag is required")
+			return 0, false
+		}
+		return 0, true
+	}
+	if v == "*" {
+		return 0, true
+	}
+	// weak validators (W/"...") never match under If-Match's strong comparison
+	for _, tag := range strings.Split(v, ",") {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, `"v`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		if n, err := strconv.ParseInt(tag[2:len(tag)-1], 10, 64); err == nil && n > 0 {
+			return n, true
+		}
+	}
+	render.Problem(w, r, http.StatusPreconditionFailed, "Precondition Failed", "If-Match does not match the current ETag")
+	return 0, false
+}
+
+// preconditionStatus reports a version mismatch as 412 when the client sent If-Match, else as the plain 409 conflict.
+func preconditionStatus(err error, expected int64) int {
+	if expected != 0 && errors.Is(err, core.ErrStaleVersion) {
+		return http.StatusPreconditionFailed
+	}
+	return errs.HTTPStatus(err)
+}
+
 func parseUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
 	return uuid.Parse(chi.URLParam(r, name))
 }
@@ -157,8 +531,85 @@ func parsePagination(r *http.Request) (int, int) {
 	return page, size
 }
 
+// parseListQuery reads listing filters (name_prefix, email_domain, created_/updated_ after|before as RFC3339,
+// attr.<key>=<value> attribute equality, status as a comma list) and sort ("field" or "-field").
+func parseListQuery(r *http.Request) (core.UserFilter, core.UserSort, error) {
+	q := r.URL.Query()
+	f := core.UserFilter{NamePrefix: q.Get("name_prefix"), EmailDomain: q.Get("email_domain")}
+	if v := q.Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			st, err := core.ParseUserStatus(s)
+			if err != nil {
+				return core.UserFilter{}, core.UserSort{}, err
+			}
+			f.Statuses = append(f.Statuses, st)
+		}
+	}
+	for param, vals := range q {
+		if key, ok := strings.CutPrefix(param, "attr."); ok {
+			if f.Attributes == nil {
+				f.Attributes = map[string]string{}
+			}
+			f.Attributes[key] = vals[0]
+		}
+	}
+	includeDeleted, _ := strconv.ParseBool(q.Get("include_deleted"))
+	onlyDeleted, _ := strconv.ParseBool(q.Get("only_deleted"))
+	switch {
+	case includeDeleted && onlyDeleted:
+		return core.UserFilter{}, core.UserSort{}, fmt.Errorf("include_deleted and only_deleted are mutually exclusive")
+	case includeDeleted:
+		f.Deleted = core.DeletedInclude
+	case onlyDeleted:
+		f.Deleted = core.DeletedOnly
+	}
+	for param, dst := range map[string]**time.Time{
+		"created_after":  &f.CreatedAfter,
+		"created_before": &f.CreatedBefore,
+		"updated_after":  &f.UpdatedAfter,
+		"updated_before": &f.UpdatedBefore,
+	} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return core.UserFilter{}, core.UserSort{}, fmt.Errorf("%s: expected RFC3339 timestamp", param)
+		}
+		*dst = &ts
+	}
+	sort, err := core.ParseUserSort(q.Get("sort"))
+	if err != nil {
+		return core.UserFilter{}, core.UserSort{}, err
+	}
+	return f, sort, nil
+}
+
+func parseCursorPagination(r *http.Request) (string, int) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return q.Get("cursor"), limit
+}
+
 func toDTO(u *core.User) userDTO {
-	return userDTO{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt.Format(time.RFC3339), UpdatedAt: u.UpdatedAt.Format(time.RFC3339)}
+	dto := userDTO{ID: u.ID, Name: u.Name, Email: u.Email, CreatedAt: u.CreatedAt.Format(time.RFC3339), UpdatedAt: u.UpdatedAt.Format(time.RFC3339), Version: u.Version, Attributes: u.Attributes,
+		Status: u.Status, StatusChangedAt: u.StatusChangedAt.Format(time.RFC3339), StatusReason: u.StatusReason}
+	if dto.Attributes == nil {
+		dto.Attributes = core.Attributes{}
+	}
+	if u.DeletedAt != nil {
+		del := u.DeletedAt.Format(time.RFC3339)
+		dto.DeletedAt = &del
+	}
+	if u.EmailVerifiedAt != nil {
+		ver := u.EmailVerifiedAt.Format(time.RFC3339)
+		dto.EmailVerifiedAt = &ver
+	}
+	return dto
 }
 
 const maxBody = 1 << 20 // 1MB
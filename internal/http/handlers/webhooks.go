@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/errs"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+	"github.com/hex-zero/MaxwellGoSpine/internal/webhook"
+)
+
+type WebhookHandler struct{ svc webhook.Service }
+
+func NewWebhookHandler(svc webhook.Service) *WebhookHandler { return &WebhookHandler{svc: svc} }
+
+// Register mounts the webhook routes; managing webhooks needs the admin scope.
+func (h *WebhookHandler) Register(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequireScope(core.ScopeAdmin))
+		r.Get("/webhooks", h.list)
+		r.Post("/webhooks", h.create)
+		r.Get("/webhooks/{id}", h.get)
+		r.Patch("/webhooks/{id}", h.update)
+		r.Delete("/webhooks/{id}", h.delete)
+		r.Get("/webhooks/{id}/deliveries", h.deliveries)
+		r.Get("/webhooks/{id}/deliveries/{delivery}", h.delivery)
+		r.Post("/webhooks/{id}/deliveries/{delivery}:redeliver", h.redeliver)
+	})
+}
+
+// webhookDTO never includes the secret except in the create response.
+type webhookDTO struct {
+	ID         uuid.UUID            `json:"id"`
+	URL        string               `json:"url"`
+	Secret     string               `json:"secret,omitempty"`
+	EventTypes []core.UserEventType `json:"event_types"`
+	Active     bool                 `json:"active"`
+	CreatedAt  string               `json:"created_at"`
+	UpdatedAt  string               `json:"updated_at"`
+}
+
+type deliveryDTO struct {
+	ID            uuid.UUID              `json:"id"`
+	EventID       string                 `json:"event_id"`
+	EventType     core.UserEventType     `json:"event_type"`
+	Status        webhook.DeliveryStatus `json:"status"`
+	Attempts      int                    `json:"attempts"`
+	NextAttemptAt string                 `json:"next_attempt_at"`
+	CreatedAt     string                 `json:"created_at"`
+	Payload       json.RawMessage        `json:"payload,omitempty"`
+	Log           []attemptDTO           `json:"log,omitempty"`
+}
+
+type attemptDTO struct {
+	AttemptedAt  string `json:"attempted_at"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Error        string `json:"error,omitempty"`
+	DurationMS   int64  `json:"duration_ms"`
+}
+
+type createWebhookReq struct {
+	URL        string               `json:"url"`
+	Secret     string               `json:"secret"`
+	EventTypes []core.UserEventType `json:"event_types"`
+}
+
+type updateWebhookReq struct {
+	URL        *string               `json:"url"`
+	Secret     *string               `json:"secret"`
+	EventTypes *[]core.UserEventType `json:"event_types"`
+	Active     *bool                 `json:"active"`
+}
+
+func (h *WebhookHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req createWebhookReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	sub, err := h.svc.Create(r.Context(), req.URL, req.Secret, req.EventTypes)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Create Failed", err.Error())
+		return
+	}
+	dto := toWebhookDTO(sub)
+	dto.Secret = sub.Secret // shown once, so the receiver can verify signatures
+	render.JSON(w, r, http.StatusCreated, dto)
+}
+
+func (h *WebhookHandler) list(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.svc.List(r.Context())
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "List Failed", err.Error())
+		return
+	}
+	out := make([]webhookDTO, 0, len(subs))
+	for _, s := range subs {
+		out = append(out, toWebhookDTO(s))
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"data": out})
+}
+
+func (h *WebhookHandler) get(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	sub, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Get Failed", err.Error())
+		return
+	}
+	render.JSON(w, r, http.StatusOK, toWebhookDTO(sub))
+}
+
+func (h *WebhookHandler) update(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	var req updateWebhookReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid JSON", err.Error())
+		return
+	}
+	sub, err := h.svc.Update(r.Context(), id, webhook.SubscriptionPatch{URL: req.URL, Secret: req.Secret, EventTypes: req.EventTypes, Active: req.Active})
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Update Failed", err.Error())
+		return
+	}
+	render.JSON(w, r, http.StatusOK, toWebhookDTO(sub))
+}
+
+func (h *WebhookHandler) delete(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	if err := h.svc.Delete(r.Context(), id); err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Delete Failed", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) deliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	ds, err := h.svc.Deliveries(r.Context(), id, limit)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "List Failed", err.Error())
+		return
+	}
+	out := make([]deliveryDTO, 0, len(ds))
+	for _, d := range ds {
+		out = append(out, toDeliveryDTO(d, nil))
+	}
+	render.JSON(w, r, http.StatusOK, map[string]any{"data": out})
+}
+
+func (h *WebhookHandler) delivery(w http.ResponseWriter, r *http.Request) {
+	id, did, ok := parseDeliveryParams(w, r)
+	if !ok {
+		return
+	}
+	d, attempts, err := h.svc.Delivery(r.Context(), id, did)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Get Failed", err.Error())
+		return
+	}
+	dto := toDeliveryDTO(d, attempts)
+	dto.Payload = d.Payload
+	render.JSON(w, r, http.StatusOK, dto)
+}
+
+// redeliver queues the delivery for an immediate new attempt; the worker sends it on its next poll.
+func (h *WebhookHandler) redeliver(w http.ResponseWriter, r *http.Request) {
+	id, did, ok := parseDeliveryParams(w, r)
+	if !ok {
+		return
+	}
+	d, err := h.svc.Redeliver(r.Context(), id, did)
+	if err != nil {
+		render.Problem(w, r, errs.HTTPStatus(err), "Redeliver Failed", err.Error())
+		return
+	}
+	render.JSON(w, r, http.StatusAccepted, toDeliveryDTO(d, nil))
+}
+
+func parseDeliveryParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	id, err := parseUUIDParam(r, "id")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid ID", err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+	did, err := parseUUIDParam(r, "delivery")
+	if err != nil {
+		render.Problem(w, r, http.StatusBadRequest, "Invalid Delivery ID", err.Error())
+		return uuid.Nil, uuid.Nil, false
+	}
+	return id, did, true
+}
+
+func toWebhookDTO(s *webhook.Subscription) webhookDTO {
+	types := s.EventTypes
+	if types == nil {
+		types = []core.UserEventType{}
+	}
+	return webhookDTO{ID: s.ID, URL: s.URL, EventTypes: types, Active: s.Active,
+		CreatedAt: s.CreatedAt.Format(time.RFC3339), UpdatedAt: s.UpdatedAt.Format(time.RFC3339)}
+}
+
+func toDeliveryDTO(d *webhook.Delivery, attempts []webhook.Attempt) deliveryDTO {
+	dto := deliveryDTO{ID: d.ID, EventID: d.EventID, EventType: d.EventType, Status: d.Status, Attempts: d.Attempts,
+		NextAttemptAt: d.NextAttemptAt.Format(time.RFC3339), CreatedAt: d.CreatedAt.Format(time.RFC3339)}
+	for _, a := range attempts {
+		dto.Log = append(dto.Log, attemptDTO{AttemptedAt: a.AttemptedAt.Format(time.RFC3339), StatusCode: a.StatusCode,
+			ResponseBody: a.ResponseBody, Error: a.Error, DurationMS: a.Duration.Milliseconds()})
+	}
+	return dto
+}
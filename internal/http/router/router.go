@@ -11,12 +11,20 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/hex-zero/MaxwellGoSpine/graph/resolver"
 	"github.com/hex-zero/MaxwellGoSpine/graph/server"
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/auth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
 	"github.com/hex-zero/MaxwellGoSpine/internal/config"
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
 	"github.com/hex-zero/MaxwellGoSpine/internal/http/handlers"
 	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/idempotency"
+	"github.com/hex-zero/MaxwellGoSpine/internal/jwtauth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
 	"github.com/hex-zero/MaxwellGoSpine/internal/metrics"
 	appmw "github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+	"github.com/hex-zero/MaxwellGoSpine/internal/reqsign"
+	"github.com/hex-zero/MaxwellGoSpine/internal/webhook"
 	"go.uber.org/zap"
 )
 
@@ -29,6 +37,21 @@ type Deps struct {
 	Commit    string
 	BuildDate string
 	DB        *sql.DB
+	Webhooks  webhook.Service // nil unless WEBHOOKS_ENABLED
+	Events    *broker.Broker  // live user change stream; nil disables /v1/users/events
+	// Idempotency keeps Idempotency-Key responses; nil uses a per-process memory store
+	Idempotency idempotency.Store
+	// Auth enables end-user sign-in (/v1/auth) and session tokens on every /v1 route; nil disables both
+	Auth auth.Service
+	// JWT accepts "Authorization: Bearer" JWTs on /v1 in place of an API key; nil disables bearer auth
+	JWT *jwtauth.Verifier
+	// APIKeys manages keys minted through /v1/admin/keys and resolves them in the auth middleware; nil accepts
+	// only the env-var keys
+	APIKeys apikey.Service
+	// KeyUsage counts requests per API key and serves /v1/admin/keys/usage; nil disables both
+	KeyUsage *keyusage.Tracker
+	// Nonces enables HMAC-signed requests on /v1 (see package reqsign) and remembers their nonces; nil disables them
+	Nonces reqsign.NonceStore
 }
 
 func New(d Deps) http.Handler {
@@ -36,7 +59,10 @@ func New(d Deps) http.Handler {
 	r.Use(appmw.RequestID)
 	r.Use(appmw.Recovery(d.Logger))
 	r.Use(appmw.Logging(d.Logger, d.Registry))
-	r.Use(appmw.Timeout(30 * time.Second))
+	r.Use(appmw.TimeoutWithOpts(30*time.Second, appmw.TimeoutOptions{
+		Exempt:    []string{"/v1/users/export", "/v1/users/import", "/v1/users/events"}, // BULK_TIMEOUT bounds bulk work
+		WebSocket: []string{"/v1/graphql"},
+	}))
 	r.Use(appmw.CORS(d.CFG.CORSOrigins))
 	r.Use(appmw.Gzip(-1))
 	r.Use(appmw.ETag)
@@ -87,12 +113,106 @@ func New(d Deps) http.Handler {
 			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
 			expUnix[k] = day.Unix()
 		}
-		api.Use(appmw.APIKeyAuthWithOpts(appmw.APIKeyOptions{Current: d.CFG.APIKeys, Old: d.CFG.OldAPIKeys, Expiries: expUnix}))
+		keyOpts := appmw.APIKeyOptions{Current: d.CFG.APIKeys, Old: d.CFG.OldAPIKeys, Expiries: expUnix, Tenants: d.CFG.APIKeyTenants, Scopes: d.CFG.APIKeyScopes}
+		if d.APIKeys != nil {
+			keyOpts.Lookup = d.APIKeys
+		}
+		// With bearer JWTs configured, requests presenting neither a token nor a key are refused, not let through
+		keyOpts.Required = d.JWT != nil
+		apiKeyAuth := appmw.APIKeyAuthWithOpts(keyOpts)
+		api.Use(func(next http.Handler) http.Handler {
+			authed := apiKeyAuth(next)
+			var bearer http.Handler
+			if d.JWT != nil {
+				bearer = appmw.BearerAuth(d.JWT)(next)
+			}
+			var signed http.Handler
+			if d.Nonces != nil {
+				signed = appmw.SignatureAuth(keyOpts, appmw.SignatureOptions{
+					Skew:    d.CFG.RequestSigningSkew,
+					Nonces:  d.Nonces,
+					MaxBody: d.CFG.RequestSigningMaxBody,
+				})(next)
+			}
+			var certAuthed http.Handler
+			if len(d.CFG.TLSClientIdentities) > 0 {
+				certAuthed = appmw.ClientCertAuth(keyOpts, d.CFG.TLSClientIdentities)(next)
+			}
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// GraphQL WebSocket clients cannot set headers; they authenticate in connection_init instead
+				if r.URL.Path == "/v1/graphql" && appmw.IsWebSocketUpgrade(r) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if bearer != nil && appmw.BearerToken(r) != "" {
+					bearer.ServeHTTP(w, r)
+					return
+				}
+				if signed != nil && reqsign.IsSigned(r) {
+					signed.ServeHTTP(w, r)
+					return
+				}
+				// A verified client certificate stands in for the API key it is mapped to, unless other credentials are sent
+				if certAuthed != nil && appmw.HasClientCert(r) && r.Header.Get("X-API-Key") == "" && r.Header.Get("Authorization") == "" {
+					certAuthed.ServeHTTP(w, r)
+					return
+				}
+				authed.ServeHTTP(w, r)
+			})
+		})
+		if d.Auth != nil {
+			api.Use(appmw.SessionAuth(d.Auth))
+		}
+		if d.KeyUsage != nil {
+			api.Use(appmw.KeyUsage(d.KeyUsage))
+		}
+		api.Use(appmw.AuditContext)
+		idemStore := d.Idempotency
+		if idemStore == nil {
+			idemStore = idempotency.NewMemoryStore()
+		}
+		api.Use(idempotency.Middleware(idemStore, idempotency.Options{
+			TTL:     d.CFG.IdempotencyTTL,
+			MaxBody: d.CFG.IdempotencyMaxBody,
+			Exempt:  []string{"/v1/users/import"}, // streamed, up to IMPORT_MAX_BYTES
+		}))
 		// REST handlers
-		handlers.NewUserHandler(d.UserSvc).Register(api)
+		if d.Events != nil {
+			handlers.NewEventsHandlerWithOpts(d.Events, handlers.EventsHandlerOptions{Keepalive: d.CFG.EventsKeepalive}).Register(api)
+		}
+		handlers.NewUserHandlerWithOpts(d.UserSvc, handlers.UserHandlerOptions{
+			RequireIfMatch: d.CFG.RequireIfMatch,
+			BulkTimeout:    d.CFG.BulkTimeout,
+			ImportMaxBytes: d.CFG.ImportMaxBytes,
+		}).Register(api)
+		if d.Auth != nil {
+			handlers.NewAuthHandler(d.Auth, d.UserSvc).Register(api)
+		}
+		if d.Webhooks != nil {
+			handlers.NewWebhookHandler(d.Webhooks).Register(api)
+		}
+		if d.APIKeys != nil {
+			handlers.NewAPIKeyHandler(d.APIKeys).Register(api)
+		}
+		if d.KeyUsage != nil {
+			handlers.NewKeyUsageHandler(d.KeyUsage, handlers.KeyUsageHandlerOptions{
+				StaticKeys:     staticKeyInfo(d.CFG, expUnix),
+				Managed:        d.APIKeys,
+				ExpiringWithin: d.CFG.APIKeyUsageExpiringWithin,
+			}).Register(api)
+		}
 		// GraphQL endpoint (gqlgen executable schema)
-		resolvers := &resolver.Resolver{UserService: d.UserSvc}
-		gqlServer := server.NewExecutableSchema(resolvers)
+		resolvers := &resolver.Resolver{UserService: d.UserSvc, Events: d.Events}
+		gqlOpts := server.Options{
+			APIKeys:          keyOpts,
+			AllowedOrigins:   d.CFG.CORSOrigins,
+			KeepAlive:        d.CFG.GraphQLWSKeepalive,
+			MaxSubscriptions: d.CFG.GraphQLWSMaxSubscriptions,
+		}
+		if d.JWT != nil {
+			gqlOpts.Bearer = d.JWT
+		}
+		gqlServer := server.NewExecutableSchemaWithOpts(resolvers, gqlOpts)
 		api.Handle("/graphql", gqlServer)
 	})
 
@@ -101,6 +221,30 @@ func New(d Deps) http.Handler {
 	return r
 }
 
+// staticKeyInfo describes the env-var keys for the usage report, with the expiry the middleware enforces.
+func staticKeyInfo(cfg *config.Config, expUnix map[string]int64) []keyusage.KeyInfo {
+	var out []keyusage.KeyInfo
+	add := func(key string, deprecated bool) {
+		tenant := cfg.APIKeyTenants[key]
+		if tenant == "" {
+			tenant = core.DefaultTenant
+		}
+		info := keyusage.KeyInfo{ID: appmw.KeyID(key), TenantID: tenant, Source: "env", Deprecated: deprecated}
+		if ts, ok := expUnix[key]; ok {
+			exp := time.Unix(ts, 0).UTC()
+			info.ExpiresAt = &exp
+		}
+		out = append(out, info)
+	}
+	for _, k := range cfg.APIKeys {
+		add(k, false)
+	}
+	for _, k := range cfg.OldAPIKeys {
+		add(k, true)
+	}
+	return out
+}
+
 // redocHTML serves the ReDoc UI for the OpenAPI spec.
 const redocHTML = `<!DOCTYPE html>
 	<html>
@@ -0,0 +1,221 @@
+// Package idempotency implements the Idempotency-Key request header (IETF httpapi-idempotency-key-header):
+// a retried POST, PATCH or DELETE carrying the key of an earlier request gets that request's response
+// instead of being executed again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+// Header is the request header carrying the client's key.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader marks responses served from the store.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// Record is what the store keeps per key. Status 0 means the first request is still being handled.
+type Record struct {
+	Fingerprint string      `json:"fp"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// InFlight reports whether the request that reserved the key has not finished yet.
+func (r *Record) InFlight() bool { return r.Status == 0 }
+
+// Store keeps records by key; implementations must make Reserve atomic across every instance sharing it.
+type Store interface {
+	// Reserve stores rec under key unless the key is taken, for at most ttl. When it is taken, the
+	// existing record is returned and reserved is false.
+	Reserve(ctx context.Context, key string, rec Record, ttl time.Duration) (existing *Record, reserved bool, err error)
+	// Complete replaces the reservation with the finished response, kept for ttl.
+	Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error
+	// Release drops the reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// Options tune Middleware; zero values select the defaults.
+type Options struct {
+	TTL time.Duration // how long responses are replayed (default 24h)
+	// LockTimeout bounds how long a reservation blocks retries if its request never finishes, e.g. because
+	// the instance crashed (default 1m; keep it above the request timeout).
+	LockTimeout time.Duration
+	// MaxBody caps the request bodies that are buffered to fingerprint them, and the responses that are stored
+	// (default 1 MiB). Larger requests are refused with 413; larger responses are passed on but not stored,
+	// leaving the key free for a retry.
+	MaxBody int64
+	// Exempt paths ignore the header, e.g. streaming uploads too large to buffer.
+	Exempt []string
+}
+
+// maxKeyLength bounds client keys; UUIDs and similar tokens are far shorter.
+const maxKeyLength = 255
+
+// Middleware makes POST, PATCH and DELETE requests with an Idempotency-Key header idempotent. Keys are
+// scoped to the tenant, API key and end-user session of the request, so it must run after authentication.
+// The response is stored unless it is a server error, which leaves the key free for a retry. A duplicate
+// arriving while the first request runs gets 409, and reusing a key for a different request gets 422.
+func Middleware(store Store, opts Options) func(http.Handler) http.Handler {
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = time.Minute
+	}
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = 1 << 20
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || !applies(r.Method) || slices.Contains(opts.Exempt, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = strings.Trim(key, `"`) // sent as a structured-field string, or bare by lenient clients
+			if key == "" || len(key) > maxKeyLength {
+				render.Problem(w, r, http.StatusBadRequest, "Invalid Idempotency-Key", "the key must be 1 to 255 characters")
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				render.Problem(w, r, http.StatusRequestEntityTooLarge, "Body Too Large", fmt.Sprintf("requests with an %s are limited to %d bytes", Header, opts.MaxBody))
+				return
+			}
+			if err != nil {
+				render.Problem(w, r, http.StatusBadRequest, "Invalid Body", err.Error())
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := r.Context()
+			storeKey := scopedKey(r, key)
+			fp := fingerprint(r, body)
+			existing, reserved, err := store.Reserve(ctx, storeKey, Record{Fingerprint: fp}, opts.LockTimeout)
+			if err != nil {
+				render.Problem(w, r, http.StatusServiceUnavailable, "Idempotency Store Unavailable", "retry the request later")
+				return
+			}
+			if !reserved {
+				switch {
+				case existing.Fingerprint != fp:
+					render.Problem(w, r, http.StatusUnprocessableEntity, "Idempotency Key Reused", "the key was already used for a different request")
+				case existing.InFlight():
+					w.Header().Set("Retry-After", "1")
+					render.Problem(w, r, http.StatusConflict, "Request In Progress", "a request with this key is still being processed")
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			outer := w.Header().Clone() // set by outer middleware for this request only, e.g. X-Request-ID
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK, max: opts.MaxBody}
+			completed := false
+			defer func() {
+				if !completed { // handler panicked or failed; let the client retry
+					_ = store.Release(context.WithoutCancel(ctx), storeKey)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+			if rec.status >= 500 || rec.overflow {
+				return
+			}
+			done := Record{Fingerprint: fp, Status: rec.status, Header: handlerHeaders(outer, rec.Header()), Body: rec.body.Bytes()}
+			if err := store.Complete(context.WithoutCancel(ctx), storeKey, done, opts.TTL); err == nil {
+				completed = true
+			}
+		})
+	}
+}
+
+func applies(method string) bool {
+	return method == http.MethodPost || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// scopedKey namespaces the client's key so two clients choosing the same key never collide. Requests acting
+// for an end user are scoped to their session too: the same app sending the same key to /v1/auth/logout for
+// two sessions must end both.
+func scopedKey(r *http.Request, key string) string {
+	ctx := r.Context()
+	scope := "idem:" + core.TenantFrom(ctx) + ":" + middleware.GetAPIKeyID(ctx) + ":"
+	if user, ok := core.EndUserFrom(ctx); ok {
+		sum := sha256.Sum256([]byte(r.Header.Get(middleware.SessionHeader)))
+		scope += "user:" + user.String() + ":" + hex.EncodeToString(sum[:8]) + ":"
+	}
+	return scope + key
+}
+
+// fingerprint identifies the request a key was first used for: method, target and body.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handlerHeaders returns the headers in after that were added or changed since before.
+func handlerHeaders(before, after http.Header) http.Header {
+	out := http.Header{}
+	for k, v := range after {
+		if !slices.Equal(before[k], v) {
+			out[k] = slices.Clone(v)
+		}
+	}
+	return out
+}
+
+func replay(w http.ResponseWriter, rec *Record) {
+	for k, v := range rec.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// recorder passes the response through while keeping a copy for the store.
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	wrote    bool
+	body     bytes.Buffer
+	max      int64
+	overflow bool // the response outgrew max, so body is incomplete
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if !r.wrote {
+		r.status, r.wrote = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wrote = true
+	if !r.overflow && int64(r.body.Len()+len(b)) <= r.max {
+		r.body.Write(b)
+	} else {
+		r.overflow = true
+		r.body.Reset()
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
@@ -0,0 +1,65 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is the local Store used without Redis. It only deduplicates requests reaching the same
+// instance and forgets everything on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	rec     Record
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}, now: time.Now}
+}
+
+func (m *MemoryStore) Reserve(_ context.Context, key string, rec Record, ttl time.Duration) (*Record, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+	if e, ok := m.entries[key]; ok && now.Before(e.expires) {
+		existing := e.rec
+		return &existing, false, nil
+	}
+	m.entries[key] = memoryEntry{rec: rec, expires: now.Add(ttl)}
+	return nil, true, nil
+}
+
+func (m *MemoryStore) Complete(_ context.Context, key string, rec Record, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = memoryEntry{rec: rec, expires: m.now().Add(ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// sweep drops expired entries, at most once a minute so Reserve stays cheap.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for k, e := range m.entries {
+		if !now.Before(e.expires) {
+			delete(m.entries, k)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore shares records between every instance using the same Redis, so a retry landing on another
+// instance is still recognised.
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStore(rdb *redis.Client) *RedisStore { return &RedisStore{rdb: rdb} }
+
+func (s *RedisStore) Reserve(ctx context.Context, key string, rec Record, ttl time.Duration) (*Record, bool, error) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, false, err
+	}
+	// The key can expire between a failed SETNX and the GET; try once more before giving up.
+	for attempt := 0; attempt < 2; attempt++ {
+		ok, err := s.rdb.SetNX(ctx, key, b, ttl).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return nil, true, nil
+		}
+		raw, err := s.rdb.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		var existing Record
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return nil, false, err
+		}
+		return &existing, false, nil
+	}
+	return nil, false, errors.New("idempotency: key kept expiring during reservation")
+}
+
+func (s *RedisStore) Complete(ctx context.Context, key string, rec Record, ttl time.Duration) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, key, b, ttl).Err()
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, key).Err()
+}
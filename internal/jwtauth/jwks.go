@@ -0,0 +1,253 @@
+// Package jwtauth verifies bearer JWTs (RS256, ES256, EdDSA) against a JSON Web Key Set.
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// key is one verification key of a set, with the JWS algorithm it verifies.
+type key struct {
+	id  string
+	alg string // RS256, ES256 or EdDSA
+	pub crypto.PublicKey
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS reads the signing keys of a JWKS document. Keys for other uses, types or curves are skipped, so a
+// set may carry keys this package cannot use, and so are malformed or weak keys (logged), so one bad key at
+// the source cannot hold back the others; a set without a usable key is an error.
+func parseJWKS(data []byte, log *zap.Logger) ([]key, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+	var keys []key
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		parsed, err := k.parse()
+		if err != nil {
+			log.Warn("jwks: skipping unusable key", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		if parsed != nil {
+			keys = append(keys, *parsed)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no RS256, ES256 or EdDSA signing key")
+	}
+	return keys, nil
+}
+
+// parse returns nil for key types this package does not verify.
+func (k jwk) parse() (*key, error) {
+	b64 := base64.RawURLEncoding
+	switch {
+	case k.Kty == "RSA" && (k.Alg == "" || k.Alg == "RS256"):
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("modulus: %w", err)
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return &key{id: k.Kid, alg: "RS256", pub: pub}, nil
+	case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == "ES256"):
+		x, errX := b64.DecodeString(k.X)
+		y, errY := b64.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid coordinates")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point not on P-256")
+		}
+		return &key{id: k.Kid, alg: "ES256", pub: pub}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519" && (k.Alg == "" || k.Alg == "EdDSA"):
+		x, err := b64.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return &key{id: k.Kid, alg: "EdDSA", pub: ed25519.PublicKey(x)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// JWKSOptions configures a JWKS.
+type JWKSOptions struct {
+	// RefreshInterval is how long a loaded set is used before it is fetched again (default 1h).
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refetches triggered by tokens naming an unknown key id, so a flood of
+	// forged kids cannot hammer the source (default 1m).
+	MinRefreshInterval time.Duration
+	// HTTPClient fetches URL sources (default: a client with a 10s timeout).
+	HTTPClient *http.Client
+	// Logger reports keys of the set that are skipped as unusable (default: no logging).
+	Logger *zap.Logger
+}
+
+// JWKS holds the keys of a set loaded from a file or an http(s) URL. It reloads the set after
+// RefreshInterval and whenever a token names a key id it does not know, so keys can be rotated at the
+// source without a restart. If a reload fails, the previous keys stay in use.
+type JWKS struct {
+	source string
+	opts   JWKSOptions
+	now    func() time.Time
+
+	reloads singleflight.Group // concurrent reloads share one fetch, made outside mu
+
+	mu       sync.Mutex // guards the fields below, never held across a fetch
+	keys     []key
+	loadedAt time.Time // last successful load
+	triedAt  time.Time // last attempt; reloads are at least MinRefreshInterval apart
+}
+
+// NewJWKS loads the set from source once, failing if it cannot be read.
+func NewJWKS(ctx context.Context, source string, opts JWKSOptions) (*JWKS, error) {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Hour
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = time.Minute
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	j := &JWKS{source: source, opts: opts, now: time.Now}
+	if err := j.reload(ctx); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// candidates returns the keys that may have signed a token with the given kid and alg. A token naming an
+// unknown kid waits for a reload, as the key may just have been rotated in at the source; a stale set is
+// reloaded in the background while its keys keep verifying.
+func (j *JWKS) candidates(ctx context.Context, kid, alg string) []key {
+	match, stale, due := j.match(kid, alg)
+	switch {
+	case !due:
+	case len(match) == 0 && kid != "":
+		if res := <-j.refresh(ctx); res.Err == nil {
+			match, _, _ = j.match(kid, alg)
+		}
+	case stale:
+		j.refresh(ctx)
+	}
+	return match
+}
+
+// match filters the current keys, and reports whether the set is stale and whether a reload may be tried.
+func (j *JWKS) match(kid, alg string) (out []key, stale, due bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, k := range j.keys {
+		if k.alg == alg && (kid == "" || k.id == kid) {
+			out = append(out, k)
+		}
+	}
+	now := j.now()
+	return out, now.Sub(j.loadedAt) >= j.opts.RefreshInterval, now.Sub(j.triedAt) >= j.opts.MinRefreshInterval
+}
+
+// refresh starts a reload, or joins the one in flight. It is detached from ctx, so a client that goes away
+// does not cancel the reload for the others; the HTTP client's timeout bounds it instead.
+func (j *JWKS) refresh(ctx context.Context) <-chan singleflight.Result {
+	ctx = context.WithoutCancel(ctx)
+	return j.reloads.DoChan("reload", func() (any, error) {
+		j.mu.Lock()
+		due := j.now().Sub(j.triedAt) >= j.opts.MinRefreshInterval
+		j.mu.Unlock()
+		if !due { // another caller reloaded just now
+			return nil, nil
+		}
+		return nil, j.reload(ctx)
+	})
+}
+
+// reload fetches the set.
+func (j *JWKS) reload(ctx context.Context) error {
+	j.mu.Lock()
+	j.triedAt = j.now()
+	tried := j.triedAt
+	j.mu.Unlock()
+	data, err := j.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data, j.opts.Logger)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	j.keys, j.loadedAt = keys, tried
+	j.mu.Unlock()
+	return nil
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "https://") && !strings.HasPrefix(j.source, "http://") {
+		data, err := os.ReadFile(j.source)
+		if err != nil {
+			return nil, fmt.Errorf("read JWKS: %w", err)
+		}
+		return data, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+	resp, err := j.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,251 @@
+package jwtauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken rejects a token that is malformed, signed by an unknown key or with an unsupported
+// algorithm, or whose claims do not pass the verifier's checks. Wrapping errors say which check failed.
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// maxTokenSize bounds the work done on an unauthenticated header.
+const maxTokenSize = 16 << 10
+
+// Claims are the verified claims of a token that the API acts on.
+type Claims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	// Scopes come from "scope" (space separated, RFC 8693) or else "scp" (a list or a space separated string).
+	Scopes []string
+	// Tenant is the string value of the verifier's TenantClaim; empty if the token has none.
+	Tenant string
+}
+
+// HasScope reports whether the token grants scope.
+func (c *Claims) HasScope(scope string) bool { return slices.Contains(c.Scopes, scope) }
+
+// VerifierOptions configures a Verifier.
+type VerifierOptions struct {
+	// Issuer must equal the token's "iss"; empty accepts any issuer.
+	Issuer string
+	// Audience lists accepted audiences, one of which the token's "aud" must contain; empty accepts any.
+	Audience []string
+	// Leeway is the clock skew tolerated on "exp", "nbf" and "iat" (default 60s).
+	Leeway time.Duration
+	// TenantClaim names the claim carrying the tenant (default "tenant").
+	TenantClaim string
+}
+
+// Verifier checks the signature and registered claims of compact JWS tokens against a JWKS.
+type Verifier struct {
+	keys *JWKS
+	opts VerifierOptions
+	now  func() time.Time
+}
+
+func NewVerifier(keys *JWKS, opts VerifierOptions) *Verifier {
+	if opts.Leeway <= 0 {
+		opts.Leeway = time.Minute
+	}
+	if opts.TenantClaim == "" {
+		opts.TenantClaim = "tenant"
+	}
+	return &Verifier{keys: keys, opts: opts, now: time.Now}
+}
+
+type header struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Crit []string `json:"crit"`
+}
+
+type registered struct {
+	Iss   string          `json:"iss"`
+	Sub   string          `json:"sub"`
+	Aud   json.RawMessage `json:"aud"`
+	Exp   *json.Number    `json:"exp"`
+	Nbf   *json.Number    `json:"nbf"`
+	Iat   *json.Number    `json:"iat"`
+	Scope string          `json:"scope"`
+	Scp   json.RawMessage `json:"scp"`
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidToken}, args...)...)
+}
+
+// Verify returns the claims of token if it is signed by a key of the set and is currently valid for the
+// configured issuer and audience. Only RS256, ES256 and EdDSA are accepted; in particular "none" and the
+// HMAC algorithms are refused, so a public key can never be used as a shared secret.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	if len(token) > maxTokenSize {
+		return nil, invalid("token too large")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid("not a compact JWS")
+	}
+	enc := base64.RawURLEncoding
+	rawHeader, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalid("header encoding")
+	}
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, invalid("header: %v", err)
+	}
+	if len(h.Crit) > 0 {
+		return nil, invalid("unsupported critical header %q", h.Crit[0])
+	}
+	switch h.Alg {
+	case "RS256", "ES256", "EdDSA":
+	default:
+		return nil, invalid("algorithm %q not accepted", h.Alg)
+	}
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid("signature encoding")
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range v.keys.candidates(ctx, h.Kid, h.Alg) {
+		if verifySignature(k, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, invalid("signature not verified by any key (kid %q)", h.Kid)
+	}
+
+	payload, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalid("payload encoding")
+	}
+	return v.claims(payload)
+}
+
+func verifySignature(k key, signed, sig []byte) bool {
+	switch pub := k.pub.(type) {
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if len(sig) != 64 { // JWS uses the fixed-size r||s form, not ASN.1
+			return false
+		}
+		sum := sha256.Sum256(signed)
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, sum[:], r, s)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, signed, sig)
+	}
+	return false
+}
+
+// claims checks the registered claims of a verified payload and extracts the rest.
+func (v *Verifier) claims(payload []byte) (*Claims, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var reg registered
+	if err := dec.Decode(&reg); err != nil {
+		return nil, invalid("claims: %v", err)
+	}
+	now := v.now()
+	exp, err := numericDate(reg.Exp)
+	if err != nil || exp.IsZero() {
+		return nil, invalid("missing or malformed exp")
+	}
+	if !now.Before(exp.Add(v.opts.Leeway)) {
+		return nil, invalid("token expired")
+	}
+	nbf, err := numericDate(reg.Nbf)
+	if err != nil {
+		return nil, invalid("malformed nbf")
+	}
+	if !nbf.IsZero() && now.Add(v.opts.Leeway).Before(nbf) {
+		return nil, invalid("token not valid yet")
+	}
+	iat, err := numericDate(reg.Iat)
+	if err != nil || (!iat.IsZero() && now.Add(v.opts.Leeway).Before(iat)) {
+		return nil, invalid("malformed or future iat")
+	}
+	if v.opts.Issuer != "" && reg.Iss != v.opts.Issuer {
+		return nil, invalid("issuer %q not accepted", reg.Iss)
+	}
+	aud, err := stringOrList(reg.Aud)
+	if err != nil {
+		return nil, invalid("malformed aud")
+	}
+	if len(v.opts.Audience) > 0 && !slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(v.opts.Audience, a) }) {
+		return nil, invalid("audience not accepted")
+	}
+	if reg.Sub == "" {
+		return nil, invalid("missing sub")
+	}
+
+	c := &Claims{Subject: reg.Sub, Issuer: reg.Iss, Audience: aud, ExpiresAt: exp}
+	if reg.Scope != "" {
+		c.Scopes = strings.Fields(reg.Scope)
+	} else if c.Scopes, err = stringOrList(reg.Scp); err != nil {
+		return nil, invalid("malformed scp")
+	}
+	if len(c.Scopes) == 1 { // "scp" given as one space separated string
+		c.Scopes = strings.Fields(c.Scopes[0])
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &all); err != nil {
+		return nil, invalid("claims: %v", err)
+	}
+	if raw, ok := all[v.opts.TenantClaim]; ok {
+		if err := json.Unmarshal(raw, &c.Tenant); err != nil {
+			return nil, invalid("claim %q must be a string", v.opts.TenantClaim)
+		}
+	}
+	return c, nil
+}
+
+// numericDate parses a NumericDate claim (seconds since the epoch, possibly fractional); nil is the zero time.
+func numericDate(n *json.Number) (time.Time, error) {
+	if n == nil {
+		return time.Time{}, nil
+	}
+	f, err := n.Float64()
+	if err != nil || f <= 0 {
+		return time.Time{}, errors.New("bad NumericDate")
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), nil
+}
+
+// stringOrList reads claims such as "aud" that are a single string or a list of strings.
+func stringOrList(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return []string{one}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,67 @@
+// Package keyusage counts the requests made with each API key, so operators can see who still uses a key
+// before retiring it. Requests are aggregated in memory by a Tracker and flushed to a shared Store in batches.
+package keyusage
+
+import (
+	"context"
+	"time"
+)
+
+// UnmatchedRoute counts requests that matched no route, so unknown paths cannot grow the route table.
+const UnmatchedRoute = "unmatched"
+
+// Event is one request authenticated by an API key.
+type Event struct {
+	KeyID     string // middleware.KeyID of the key; never the secret
+	TenantID  string
+	Route     string // method and route pattern, e.g. "GET /v1/users/{id}"
+	Status    int
+	IP        string
+	UserAgent string
+	At        time.Time
+}
+
+// Usage is the activity of one key. Counters are totals in a Store and deltas in a flush batch.
+type Usage struct {
+	KeyID         string
+	TenantID      string
+	Requests      int64
+	Errors        int64 // responses with status >= 400
+	LastUsedAt    time.Time
+	LastIP        string
+	LastUserAgent string
+	Routes        map[string]int64 // requests per route
+}
+
+// merge adds the counters of o to u and keeps the most recent client details.
+func (u *Usage) merge(o *Usage) {
+	u.Requests += o.Requests
+	u.Errors += o.Errors
+	if o.LastUsedAt.After(u.LastUsedAt) {
+		u.LastUsedAt, u.LastIP, u.LastUserAgent = o.LastUsedAt, o.LastIP, o.LastUserAgent
+	}
+	if u.Routes == nil {
+		u.Routes = map[string]int64{}
+	}
+	for route, n := range o.Routes {
+		u.Routes[route] += n
+	}
+}
+
+func (u *Usage) clone() *Usage {
+	c := *u
+	c.Routes = make(map[string]int64, len(u.Routes))
+	for route, n := range u.Routes {
+		c.Routes[route] = n
+	}
+	return &c
+}
+
+// Store keeps usage totals shared by every instance.
+type Store interface {
+	// Add merges a batch of deltas into the totals: counters are summed, and the client details of the most
+	// recent use win.
+	Add(ctx context.Context, batch []Usage) error
+	// List returns the totals of the tenant's keys.
+	List(ctx context.Context, tenant string) ([]Usage, error)
+}
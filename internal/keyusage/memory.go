@@ -0,0 +1,43 @@
+package keyusage
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps totals in process, for in-memory mode; they do not survive restarts.
+type MemoryStore struct {
+	mu    sync.Mutex
+	usage map[string]*Usage // by tenant and key
+}
+
+func NewMemoryStore() *MemoryStore { return &MemoryStore{usage: map[string]*Usage{}} }
+
+func (m *MemoryStore) Add(_ context.Context, batch []Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range batch {
+		u := &batch[i]
+		id := u.TenantID + "|" + u.KeyID
+		if cur, ok := m.usage[id]; ok {
+			cur.merge(u)
+		} else {
+			m.usage[id] = u.clone()
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) List(_ context.Context, tenant string) ([]Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Usage{}
+	for _, u := range m.usage {
+		if u.TenantID == tenant {
+			out = append(out, *u.clone())
+		}
+	}
+	return out, nil
+}
+
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,92 @@
+package keyusage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisPrefix = "keyusage:"
+
+// addScript merges one delta into the hash KEYS[1] and lists the key in the tenant set KEYS[2].
+// ARGV: key id, requests, errors, last used (unix ms), ip, user agent, then route/count pairs.
+const addScript = `
+redis.call('SADD', KEYS[2], ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'requests', ARGV[2])
+redis.call('HINCRBY', KEYS[1], 'errors', ARGV[3])
+local last = tonumber(redis.call('HGET', KEYS[1], 'last_used_at') or '0')
+if tonumber(ARGV[4]) >= last then
+  redis.call('HSET', KEYS[1], 'last_used_at', ARGV[4], 'last_ip', ARGV[5], 'last_user_agent', ARGV[6])
+end
+for i = 7, #ARGV, 2 do
+  redis.call('HINCRBY', KEYS[1], 'route:' .. ARGV[i], ARGV[i + 1])
+end
+return 1
+`
+
+// RedisStore shares totals between instances: a hash per key, and a set per tenant naming its keys.
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStore(rdb *redis.Client) *RedisStore { return &RedisStore{rdb: rdb} }
+
+func (s *RedisStore) Add(ctx context.Context, batch []Usage) error {
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, u := range batch {
+			args := []any{u.KeyID, u.Requests, u.Errors, u.LastUsedAt.UnixMilli(), u.LastIP, u.LastUserAgent}
+			for route, n := range u.Routes {
+				args = append(args, route, n)
+			}
+			pipe.Eval(ctx, addScript, []string{redisPrefix + u.TenantID + ":" + u.KeyID, redisPrefix + u.TenantID}, args...)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) List(ctx context.Context, tenant string) ([]Usage, error) {
+	ids, err := s.rdb.SMembers(ctx, redisPrefix+tenant).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	if _, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, redisPrefix+tenant+":"+id)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	out := make([]Usage, 0, len(ids))
+	for i, id := range ids {
+		u := Usage{KeyID: id, TenantID: tenant, Routes: map[string]int64{}}
+		for field, v := range cmds[i].Val() {
+			n, _ := strconv.ParseInt(v, 10, 64)
+			switch field {
+			case "requests":
+				u.Requests = n
+			case "errors":
+				u.Errors = n
+			case "last_used_at":
+				u.LastUsedAt = time.UnixMilli(n).UTC()
+			case "last_ip":
+				u.LastIP = v
+			case "last_user_agent":
+				u.LastUserAgent = v
+			default:
+				if route, ok := strings.CutPrefix(field, "route:"); ok {
+					u.Routes[route] = n
+				}
+			}
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+var _ Store = (*RedisStore)(nil)
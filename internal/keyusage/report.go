@@ -0,0 +1,63 @@
+package keyusage
+
+import (
+	"sort"
+	"time"
+)
+
+// KeyInfo describes a known key for the usage report.
+type KeyInfo struct {
+	ID         string // middleware.KeyID of the key
+	TenantID   string
+	Name       string
+	Source     string // "env" or "managed"
+	Deprecated bool   // listed in API_KEYS_OLD, or rotated out
+	Revoked    bool
+	ExpiresAt  *time.Time
+}
+
+// ReportEntry is a key's usage with the attention it needs.
+type ReportEntry struct {
+	Usage
+	Key          *KeyInfo // nil for a key that is no longer known, e.g. removed from API_KEYS
+	ExpiringSoon bool     // expires within the report window
+}
+
+// Attention reports whether the key should be retired or replaced soon.
+func (e ReportEntry) Attention() bool {
+	return e.ExpiringSoon || (e.Key != nil && e.Key.Deprecated)
+}
+
+// BuildReport joins usage with the tenant's known keys, including keys that were never used. Keys needing
+// attention come first, then the busiest.
+func BuildReport(usage []Usage, keys []KeyInfo, now time.Time, within time.Duration) []ReportEntry {
+	byID := make(map[string]*KeyInfo, len(keys))
+	for i := range keys {
+		byID[keys[i].ID] = &keys[i]
+	}
+	out := make([]ReportEntry, 0, len(usage)+len(keys))
+	seen := make(map[string]bool, len(usage))
+	entry := func(u Usage, k *KeyInfo) ReportEntry {
+		e := ReportEntry{Usage: u, Key: k}
+		if k != nil && !k.Revoked && k.ExpiresAt != nil && k.ExpiresAt.After(now) {
+			e.ExpiringSoon = k.ExpiresAt.Sub(now) <= within
+		}
+		return e
+	}
+	for _, u := range usage {
+		seen[u.KeyID] = true
+		out = append(out, entry(u, byID[u.KeyID]))
+	}
+	for i := range keys {
+		if !seen[keys[i].ID] {
+			out = append(out, entry(Usage{KeyID: keys[i].ID}, &keys[i]))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if a, b := out[i].Attention(), out[j].Attention(); a != b {
+			return a
+		}
+		return out[i].Requests > out[j].Requests
+	})
+	return out
+}
@@ -0,0 +1,178 @@
+package keyusage
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// OtherKeyLabel is the metrics label shared by keys seen after Options.MaxMetricKeys distinct ones.
+const OtherKeyLabel = "other"
+
+type Options struct {
+	FlushInterval time.Duration // default 10s
+	MaxRoutes     int           // distinct routes counted per key; later ones count as UnmatchedRoute (default 100)
+	// MaxMetricKeys bounds the key label of the Prometheus metrics (default 100); nil Metrics disables them.
+	MaxMetricKeys int
+	Metrics       *metrics.Registry
+}
+
+// Tracker aggregates Events in memory and flushes them to its Store every FlushInterval, so requests never
+// wait for the Store.
+type Tracker struct {
+	store Store
+	log   *zap.Logger
+	opts  Options
+
+	mu       sync.Mutex
+	pending  map[string]*Usage   // by tenant and key
+	labelled map[string]struct{} // keys with their own metrics label
+}
+
+func NewTracker(store Store, log *zap.Logger, opts Options) *Tracker {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	if opts.MaxRoutes <= 0 {
+		opts.MaxRoutes = 100
+	}
+	if opts.MaxMetricKeys <= 0 {
+		opts.MaxMetricKeys = 100
+	}
+	return &Tracker{store: store, log: log, opts: opts, pending: map[string]*Usage{}, labelled: map[string]struct{}{}}
+}
+
+// Record counts ev towards the next flush and updates the metrics.
+func (t *Tracker) Record(ev Event) {
+	if ev.KeyID == "" {
+		return
+	}
+	if ev.Route == "" {
+		ev.Route = UnmatchedRoute
+	}
+	t.mu.Lock()
+	id := ev.TenantID + "|" + ev.KeyID
+	u, ok := t.pending[id]
+	if !ok {
+		u = &Usage{KeyID: ev.KeyID, TenantID: ev.TenantID, Routes: map[string]int64{}}
+		t.pending[id] = u
+	}
+	u.Requests++
+	if ev.Status >= 400 {
+		u.Errors++
+	}
+	if !ev.At.Before(u.LastUsedAt) {
+		u.LastUsedAt, u.LastIP, u.LastUserAgent = ev.At, ev.IP, ev.UserAgent
+	}
+	if _, ok := u.Routes[ev.Route]; !ok && len(u.Routes) >= t.opts.MaxRoutes {
+		ev.Route = UnmatchedRoute
+	}
+	u.Routes[ev.Route]++
+	label := t.metricLabel(ev.KeyID)
+	t.mu.Unlock()
+
+	if m := t.opts.Metrics; m != nil {
+		m.APIKeyRequests.WithLabelValues(label, strconv.Itoa(ev.Status/100)+"xx").Inc()
+		m.APIKeyLastUsed.WithLabelValues(label).Set(float64(ev.At.Unix()))
+	}
+}
+
+// metricLabel is key's own label until MaxMetricKeys keys have one, and OtherKeyLabel after. t.mu is held.
+func (t *Tracker) metricLabel(key string) string {
+	if _, ok := t.labelled[key]; ok {
+		return key
+	}
+	if len(t.labelled) >= t.opts.MaxMetricKeys {
+		return OtherKeyLabel
+	}
+	t.labelled[key] = struct{}{}
+	return key
+}
+
+// Flush writes the pending batch to the Store. A failed batch is kept and retried with the next one.
+func (t *Tracker) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = map[string]*Usage{}
+	t.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	out := make([]Usage, 0, len(batch))
+	for _, u := range batch {
+		out = append(out, *u)
+	}
+	if err := t.store.Add(ctx, out); err != nil {
+		t.mu.Lock()
+		for id, u := range batch {
+			if cur, ok := t.pending[id]; ok {
+				u.merge(cur)
+			}
+			t.pending[id] = u
+		}
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes every FlushInterval until ctx ends, then flushes once more.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := t.Flush(flushCtx); err != nil {
+				t.log.Warn("final api key usage flush failed", zap.Error(err))
+			}
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil && ctx.Err() == nil {
+				t.log.Warn("api key usage flush failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Usage returns the tenant's totals including this instance's unflushed batch, busiest key first.
+func (t *Tracker) Usage(ctx context.Context, tenant string) ([]Usage, error) {
+	stored, err := t.store.List(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*Usage, len(stored))
+	for i := range stored {
+		byKey[stored[i].KeyID] = &stored[i]
+	}
+	t.mu.Lock()
+	for _, u := range t.pending {
+		if u.TenantID != tenant {
+			continue
+		}
+		if cur, ok := byKey[u.KeyID]; ok {
+			cur.merge(u)
+		} else {
+			byKey[u.KeyID] = u.clone()
+		}
+	}
+	t.mu.Unlock()
+	out := make([]Usage, 0, len(byKey))
+	for _, u := range byKey {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].KeyID < out[j].KeyID
+	})
+	return out, nil
+}
@@ -0,0 +1,70 @@
+// Package mailer sends plain-text mail: to the log or a file in development, over SMTP in production.
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message is a plain-text mail to a single recipient.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers one message. An error means the message was not accepted for delivery.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// LogMailer writes each message to the application log instead of sending it.
+type LogMailer struct{ log *zap.Logger }
+
+func NewLogMailer(log *zap.Logger) *LogMailer { return &LogMailer{log: log} }
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	m.log.Info("mail", zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.String("text", msg.Text))
+	return nil
+}
+
+// FileMailer appends messages to a file as newline-delimited JSON, so development tools and tests can read
+// the tokens back.
+type FileMailer struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileMailer(path string) (*FileMailer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open mail file: %w", err)
+	}
+	return &FileMailer{f: f}, nil
+}
+
+type fileRecord struct {
+	SentAt  time.Time `json:"sent_at"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Text    string    `json:"text"`
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	b, err := json.Marshal(fileRecord{SentAt: time.Now().UTC(), To: msg.To, Subject: msg.Subject, Text: msg.Text})
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err = m.f.Write(append(b, '\n'))
+	return err
+}
+
+func (m *FileMailer) Close() error { return m.f.Close() }
@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMTPOptions configures an SMTPMailer. Username and Password, if set, authenticate with PLAIN, which
+// net/smtp only allows over TLS or to localhost.
+type SMTPOptions struct {
+	Addr     string // host:port
+	From     string
+	Username string
+	Password string
+	// TLSConfig is used for STARTTLS when the server offers it; nil verifies against the host of Addr.
+	TLSConfig *tls.Config
+}
+
+// SMTPMailer sends each message in its own SMTP session.
+type SMTPMailer struct {
+	opts SMTPOptions
+	host string
+}
+
+func NewSMTPMailer(opts SMTPOptions) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp address %q: %w", opts.Addr, err)
+	}
+	if opts.From == "" {
+		return nil, errors.New("smtp sender address required")
+	}
+	if opts.TLSConfig == nil {
+		opts.TLSConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+	return &SMTPMailer{opts: opts, host: host}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("mail header contains a line break")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.opts.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp dial: %w", err)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(m.opts.TLSConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if m.opts.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.opts.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("smtp RCPT TO: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(m.compose(msg)); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return c.Quit()
+}
+
+// compose renders msg as an RFC 5322 message with CRLF line endings; the dot-stuffing is left to net/smtp.
+func (m *SMTPMailer) compose(msg Message) []byte {
+	var b strings.Builder
+	header := func(k, v string) { b.WriteString(k + ": " + v + "\r\n") }
+	header("From", m.opts.From)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+uuid.NewString()+"@"+m.host+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	text := strings.ReplaceAll(msg.Text, "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	if !strings.HasSuffix(text, "\n") {
+		b.WriteString("\r\n")
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// UserMailOptions configures a UserMailer.
+type UserMailOptions struct {
+	// VerifyURL and ResetURL are the pages that consume email verification and password reset tokens; the
+	// token is added as the token query parameter. Empty mails the bare token.
+	VerifyURL string
+	ResetURL  string
+	// Timeout bounds the delivery of one mail (default 30s).
+	Timeout time.Duration
+}
+
+// UserMailer mails tokens to users in the background: it implements core.VerificationSender and
+// auth.ResetSender. Delivery failures are logged; the user can ask for a new token.
+type UserMailer struct {
+	m    Mailer
+	log  *zap.Logger
+	opts UserMailOptions
+	wg   sync.WaitGroup
+}
+
+func NewUserMailer(m Mailer, log *zap.Logger, opts UserMailOptions) *UserMailer {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	return &UserMailer{m: m, log: log, opts: opts}
+}
+
+func (v *UserMailer) SendVerification(ctx context.Context, u *core.User, token string, expires time.Time) {
+	text := v.text(u, fmt.Sprintf("please confirm that %s is your email address", u.Email), v.opts.VerifyURL, token, expires)
+	v.send(ctx, u, Message{To: u.Email, Subject: "Confirm your email address", Text: text})
+}
+
+func (v *UserMailer) SendPasswordReset(ctx context.Context, u *core.User, token string, expires time.Time) {
+	text := v.text(u, "someone asked to reset your password; to choose a new one, continue", v.opts.ResetURL, token, expires)
+	v.send(ctx, u, Message{To: u.Email, Subject: "Reset your password", Text: text})
+}
+
+func (v *UserMailer) send(ctx context.Context, u *core.User, msg Message) {
+	// the request may end before the mail is out; keep its values (tenant, request ID) but not its deadline
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), v.opts.Timeout)
+	v.wg.Add(1)
+	go func() {
+		defer v.wg.Done()
+		defer cancel()
+		if err := v.m.Send(ctx, msg); err != nil {
+			v.log.Warn("mail failed", zap.String("subject", msg.Subject), zap.String("user_id", u.ID.String()), zap.Error(err))
+		}
+	}()
+}
+
+// Wait blocks until the mails sent so far are delivered or have failed, e.g. before shutting down.
+func (v *UserMailer) Wait() { v.wg.Wait() }
+
+func (v *UserMailer) text(u *core.User, ask, link, token string, expires time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hi %s,\n\n%s", u.Name, ask)
+	if link != "" {
+		sep := "?"
+		if strings.Contains(link, "?") {
+			sep = "&"
+		}
+		fmt.Fprintf(&b, " by opening this link:\n\n%s%stoken=%s\n", link, sep, url.QueryEscape(token))
+	} else {
+		fmt.Fprintf(&b, " by submitting this token:\n\n%s\n", token)
+	}
+	fmt.Fprintf(&b, "\nIt expires at %s. If you did not expect this mail, ignore it.\n", expires.UTC().Format(time.RFC1123))
+	return b.String()
+}
@@ -9,6 +9,9 @@ type Registry struct {
 	Gatherer     *prometheus.Registry
 	HTTPRequests *prometheus.CounterVec
 	HTTPDuration *prometheus.HistogramVec
+	// Per API key; the key label is bounded by keyusage.Options.MaxMetricKeys
+	APIKeyRequests *prometheus.CounterVec
+	APIKeyLastUsed *prometheus.GaugeVec
 }
 
 func NewRegistry() *Registry {
@@ -16,5 +19,7 @@ func NewRegistry() *Registry {
 	r := &Registry{Gatherer: reg}
 	r.HTTPRequests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{Name: "http_requests_total", Help: "Total HTTP requests"}, []string{"method", "path", "status"})
 	r.HTTPDuration = promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{Name: "http_request_duration_seconds", Help: "Duration", Buckets: prometheus.DefBuckets}, []string{"method", "path"})
+	r.APIKeyRequests = promauto.With(reg).NewCounterVec(prometheus.CounterOpts{Name: "api_key_requests_total", Help: "Requests per API key and status class"}, []string{"key", "class"})
+	r.APIKeyLastUsed = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{Name: "api_key_last_used_timestamp_seconds", Help: "Last request per API key"}, []string{"key"})
 	return r
 }
@@ -1,9 +1,14 @@
 package middleware
 
 import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
     "net/http"
     "strings"
     "time"
+
+    "github.com/hex-zero/MaxwellGoSpine/internal/core"
 )
 
 // APIKeyAuth returns middleware enforcing presence of a valid API key.
@@ -12,6 +17,12 @@ type APIKeyOptions struct {
     Current []string
     Old     []string // accepted but deprecated
     Expiries map[string]int64 // unix date (start of day) expiry (exclusive)
+    Tenants  map[string]string // key -> tenant its requests are scoped to; unlisted keys get core.DefaultTenant
+    Scopes   map[string][]core.Scope // key -> scopes it is limited to; once set, unlisted keys get none (nil: no limits)
+    Lookup   KeyLookup // resolves keys not listed above, e.g. minted ones; nil accepts only the listed keys
+    // Required rejects requests without a valid key even when no key is configured, because another
+    // credential (e.g. a bearer JWT) is; otherwise such a deployment would let anonymous requests through.
+    Required bool
 }
 
 func APIKeyAuth(keys []string) func(http.Handler) http.Handler { // backward compat
@@ -19,7 +30,7 @@ func APIKeyAuth(keys []string) func(http.Handler) http.Handler { // backward com
 }
 
 func APIKeyAuthWithOpts(opts APIKeyOptions) func(http.Handler) http.Handler {
-    if len(opts.Current) == 0 && len(opts.Old) == 0 {
+    if !opts.Enabled() {
         return func(next http.Handler) http.Handler { return next }
     }
     current := make(map[string]struct{}, len(opts.Current))
@@ -45,7 +56,7 @@ func APIKeyAuthWithOpts(opts APIKeyOptions) func(http.Handler) http.Handler {
                     unauthorized(w)
                     return
                 }
-                next.ServeHTTP(w, r)
+                next.ServeHTTP(w, r.WithContext(opts.WithKey(r.Context(), candidate)))
                 return
             }
             if _, ok := old[candidate]; ok {
@@ -54,14 +65,73 @@ func APIKeyAuthWithOpts(opts APIKeyOptions) func(http.Handler) http.Handler {
                     return
                 }
                 w.Header().Add("Warning", "299 - \"Deprecated API key in use; rotate to a current key\"")
-                next.ServeHTTP(w, r)
+                next.ServeHTTP(w, r.WithContext(opts.WithKey(r.Context(), candidate)))
                 return
             }
+            if opts.Lookup != nil {
+                ctx, k, err := opts.lookup(r.Context(), candidate)
+                if err != nil {
+                    http.Error(w, "api key lookup failed", http.StatusServiceUnavailable)
+                    return
+                }
+                if k != nil {
+                    if k.Deprecated() {
+                        w.Header().Add("Warning", "299 - \"Deprecated API key in use; rotate to a current key\"")
+                    }
+                    next.ServeHTTP(w, r.WithContext(ctx))
+                    return
+                }
+            }
             unauthorized(w)
         })
     }
 }
 
+// Valid reports whether key is accepted (current or deprecated, and unexpired), for transports that carry
+// the key outside HTTP headers, such as the GraphQL WebSocket connection_init payload.
+func (opts APIKeyOptions) Valid(key string) bool {
+    if key == "" || isExpired(key, opts.Expiries) {
+        return false
+    }
+    for _, k := range opts.Current {
+        if k == key { return true }
+    }
+    for _, k := range opts.Old {
+        if k == key { return true }
+    }
+    return false
+}
+
+const APIKeyIDKey ctxKey = "api_key_id"
+
+// KeyID is the non-secret identity of an API key ("apikey:" + 12 hex chars of its SHA-256), safe to log and audit.
+func KeyID(key string) string {
+    sum := sha256.Sum256([]byte(key))
+    return "apikey:" + hex.EncodeToString(sum[:6])
+}
+
+// GetAPIKeyID returns the KeyID of the key that authenticated the request, or "" if none did.
+func GetAPIKeyID(ctx context.Context) string { v, _ := ctx.Value(APIKeyIDKey).(string); return v }
+
+// WithAPIKeyID records key's identity in ctx, as the middleware does for header-authenticated requests.
+func WithAPIKeyID(ctx context.Context, key string) context.Context {
+    return context.WithValue(ctx, APIKeyIDKey, KeyID(key))
+}
+
+// WithKey records key's identity, its tenant (see core.WithTenant) and its scopes (see core.WithScopes) in
+// ctx, as the middleware does for header-authenticated requests.
+func (opts APIKeyOptions) WithKey(ctx context.Context, key string) context.Context {
+    tenant := opts.Tenants[key]
+    if tenant == "" {
+        tenant = core.DefaultTenant
+    }
+    ctx = core.WithTenant(WithAPIKeyID(ctx, key), tenant)
+    if opts.Scopes != nil {
+        ctx = core.WithScopes(ctx, opts.Scopes[key]) // an unlisted key can authenticate but do nothing
+    }
+    return ctx
+}
+
 func isExpired(key string, expiries map[string]int64) bool {
     if len(expiries) == 0 { return false }
     if ts, ok := expiries[key]; ok {
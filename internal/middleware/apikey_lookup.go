@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// KeyLookup resolves API keys minted at runtime; apikey.Service implements it.
+type KeyLookup interface {
+	// LookupKey returns the active key with the secret, or nil.
+	LookupKey(ctx context.Context, secret string) (*apikey.Key, error)
+}
+
+// Enabled reports whether requests must authenticate: some key is configured, or opts.Required is set.
+func (opts APIKeyOptions) Enabled() bool {
+	return opts.Required || len(opts.Current) > 0 || len(opts.Old) > 0 || opts.Lookup != nil
+}
+
+// Authenticate resolves key against the listed keys and then opts.Lookup, for transports that carry the key
+// outside HTTP headers; it returns ctx carrying the key's identity, tenant and scopes, or ok false.
+func (opts APIKeyOptions) Authenticate(ctx context.Context, key string) (_ context.Context, ok bool, err error) {
+	if opts.Valid(key) {
+		return opts.WithKey(ctx, key), true, nil
+	}
+	if opts.Lookup == nil || key == "" {
+		return ctx, false, nil
+	}
+	ctx, k, err := opts.lookup(ctx, key)
+	return ctx, k != nil, err
+}
+
+// lookup resolves a minted key, returning ctx carrying its identity, tenant and scopes, or a nil key.
+func (opts APIKeyOptions) lookup(ctx context.Context, key string) (context.Context, *apikey.Key, error) {
+	k, err := opts.Lookup.LookupKey(ctx, key)
+	if err != nil || k == nil {
+		return ctx, nil, err
+	}
+	return withManagedKey(ctx, k), k, nil
+}
+
+// withManagedKey records the identity (the KeyID of its secret), tenant and scopes of a minted key in ctx.
+func withManagedKey(ctx context.Context, k *apikey.Key) context.Context {
+	ctx = core.WithTenant(context.WithValue(ctx, APIKeyIDKey, k.UsageID()), k.TenantID)
+	return core.WithScopes(ctx, k.Scopes)
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// AnonymousActor is audited for requests that no API key authenticated (auth disabled).
+const AnonymousActor = "anonymous"
+
+// AuditContext attributes service calls made while handling the request to the signed-in end user or else
+// the bearer token subject or authenticated API key, and to the request ID. It must run after RequestID,
+// APIKeyAuthWithOpts or BearerAuth, and SessionAuth.
+func AuditContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithAudit(r.Context())))
+	})
+}
+
+// WithAudit derives the core.AuditContext from the end user, bearer token or API key identity and request ID
+// already in ctx.
+func WithAudit(ctx context.Context) context.Context {
+	actor := GetAPIKeyID(ctx)
+	if p := PrincipalFrom(ctx); p != nil {
+		actor = "jwt:" + p.Subject
+	}
+	if id, ok := core.EndUserFrom(ctx); ok {
+		actor = "user:" + id.String()
+	}
+	if actor == "" {
+		actor = AnonymousActor
+	}
+	return core.WithAuditContext(ctx, core.AuditContext{Actor: actor, RequestID: GetRequestID(ctx)})
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/servertls"
+)
+
+// HasClientCert reports whether r arrived over TLS with a client certificate that verified against the
+// configured client CAs.
+func HasClientCert(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// ClientCertAuth authenticates requests by their verified client certificate (mTLS). identities maps a
+// certificate name (see servertls.Names) to the credential of an API key, named as for SignatureAuth; the
+// first name of the certificate that is mapped wins. The request then carries that key's identity, tenant and
+// scopes, so a certificate is the same principal as its key and is revoked or rescoped along with it.
+// Requests without a verified certificate, or whose certificate is not mapped, are rejected.
+func ClientCertAuth(keys APIKeyOptions, identities map[string]string) func(http.Handler) http.Handler {
+	creds := newCredentials(keys)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasClientCert(r) {
+				http.Error(w, "client certificate required", http.StatusUnauthorized)
+				return
+			}
+			var credential string
+			for _, name := range servertls.Names(r.TLS.VerifiedChains[0][0]) {
+				if c, ok := identities[name]; ok {
+					credential = c
+					break
+				}
+			}
+			if credential == "" {
+				http.Error(w, "client certificate is not mapped to an api key", http.StatusUnauthorized)
+				return
+			}
+			key, err := creds.resolve(r.Context(), credential)
+			if err != nil {
+				http.Error(w, "api key lookup failed", http.StatusServiceUnavailable)
+				return
+			}
+			if key == nil {
+				http.Error(w, "api key of client certificate is unknown, expired or revoked", http.StatusUnauthorized)
+				return
+			}
+			if key.deprecated {
+				w.Header().Add("Warning", "299 - \"Deprecated API key in use; rotate to a current key\"")
+			}
+			next.ServeHTTP(w, r.WithContext(key.ctx))
+		})
+	}
+}
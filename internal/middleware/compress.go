@@ -2,7 +2,6 @@ package middleware
 
 import (
 	"compress/gzip"
-	"io"
 	"net/http"
 	"strings"
 )
@@ -13,7 +12,7 @@ func Gzip(level int) func(http.Handler) http.Handler {
 	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || IsWebSocketUpgrade(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -24,7 +23,7 @@ func Gzip(level int) func(http.Handler) http.Handler {
 			}
 			defer gz.Close()
 			w.Header().Set("Content-Encoding", "gzip")
-			gw := &gzipResponseWriter{ResponseWriter: w, Writer: gz}
+			gw := &gzipResponseWriter{ResponseWriter: w, gz: gz}
 			next.ServeHTTP(gw, r)
 		})
 	}
@@ -32,7 +31,18 @@ func Gzip(level int) func(http.Handler) http.Handler {
 
 type gzipResponseWriter struct {
 	http.ResponseWriter
-	io.Writer
+	gz *gzip.Writer
 }
 
-func (w *gzipResponseWriter) Write(b []byte) (int, error) { return w.Writer.Write(b) }
+func (w *gzipResponseWriter) Write(b []byte) (int, error) { return w.gz.Write(b) }
+
+// Flush pushes the compressed bytes written so far to the client, so streamed responses are not held back.
+func (w *gzipResponseWriter) Flush() {
+	_ = w.gz.Flush()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (e.g. to lift the write deadline).
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -19,7 +19,7 @@ func CORS(allowed []string) func(http.Handler) http.Handler {
 				// Keep Vary so caches differentiate per-origin
 				w.Header().Set("Vary", "Origin")
 				// Include X-API-Key so browser preflight succeeds; add common headers and ETag/Warning exposure
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Request-ID,X-API-Key")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Request-ID,X-API-Key,If-Match,If-None-Match")
 				w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PATCH,DELETE,OPTIONS")
 				w.Header().Set("Access-Control-Allow-Credentials", "true")
 				w.Header().Set("Access-Control-Expose-Headers", "ETag,Warning")
@@ -4,47 +4,91 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"net/http"
+	"strings"
 )
 
 // ETag sets an ETag header for cacheable 200 JSON responses and handles If-None-Match.
+// A handler-provided ETag (e.g. a row version) is kept instead of hashing the body.
+// Streamed responses (text/event-stream, or any handler that flushes) and WebSocket upgrades bypass the buffer.
 func ETag(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
 		rr := &respRecorder{ResponseWriter: w, status: 200}
 		next.ServeHTTP(rr, r)
+		if rr.streaming {
+			return
+		}
 		if rr.status == http.StatusOK && rr.hdrContentTypeJSON() && len(rr.body) > 0 {
-			sum := sha256.Sum256(rr.body)
-			etag := "\"" + hex.EncodeToString(sum[:8]) + "\"" // short strong etag
-			if inm := r.Header.Get("If-None-Match"); inm != "" && inm == etag {
+			etag := w.Header().Get("ETag")
+			if etag == "" {
+				sum := sha256.Sum256(rr.body)
+				etag = "\"" + hex.EncodeToString(sum[:8]) + "\"" // short strong etag
 				w.Header().Set("ETag", etag)
+			}
+			if inm := r.Header.Get("If-None-Match"); inm != "" && inm == etag {
 				w.WriteHeader(http.StatusNotModified)
 				return
 			}
-			w.Header().Set("ETag", etag)
-			// rewrite body
-			if !rr.wrote {
-				w.WriteHeader(rr.status)
-			}
-			_, _ = w.Write(rr.body)
 		}
+		// headers are held back until here so the ETag above is not sent too late
+		w.WriteHeader(rr.status)
+		_, _ = w.Write(rr.body)
 	})
 }
 
 type respRecorder struct {
 	http.ResponseWriter
-	body   []byte
-	wrote  bool
-	status int
+	body      []byte
+	wrote     bool
+	status    int
+	streaming bool // passing writes through; no ETag for this response
 }
 
 func (r *respRecorder) WriteHeader(code int) {
+	if r.wrote {
+		return
+	}
 	r.status = code
-	r.ResponseWriter.WriteHeader(code)
 	r.wrote = true
+	if strings.HasPrefix(r.Header().Get("Content-Type"), "text/event-stream") {
+		r.stream()
+	}
 }
 func (r *respRecorder) Write(b []byte) (int, error) {
+	if !r.wrote {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.streaming {
+		return r.ResponseWriter.Write(b)
+	}
 	r.body = append(r.body, b...)
 	return len(b), nil
 }
+
+// Flush switches to pass-through: whatever is buffered is sent and later writes go straight out.
+func (r *respRecorder) Flush() {
+	r.stream()
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *respRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+func (r *respRecorder) stream() {
+	if r.streaming {
+		return
+	}
+	r.streaming = true
+	r.ResponseWriter.WriteHeader(r.status)
+	if len(r.body) > 0 {
+		_, _ = r.ResponseWriter.Write(r.body)
+		r.body = nil
+	}
+}
 func (r *respRecorder) hdrContentTypeJSON() bool {
 	ct := r.Header().Get("Content-Type")
 	return ct == "application/json" || ct == "application/json; charset=utf-8"
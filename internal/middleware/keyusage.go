@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
+)
+
+const maxUserAgent = 256
+
+// KeyUsage records each request authenticated by an API key in t, with its route pattern rather than its path,
+// so per-key route counts stay bounded. It must run inside the API key middleware.
+func KeyUsage(t *keyusage.Tracker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := GetAPIKeyID(r.Context())
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			route := ""
+			if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+				route = r.Method + " " + rc.RoutePattern()
+			}
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			ua := r.UserAgent()
+			if len(ua) > maxUserAgent {
+				ua = ua[:maxUserAgent]
+			}
+			t.Record(keyusage.Event{KeyID: key, TenantID: core.TenantFrom(r.Context()), Route: route, Status: sw.status,
+				IP: ip, UserAgent: ua, At: time.Now().UTC()})
+		})
+	}
+}
@@ -11,6 +11,9 @@ func Recovery(logger *zap.Logger) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec) // deliberate abort of a started response; net/http closes the connection quietly
+					}
 					logger.Error("panic recovered", zap.Any("error", rec), zap.ByteString("stack", debug.Stack()))
 					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				}
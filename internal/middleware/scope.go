@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/render"
+)
+
+// RequireScope lets the request through only if the caller holds scope (see core.RequireScope); otherwise it
+// answers 403 Problem Details naming the missing scope. It must run after the auth middlewares.
+func RequireScope(scope core.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := core.RequireScope(r.Context(), scope); err != nil {
+				ScopeProblem(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ScopeProblem writes the 403 for a *core.ScopeError returned by core.RequireScope.
+func ScopeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	render.Problem(w, r, http.StatusForbidden, "Insufficient Scope", err.Error()+" for this operation")
+}
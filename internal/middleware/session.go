@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/auth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// SessionHeader carries the session token of the end user on whose behalf the calling application acts.
+const SessionHeader = "X-Session-Token"
+
+// SessionAuthenticator resolves session tokens; auth.Service implements it.
+type SessionAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*auth.Session, error)
+}
+
+// SessionAuth identifies the end user of requests carrying SessionHeader (see core.EndUserFrom). It runs
+// after APIKeyAuthWithOpts: the key still authenticates the application and picks the tenant, and the session
+// must belong to that tenant. Requests without the header pass unchanged; an invalid token is a 401.
+func SessionAuth(a SessionAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(SessionHeader)
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			s, err := a.Authenticate(r.Context(), token)
+			if errors.Is(err, auth.ErrInvalidSession) {
+				w.Header().Set("WWW-Authenticate", "Session realm=api")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, "session lookup failed", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(core.WithEndUser(r.Context(), s.UserID)))
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AcceptsEventStream reports whether the client asked for a text/event-stream response.
+func AcceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// IsWebSocketUpgrade reports whether r asks to switch to the WebSocket protocol. Such requests need the
+// raw connection, so buffering middlewares must hand them the original ResponseWriter.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
@@ -3,12 +3,32 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"slices"
 	"time"
 )
 
-func Timeout(d time.Duration) func(http.Handler) http.Handler {
+type TimeoutOptions struct {
+	// Exempt paths are never bounded: their handlers apply a bound of their own (e.g. bulk export and import)
+	// or are long-lived by design (event streams), ending when the client disconnects.
+	Exempt []string
+	// WebSocket paths are exempt only for WebSocket upgrades; plain requests to them are bounded as usual.
+	WebSocket []string
+}
+
+// Timeout bounds the request context to d, except for requests to the exempt paths.
+func Timeout(d time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return TimeoutWithOpts(d, TimeoutOptions{Exempt: exempt})
+}
+
+// TimeoutWithOpts bounds the request context to d, except as opts allows. Exemptions go by route only:
+// headers such as Accept: text/event-stream are up to the client and would let any request escape the bound.
+func TimeoutWithOpts(d time.Duration, opts TimeoutOptions) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(opts.Exempt, r.URL.Path) || (IsWebSocketUpgrade(r) && slices.Contains(opts.WebSocket, r.URL.Path)) {
+				next.ServeHTTP(w, r)
+				return
+			}
 			ctx, cancel := context.WithTimeout(r.Context(), d)
 			defer cancel()
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -0,0 +1,58 @@
+package outbox
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"time"
+)
+
+// TypePrefix namespaces event types, e.g. "com.maxwell.user.created".
+const TypePrefix = "com.maxwell."
+
+// CloudEvent is a CloudEvents 1.0 envelope in structured JSON mode.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	TenantID        string          `json:"tenantid,omitempty"` // extension attribute: the tenant whose user changed
+	Data            json.RawMessage `json:"data"`
+}
+
+// userData is the event payload; it mirrors the REST user representation.
+type userData struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Email     string     `json:"email,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   int64      `json:"version,omitempty"`
+	// Attributes are omitted when empty
+	Attributes core.Attributes `json:"attributes,omitempty"`
+}
+
+// NewCloudEvent wraps e; deletes and purges carry only the user id as data.
+func NewCloudEvent(source string, e core.UserEvent) CloudEvent {
+	d := userData{ID: e.UserID}
+	if u := e.User; u != nil {
+		d.Name, d.Email, d.Version, d.Attributes = u.Name, u.Email, u.Version, u.Attributes
+		d.CreatedAt, d.UpdatedAt, d.DeletedAt = &u.CreatedAt, &u.UpdatedAt, u.DeletedAt
+	}
+	data, _ := json.Marshal(d)
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              e.ID.String(),
+		Source:          source,
+		Type:            TypePrefix + string(e.Type),
+		Subject:         e.UserID.String(),
+		Time:            e.OccurredAt,
+		DataContentType: "application/json",
+		TenantID:        e.TenantID,
+		Data:            data,
+	}
+}
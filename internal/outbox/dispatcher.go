@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"go.uber.org/zap"
+)
+
+// Store is the dispatcher's view of the outbox, implemented by postgres.OutboxStore and core.InMemoryUserRepo.
+// ProcessEvents hands up to limit undelivered events to fn, oldest first, and retires the first n that fn
+// reports delivered.
+type Store interface {
+	ProcessEvents(ctx context.Context, limit int, fn func(context.Context, []core.UserEvent) (int, error)) (int, error)
+}
+
+type DispatcherOptions struct {
+	PollInterval time.Duration // idle wait between polls (default 1s)
+	BatchSize    int           // events claimed per poll (default 100)
+	Source       string        // CloudEvents source attribute (default "/maxwell/users")
+}
+
+// Dispatcher moves events from the outbox to a Publisher. Delivery is at-least-once: an event is retired
+// only after Publish succeeds, and a failure stops the batch so later events never overtake it.
+type Dispatcher struct {
+	store Store
+	pub   Publisher
+	log   *zap.Logger
+	opts  DispatcherOptions
+}
+
+func NewDispatcher(store Store, pub Publisher, log *zap.Logger, opts DispatcherOptions) *Dispatcher {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Source == "" {
+		opts.Source = "/maxwell/users"
+	}
+	return &Dispatcher{store: store, pub: pub, log: log, opts: opts}
+}
+
+// Run polls until ctx is cancelled. A full batch is followed immediately by the next poll to drain backlogs.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.log.Warn("user event dispatch failed", zap.Error(err))
+		}
+		if err == nil && n == d.opts.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.opts.PollInterval):
+		}
+	}
+}
+
+// DispatchOnce delivers at most one batch and reports how many events were published.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	return d.store.ProcessEvents(ctx, d.opts.BatchSize, func(ctx context.Context, events []core.UserEvent) (int, error) {
+		for i, e := range events {
+			if err := d.pub.Publish(ctx, NewCloudEvent(d.opts.Source, e)); err != nil {
+				return i, err
+			}
+		}
+		return len(events), nil
+	})
+}
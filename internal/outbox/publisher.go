@@ -0,0 +1,95 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Publisher delivers one event to the outside world. An error leaves the event in the outbox for a retry,
+// so implementations should be idempotent per event ID.
+type Publisher interface {
+	Publish(ctx context.Context, ev CloudEvent) error
+}
+
+// LogPublisher writes each event to the application log.
+type LogPublisher struct{ log *zap.Logger }
+
+func NewLogPublisher(log *zap.Logger) *LogPublisher { return &LogPublisher{log: log} }
+
+func (p *LogPublisher) Publish(_ context.Context, ev CloudEvent) error {
+	p.log.Info("user event",
+		zap.String("id", ev.ID),
+		zap.String("type", ev.Type),
+		zap.String("subject", ev.Subject),
+		zap.ByteString("data", ev.Data))
+	return nil
+}
+
+// FilePublisher appends events to a file as newline-delimited JSON.
+type FilePublisher struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open event file: %w", err)
+	}
+	return &FilePublisher{f: f}, nil
+}
+
+func (p *FilePublisher) Publish(_ context.Context, ev CloudEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.f.Write(append(b, '\n'))
+	return err
+}
+
+func (p *FilePublisher) Close() error { return p.f.Close() }
+
+// MemoryPublisher keeps published events in memory, for tests and local inspection.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []CloudEvent
+}
+
+func NewMemoryPublisher() *MemoryPublisher { return &MemoryPublisher{} }
+
+func (p *MemoryPublisher) Publish(_ context.Context, ev CloudEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, ev)
+	return nil
+}
+
+// Events returns a copy of everything published so far, in order.
+func (p *MemoryPublisher) Events() []CloudEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]CloudEvent(nil), p.events...)
+}
+
+// Multi publishes to each publisher in turn and stops at the first error; the event is then retried
+// for all of them, so earlier publishers may see it twice.
+func Multi(pubs ...Publisher) Publisher { return multiPublisher(pubs) }
+
+type multiPublisher []Publisher
+
+func (m multiPublisher) Publish(ctx context.Context, ev CloudEvent) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
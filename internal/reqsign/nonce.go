@@ -0,0 +1,63 @@
+package reqsign
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NonceStore remembers used nonces for as long as a request carrying them could pass the skew check.
+type NonceStore interface {
+	// Use records nonce as used for ttl and reports false if it already was.
+	Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is a local TTL set. It only protects the instance it runs on; use RedisNonceStore when
+// several instances serve the same clients.
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	until     map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{until: map[string]time.Time{}, now: time.Now}
+}
+
+func (m *MemoryNonceStore) Use(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if now.Sub(m.lastSweep) >= ttl {
+		for n, until := range m.until {
+			if !now.Before(until) {
+				delete(m.until, n)
+			}
+		}
+		m.lastSweep = now
+	}
+	if until, ok := m.until[nonce]; ok && now.Before(until) {
+		return false, nil
+	}
+	m.until[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// RedisNonceStore shares used nonces between every instance using the same Redis.
+type RedisNonceStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisNonceStore(rdb *redis.Client) *RedisNonceStore { return &RedisNonceStore{rdb: rdb} }
+
+func (s *RedisNonceStore) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.rdb.SetNX(ctx, "reqsign:nonce:"+nonce, 1, ttl).Result()
+}
+
+var (
+	_ NonceStore = (*MemoryNonceStore)(nil)
+	_ NonceStore = (*RedisNonceStore)(nil)
+)
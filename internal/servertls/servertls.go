@@ -0,0 +1,165 @@
+// Package servertls serves TLS from certificate files that can be replaced while the server runs, and
+// optionally verifies client certificates (mutual TLS) against a CA bundle.
+package servertls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Options struct {
+	CertFile string // PEM certificate chain, leaf first
+	KeyFile  string
+	// ClientCAFile enables mTLS: client certificates are verified against these PEM CAs. Without
+	// RequireClientCert a client may still connect without one, and authenticate another way.
+	ClientCAFile      string
+	RequireClientCert bool
+}
+
+// Reloader holds the certificate, and client CAs, currently served. Reload swaps them for the files' current
+// contents; a failed reload keeps the previous ones, so a half-written file never takes the server down.
+type Reloader struct {
+	opts Options
+
+	mu     sync.RWMutex
+	config *tls.Config // served to every new connection
+	stamp  string      // size and mtime of the files behind config
+}
+
+// New loads the files named by opts.
+func New(opts Options) (*Reloader, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("servertls: certificate and key file required")
+	}
+	r := &Reloader{opts: opts}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again.
+func (r *Reloader) Reload() error {
+	stamp := r.fileStamp()
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("servertls: load key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("servertls: read client CAs: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("servertls: no PEM certificates in %s", r.opts.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if r.opts.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	r.mu.Lock()
+	r.config, r.stamp = cfg, stamp
+	r.mu.Unlock()
+	return nil
+}
+
+// TLSConfig is the configuration for http.Server.TLSConfig or tls.NewListener; every handshake uses the
+// files loaded last.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+// Certificate returns the leaf certificate served at the moment.
+func (r *Reloader) Certificate() *x509.Certificate {
+	cfg := r.current()
+	leaf, _ := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	return leaf
+}
+
+func (r *Reloader) current() *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// Watch reloads whenever one of the files changes size or modification time, checking every interval until
+// ctx ends. Polling also catches the symlink swaps with which Kubernetes updates mounted secrets.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.RLock()
+			unchanged := r.stamp == r.fileStamp()
+			r.mu.RUnlock()
+			if unchanged {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Warn("tls reload failed; keeping the loaded certificate", zap.Error(err))
+				continue
+			}
+			log.Info("tls certificate reloaded", zap.Time("not_after", r.Certificate().NotAfter))
+		}
+	}
+}
+
+func (r *Reloader) fileStamp() string {
+	var b strings.Builder
+	for _, name := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		if fi, err := os.Stat(name); err == nil {
+			fmt.Fprintf(&b, "%d:%d;", fi.Size(), fi.ModTime().UnixNano())
+		} else {
+			b.WriteString("missing;")
+		}
+	}
+	return b.String()
+}
+
+// Names lists the identities a client certificate asserts, most specific first: its URI SANs ("URI:spiffe://…"),
+// DNS SANs ("DNS:…"), email SANs ("EMAIL:…") and finally its subject common name ("CN:…").
+func Names(cert *x509.Certificate) []string {
+	names := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+len(cert.EmailAddresses)+1)
+	for _, u := range cert.URIs {
+		names = append(names, "URI:"+u.String())
+	}
+	for _, d := range cert.DNSNames {
+		names = append(names, "DNS:"+d)
+	}
+	for _, e := range cert.EmailAddresses {
+		names = append(names, "EMAIL:"+e)
+	}
+	if cert.Subject.CommonName != "" {
+		names = append(names, "CN:"+cert.Subject.CommonName)
+	}
+	return names
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// APIKeyStore implements apikey.Store on the table of migrations 0014 and 0016.
+type APIKeyStore struct{ db *sql.DB }
+
+func NewAPIKeyStore(db *sql.DB) *APIKeyStore { return &APIKeyStore{db: db} }
+
+const apiKeyColumns = `id, tenant_id, name, owner, prefix, hash, scopes, created_at, expires_at, revoked_at, last_used_at, replaced_by, signing_key`
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertAPIKey(ctx context.Context, db execer, k *apikey.Key) error {
+	scopes, _ := json.Marshal(scopesOrEmpty(k.Scopes))
+	const q = `INSERT INTO api_keys (` + apiKeyColumns + `) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)`
+	_, err := db.ExecContext(ctx, q, k.ID, k.TenantID, k.Name, k.Owner, k.Prefix, k.Hash, string(scopes),
+		k.CreatedAt, k.ExpiresAt, k.RevokedAt, k.LastUsedAt, k.ReplacedBy, k.SealedSigningKey)
+	if err != nil {
+		return translateErr("insert api key", err)
+	}
+	return nil
+}
+
+func updateAPIKey(ctx context.Context, db execer, k *apikey.Key) error {
+	const q = `UPDATE api_keys SET expires_at=$2, revoked_at=$3, replaced_by=$4 WHERE id=$1`
+	res, err := db.ExecContext(ctx, q, k.ID, k.ExpiresAt, k.RevokedAt, k.ReplacedBy)
+	if err != nil {
+		return fmt.Errorf("update api key: %w", err)
+	}
+	return expectOne(res)
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, k *apikey.Key) error {
+	return insertAPIKey(ctx, s.db, k)
+}
+
+func (s *APIKeyStore) Get(ctx context.Context, id uuid.UUID) (*apikey.Key, error) {
+	return s.getOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id=$1`, id)
+}
+
+func (s *APIKeyStore) GetByPrefix(ctx context.Context, prefix string) (*apikey.Key, error) {
+	return s.getOne(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix=$1`, prefix)
+}
+
+func (s *APIKeyStore) getOne(ctx context.Context, q string, arg any) (*apikey.Key, error) {
+	k, err := scanAPIKey(s.db.QueryRowContext(ctx, q, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, core.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	return k, nil
+}
+
+func (s *APIKeyStore) List(ctx context.Context, tenant string) ([]*apikey.Key, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id=$1 ORDER BY created_at`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+	out := []*apikey.Key{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (s *APIKeyStore) Update(ctx context.Context, k *apikey.Key) error {
+	return updateAPIKey(ctx, s.db, k)
+}
+
+func (s *APIKeyStore) Rotate(ctx context.Context, old, next *apikey.Key) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := insertAPIKey(ctx, tx, next); err != nil {
+		return err
+	}
+	if err := updateAPIKey(ctx, tx, old); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Touch never moves last_used_at backwards, as writes from several instances may arrive out of order.
+func (s *APIKeyStore) Touch(ctx context.Context, id uuid.UUID, t time.Time) error {
+	const q = `UPDATE api_keys SET last_used_at=$2 WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < $2)`
+	if _, err := s.db.ExecContext(ctx, q, id, t); err != nil {
+		return fmt.Errorf("touch api key: %w", err)
+	}
+	return nil
+}
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*apikey.Key, error) {
+	var (
+		k      apikey.Key
+		scopes []byte
+	)
+	if err := row.Scan(&k.ID, &k.TenantID, &k.Name, &k.Owner, &k.Prefix, &k.Hash, &scopes, &k.CreatedAt,
+		&k.ExpiresAt, &k.RevokedAt, &k.LastUsedAt, &k.ReplacedBy, &k.SealedSigningKey); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &k.Scopes); err != nil {
+		return nil, fmt.Errorf("decode api key scopes: %w", err)
+	}
+	return &k, nil
+}
+
+func scopesOrEmpty(scopes []core.Scope) []core.Scope {
+	if scopes == nil {
+		return []core.Scope{}
+	}
+	return scopes
+}
+
+var _ apikey.Store = (*APIKeyStore)(nil)
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// auditLog implements core.Auditor on the audit_log table (migration 0008), inside or outside a transaction.
+type auditLog struct{ db dbtx }
+
+func (a auditLog) Record(ctx context.Context, entries ...core.AuditEntry) error {
+	const q = `INSERT INTO audit_log (id, user_id, action, actor, request_id, changes, occurred_at, tenant_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
+	for _, e := range entries {
+		tenant := e.TenantID
+		if tenant == "" {
+			tenant = core.TenantFrom(ctx)
+		}
+		changes, err := json.Marshal(changesOrEmpty(e.Changes))
+		if err != nil {
+			return fmt.Errorf("encode audit changes: %w", err)
+		}
+		if _, err := a.db.ExecContext(ctx, q, e.ID, e.UserID, string(e.Action), e.Actor, e.RequestID, string(changes), e.OccurredAt, tenant); err != nil {
+			return fmt.Errorf("insert audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a auditLog) History(ctx context.Context, userID uuid.UUID, limit int) ([]core.AuditEntry, error) {
+	const q = `SELECT id, user_id, action, actor, request_id, changes, occurred_at, tenant_id FROM audit_log
+		WHERE tenant_id=$1 AND user_id=$2 ORDER BY occurred_at DESC, id LIMIT $3`
+	rows, err := a.db.QueryContext(ctx, q, core.TenantFrom(ctx), userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query audit log: %w", err)
+	}
+	defer rows.Close()
+	out := []core.AuditEntry{}
+	for rows.Next() {
+		var (
+			e       core.AuditEntry
+			action  string
+			changes []byte
+		)
+		if err := rows.Scan(&e.ID, &e.UserID, &action, &e.Actor, &e.RequestID, &changes, &e.OccurredAt, &e.TenantID); err != nil {
+			return nil, fmt.Errorf("scan audit entry: %w", err)
+		}
+		e.Action = core.AuditAction(action)
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, fmt.Errorf("decode audit changes: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func changesOrEmpty(c []core.FieldChange) []core.FieldChange {
+	if c == nil {
+		return []core.FieldChange{}
+	}
+	return c
+}
+
+// Record and History make UserRepo the core.Auditor read by UserService.History.
+func (r *UserRepo) Record(ctx context.Context, entries ...core.AuditEntry) error {
+	return auditLog{r.db}.Record(ctx, entries...)
+}
+
+func (r *UserRepo) History(ctx context.Context, userID uuid.UUID, limit int) ([]core.AuditEntry, error) {
+	return auditLog{r.db}.History(ctx, userID, limit)
+}
+
+var _ core.Auditor = (*UserRepo)(nil)
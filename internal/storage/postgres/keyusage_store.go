@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
+)
+
+// KeyUsageStore implements keyusage.Store on the tables of migration 0015.
+type KeyUsageStore struct{ db *sql.DB }
+
+func NewKeyUsageStore(db *sql.DB) *KeyUsageStore { return &KeyUsageStore{db: db} }
+
+// Add merges the batch in one transaction. Rows are written in key and route order, so concurrent flushes
+// from several instances lock them in the same order and cannot deadlock.
+func (s *KeyUsageStore) Add(ctx context.Context, batch []keyusage.Usage) error {
+	sort.Slice(batch, func(i, j int) bool {
+		if batch[i].TenantID != batch[j].TenantID {
+			return batch[i].TenantID < batch[j].TenantID
+		}
+		return batch[i].KeyID < batch[j].KeyID
+	})
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	const upsertKey = `INSERT INTO api_key_usage (tenant_id, key_id, requests, errors, last_used_at, last_ip, last_user_agent)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		ON CONFLICT (tenant_id, key_id) DO UPDATE SET
+			requests = api_key_usage.requests + EXCLUDED.requests,
+			errors = api_key_usage.errors + EXCLUDED.errors,
+			last_ip = CASE WHEN EXCLUDED.last_used_at >= api_key_usage.last_used_at THEN EXCLUDED.last_ip ELSE api_key_usage.last_ip END,
+			last_user_agent = CASE WHEN EXCLUDED.last_used_at >= api_key_usage.last_used_at THEN EXCLUDED.last_user_agent ELSE api_key_usage.last_user_agent END,
+			last_used_at = GREATEST(api_key_usage.last_used_at, EXCLUDED.last_used_at)`
+	const upsertRoute = `INSERT INTO api_key_route_usage (tenant_id, key_id, route, requests) VALUES ($1,$2,$3,$4)
+		ON CONFLICT (tenant_id, key_id, route) DO UPDATE SET requests = api_key_route_usage.requests + EXCLUDED.requests`
+	for _, u := range batch {
+		if _, err := tx.ExecContext(ctx, upsertKey, u.TenantID, u.KeyID, u.Requests, u.Errors, u.LastUsedAt, u.LastIP, u.LastUserAgent); err != nil {
+			return fmt.Errorf("add api key usage: %w", err)
+		}
+		routes := make([]string, 0, len(u.Routes))
+		for route := range u.Routes {
+			routes = append(routes, route)
+		}
+		sort.Strings(routes)
+		for _, route := range routes {
+			if _, err := tx.ExecContext(ctx, upsertRoute, u.TenantID, u.KeyID, route, u.Routes[route]); err != nil {
+				return fmt.Errorf("add api key route usage: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *KeyUsageStore) List(ctx context.Context, tenant string) ([]keyusage.Usage, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT key_id, requests, errors, last_used_at, last_ip, last_user_agent
+		FROM api_key_usage WHERE tenant_id=$1`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("list api key usage: %w", err)
+	}
+	defer rows.Close()
+	out := []keyusage.Usage{}
+	index := map[string]int{}
+	for rows.Next() {
+		u := keyusage.Usage{TenantID: tenant, Routes: map[string]int64{}}
+		if err := rows.Scan(&u.KeyID, &u.Requests, &u.Errors, &u.LastUsedAt, &u.LastIP, &u.LastUserAgent); err != nil {
+			return nil, fmt.Errorf("scan api key usage: %w", err)
+		}
+		index[u.KeyID] = len(out)
+		out = append(out, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	routeRows, err := s.db.QueryContext(ctx, `SELECT key_id, route, requests FROM api_key_route_usage WHERE tenant_id=$1`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("list api key route usage: %w", err)
+	}
+	defer routeRows.Close()
+	for routeRows.Next() {
+		var (
+			key, route string
+			n          int64
+		)
+		if err := routeRows.Scan(&key, &route, &n); err != nil {
+			return nil, fmt.Errorf("scan api key route usage: %w", err)
+		}
+		if i, ok := index[key]; ok {
+			out[i].Routes[route] = n
+		}
+	}
+	return out, routeRows.Err()
+}
+
+var _ keyusage.Store = (*KeyUsageStore)(nil)
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"strconv"
+	"strings"
+)
+
+// txOutbox writes user_events rows (migration 0006) in the unit of work's transaction.
+type txOutbox struct{ tx *sql.Tx }
+
+func (o *txOutbox) Append(ctx context.Context, events ...core.UserEvent) error {
+	const q = `INSERT INTO user_events (id, type, user_id, payload, occurred_at, tenant_id) VALUES ($1,$2,$3,$4,$5,$6)`
+	for _, e := range events {
+		payload, err := json.Marshal(e.User)
+		if err != nil {
+			return fmt.Errorf("encode user event: %w", err)
+		}
+		tenant := e.TenantID
+		if tenant == "" {
+			tenant = core.TenantFrom(ctx)
+		}
+		if _, err := o.tx.ExecContext(ctx, q, e.ID, string(e.Type), e.UserID, payload, e.OccurredAt, tenant); err != nil {
+			return fmt.Errorf("insert user event: %w", err)
+		}
+	}
+	return nil
+}
+
+// OutboxStore is the dispatcher side of the user_events outbox.
+type OutboxStore struct{ db *sql.DB }
+
+func NewOutboxStore(db *sql.DB) *OutboxStore { return &OutboxStore{db: db} }
+
+// ProcessEvents locks up to limit undelivered events with FOR UPDATE SKIP LOCKED, so concurrent dispatchers
+// split the backlog instead of blocking, and hands them to fn oldest first. The first n events fn reports
+// delivered are marked published; if fn fails on the next one its attempt is recorded. The locks are held
+// until then, so a crashed dispatcher simply leaves its events to the next poll.
+func (s *OutboxStore) ProcessEvents(ctx context.Context, limit int, fn func(context.Context, []core.UserEvent) (int, error)) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	const sq = `SELECT seq, id, type, user_id, payload, occurred_at, tenant_id FROM user_events
+		WHERE published_at IS NULL ORDER BY seq LIMIT $1 FOR UPDATE SKIP LOCKED`
+	rows, err := tx.QueryContext(ctx, sq, limit)
+	if err != nil {
+		return 0, fmt.Errorf("claim user events: %w", err)
+	}
+	var (
+		seqs   []int64
+		events []core.UserEvent
+	)
+	for rows.Next() {
+		var (
+			seq     int64
+			e       core.UserEvent
+			typ     string
+			payload []byte
+		)
+		if err := rows.Scan(&seq, &e.ID, &typ, &e.UserID, &payload, &e.OccurredAt, &e.TenantID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan user event: %w", err)
+		}
+		e.Type = core.UserEventType(typ)
+		if err := json.Unmarshal(payload, &e.User); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("decode user event %d: %w", seq, err)
+		}
+		seqs = append(seqs, seq)
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	n, deliverErr := fn(ctx, events)
+	if n > 0 {
+		const pq = `UPDATE user_events SET published_at=now() WHERE seq = ANY($1::bigint[])`
+		if _, err := tx.ExecContext(ctx, pq, int64Array(seqs[:n])); err != nil {
+			return 0, fmt.Errorf("mark user events published: %w", err)
+		}
+	}
+	if deliverErr != nil && n < len(seqs) {
+		const fq = `UPDATE user_events SET attempts=attempts+1, last_error=$2 WHERE seq=$1`
+		if _, err := tx.ExecContext(ctx, fq, seqs[n], deliverErr.Error()); err != nil {
+			return 0, fmt.Errorf("record user event failure: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit user events: %w", err)
+	}
+	return n, deliverErr
+}
+
+// int64Array renders a Postgres array literal, keeping the query independent of driver slice support.
+func int64Array(v []int64) string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.FormatInt(n, 10)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -3,29 +3,58 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/jackc/pgx/v5/pgconn"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 )
 
+// UserRepo scopes every statement to the tenant in the context (core.TenantFrom) with an explicit tenant_id
+// predicate. Transactions additionally pin the tenant for the row-level security policy of migration 0011.
 type UserRepo struct{ db *sql.DB }
 type userTxRepo struct{ tx *sql.Tx }
 
+// dbtx is the query surface shared by *sql.DB and *sql.Tx so both repos can reuse query helpers.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 func NewUserRepo(db *sql.DB) *UserRepo { return &UserRepo{db: db} }
 
 // BeginTx implements core.TxStarter when asserted by service layer.
 func (r *UserRepo) BeginTx(ctx context.Context) (core.UnitOfWork, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
+	tx, err := beginTenantTx(ctx, r.db)
 	if err != nil {
-		return nil, fmt.Errorf("begin tx: %w", err)
+		return nil, err
 	}
 	return &userTxRepo{tx: tx}, nil
 }
 
+// beginTenantTx starts a transaction whose statements row-level security confines to the tenant in ctx.
+func beginTenantTx(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.tenant_id', $1, true)`, core.TenantFrom(ctx)); err != nil {
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("pin tenant: %w", err)
+	}
+	return tx, nil
+}
+
 // UnitOfWork interface implementation
 func (t *userTxRepo) UserRepo() core.UserRepository { return &txUserRepo{tx: t.tx} }
+func (t *userTxRepo) Outbox() core.EventOutbox      { return &txOutbox{tx: t.tx} }
+func (t *userTxRepo) Auditor() core.Auditor         { return auditLog{t.tx} }
 func (t *userTxRepo) Commit() error                 { return t.tx.Commit() }
 func (t *userTxRepo) Rollback() error               { return t.tx.Rollback() }
 
@@ -33,17 +62,149 @@ func (t *userTxRepo) Rollback() error               { return t.tx.Rollback() }
 type txUserRepo struct{ tx *sql.Tx }
 
 func (r *txUserRepo) Create(ctx context.Context, u *core.User) error {
-	const q = `INSERT INTO users (id, name, email, created_at, updated_at) VALUES ($1,$2,$3,$4,$5)`
-	if _, err := r.tx.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt); err != nil {
-		return fmt.Errorf("insert user: %w", err)
-	}
-	return nil
+	return create(ctx, r.tx, u)
+}
+func (r *txUserRepo) CreateMany(ctx context.Context, users []*core.User) error {
+	return createMany(ctx, r.tx, users)
 }
 func (r *txUserRepo) Get(ctx context.Context, id uuid.UUID) (*core.User, error) {
-	const q = `SELECT id, name, email, created_at, updated_at, deleted_at FROM users WHERE id=$1 AND deleted_at IS NULL`
-	row := r.tx.QueryRowContext(ctx, q, id)
-	u := &core.User{}
-	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt); err != nil {
+	return get(ctx, r.tx, id)
+}
+func (r *txUserRepo) Update(ctx context.Context, u *core.User) error {
+	return update(ctx, r.tx, u)
+}
+func (r *txUserRepo) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	return softDelete(ctx, r.tx, id, expectedVersion)
+}
+func (r *txUserRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	return restore(ctx, r.tx, id)
+}
+func (r *txUserRepo) Purge(ctx context.Context, id uuid.UUID) error {
+	return purge(ctx, r.tx, id)
+}
+func (r *txUserRepo) List(ctx context.Context, f core.UserFilter, s core.UserSort, page, pageSize int) ([]*core.User, int, error) {
+	return listPage(ctx, r.tx, f, s, page, pageSize)
+}
+func (r *txUserRepo) ListAfter(ctx context.Context, f core.UserFilter, s core.UserSort, after *core.Cursor, limit int) ([]*core.User, error) {
+	return listAfter(ctx, r.tx, f, s, after, limit)
+}
+func (r *txUserRepo) Search(ctx context.Context, query string, limit int) ([]core.SearchHit, error) {
+	return search(ctx, r.tx, query, limit)
+}
+func (r *txUserRepo) GetByEmail(ctx context.Context, email string) (*core.User, error) {
+	return getByEmail(ctx, r.tx, email)
+}
+
+func (r *UserRepo) Create(ctx context.Context, u *core.User) error {
+	return create(ctx, r.db, u)
+}
+
+// CreateMany implements core.BatchCreator. Batches larger than one statement run in their own transaction
+// so a failure still stores nothing.
+func (r *UserRepo) CreateMany(ctx context.Context, users []*core.User) error {
+	if len(users) <= insertChunk {
+		return createMany(ctx, r.db, users)
+	}
+	tx, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	if err := createMany(ctx, tx, users); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *UserRepo) Get(ctx context.Context, id uuid.UUID) (*core.User, error) {
+	return get(ctx, r.db, id)
+}
+
+func (r *UserRepo) Update(ctx context.Context, u *core.User) error {
+	return update(ctx, r.db, u)
+}
+
+func (r *UserRepo) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	return softDelete(ctx, r.db, id, expectedVersion)
+}
+
+func (r *UserRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	return restore(ctx, r.db, id)
+}
+
+func (r *UserRepo) Purge(ctx context.Context, id uuid.UUID) error {
+	return purge(ctx, r.db, id)
+}
+
+func (r *UserRepo) List(ctx context.Context, f core.UserFilter, s core.UserSort, page, pageSize int) ([]*core.User, int, error) {
+	return listPage(ctx, r.db, f, s, page, pageSize)
+}
+
+func (r *UserRepo) ListAfter(ctx context.Context, f core.UserFilter, s core.UserSort, after *core.Cursor, limit int) ([]*core.User, error) {
+	return listAfter(ctx, r.db, f, s, after, limit)
+}
+
+func (r *UserRepo) Search(ctx context.Context, query string, limit int) ([]core.SearchHit, error) {
+	return search(ctx, r.db, query, limit)
+}
+
+// GetByEmail implements core.EmailFinder.
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*core.User, error) {
+	return getByEmail(ctx, r.db, email)
+}
+
+// PasswordHash implements core.CredentialRepository.
+func (r *UserRepo) PasswordHash(ctx context.Context, id uuid.UUID) (string, error) {
+	return passwordHash(ctx, r.db, id)
+}
+
+// SetPasswordHash implements core.CredentialRepository.
+func (r *UserRepo) SetPasswordHash(ctx context.Context, id uuid.UUID, hash string) error {
+	return setPasswordHash(ctx, r.db, id, hash)
+}
+
+// exportFetch is the number of rows StreamUsers holds in memory at a time.
+const exportFetch = 500
+
+// StreamUsers implements core.UserStreamer with a server-side cursor, fetching exportFetch rows per round
+// trip. The cursor lives in a read-only transaction, so the export is one consistent snapshot.
+func (r *UserRepo) StreamUsers(ctx context.Context, f core.UserFilter, s core.UserSort, fn func(*core.User) error) error {
+	tx, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }() // nothing to commit; also releases the cursor
+	if _, err := tx.ExecContext(ctx, `SET TRANSACTION READ ONLY`); err != nil {
+		return fmt.Errorf("export users: %w", err)
+	}
+	where, args := userWhere(core.TenantFrom(ctx), f)
+	if _, err := tx.ExecContext(ctx, `DECLARE user_export NO SCROLL CURSOR FOR SELECT `+userColumns+` FROM users WHERE `+where+` `+orderBy(s), args...); err != nil {
+		return fmt.Errorf("export users: %w", err)
+	}
+	for {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`FETCH FORWARD %d FROM user_export`, exportFetch))
+		if err != nil {
+			return fmt.Errorf("export users: %w", err)
+		}
+		users, err := scanUsers(rows)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		if len(users) < exportFetch {
+			return nil
+		}
+	}
+}
+
+func get(ctx context.Context, q dbtx, id uuid.UUID) (*core.User, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id=$1 AND tenant_id=$2 AND deleted_at IS NULL`, id, core.TenantFrom(ctx))
+	u, err := scanUser(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, core.ErrNotFound
 		}
@@ -51,90 +212,174 @@ func (r *txUserRepo) Get(ctx context.Context, id uuid.UUID) (*core.User, error)
 	}
 	return u, nil
 }
-func (r *txUserRepo) Update(ctx context.Context, u *core.User) error {
-	const q = `UPDATE users SET name=$2, email=$3, updated_at=$4 WHERE id=$1 AND deleted_at IS NULL`
-	res, err := r.tx.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.UpdatedAt)
+
+// getByEmail finds a live user by normalized email through uq_users_tenant_email_live.
+func getByEmail(ctx context.Context, q dbtx, email string) (*core.User, error) {
+	row := q.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE tenant_id=$1 AND lower(email)=$2 AND deleted_at IS NULL`, core.TenantFrom(ctx), email)
+	u, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, core.ErrNotFound
+		}
+		return nil, fmt.Errorf("get user by email: %w", err)
+	}
+	return u, nil
+}
+
+func create(ctx context.Context, q dbtx, u *core.User) error {
+	attrs, err := attributesArg(u.Attributes)
 	if err != nil {
-		return fmt.Errorf("update user: %w", err)
+		return err
+	}
+	status, changedAt := statusArgs(u)
+	tenant := core.TenantFrom(ctx)
+	const iq = `INSERT INTO users (id, name, email, created_at, updated_at, attributes, status, status_changed_at, tenant_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+	if _, err := q.ExecContext(ctx, iq, u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt, attrs, status, changedAt, tenant); err != nil {
+		return translateErr("insert user", err)
+	}
+	u.TenantID = tenant
+	return nil
+}
+
+// insertChunk rows per statement keeps the 9 bind parameters per row far below Postgres' 65535 limit.
+const insertChunk = 1000
+
+// createMany inserts users with one multi-row INSERT per chunk instead of a round trip per user.
+func createMany(ctx context.Context, q dbtx, users []*core.User) error {
+	tenant := core.TenantFrom(ctx)
+	for start := 0; start < len(users); start += insertChunk {
+		chunk := users[start:min(start+insertChunk, len(users))]
+		var sb strings.Builder
+		sb.WriteString(`INSERT INTO users (id, name, email, created_at, updated_at, attributes, status, status_changed_at, tenant_id) VALUES `)
+		args := make([]any, 0, len(chunk)*9)
+		for i, u := range chunk {
+			attrs, err := attributesArg(u.Attributes)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			n := len(args)
+			fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9)
+			status, changedAt := statusArgs(u)
+			args = append(args, u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt, attrs, status, changedAt, tenant)
+		}
+		if _, err := q.ExecContext(ctx, sb.String(), args...); err != nil {
+			return translateErr("insert users", err)
+		}
+	}
+	for _, u := range users {
+		u.TenantID = tenant
+	}
+	return nil
+}
+
+// update relies on trg_users_bump_version (migration 0004) to increment version; the WHERE clause is the optimistic lock.
+func update(ctx context.Context, q dbtx, u *core.User) error {
+	attrs, err := attributesArg(u.Attributes)
+	if err != nil {
+		return err
+	}
+	status, changedAt := statusArgs(u)
+	const uq = `UPDATE users SET name=$2, email=$3, updated_at=$4, attributes=$6, status=$7, status_changed_at=$8, status_reason=$9, email_verified_at=$11 WHERE id=$1 AND tenant_id=$10 AND version=$5 AND deleted_at IS NULL`
+	res, err := q.ExecContext(ctx, uq, u.ID, u.Name, u.Email, u.UpdatedAt, u.Version, attrs, status, changedAt, u.StatusReason, core.TenantFrom(ctx), u.EmailVerifiedAt)
+	if err != nil {
+		return translateErr("update user", err)
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return core.ErrNotFound
+		return missingOrStale(ctx, q, u.ID)
 	}
+	u.Version++
 	return nil
 }
-func (r *txUserRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	const q = `UPDATE users SET deleted_at=$2 WHERE id=$1 AND deleted_at IS NULL`
+
+func softDelete(ctx context.Context, q dbtx, id uuid.UUID, expectedVersion int64) error {
 	now := time.Now().UTC()
-	res, err := r.tx.ExecContext(ctx, q, id, now)
+	tenant := core.TenantFrom(ctx)
+	var (
+		res sql.Result
+		err error
+	)
+	if expectedVersion == 0 {
+		res, err = q.ExecContext(ctx, `UPDATE users SET deleted_at=$2 WHERE id=$1 AND tenant_id=$3 AND deleted_at IS NULL`, id, now, tenant)
+	} else {
+		res, err = q.ExecContext(ctx, `UPDATE users SET deleted_at=$2 WHERE id=$1 AND tenant_id=$3 AND deleted_at IS NULL AND version=$4`, id, now, tenant, expectedVersion)
+	}
 	if err != nil {
 		return fmt.Errorf("soft delete user: %w", err)
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		return core.ErrNotFound
+		if expectedVersion == 0 {
+			return core.ErrNotFound
+		}
+		return missingOrStale(ctx, q, id)
 	}
 	return nil
 }
-func (r *txUserRepo) List(ctx context.Context, page, pageSize int) ([]*core.User, int, error) {
-	if page < 1 {
-		page = 1
+
+// missingOrStale explains a zero-row versioned write: the user is gone, or its version moved on.
+func missingOrStale(ctx context.Context, q dbtx, id uuid.UUID) error {
+	var exists bool
+	const eq = `SELECT EXISTS(SELECT 1 FROM users WHERE id=$1 AND tenant_id=$2 AND deleted_at IS NULL)`
+	if err := q.QueryRowContext(ctx, eq, id, core.TenantFrom(ctx)).Scan(&exists); err != nil {
+		return fmt.Errorf("check user version: %w", err)
 	}
-	if pageSize <= 0 || pageSize > 100 {
-		pageSize = 20
+	if !exists {
+		return core.ErrNotFound
 	}
-	offset := (page - 1) * pageSize
-	const q = `SELECT id, name, email, created_at, updated_at, deleted_at FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-	rows, err := r.tx.QueryContext(ctx, q, pageSize, offset)
+	return core.ErrStaleVersion
+}
+
+func restore(ctx context.Context, q dbtx, id uuid.UUID) error {
+	const rq = `UPDATE users SET deleted_at=NULL, updated_at=$2 WHERE id=$1 AND tenant_id=$3 AND deleted_at IS NOT NULL`
+	res, err := q.ExecContext(ctx, rq, id, time.Now().UTC(), core.TenantFrom(ctx))
 	if err != nil {
-		return nil, 0, fmt.Errorf("list users: %w", err)
+		return translateErr("restore user", err)
 	}
-	defer rows.Close()
-	var out []*core.User
-	for rows.Next() {
-		u := &core.User{}
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt); err != nil {
-			return nil, 0, fmt.Errorf("scan user: %w", err)
-		}
-		out = append(out, u)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, 0, err
-	}
-	var total int
-	if err := r.tx.QueryRowContext(ctx, `SELECT count(*) FROM users WHERE deleted_at IS NULL`).Scan(&total); err != nil {
-		return nil, 0, err
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return core.ErrNotFound
 	}
-	return out, total, nil
+	return nil
 }
 
-func (r *UserRepo) Create(ctx context.Context, u *core.User) error {
-	const q = `INSERT INTO users (id, name, email, created_at, updated_at) VALUES ($1,$2,$3,$4,$5)`
-	_, err := r.db.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt)
+func purge(ctx context.Context, q dbtx, id uuid.UUID) error {
+	res, err := q.ExecContext(ctx, `DELETE FROM users WHERE id=$1 AND tenant_id=$2`, id, core.TenantFrom(ctx))
 	if err != nil {
-		return fmt.Errorf("insert user: %w", err)
+		return fmt.Errorf("purge user: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return core.ErrNotFound
 	}
 	return nil
 }
 
-func (r *UserRepo) Get(ctx context.Context, id uuid.UUID) (*core.User, error) {
-	const q = `SELECT id, name, email, created_at, updated_at, deleted_at FROM users WHERE id=$1 AND deleted_at IS NULL`
-	row := r.db.QueryRowContext(ctx, q, id)
-	u := &core.User{}
-	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt); err != nil {
+// passwordHash reads the credential of a live user; the outer join tells a missing user from one without a password.
+func passwordHash(ctx context.Context, q dbtx, id uuid.UUID) (string, error) {
+	const pq = `SELECT coalesce(c.password_hash, '') FROM users u LEFT JOIN user_credentials c ON c.user_id=u.id
+		WHERE u.id=$1 AND u.tenant_id=$2 AND u.deleted_at IS NULL`
+	var hash string
+	if err := q.QueryRowContext(ctx, pq, id, core.TenantFrom(ctx)).Scan(&hash); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, core.ErrNotFound
+			return "", core.ErrNotFound
 		}
-		return nil, fmt.Errorf("get user: %w", err)
+		return "", fmt.Errorf("get password hash: %w", err)
 	}
-	return u, nil
+	return hash, nil
 }
 
-func (r *UserRepo) Update(ctx context.Context, u *core.User) error {
-	const q = `UPDATE users SET name=$2, email=$3, updated_at=$4 WHERE id=$1 AND deleted_at IS NULL`
-	res, err := r.db.ExecContext(ctx, q, u.ID, u.Name, u.Email, u.UpdatedAt)
+// setPasswordHash upserts the credential, selecting the user row so only a live user of the tenant gets one.
+func setPasswordHash(ctx context.Context, q dbtx, id uuid.UUID, hash string) error {
+	const sq = `INSERT INTO user_credentials (user_id, tenant_id, password_hash, updated_at)
+		SELECT id, tenant_id, $3, $4 FROM users WHERE id=$1 AND tenant_id=$2 AND deleted_at IS NULL
+		ON CONFLICT (user_id) DO UPDATE SET password_hash=EXCLUDED.password_hash, updated_at=EXCLUDED.updated_at`
+	res, err := q.ExecContext(ctx, sq, id, core.TenantFrom(ctx), hash, time.Now().UTC())
 	if err != nil {
-		return fmt.Errorf("update user: %w", err)
+		return fmt.Errorf("set password hash: %w", err)
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
@@ -143,21 +388,42 @@ func (r *UserRepo) Update(ctx context.Context, u *core.User) error {
 	return nil
 }
 
-func (r *UserRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	const q = `UPDATE users SET deleted_at=$2 WHERE id=$1 AND deleted_at IS NULL`
-	now := time.Now().UTC()
-	res, err := r.db.ExecContext(ctx, q, id, now)
-	if err != nil {
-		return fmt.Errorf("soft delete user: %w", err)
+const uniqueViolation = "23505"
+
+// uniqueFields maps unique constraints/indexes onto the API field they protect.
+var uniqueFields = map[string]string{
+	"uq_users_tenant_email_live": "email",
+	"uq_users_email_live":        "email", // pre-0011 schema
+	"users_email_key":            "email", // pre-0005 schema
+}
+
+// translateErr turns a unique violation (SQLSTATE 23505) into a *core.ConflictError and wraps anything else.
+func translateErr(op string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		field := uniqueFields[pgErr.ConstraintName]
+		if field == "" {
+			field = pgErr.ColumnName
+		}
+		return &core.ConflictError{Field: field, Value: conflictValue(pgErr.Detail)}
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		return core.ErrNotFound
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// conflictDetail captures the value from `Key (lower(email))=(a@b.c) already exists.`
+var conflictDetail = regexp.MustCompile(`\)=\((.*)\) already exists`)
+
+func conflictValue(detail string) string {
+	if m := conflictDetail.FindStringSubmatch(detail); m != nil {
+		return m[1]
 	}
-	return nil
+	return ""
 }
 
-func (r *UserRepo) List(ctx context.Context, page, pageSize int) ([]*core.User, int, error) {
+const userColumns = `id, name, email, created_at, updated_at, deleted_at, version, attributes, status, status_changed_at, status_reason, tenant_id, email_verified_at`
+
+// listPage is offset pagination plus a total count over the same filter.
+func listPage(ctx context.Context, q dbtx, f core.UserFilter, s core.UserSort, page, pageSize int) ([]*core.User, int, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -165,28 +431,211 @@ func (r *UserRepo) List(ctx context.Context, page, pageSize int) ([]*core.User,
 		pageSize = 20
 	}
 	offset := (page - 1) * pageSize
-	const q = `SELECT id, name, email, created_at, updated_at, deleted_at FROM users WHERE deleted_at IS NULL ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-	rows, err := r.db.QueryContext(ctx, q, pageSize, offset)
+	where, args := userWhere(core.TenantFrom(ctx), f)
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + where + ` ` + orderBy(s) +
+		fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2)
+	rows, err := q.QueryContext(ctx, query, append(append([]any{}, args...), pageSize, offset)...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("list users: %w", err)
 	}
+	out, err := scanUsers(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int
+	if err := q.QueryRowContext(ctx, `SELECT count(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// listAfter is keyset pagination; for the default sort it walks idx_users_created_at, and the row comparison keeps pages stable under concurrent inserts.
+func listAfter(ctx context.Context, q dbtx, f core.UserFilter, s core.UserSort, after *core.Cursor, limit int) ([]*core.User, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	where, args := userWhere(core.TenantFrom(ctx), f)
+	if after != nil {
+		op := ">"
+		if s.Desc {
+			op = "<"
+		}
+		args = append(args, after.KeyValue(), after.ID)
+		where += fmt.Sprintf(" AND (%s, id) %s ($%d, $%d)", sortColumn(s), op, len(args)-1, len(args))
+	}
+	args = append(args, limit)
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + where + ` ` + orderBy(s) + fmt.Sprintf(` LIMIT $%d`, len(args))
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// search ranks full-text matches (ts_rank) together with trigram word similarity so typos still match (migration 0003).
+func search(ctx context.Context, q dbtx, query string, limit int) ([]core.SearchHit, error) {
+	const sq = `SELECT ` + userColumns + `,
+		ts_rank(search, plainto_tsquery('simple', $1)) + greatest(word_similarity($1, name), word_similarity($1, email)) AS score
+		FROM users
+		WHERE tenant_id = $3 AND deleted_at IS NULL AND (search @@ plainto_tsquery('simple', $1) OR $1 <% name OR $1 <% email)
+		ORDER BY score DESC, id
+		LIMIT $2`
+	rows, err := q.QueryContext(ctx, sq, query, limit, core.TenantFrom(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
 	defer rows.Close()
-	var out []*core.User
+	out := []core.SearchHit{}
 	for rows.Next() {
-		u := &core.User{}
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt); err != nil {
-			return nil, 0, fmt.Errorf("scan user: %w", err)
+		var h core.SearchHit
+		u, err := scanUser(rows, &h.Score)
+		if err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
 		}
-		out = append(out, u)
+		h.User = u
+		out = append(out, h)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	var total int
-	if err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM users WHERE deleted_at IS NULL`).Scan(&total); err != nil {
-		return nil, 0, err
+	return out, nil
+}
+
+// userWhere renders f over the tenant's users as a parameterized predicate; only values are bound, never spliced.
+func userWhere(tenant string, f core.UserFilter) (string, []any) {
+	conds := []string{"tenant_id = $1"}
+	args := []any{tenant}
+	switch f.Deleted {
+	case core.DeletedInclude:
+	case core.DeletedOnly:
+		conds = append(conds, "deleted_at IS NOT NULL")
+	default:
+		conds = append(conds, "deleted_at IS NULL")
 	}
-	return out, total, nil
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.NamePrefix != "" {
+		add("name ILIKE $%d", escapeLike(f.NamePrefix)+"%")
+	}
+	if f.EmailDomain != "" {
+		add("email LIKE $%d", "%@"+escapeLike(f.EmailDomain))
+	}
+	if f.CreatedAfter != nil {
+		add("created_at >= $%d", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		add("created_at < $%d", *f.CreatedBefore)
+	}
+	if f.UpdatedAfter != nil {
+		add("updated_at >= $%d", *f.UpdatedAfter)
+	}
+	if f.UpdatedBefore != nil {
+		add("updated_at < $%d", *f.UpdatedBefore)
+	}
+	if len(f.Statuses) > 0 {
+		add("status = ANY($%d::text[])", textArray(f.Statuses))
+	}
+	keys := make([]string, 0, len(f.Attributes))
+	for k := range f.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // stable SQL text for the statement cache
+	for _, k := range keys {
+		args = append(args, k, f.Attributes[k])
+		conds = append(conds, fmt.Sprintf("attributes->>$%d = $%d", len(args)-1, len(args)))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// sortColumn maps the sort field onto a fixed column whitelist.
+func sortColumn(s core.UserSort) string {
+	switch s.Field {
+	case core.SortByUpdatedAt:
+		return "updated_at"
+	case core.SortByName:
+		return "name"
+	case core.SortByEmail:
+		return "email"
+	default:
+		return "created_at"
+	}
+}
+
+func orderBy(s core.UserSort) string {
+	dir := "ASC"
+	if s.Desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, id %s", sortColumn(s), dir, dir)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string { return likeEscaper.Replace(s) }
+
+// textArray renders a Postgres array literal; the values are validated statuses, which need no quoting.
+func textArray[T ~string](v []T) string {
+	parts := make([]string, len(v))
+	for i, s := range v {
+		parts[i] = string(s)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// scanUser reads one row selected with userColumns, followed by any extra columns.
+func scanUser(row interface{ Scan(...any) error }, extra ...any) (*core.User, error) {
+	u := &core.User{}
+	var attrs []byte
+	dest := append([]any{&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt, &u.Version, &attrs,
+		&u.Status, &u.StatusChangedAt, &u.StatusReason, &u.TenantID, &u.EmailVerifiedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	u.Attributes = core.Attributes{}
+	if len(attrs) > 0 {
+		if err := json.Unmarshal(attrs, &u.Attributes); err != nil {
+			return nil, fmt.Errorf("decode attributes: %w", err)
+		}
+	}
+	return u, nil
+}
+
+// statusArgs fills in the column defaults for users built without a status.
+func statusArgs(u *core.User) (core.UserStatus, time.Time) {
+	if u.Status == "" {
+		return core.StatusActive, u.CreatedAt
+	}
+	return u.Status, u.StatusChangedAt
+}
+
+// attributesArg encodes attributes for a JSONB column; nil is stored as an empty object.
+func attributesArg(attrs core.Attributes) (string, error) {
+	if attrs == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(attrs)
+	if err != nil {
+		return "", fmt.Errorf("encode attributes: %w", err)
+	}
+	return string(b), nil
+}
+
+func scanUsers(rows *sql.Rows) ([]*core.User, error) {
+	defer rows.Close()
+	out := []*core.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		out = append(out, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 // Existing root-level repository methods remain (non-transactional) below.
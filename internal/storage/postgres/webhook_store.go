@@ -0,0 +1,229 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/webhook"
+)
+
+// WebhookStore implements webhook.Store on the tables of migration 0007.
+type WebhookStore struct{ db *sql.DB }
+
+func NewWebhookStore(db *sql.DB) *WebhookStore { return &WebhookStore{db: db} }
+
+const subscriptionColumns = `id, url, secret, event_types, active, created_at, updated_at, tenant_id`
+
+func (s *WebhookStore) CreateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	types, _ := json.Marshal(eventTypesOrEmpty(sub.EventTypes))
+	const q = `INSERT INTO webhook_subscriptions (` + subscriptionColumns + `) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
+	if _, err := s.db.ExecContext(ctx, q, sub.ID, sub.URL, sub.Secret, string(types), sub.Active, sub.CreatedAt, sub.UpdatedAt, sub.TenantID); err != nil {
+		return fmt.Errorf("insert webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (s *WebhookStore) GetSubscription(ctx context.Context, id uuid.UUID) (*webhook.Subscription, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id=$1`, id)
+	sub, err := scanSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, core.ErrNotFound
+	}
+	return sub, err
+}
+
+func (s *WebhookStore) ListSubscriptions(ctx context.Context) ([]*webhook.Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+	out := []*webhook.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sub)
+	}
+	return out, rows.Err()
+}
+
+func (s *WebhookStore) UpdateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	types, _ := json.Marshal(eventTypesOrEmpty(sub.EventTypes))
+	const q = `UPDATE webhook_subscriptions SET url=$2, secret=$3, event_types=$4, active=$5, updated_at=$6 WHERE id=$1`
+	res, err := s.db.ExecContext(ctx, q, sub.ID, sub.URL, sub.Secret, string(types), sub.Active, sub.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("update webhook subscription: %w", err)
+	}
+	return expectOne(res)
+}
+
+// DeleteSubscription relies on ON DELETE CASCADE for deliveries and attempts.
+func (s *WebhookStore) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id=$1`, id)
+	if err != nil {
+		return fmt.Errorf("delete webhook subscription: %w", err)
+	}
+	return expectOne(res)
+}
+
+func (s *WebhookStore) Enqueue(ctx context.Context, ds []*webhook.Delivery) error {
+	const q = `INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	for _, d := range ds {
+		if _, err := s.db.ExecContext(ctx, q, d.ID, d.SubscriptionID, d.EventID, string(d.EventType), string(d.Payload),
+			string(d.Status), d.Attempts, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt); err != nil {
+			return fmt.Errorf("enqueue webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, updated_at`
+
+// ClaimDue leases due rows in one statement; SKIP LOCKED keeps concurrent workers from claiming the same rows.
+func (s *WebhookStore) ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*webhook.Delivery, error) {
+	const q = `UPDATE webhook_deliveries SET next_attempt_at=$2 WHERE id IN (
+			SELECT id FROM webhook_deliveries WHERE status='pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING ` + deliveryColumns
+	rows, err := s.db.QueryContext(ctx, q, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim webhook deliveries: %w", err)
+	}
+	return scanDeliveries(rows)
+}
+
+func (s *WebhookStore) RecordAttempt(ctx context.Context, d *webhook.Delivery, a webhook.Attempt) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	const aq = `INSERT INTO webhook_attempts (delivery_id, attempted_at, status_code, response_body, error, duration_ms) VALUES ($1,$2,$3,$4,$5,$6)`
+	if _, err := tx.ExecContext(ctx, aq, a.DeliveryID, a.AttemptedAt, a.StatusCode, a.ResponseBody, a.Error, a.Duration.Milliseconds()); err != nil {
+		return fmt.Errorf("insert webhook attempt: %w", err)
+	}
+	const dq = `UPDATE webhook_deliveries SET status=$2, attempts=$3, next_attempt_at=$4, updated_at=$5 WHERE id=$1`
+	if _, err := tx.ExecContext(ctx, dq, d.ID, string(d.Status), d.Attempts, d.NextAttemptAt, d.UpdatedAt); err != nil {
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *WebhookStore) GetDelivery(ctx context.Context, id uuid.UUID) (*webhook.Delivery, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id=$1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook delivery: %w", err)
+	}
+	ds, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ds) == 0 {
+		return nil, core.ErrNotFound
+	}
+	return ds[0], nil
+}
+
+func (s *WebhookStore) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]*webhook.Delivery, error) {
+	const q = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE subscription_id=$1 ORDER BY created_at DESC LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, q, subscriptionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	return scanDeliveries(rows)
+}
+
+func (s *WebhookStore) ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]webhook.Attempt, error) {
+	const q = `SELECT delivery_id, attempted_at, status_code, response_body, error, duration_ms FROM webhook_attempts WHERE delivery_id=$1 ORDER BY id`
+	rows, err := s.db.QueryContext(ctx, q, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook attempts: %w", err)
+	}
+	defer rows.Close()
+	out := []webhook.Attempt{}
+	for rows.Next() {
+		var (
+			a  webhook.Attempt
+			ms int64
+		)
+		if err := rows.Scan(&a.DeliveryID, &a.AttemptedAt, &a.StatusCode, &a.ResponseBody, &a.Error, &ms); err != nil {
+			return nil, fmt.Errorf("scan webhook attempt: %w", err)
+		}
+		a.Duration = time.Duration(ms) * time.Millisecond
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (s *WebhookStore) Requeue(ctx context.Context, id uuid.UUID, now time.Time) (*webhook.Delivery, error) {
+	const q = `UPDATE webhook_deliveries SET status='pending', next_attempt_at=$2, updated_at=$2 WHERE id=$1 RETURNING ` + deliveryColumns
+	rows, err := s.db.QueryContext(ctx, q, id, now)
+	if err != nil {
+		return nil, fmt.Errorf("requeue webhook delivery: %w", err)
+	}
+	ds, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ds) == 0 {
+		return nil, core.ErrNotFound
+	}
+	return ds[0], nil
+}
+
+func scanSubscription(row interface{ Scan(...any) error }) (*webhook.Subscription, error) {
+	var (
+		sub   webhook.Subscription
+		types []byte
+	)
+	if err := row.Scan(&sub.ID, &sub.URL, &sub.Secret, &types, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt, &sub.TenantID); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(types, &sub.EventTypes); err != nil {
+		return nil, fmt.Errorf("decode webhook event types: %w", err)
+	}
+	return &sub, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*webhook.Delivery, error) {
+	defer rows.Close()
+	out := []*webhook.Delivery{}
+	for rows.Next() {
+		var (
+			d           webhook.Delivery
+			typ, status string
+		)
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &typ, &d.Payload, &status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		d.EventType, d.Status = core.UserEventType(typ), webhook.DeliveryStatus(status)
+		out = append(out, &d)
+	}
+	return out, rows.Err()
+}
+
+func eventTypesOrEmpty(types []core.UserEventType) []core.UserEventType {
+	if types == nil {
+		return []core.UserEventType{}
+	}
+	return types
+}
+
+// expectOne maps a write that matched no row to core.ErrNotFound.
+func expectOne(res sql.Result) error {
+	if n, _ := res.RowsAffected(); n == 0 {
+		return core.ErrNotFound
+	}
+	return nil
+}
+
+var _ webhook.Store = (*WebhookStore)(nil)
@@ -0,0 +1,192 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// MemoryStore is the in-memory Store used without Postgres; the queue does not survive restarts.
+type MemoryStore struct {
+	mu         sync.Mutex
+	subs       map[uuid.UUID]*Subscription
+	deliveries map[uuid.UUID]*Delivery
+	attempts   map[uuid.UUID][]Attempt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		subs:       map[uuid.UUID]*Subscription{},
+		deliveries: map[uuid.UUID]*Delivery{},
+		attempts:   map[uuid.UUID][]Attempt{},
+	}
+}
+
+func (m *MemoryStore) CreateSubscription(_ context.Context, s *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs[s.ID] = copySub(s)
+	return nil
+}
+
+func (m *MemoryStore) GetSubscription(_ context.Context, id uuid.UUID) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.subs[id]
+	if !ok {
+		return nil, core.ErrNotFound
+	}
+	return copySub(s), nil
+}
+
+func (m *MemoryStore) ListSubscriptions(_ context.Context) ([]*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*Subscription, 0, len(m.subs))
+	for _, s := range m.subs {
+		out = append(out, copySub(s))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (m *MemoryStore) UpdateSubscription(_ context.Context, s *Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subs[s.ID]; !ok {
+		return core.ErrNotFound
+	}
+	m.subs[s.ID] = copySub(s)
+	return nil
+}
+
+func (m *MemoryStore) DeleteSubscription(_ context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subs[id]; !ok {
+		return core.ErrNotFound
+	}
+	delete(m.subs, id)
+	for did, d := range m.deliveries {
+		if d.SubscriptionID == id {
+			delete(m.deliveries, did)
+			delete(m.attempts, did)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Enqueue(_ context.Context, ds []*Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range ds {
+		if _, ok := m.subs[d.SubscriptionID]; !ok || m.queued(d.SubscriptionID, d.EventID) {
+			continue
+		}
+		cpy := *d
+		m.deliveries[d.ID] = &cpy
+	}
+	return nil
+}
+
+// queued reports whether the event is already queued for the subscription. Caller holds m.mu.
+func (m *MemoryStore) queued(subID uuid.UUID, eventID string) bool {
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subID && d.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) ClaimDue(_ context.Context, now time.Time, limit int, lease time.Duration) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*Delivery
+	for _, d := range m.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	out := make([]*Delivery, len(due))
+	for i, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+		cpy := *d
+		out[i] = &cpy
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) RecordAttempt(_ context.Context, d *Delivery, a Attempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deliveries[d.ID]; !ok {
+		return core.ErrNotFound
+	}
+	cpy := *d
+	m.deliveries[d.ID] = &cpy
+	m.attempts[d.ID] = append(m.attempts[d.ID], a)
+	return nil
+}
+
+func (m *MemoryStore) GetDelivery(_ context.Context, id uuid.UUID) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, core.ErrNotFound
+	}
+	cpy := *d
+	return &cpy, nil
+}
+
+func (m *MemoryStore) ListDeliveries(_ context.Context, subscriptionID uuid.UUID, limit int) ([]*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []*Delivery{}
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == subscriptionID {
+			cpy := *d
+			out = append(out, &cpy)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *MemoryStore) ListAttempts(_ context.Context, deliveryID uuid.UUID) ([]Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Attempt{}, m.attempts[deliveryID]...), nil
+}
+
+func (m *MemoryStore) Requeue(_ context.Context, id uuid.UUID, now time.Time) (*Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, core.ErrNotFound
+	}
+	d.Status, d.NextAttemptAt, d.UpdatedAt = DeliveryPending, now, now
+	cpy := *d
+	return &cpy, nil
+}
+
+func copySub(s *Subscription) *Subscription {
+	cpy := *s
+	cpy.EventTypes = append([]core.UserEventType(nil), s.EventTypes...)
+	return &cpy
+}
+
+var _ Store = (*MemoryStore)(nil)
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/outbox"
+)
+
+// Publisher is the outbox.Publisher that turns each user event into one queued delivery per interested
+// subscription of the event's tenant. Enqueueing is idempotent per event, so outbox redeliveries do not duplicate webhooks.
+type Publisher struct{ store Store }
+
+func NewPublisher(store Store) *Publisher { return &Publisher{store: store} }
+
+func (p *Publisher) Publish(ctx context.Context, ev outbox.CloudEvent) error {
+	subs, err := p.store.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	t := core.UserEventType(strings.TrimPrefix(ev.Type, outbox.TypePrefix))
+	tenant := ev.TenantID
+	if tenant == "" {
+		tenant = core.DefaultTenant // recorded before tenancy
+	}
+	var ds []*Delivery
+	var payload []byte
+	now := time.Now().UTC()
+	for _, s := range subs {
+		if s.TenantID != tenant || !s.Wants(t) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(ev); err != nil {
+				return err
+			}
+		}
+		ds = append(ds, &Delivery{
+			ID: uuid.New(), SubscriptionID: s.ID, EventID: ev.ID, EventType: t, Payload: payload,
+			Status: DeliveryPending, NextAttemptAt: now, CreatedAt: now, UpdatedAt: now,
+		})
+	}
+	if len(ds) == 0 {
+		return nil
+	}
+	return p.store.Enqueue(ctx, ds)
+}
@@ -0,0 +1,279 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+// Subscription registers a URL for user events of its tenant. Empty EventTypes means every type.
+type Subscription struct {
+	ID         uuid.UUID
+	TenantID   string
+	URL        string
+	Secret     string
+	EventTypes []core.UserEventType
+	Active     bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Wants reports whether s should receive events of type t.
+func (s *Subscription) Wants(t core.UserEventType) bool {
+	if !s.Active {
+		return false
+	}
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, et := range s.EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed" // gave up after MaxAttempts, or the subscription was deactivated
+)
+
+// Delivery is one event queued for one subscription. Payload is the CloudEvent JSON sent as the body.
+type Delivery struct {
+	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	EventID        string
+	EventType      core.UserEventType
+	Payload        []byte
+	Status         DeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Attempt is a delivery log entry.
+type Attempt struct {
+	DeliveryID   uuid.UUID
+	AttemptedAt  time.Time
+	StatusCode   int    // 0 when no response was received
+	ResponseBody string // truncated to maxLoggedBody
+	Error        string
+	Duration     time.Duration
+}
+
+// Store persists subscriptions and the delivery queue; lookups of unknown ids return core.ErrNotFound.
+// It serves every tenant: Service confines callers to the subscriptions of the tenant in their context.
+type Store interface {
+	CreateSubscription(ctx context.Context, s *Subscription) error
+	GetSubscription(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	UpdateSubscription(ctx context.Context, s *Subscription) error
+	// DeleteSubscription also drops the subscription's deliveries and their log.
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+
+	// Enqueue adds deliveries, ignoring any whose (subscription, event) pair is already queued.
+	Enqueue(ctx context.Context, ds []*Delivery) error
+	// ClaimDue leases up to limit pending deliveries due by now: their next attempt moves to now+lease,
+	// so concurrent workers skip them and a crashed worker's claims come back after the lease.
+	ClaimDue(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*Delivery, error)
+	// RecordAttempt appends a to the log and saves d's new status, attempt count and next attempt time.
+	RecordAttempt(ctx context.Context, d *Delivery, a Attempt) error
+	GetDelivery(ctx context.Context, id uuid.UUID) (*Delivery, error)
+	// ListDeliveries returns the subscription's most recent deliveries first.
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]*Delivery, error)
+	ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]Attempt, error)
+	// Requeue makes a delivery pending and due immediately, keeping its log.
+	Requeue(ctx context.Context, id uuid.UUID, now time.Time) (*Delivery, error)
+}
+
+// SubscriptionPatch carries the fields of an update; nil leaves a field unchanged.
+type SubscriptionPatch struct {
+	URL        *string
+	Secret     *string
+	EventTypes *[]core.UserEventType
+	Active     *bool
+}
+
+type Service interface {
+	// Create registers a subscription; an empty secret is replaced by a generated one.
+	Create(ctx context.Context, rawURL, secret string, types []core.UserEventType) (*Subscription, error)
+	Get(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	List(ctx context.Context) ([]*Subscription, error)
+	Update(ctx context.Context, id uuid.UUID, p SubscriptionPatch) (*Subscription, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	Deliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]*Delivery, error)
+	// Delivery returns a delivery of the subscription together with its attempt log.
+	Delivery(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*Delivery, []Attempt, error)
+	// Redeliver queues a delivery again, whatever its status.
+	Redeliver(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*Delivery, error)
+}
+
+func NewService(store Store) Service { return &service{store: store} }
+
+type service struct{ store Store }
+
+func (s *service) Create(ctx context.Context, rawURL, secret string, types []core.UserEventType) (*Subscription, error) {
+	u, err := validateURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTypes(types); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		secret = generateSecret()
+	} else if err := validateSecret(secret); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	sub := &Subscription{ID: uuid.New(), TenantID: core.TenantFrom(ctx), URL: u, Secret: secret, EventTypes: types, Active: true, CreatedAt: now, UpdatedAt: now}
+	if err := s.store.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Get treats subscriptions of other tenants as missing.
+func (s *service) Get(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	sub, err := s.store.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.TenantID != core.TenantFrom(ctx) {
+		return nil, core.ErrNotFound
+	}
+	return sub, nil
+}
+
+func (s *service) List(ctx context.Context) ([]*Subscription, error) {
+	subs, err := s.store.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tenant := core.TenantFrom(ctx)
+	out := subs[:0]
+	for _, sub := range subs {
+		if sub.TenantID == tenant {
+			out = append(out, sub)
+		}
+	}
+	return out, nil
+}
+
+func (s *service) Update(ctx context.Context, id uuid.UUID, p SubscriptionPatch) (*Subscription, error) {
+	sub, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.URL != nil {
+		if sub.URL, err = validateURL(*p.URL); err != nil {
+			return nil, err
+		}
+	}
+	if p.Secret != nil {
+		if err := validateSecret(*p.Secret); err != nil {
+			return nil, err
+		}
+		sub.Secret = *p.Secret
+	}
+	if p.EventTypes != nil {
+		if err := validateTypes(*p.EventTypes); err != nil {
+			return nil, err
+		}
+		sub.EventTypes = *p.EventTypes
+	}
+	if p.Active != nil {
+		sub.Active = *p.Active
+	}
+	sub.UpdatedAt = time.Now().UTC()
+	if err := s.store.UpdateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *service) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return s.store.DeleteSubscription(ctx, id)
+}
+
+func (s *service) Deliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]*Delivery, error) {
+	if _, err := s.Get(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return s.store.ListDeliveries(ctx, subscriptionID, limit)
+}
+
+func (s *service) Delivery(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*Delivery, []Attempt, error) {
+	if _, err := s.Get(ctx, subscriptionID); err != nil {
+		return nil, nil, err
+	}
+	d, err := s.store.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.SubscriptionID != subscriptionID {
+		return nil, nil, core.ErrNotFound
+	}
+	attempts, err := s.store.ListAttempts(ctx, deliveryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, attempts, nil
+}
+
+func (s *service) Redeliver(ctx context.Context, subscriptionID, deliveryID uuid.UUID) (*Delivery, error) {
+	if _, _, err := s.Delivery(ctx, subscriptionID, deliveryID); err != nil {
+		return nil, err
+	}
+	return s.store.Requeue(ctx, deliveryID, time.Now().UTC())
+}
+
+func validateURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("url must be an absolute http(s) URL: %w", core.ErrValidation)
+	}
+	return u.String(), nil
+}
+
+func validateSecret(secret string) error {
+	if len(secret) < 16 {
+		return fmt.Errorf("secret must be at least 16 characters: %w", core.ErrValidation)
+	}
+	return nil
+}
+
+func validateTypes(types []core.UserEventType) error {
+	for _, t := range types {
+		switch t {
+		case core.UserCreated, core.UserUpdated, core.UserDeleted, core.UserRestored, core.UserPurged, core.UserStatusChanged:
+		default:
+			return fmt.Errorf("unknown event type %q: %w", t, core.ErrValidation)
+		}
+	}
+	return nil
+}
+
+func generateSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const maxLoggedBody = 2048
+
+type WorkerOptions struct {
+	PollInterval time.Duration // idle wait between polls (default 1s)
+	BatchSize    int           // deliveries claimed per poll (default 50)
+	Timeout      time.Duration // per request (default 10s)
+	MaxAttempts  int           // attempts before a delivery is marked failed (default 8)
+	BaseBackoff  time.Duration // delay after the first failure (default 10s)
+	MaxBackoff   time.Duration // cap on the delay (default 1h)
+	// AllowPrivate lets deliveries reach loopback, private and link-local addresses, e.g. receivers on the
+	// developer's machine. Off, subscribers cannot make the server call internal services.
+	AllowPrivate bool
+	Client       *http.Client // optional, used as is; Timeout is applied per request
+}
+
+// Worker sends due deliveries and reschedules failures with exponential backoff.
+type Worker struct {
+	store Store
+	log   *zap.Logger
+	opts  WorkerOptions
+	now   func() time.Time
+}
+
+func NewWorker(store Store, log *zap.Logger, opts WorkerOptions) *Worker {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = 10 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.Client == nil {
+		opts.Client = newClient(opts.AllowPrivate)
+	}
+	return &Worker{store: store, log: log, opts: opts, now: func() time.Time { return time.Now().UTC() }}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		n, err := w.DeliverDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.log.Warn("webhook delivery poll failed", zap.Error(err))
+		}
+		if err == nil && n == w.opts.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.opts.PollInterval):
+		}
+	}
+}
+
+// DeliverDue claims one batch of due deliveries, attempts each once and reports how many were claimed. A
+// delivery that cannot be attempted or recorded is logged and skipped, so it does not strand the rest of the
+// batch until their lease runs out; it comes back itself once its own lease does.
+func (w *Worker) DeliverDue(ctx context.Context) (int, error) {
+	// the lease outlives every attempt in the batch, so nobody else picks these up meanwhile
+	lease := time.Duration(w.opts.BatchSize)*w.opts.Timeout + time.Minute
+	ds, err := w.store.ClaimDue(ctx, w.now(), w.opts.BatchSize, lease)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range ds {
+		if ctx.Err() != nil {
+			return len(ds), ctx.Err()
+		}
+		if err := w.deliver(ctx, d); err != nil {
+			w.log.Warn("webhook delivery attempt failed", zap.String("delivery", d.ID.String()), zap.Error(err))
+		}
+	}
+	return len(ds), nil
+}
+
+func (w *Worker) deliver(ctx context.Context, d *Delivery) error {
+	sub, err := w.store.GetSubscription(ctx, d.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if !sub.Active { // deactivated after the delivery was queued; redelivering it later sends it again
+		now := w.now()
+		d.Status, d.UpdatedAt = DeliveryFailed, now
+		return w.store.RecordAttempt(ctx, d, Attempt{DeliveryID: d.ID, AttemptedAt: now, Error: "subscription is inactive; not sent"})
+	}
+	a := w.send(ctx, sub, d)
+	d.Attempts++
+	switch {
+	case a.StatusCode >= 200 && a.StatusCode < 300:
+		d.Status = DeliverySucceeded
+	case d.Attempts >= w.opts.MaxAttempts:
+		d.Status = DeliveryFailed
+		w.log.Warn("webhook delivery failed permanently", zap.String("delivery", d.ID.String()), zap.String("url", sub.URL))
+	default:
+		d.Status = DeliveryPending
+		d.NextAttemptAt = a.AttemptedAt.Add(Backoff(d.Attempts, w.opts.BaseBackoff, w.opts.MaxBackoff))
+	}
+	d.UpdatedAt = a.AttemptedAt
+	return w.store.RecordAttempt(ctx, d, a)
+}
+
+// send performs one signed POST and describes the outcome.
+func (w *Worker) send(ctx context.Context, sub *Subscription, d *Delivery) Attempt {
+	start := w.now()
+	a := Attempt{DeliveryID: d.ID, AttemptedAt: start}
+	ctx, cancel := context.WithTimeout(ctx, w.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	req.Header.Set("User-Agent", "maxwell-webhooks/1")
+	req.Header.Set("X-Maxwell-Delivery", d.ID.String())
+	req.Header.Set("X-Maxwell-Event", string(d.EventType))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, start, d.Payload))
+	resp, err := w.opts.Client.Do(req)
+	a.Duration = w.now().Sub(start)
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedBody))
+	a.StatusCode = resp.StatusCode
+	a.ResponseBody = string(body)
+	return a
+}
+
+// newClient does not follow redirects, which could lead anywhere, and unless allowPrivate refuses
+// non-public addresses. The check runs on the address dialed, after DNS resolution, so a public name that
+// resolves to an internal address is refused too.
+func newClient(allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: refusePrivate}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil // a proxy would connect on our behalf, past the check
+	}
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+// ErrPrivateAddress is the error of attempts to deliver to a non-public address.
+var ErrPrivateAddress = errors.New("webhook destination is not a public address")
+
+// nonPublic are ranges outside netip's predicates that still must not be reached: shared address space
+// (carrier-grade NAT), benchmarking, and the IPv4 "this network" block.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("0.0.0.0/8"),
+}
+
+func refusePrivate(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := ap.Addr().Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+	}
+	for _, p := range nonPublic {
+		if p.Contains(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+		}
+	}
+	return nil
+}
+
+// Backoff is the delay before retry number attempt (1-based): base doubled per attempt, capped at max,
+// with "equal jitter" (a random point in the upper half) so failing receivers are not hit in lockstep.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
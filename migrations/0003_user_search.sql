@@ -0,0 +1,10 @@
+-- Full-text + fuzzy search over name and email
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- '@' and '.' are split out of the email so "alice" or "example" match alice@example.com
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', name || ' ' || email || ' ' || translate(email, '@.', '  '))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_users_search ON users USING GIN (search);
+CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (email gin_trgm_ops);
@@ -0,0 +1,13 @@
+-- Optimistic concurrency: row version bumped on every UPDATE (edits, soft delete, restore)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION users_bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_users_bump_version ON users;
+CREATE TRIGGER trg_users_bump_version BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION users_bump_version();
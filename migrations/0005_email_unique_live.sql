@@ -0,0 +1,4 @@
+-- Email uniqueness: case-insensitive and only among live users, so a soft-deleted
+-- user no longer blocks re-registration of the same address.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_users_email_live ON users (lower(email)) WHERE deleted_at IS NULL;
@@ -0,0 +1,15 @@
+-- Transactional outbox: user domain events written in the same transaction as the change,
+-- delivered by the dispatcher (FOR UPDATE SKIP LOCKED) and then stamped published_at.
+CREATE TABLE IF NOT EXISTS user_events (
+    seq          BIGSERIAL PRIMARY KEY,
+    id           UUID NOT NULL UNIQUE,
+    type         TEXT NOT NULL,
+    user_id      UUID NOT NULL,
+    payload      JSONB,
+    occurred_at  TIMESTAMPTZ NOT NULL,
+    published_at TIMESTAMPTZ,
+    attempts     INT NOT NULL DEFAULT 0,
+    last_error   TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_events_pending ON user_events (seq) WHERE published_at IS NULL;
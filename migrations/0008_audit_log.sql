@@ -0,0 +1,13 @@
+-- Audit trail of user changes, written in the same transaction as the change. No foreign key to users:
+-- the history must outlive a purge.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          UUID PRIMARY KEY,
+    user_id     UUID NOT NULL,
+    action      TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    request_id  TEXT NOT NULL DEFAULT '',
+    changes     JSONB NOT NULL DEFAULT '[]',
+    occurred_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log (user_id, occurred_at DESC);
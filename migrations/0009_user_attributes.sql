@@ -0,0 +1,4 @@
+-- Caller-defined user attributes, validated against ATTRIBUTES_SCHEMA by the service.
+-- The GIN index serves containment (@>) lookups; listing filters compare attributes->>key as text.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}'::jsonb;
+CREATE INDEX IF NOT EXISTS idx_users_attributes ON users USING GIN (attributes jsonb_path_ops);
@@ -0,0 +1,9 @@
+-- Lifecycle status, changed only through the service's state machine. Existing users are active
+-- since their creation.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('invited', 'active', 'suspended', 'locked'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+UPDATE users SET status_changed_at = created_at WHERE status_changed_at IS NULL;
+ALTER TABLE users ALTER COLUMN status_changed_at SET DEFAULT now(), ALTER COLUMN status_changed_at SET NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
@@ -0,0 +1,35 @@
+-- Multi-tenancy: users, their audit trail, outbox events and webhook subscriptions belong to a tenant.
+-- Existing rows go to the 'default' tenant; new rows must name theirs.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE audit_log ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE user_events ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE user_events ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE webhook_subscriptions ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- Emails are unique per tenant; listings and history lookups lead with the tenant.
+DROP INDEX IF EXISTS uq_users_email_live;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_users_tenant_email_live ON users (tenant_id, lower(email)) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS idx_users_created_at;
+CREATE INDEX IF NOT EXISTS idx_users_tenant_created_at ON users (tenant_id, created_at DESC, id DESC);
+DROP INDEX IF EXISTS idx_audit_log_user;
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log (tenant_id, user_id, occurred_at DESC);
+
+-- Row-level security as defense in depth behind the repository's tenant_id predicates. The service's
+-- transactions pin app.tenant_id (set_config(..., true)), confining every statement in them to that tenant.
+-- Sessions that never set it (migrations, the outbox dispatcher, psql) are not restricted. FORCE applies the
+-- policies to the table owner too, which is usually the application role.
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON users;
+CREATE POLICY tenant_isolation ON users
+    USING (tenant_id = coalesce(nullif(current_setting('app.tenant_id', true), ''), tenant_id))
+    WITH CHECK (tenant_id = coalesce(nullif(current_setting('app.tenant_id', true), ''), tenant_id));
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_log FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON audit_log;
+CREATE POLICY tenant_isolation ON audit_log
+    USING (tenant_id = coalesce(nullif(current_setting('app.tenant_id', true), ''), tenant_id))
+    WITH CHECK (tenant_id = coalesce(nullif(current_setting('app.tenant_id', true), ''), tenant_id));
@@ -0,0 +1,2 @@
+-- Email verification: set when the user confirms the current address, cleared when the email changes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
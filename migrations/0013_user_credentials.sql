@@ -0,0 +1,15 @@
+-- Password credentials live apart from users, so setting one neither bumps the user's version nor reaches
+-- any query that loads users. Purging a user removes them.
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id       UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id     TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE user_credentials ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_credentials FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON user_credentials;
+CREATE POLICY tenant_isolation ON user_credentials
+    USING (tenant_id = coalesce(nullif(current_setting('app.tenant_id', true), ''), tenant_id))
+    WITH CHECK (tenant_id = coalesce(nullif(current_setting('app.tenant_id', true), ''), tenant_id));
@@ -0,0 +1,19 @@
+-- API keys minted at runtime (/admin/keys). The secret is never kept: a public prefix and a SHA-256 of it serve
+-- lookups, and neither can authenticate or sign a request (0016 adds the signing key, sealed under a KEK).
+-- Lookups by prefix happen before the tenant is known, so the service, not RLS, confines admins to their tenant.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           UUID PRIMARY KEY,
+    tenant_id    TEXT NOT NULL,
+    name         TEXT NOT NULL,
+    owner        TEXT NOT NULL DEFAULT '',
+    prefix       TEXT NOT NULL UNIQUE,
+    hash         TEXT NOT NULL,
+    scopes       JSONB NOT NULL DEFAULT '[]',
+    created_at   TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    replaced_by  UUID REFERENCES api_keys(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys (tenant_id, created_at);
@@ -0,0 +1,21 @@
+-- Per API key request totals, merged from each instance's batches. key_id is the non-secret "apikey:<hash>"
+-- identity, which also covers env-var keys that have no api_keys row.
+CREATE TABLE IF NOT EXISTS api_key_usage (
+    tenant_id       TEXT NOT NULL,
+    key_id          TEXT NOT NULL,
+    requests        BIGINT NOT NULL DEFAULT 0,
+    errors          BIGINT NOT NULL DEFAULT 0,
+    last_used_at    TIMESTAMPTZ NOT NULL,
+    last_ip         TEXT NOT NULL DEFAULT '',
+    last_user_agent TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (tenant_id, key_id)
+);
+
+CREATE TABLE IF NOT EXISTS api_key_route_usage (
+    tenant_id TEXT NOT NULL,
+    key_id    TEXT NOT NULL,
+    route     TEXT NOT NULL,
+    requests  BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, key_id, route),
+    FOREIGN KEY (tenant_id, key_id) REFERENCES api_key_usage (tenant_id, key_id) ON DELETE CASCADE
+);
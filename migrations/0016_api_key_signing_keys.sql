@@ -0,0 +1,3 @@
+-- Request signing keys of minted API keys, AES-GCM sealed with API_KEY_SIGNING_KEK. NULL for keys minted
+-- without one, which cannot sign requests.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS signing_key BYTEA;
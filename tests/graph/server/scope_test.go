@@ -0,0 +1,64 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hex-zero/MaxwellGoSpine/graph/resolver"
+	"github.com/hex-zero/MaxwellGoSpine/graph/server"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+type gqlError struct {
+	Message    string         `json:"message"`
+	Extensions map[string]any `json:"extensions"`
+}
+
+func TestScopedKeysInGraphQL(t *testing.T) {
+	keys := middleware.APIKeyOptions{
+		Current: []string{"reader", "writer"},
+		Scopes: map[string][]core.Scope{
+			"reader": {core.ScopeUsersRead},
+			"writer": {core.ScopeUsersRead, core.ScopeUsersWrite},
+		},
+	}
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	gql := server.NewExecutableSchemaWithOpts(&resolver.Resolver{UserService: svc}, server.Options{APIKeys: keys})
+	h := middleware.APIKeyAuthWithOpts(keys)(gql)
+	do := func(key, query string) []gqlError {
+		t.Helper()
+		body, _ := json.Marshal(map[string]string{"query": query})
+		req := httptest.NewRequest(http.MethodPost, "/v1/graphql", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var resp struct {
+			Errors []gqlError `json:"errors"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %d %s: %v", w.Code, w.Body.String(), err)
+		}
+		return resp.Errors
+	}
+
+	const create = `mutation { createUser(name: "Ann", email: "ann@example.com") { id } }`
+	errs := do("reader", create)
+	if len(errs) != 1 || errs[0].Extensions["code"] != "FORBIDDEN" || errs[0].Extensions["scope"] != "users:write" {
+		t.Fatalf("expected FORBIDDEN naming users:write, got %+v", errs)
+	}
+	if errs := do("writer", create); len(errs) != 0 {
+		t.Fatalf("writer create: %+v", errs)
+	}
+	if errs := do("reader", `{ users { email } }`); len(errs) != 0 {
+		t.Fatalf("reader query: %+v", errs)
+	}
+	errs = do("writer", `mutation { deleteUsers(ids: []) { index } }`)
+	if len(errs) != 1 || errs[0].Extensions["scope"] != "users:delete" {
+		t.Fatalf("expected FORBIDDEN naming users:delete, got %+v", errs)
+	}
+}
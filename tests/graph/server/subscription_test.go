@@ -0,0 +1,186 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hex-zero/MaxwellGoSpine/graph/resolver"
+	"github.com/hex-zero/MaxwellGoSpine/graph/server"
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/jwtauth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func dial(t *testing.T, url string, initPayload map[string]any) *websocket.Conn {
+	t.Helper()
+	d := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	conn, _, err := d.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	send(t, conn, wsMessage{Type: "connection_init", Payload: mustJSON(initPayload)})
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, m wsMessage) {
+	t.Helper()
+	if err := conn.WriteJSON(m); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+// read returns the next message other than a ping.
+func read(t *testing.T, conn *websocket.Conn) (wsMessage, error) {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var m wsMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			return m, err
+		}
+		if m.Type != "ping" && m.Type != "pong" {
+			return m, nil
+		}
+	}
+}
+
+func mustJSON(v any) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func subscribe(id string) wsMessage {
+	return wsMessage{ID: id, Type: "subscribe", Payload: mustJSON(map[string]any{
+		"query": `subscription { userChanged(kinds: [CREATED]) { kind userId user { name } } }`,
+	})}
+}
+
+func TestUserChangedSubscription(t *testing.T) {
+	b := broker.New(broker.Options{})
+	svc := core.NewUserServiceWithOpts(core.NewInMemoryUserRepo(), core.UserServiceOptions{Notifier: b})
+	gql := server.NewExecutableSchemaWithOpts(&resolver.Resolver{UserService: svc, Events: b}, server.Options{
+		APIKeys:          middleware.APIKeyOptions{Current: []string{"k1"}},
+		MaxSubscriptions: 1,
+	})
+	srv := httptest.NewServer(gql)
+	t.Cleanup(srv.Close) // runs after the connections below are closed
+
+	t.Run("rejects bad key", func(t *testing.T) {
+		conn := dial(t, srv.URL, map[string]any{"apiKey": "nope"})
+		if m, err := read(t, conn); err == nil && m.Type == "connection_ack" {
+			t.Fatalf("connection acknowledged with a bad key")
+		}
+	})
+
+	conn := dial(t, srv.URL, map[string]any{"apiKey": "k1"})
+	if m, err := read(t, conn); err != nil || m.Type != "connection_ack" {
+		t.Fatalf("expected ack, got %+v %v", m, err)
+	}
+	send(t, conn, subscribe("1"))
+	// the broker subscription is registered asynchronously, so wait for it before going on
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	send(t, conn, subscribe("2")) // over the per-connection limit
+	m, err := read(t, conn)
+	if err != nil || m.ID != "2" || !strings.Contains(string(m.Payload), "TOO_MANY_REQUESTS") {
+		t.Fatalf("expected limit error, got %+v %v", m, err)
+	}
+
+	u, err := svc.Create(context.Background(), "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for m.ID != "1" && err == nil { // skip the rest of subscription 2
+		m, err = read(t, conn)
+	}
+	if err != nil || m.Type != "next" {
+		t.Fatalf("expected next, got %+v %v", m, err)
+	}
+	var got struct {
+		Data struct {
+			UserChanged struct {
+				Kind   string
+				UserID string
+				User   struct{ Name string }
+			}
+		}
+	}
+	_ = json.Unmarshal(m.Payload, &got)
+	ev := got.Data.UserChanged
+	if ev.Kind != "CREATED" || ev.UserID != u.ID.String() || ev.User.Name != "Ann" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	send(t, conn, wsMessage{ID: "1", Type: "complete"})
+	deadline = time.Now().Add(2 * time.Second)
+	for b.Subscribers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := b.Subscribers(); n != 0 {
+		t.Fatalf("subscription not released, %d left", n)
+	}
+}
+
+func TestWebSocketOriginCheck(t *testing.T) {
+	gql := server.NewExecutableSchemaWithOpts(&resolver.Resolver{}, server.Options{AllowedOrigins: []string{"https://app.example"}})
+	srv := httptest.NewServer(gql)
+	defer srv.Close()
+	d := websocket.Dialer{Subprotocols: []string{"graphql-transport-ws"}}
+	h := http.Header{"Origin": {"https://evil.example"}}
+	if _, resp, err := d.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), h); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for a foreign origin, got %v", err)
+	}
+}
+
+// tokenVerifier accepts the token "good" as subject "svc" of tenant "acme".
+type tokenVerifier struct{}
+
+func (tokenVerifier) Verify(_ context.Context, token string) (*jwtauth.Claims, error) {
+	if token != "good" {
+		return nil, errors.New("invalid token")
+	}
+	return &jwtauth.Claims{Subject: "svc", Tenant: "acme"}, nil
+}
+
+func TestWebSocketAuthWithBearerOnly(t *testing.T) {
+	b := broker.New(broker.Options{})
+	svc := core.NewUserServiceWithOpts(core.NewInMemoryUserRepo(), core.UserServiceOptions{Notifier: b})
+	gql := server.NewExecutableSchemaWithOpts(&resolver.Resolver{UserService: svc, Events: b}, server.Options{
+		APIKeys: middleware.APIKeyOptions{Required: true}, // JWT-only: no API keys are configured
+		Bearer:  tokenVerifier{},
+	})
+	srv := httptest.NewServer(gql)
+	t.Cleanup(srv.Close)
+
+	for name, payload := range map[string]map[string]any{
+		"no credentials": {},
+		"bad token":      {"Authorization": "Bearer forged"},
+		"any api key":    {"apiKey": "guess"},
+	} {
+		conn := dial(t, srv.URL, payload)
+		if m, err := read(t, conn); err == nil && m.Type == "connection_ack" {
+			t.Fatalf("%s: connection acknowledged", name)
+		}
+	}
+	conn := dial(t, srv.URL, map[string]any{"Authorization": "Bearer good"})
+	if m, err := read(t, conn); err != nil || m.Type != "connection_ack" {
+		t.Fatalf("expected ack for a valid bearer token, got %+v %v", m, err)
+	}
+}
@@ -0,0 +1,160 @@
+package apikey_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/reqsign"
+)
+
+// countingStore counts prefix lookups, to observe the service's cache.
+type countingStore struct {
+	*apikey.MemoryStore
+	lookups atomic.Int32
+}
+
+func (s *countingStore) GetByPrefix(ctx context.Context, prefix string) (*apikey.Key, error) {
+	s.lookups.Add(1)
+	return s.MemoryStore.GetByPrefix(ctx, prefix)
+}
+
+func TestMintLookupRevoke(t *testing.T) {
+	ctx := core.WithTenant(context.Background(), "acme")
+	store := &countingStore{MemoryStore: apikey.NewMemoryStore()}
+	svc := apikey.NewService(store, apikey.Options{})
+
+	if _, _, err := svc.Mint(ctx, apikey.MintRequest{Name: "ci", Scopes: []core.Scope{"users:fly"}}); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("expected validation error for unknown scope, got %v", err)
+	}
+	k, secret, err := svc.Mint(ctx, apikey.MintRequest{Name: "ci", Owner: "ops@example.com", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if !strings.HasPrefix(secret, "mxk_"+k.Prefix+"_") || strings.Contains(k.Hash, secret) || k.TenantID != "acme" {
+		t.Fatalf("unexpected key %+v for secret %q", k, secret)
+	}
+
+	for i := 0; i < 3; i++ {
+		got, err := svc.LookupKey(context.Background(), secret)
+		if err != nil || got == nil || got.ID != k.ID {
+			t.Fatalf("lookup %d: %+v %v", i, got, err)
+		}
+	}
+	if n := store.lookups.Load(); n != 1 {
+		t.Fatalf("expected one store lookup behind the cache, got %d", n)
+	}
+	if got, _ := svc.LookupKey(context.Background(), secret+"x"); got != nil {
+		t.Fatal("a wrong secret with a valid prefix must not resolve")
+	}
+	if got, _ := svc.LookupKey(context.Background(), "static-env-key"); got != nil {
+		t.Fatal("a non-minted secret must not resolve")
+	}
+
+	if _, err := svc.Revoke(ctx, k.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if got, _ := svc.LookupKey(context.Background(), secret); got != nil {
+		t.Fatal("a revoked key must not resolve")
+	}
+	got, err := svc.Get(ctx, k.ID)
+	if err != nil || got.Status(time.Now()) != "revoked" {
+		t.Fatalf("get after revoke: %+v %v", got, err)
+	}
+}
+
+func TestRotateKeepsOldKeyDuringGrace(t *testing.T) {
+	ctx := context.Background()
+	svc := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{})
+	old, oldSecret, err := svc.Mint(ctx, apikey.MintRequest{Name: "ci", Scopes: []core.Scope{core.ScopeAdmin}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	next, nextSecret, err := svc.Rotate(ctx, old.ID, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if next.Name != "ci" || len(next.Scopes) != 1 || next.Scopes[0] != core.ScopeAdmin || nextSecret == oldSecret {
+		t.Fatalf("unexpected successor %+v", next)
+	}
+	got, _ := svc.LookupKey(ctx, oldSecret)
+	if got == nil || !got.Deprecated() || *got.ReplacedBy != next.ID || got.ExpiresAt == nil || time.Until(*got.ExpiresAt) > time.Hour {
+		t.Fatalf("expected deprecated old key within grace, got %+v", got)
+	}
+	if _, _, err := svc.Rotate(ctx, old.ID, time.Hour, nil); !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected conflict rotating a rotated key, got %v", err)
+	}
+
+	if _, _, err := svc.Rotate(ctx, next.ID, 0, nil); err != nil {
+		t.Fatalf("rotate without grace: %v", err)
+	}
+	if got, _ := svc.LookupKey(ctx, nextSecret); got != nil {
+		t.Fatal("a key rotated without grace must stop working at once")
+	}
+}
+
+func TestKeysAreConfinedToTheirTenant(t *testing.T) {
+	svc := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{})
+	acme := core.WithTenant(context.Background(), "acme")
+	globex := core.WithTenant(context.Background(), "globex")
+	k, secret, err := svc.Mint(acme, apikey.MintRequest{Name: "ci", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if _, err := svc.Get(globex, k.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("expected not found across tenants, got %v", err)
+	}
+	if _, err := svc.Revoke(globex, k.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("expected not found revoking across tenants, got %v", err)
+	}
+	if keys, _ := svc.List(globex); len(keys) != 0 {
+		t.Fatalf("expected no keys for globex, got %d", len(keys))
+	}
+	// lookups resolve the key's own tenant, whoever asks
+	if got, _ := svc.LookupKey(globex, secret); got == nil || got.TenantID != "acme" {
+		t.Fatalf("lookup: %+v", got)
+	}
+}
+
+func TestSigningKeyIsSealed(t *testing.T) {
+	ctx := core.WithTenant(context.Background(), "acme")
+	kek := bytes.Repeat([]byte{7}, 32)
+	svc := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{SigningKEK: kek})
+	k, secret, err := svc.Mint(ctx, apikey.MintRequest{Name: "ci", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	got, err := svc.SigningKey(k)
+	if err != nil || !bytes.Equal(got, reqsign.SigningKey(secret)) {
+		t.Fatalf("signing key: %x %v", got, err)
+	}
+	if bytes.Contains(k.SealedSigningKey, got) {
+		t.Fatal("the signing key must not be stored in the clear")
+	}
+
+	moved := *k
+	moved.ID = uuid.New()
+	if _, err := svc.SigningKey(&moved); err == nil {
+		t.Fatal("a sealed signing key must not open for another key")
+	}
+	other := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{SigningKEK: bytes.Repeat([]byte{8}, 32)})
+	if _, err := other.SigningKey(k); err == nil {
+		t.Fatal("a sealed signing key must not open under another KEK")
+	}
+
+	unsealed := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{})
+	k, _, err = unsealed.Mint(ctx, apikey.MintRequest{Name: "ci", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if _, err := unsealed.SigningKey(k); !errors.Is(err, apikey.ErrCannotSign) {
+		t.Fatalf("expected ErrCannotSign for a key minted without a KEK, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/auth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	hash, err := auth.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("unexpected encoding %q", hash)
+	}
+	if !auth.CheckPassword(hash, "correct horse battery") || auth.CheckPassword(hash, "correct horse battery!") {
+		t.Fatal("password check mismatch")
+	}
+	if other, _ := auth.HashPassword("correct horse battery"); other == hash {
+		t.Fatal("expected a fresh salt per hash")
+	}
+	for _, bad := range []string{"", "plain", "$argon2id$v=19$m=1,t=0,p=1$AAAA$AAAA", "$bcrypt$x$y$z$w"} {
+		if auth.CheckPassword(bad, "x") {
+			t.Fatalf("malformed hash %q matched", bad)
+		}
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	u := &core.User{Name: "Annabel Lee", Email: "annabel@example.com"}
+	p := auth.PasswordPolicy{}
+	for pw, ok := range map[string]bool{
+		"short1!":                false,
+		"aaaaaaaaaaaaaaaa":       false, // too few distinct characters
+		"password1234":           false,
+		"passwordpassword!":      false,
+		"my-annabel-secret":      false,
+		"tidal shoe vortex 42":   true,
+		strings.Repeat("ab", 65): false, // longer than 128
+	} {
+		err := p.Check(pw, u)
+		if ok != (err == nil) {
+			t.Fatalf("%q: ok=%v, err=%v", pw, ok, err)
+		}
+		if err != nil && !errors.Is(err, core.ErrValidation) {
+			t.Fatalf("%q: expected ErrValidation, got %v", pw, err)
+		}
+	}
+}
+
+type resetRecorder struct{ tokens []string }
+
+func (r *resetRecorder) SendPasswordReset(_ context.Context, _ *core.User, token string, _ time.Time) {
+	r.tokens = append(r.tokens, token)
+}
+
+func TestLoginSessionsAndReset(t *testing.T) {
+	ctx := context.Background()
+	repo := core.NewInMemoryUserRepo()
+	users := core.NewUserService(repo)
+	resets := &resetRecorder{}
+	svc := auth.NewService(users, repo, auth.NewMemorySessionStore(), auth.Options{ResetSecret: []byte("secret"), ResetSender: resets})
+	u, err := users.Create(ctx, "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, _, _, err := svc.Login(ctx, "ann@example.com", "anything at all"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("login without a password: %v", err)
+	}
+	if err := svc.SetPassword(ctx, u.ID, "weak"); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("weak password: %v", err)
+	}
+	if err := svc.SetPassword(ctx, u.ID, "tidal shoe vortex 42"); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	for _, email := range []string{"nobody@example.com", "ann@example.com"} {
+		if _, _, _, err := svc.Login(ctx, email, "wrong password here"); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("bad login for %s: %v", email, err)
+		}
+	}
+	token, sess, got, err := svc.Login(ctx, " ANN@example.com ", "tidal shoe vortex 42")
+	if err != nil || got.ID != u.ID || sess.UserID != u.ID || token == "" {
+		t.Fatalf("login: %v", err)
+	}
+	if s, err := svc.Authenticate(ctx, token); err != nil || s.UserID != u.ID {
+		t.Fatalf("authenticate: %+v, %v", s, err)
+	}
+	if _, err := svc.Authenticate(core.WithTenant(ctx, "acme"), token); !errors.Is(err, auth.ErrInvalidSession) {
+		t.Fatalf("session used in another tenant: %v", err)
+	}
+
+	// suspending the user ends the session and refuses new ones
+	if _, err := users.Transition(ctx, u.ID, core.StatusSuspended, "test"); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, token); !errors.Is(err, auth.ErrInvalidSession) {
+		t.Fatalf("session of a suspended user: %v", err)
+	}
+	if _, _, _, err := svc.Login(ctx, "ann@example.com", "tidal shoe vortex 42"); !errors.Is(err, auth.ErrAccountDisabled) {
+		t.Fatalf("login while suspended: %v", err)
+	}
+	if _, err := users.Transition(ctx, u.ID, core.StatusActive, ""); err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+
+	// a reset works once and ends existing sessions
+	token, _, _, _ = svc.Login(ctx, "ann@example.com", "tidal shoe vortex 42")
+	if err := svc.RequestPasswordReset(ctx, "nobody@example.com"); err != nil || len(resets.tokens) != 0 {
+		t.Fatalf("reset for an unknown email: %v, %d sent", err, len(resets.tokens))
+	}
+	if err := svc.RequestPasswordReset(ctx, "ann@example.com"); err != nil || len(resets.tokens) != 1 {
+		t.Fatalf("reset request: %v, %d sent", err, len(resets.tokens))
+	}
+	if err := svc.ResetPassword(ctx, resets.tokens[0]+"x", "quiet river lantern 7"); !errors.Is(err, auth.ErrInvalidResetToken) {
+		t.Fatalf("forged reset token: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, resets.tokens[0], "quiet river lantern 7"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, resets.tokens[0], "another fine password 8"); !errors.Is(err, auth.ErrInvalidResetToken) {
+		t.Fatalf("reused reset token: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, token); !errors.Is(err, auth.ErrInvalidSession) {
+		t.Fatalf("session after reset: %v", err)
+	}
+	if err := svc.ChangePassword(ctx, u.ID, "tidal shoe vortex 42", "another fine password 8"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("change with the old password: %v", err)
+	}
+	token, _, _, err = svc.Login(ctx, "ann@example.com", "quiet river lantern 7")
+	if err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+	if err := svc.Logout(ctx, token); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, token); !errors.Is(err, auth.ErrInvalidSession) {
+		t.Fatalf("session after logout: %v", err)
+	}
+}
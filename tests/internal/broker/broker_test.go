@@ -0,0 +1,86 @@
+package broker_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+func notify(b *broker.Broker, types ...core.UserEventType) {
+	for _, t := range types {
+		b.Notify(core.NewUserEvent(t, uuid.New(), nil))
+	}
+}
+
+func TestSubscribeFiltersAndResumes(t *testing.T) {
+	b := broker.New(broker.Options{ReplaySize: 2})
+	live, _, _ := b.Subscribe(core.DefaultTenant, []core.UserEventType{core.UserDeleted}, 0)
+	defer live.Close()
+	notify(b, core.UserCreated, core.UserDeleted)
+	ev := <-live.C
+	if ev.Type != core.UserDeleted {
+		t.Fatalf("filter let through %s", ev.Type)
+	}
+
+	sub, replay, complete := b.Subscribe(core.DefaultTenant, nil, ev.Seq-1)
+	sub.Close()
+	if !complete || len(replay) != 1 || replay[0].Seq != ev.Seq {
+		t.Fatalf("expected complete replay of the last event, got %v %+v", complete, replay)
+	}
+	for i := 0; i < 5; i++ { // the buffer keeps 2 to 4 events
+		notify(b, core.UserUpdated)
+	}
+	sub, replay, complete = b.Subscribe(core.DefaultTenant, nil, ev.Seq)
+	sub.Close()
+	if complete || len(replay) == 0 || replay[0].Seq <= ev.Seq+1 {
+		t.Fatalf("expected an incomplete replay once the buffer rolled over, got %v %+v", complete, replay)
+	}
+	if _, _, complete := b.Subscribe(core.DefaultTenant, nil, ev.Seq+1_000_000); complete {
+		t.Fatal("a position from the future (another process) must not resume")
+	}
+}
+
+func TestSlowSubscriberIsDroppedAndCloseEndsAll(t *testing.T) {
+	b := broker.New(broker.Options{SubscriberBuffer: 1})
+	slow, _, _ := b.Subscribe(core.DefaultTenant, nil, 0)
+	fast, _, _ := b.Subscribe(core.DefaultTenant, nil, 0)
+	notify(b, core.UserCreated)
+	<-fast.C
+	notify(b, core.UserCreated)
+	<-fast.C
+	<-slow.C // the one buffered event
+	if _, ok := <-slow.C; ok {
+		t.Fatal("expected the slow subscriber to be dropped")
+	}
+	if b.Subscribers() != 1 {
+		t.Fatalf("expected 1 subscriber left, got %d", b.Subscribers())
+	}
+	b.Close()
+	if _, ok := <-fast.C; ok || b.Subscribers() != 0 {
+		t.Fatal("expected Close to end every subscription")
+	}
+	late, _, _ := b.Subscribe(core.DefaultTenant, nil, 0)
+	if _, ok := <-late.C; ok {
+		t.Fatal("expected subscriptions after Close to end immediately")
+	}
+}
+
+func TestSubscribersOnlySeeTheirTenant(t *testing.T) {
+	b := broker.New(broker.Options{})
+	acme, _, _ := b.Subscribe("acme", nil, 0)
+	defer acme.Close()
+	other := core.NewUserEvent(core.UserCreated, uuid.New(), nil)
+	other.TenantID = "globex"
+	own := core.NewUserEvent(core.UserCreated, uuid.New(), nil)
+	own.TenantID = "acme"
+	b.Notify(other, own)
+	if ev := <-acme.C; ev.UserID != own.UserID {
+		t.Fatalf("received another tenant's event %+v", ev)
+	}
+	_, replay, _ := b.Subscribe("acme", nil, 1)
+	if len(replay) != 1 || replay[0].UserID != own.UserID {
+		t.Fatalf("replay must be tenant scoped too, got %+v", replay)
+	}
+}
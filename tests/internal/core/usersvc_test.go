@@ -0,0 +1,683 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/attrschema"
+	"github.com/hex-zero/MaxwellGoSpine/internal/cache"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+)
+
+func TestListAfterPagesWithoutGapsOrDuplicates(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	for i := 0; i < 7; i++ {
+		if _, err := svc.Create(ctx, fmt.Sprintf("User %d", i), fmt.Sprintf("u%d@example.com", i), nil); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	seen := map[string]bool{}
+	cursor := ""
+	pages := 0
+	for {
+		users, next, err := svc.ListAfter(ctx, core.UserFilter{}, core.UserSort{}, cursor, 3)
+		if err != nil {
+			t.Fatalf("list after: %v", err)
+		}
+		pages++
+		for _, u := range users {
+			if seen[u.Email] {
+				t.Fatalf("duplicate user %s across pages", u.Email)
+			}
+			seen[u.Email] = true
+		}
+		if next == "" {
+			break
+		}
+		// a user created mid-iteration sorts first and must not shift later pages
+		if pages == 1 {
+			if _, err := svc.Create(ctx, "Late", "late@example.com", nil); err != nil {
+				t.Fatalf("create: %v", err)
+			}
+		}
+		cursor = next
+	}
+	if len(seen) != 7 || pages != 3 {
+		t.Fatalf("expected 7 users over 3 pages, got %d over %d", len(seen), pages)
+	}
+}
+
+func TestListAfterRejectsInvalidCursor(t *testing.T) {
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	if _, _, err := svc.ListAfter(context.Background(), core.UserFilter{}, core.UserSort{}, "not-a-cursor", 10); err == nil {
+		t.Fatalf("expected validation error")
+	}
+}
+
+func TestListFilterAndSort(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	for _, in := range []struct{ name, email string }{
+		{"Carol", "carol@acme.io"},
+		{"alice", "alice@acme.io"},
+		{"Bob", "bob@other.org"},
+		{"Alfred", "alfred@acme.io"},
+	} {
+		if _, err := svc.Create(ctx, in.name, in.email, nil); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	byName, err := core.ParseUserSort("name")
+	if err != nil {
+		t.Fatalf("parse sort: %v", err)
+	}
+	users, total, err := svc.List(ctx, core.UserFilter{EmailDomain: "@ACME.io"}, byName, 1, 10)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 3 || users[0].Name != "Alfred" || users[1].Name != "Carol" || users[2].Name != "alice" {
+		t.Fatalf("unexpected domain listing: total=%d %v", total, names(users))
+	}
+	users, _, err = svc.List(ctx, core.UserFilter{NamePrefix: "al"}, core.UserSort{Field: core.SortByEmail, Desc: true}, 1, 10)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(users) != 2 || users[0].Name != "alice" || users[1].Name != "Alfred" {
+		t.Fatalf("unexpected prefix listing: %v", names(users))
+	}
+
+	// keyset paging honours the sort, and a cursor cannot be replayed under a different one
+	first, next, err := svc.ListAfter(ctx, core.UserFilter{}, byName, "", 2)
+	if err != nil || len(first) != 2 || next == "" {
+		t.Fatalf("first page: %v %v %q", err, names(first), next)
+	}
+	rest, next2, err := svc.ListAfter(ctx, core.UserFilter{}, byName, next, 2)
+	if err != nil || next2 != "" || len(rest) != 2 || rest[0].Name != "Carol" || rest[1].Name != "alice" {
+		t.Fatalf("second page: %v %v %q", err, names(rest), next2)
+	}
+	if _, _, err := svc.ListAfter(ctx, core.UserFilter{}, core.UserSort{}, next, 2); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("expected validation error for mismatched cursor, got %v", err)
+	}
+	if _, err := core.ParseUserSort("-password"); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("expected validation error for unknown sort field, got %v", err)
+	}
+}
+
+func names(users []*core.User) []string {
+	out := make([]string, 0, len(users))
+	for _, u := range users {
+		out = append(out, u.Name)
+	}
+	return out
+}
+
+func TestSearchRanksAndExcludesDeleted(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	jon, _ := svc.Create(ctx, "Jonathan Smith", "jon@example.com", nil)
+	_, _ = svc.Create(ctx, "Joanna Smyth", "joanna@example.com", nil)
+	gone, _ := svc.Create(ctx, "Jonas Gone", "jonas@example.com", nil)
+	_, _ = svc.Create(ctx, "Unrelated", "zed@other.org", nil)
+	if err := svc.Delete(ctx, gone.ID, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	hits, err := svc.Search(ctx, "jon", 10)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) == 0 || hits[0].User.ID != jon.ID {
+		t.Fatalf("expected prefix match first, got %+v", hits)
+	}
+	for _, h := range hits {
+		if h.User.ID == gone.ID {
+			t.Fatalf("soft-deleted user returned by search")
+		}
+	}
+
+	// misspelled surname still finds both Smiths via trigram similarity
+	hits, err = svc.Search(ctx, "smiht", 10)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(hits) != 1 || hits[0].User.ID != jon.ID {
+		t.Fatalf("expected fuzzy match on Smith, got %d hits", len(hits))
+	}
+
+	if _, err := svc.Search(ctx, " ", 10); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("expected validation error for blank query, got %v", err)
+	}
+}
+
+func TestRestorePurgeAndDeletedListing(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	live, _ := svc.Create(ctx, "Live", "live@example.com", nil)
+	gone, _ := svc.Create(ctx, "Gone", "gone@example.com", nil)
+	if err := svc.Delete(ctx, gone.ID, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	only, total, err := svc.List(ctx, core.UserFilter{Deleted: core.DeletedOnly}, core.UserSort{}, 1, 10)
+	if err != nil || total != 1 || only[0].ID != gone.ID || only[0].DeletedAt == nil {
+		t.Fatalf("only_deleted: %v total=%d", err, total)
+	}
+	if _, total, _ := svc.List(ctx, core.UserFilter{Deleted: core.DeletedInclude}, core.UserSort{}, 1, 10); total != 2 {
+		t.Fatalf("include_deleted: expected 2, got %d", total)
+	}
+
+	if _, err := svc.Restore(ctx, live.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("restoring a live user should be not found, got %v", err)
+	}
+	restored, err := svc.Restore(ctx, gone.ID)
+	if err != nil || restored.DeletedAt != nil {
+		t.Fatalf("restore: %v %+v", err, restored)
+	}
+
+	if err := svc.Purge(ctx, gone.ID); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, total, _ := svc.List(ctx, core.UserFilter{Deleted: core.DeletedInclude}, core.UserSort{}, 1, 10); total != 1 {
+		t.Fatalf("purged user still listed: total=%d", total)
+	}
+	if err := svc.Purge(ctx, gone.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("second purge should be not found, got %v", err)
+	}
+}
+
+func TestUpdateRejectsStaleVersion(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	u, _ := svc.Create(ctx, "Ann", "ann@example.com", nil)
+	if u.Version != 1 {
+		t.Fatalf("new users start at version 1, got %d", u.Version)
+	}
+	first, second := "Admin One", "Admin Two"
+	updated, err := svc.Update(ctx, u.ID, &first, nil, nil, u.Version)
+	if err != nil || updated.Version != 2 {
+		t.Fatalf("first update: %v version=%d", err, updated.Version)
+	}
+	// second admin still holds version 1
+	if _, err := svc.Update(ctx, u.ID, &second, nil, nil, u.Version); !errors.Is(err, core.ErrStaleVersion) || !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected stale version conflict, got %v", err)
+	}
+	if err := svc.Delete(ctx, u.ID, u.Version); !errors.Is(err, core.ErrStaleVersion) {
+		t.Fatalf("expected stale delete to fail, got %v", err)
+	}
+	if err := svc.Delete(ctx, u.ID, updated.Version); err != nil {
+		t.Fatalf("delete at current version: %v", err)
+	}
+}
+
+func TestEmailUniqueAmongLiveUsers(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	first, err := svc.Create(ctx, "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = svc.Create(ctx, "Ann Again", "ANN@example.com", nil)
+	var conflict *core.ConflictError
+	if !errors.As(err, &conflict) || conflict.Field != "email" || !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected email conflict, got %v", err)
+	}
+
+	// soft-deleting frees the address; restoring the old user then conflicts
+	if err := svc.Delete(ctx, first.ID, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	second, err := svc.Create(ctx, "Ann Two", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("re-register after delete: %v", err)
+	}
+	if _, err := svc.Restore(ctx, first.ID); !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected restore conflict, got %v", err)
+	}
+
+	other, _ := svc.Create(ctx, "Bob", "bob@example.com", nil)
+	email := "Ann@Example.com"
+	if _, err := svc.Update(ctx, other.ID, nil, &email, nil, 0); !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected update conflict, got %v", err)
+	}
+	if _, err := svc.Update(ctx, second.ID, nil, &email, nil, 0); err != nil {
+		t.Fatalf("re-saving own email must not conflict: %v", err)
+	}
+}
+
+func TestBatchAtomicRollsBackAndPartialReportsItems(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	existing, _ := svc.Create(ctx, "Zed", "zed@example.com", nil)
+	str := func(s string) *string { return &s }
+	ops := []core.BatchOp{
+		{Kind: core.BatchCreate, Name: str("Ann"), Email: str("ann@example.com")},
+		{Kind: core.BatchCreate, Name: str("Bob"), Email: str("bob@example.com")},
+		{Kind: core.BatchUpdate, ID: existing.ID, Name: str("Zed Two")},
+		{Kind: core.BatchCreate, Name: str("Bob Again"), Email: str("Bob@example.com")},
+		{Kind: core.BatchDelete, ID: uuid.New()},
+	}
+
+	_, err := svc.Batch(ctx, ops, core.BatchAtomic)
+	var item *core.BatchItemError
+	if !errors.As(err, &item) || item.Index != 3 || !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected conflict at item 3, got %v", err)
+	}
+	if _, total, _ := svc.List(ctx, core.UserFilter{}, core.UserSort{}, 1, 10); total != 1 {
+		t.Fatalf("atomic batch must roll back, have %d users", total)
+	}
+	if u, _ := svc.Get(ctx, existing.ID); u.Name != "Zed" {
+		t.Fatalf("atomic batch must roll back updates, name is %q", u.Name)
+	}
+
+	results, err := svc.Batch(ctx, ops, core.BatchPartial)
+	if err != nil {
+		t.Fatalf("partial batch: %v", err)
+	}
+	for i, wantErr := range []error{nil, nil, nil, core.ErrConflict, core.ErrNotFound} {
+		if wantErr == nil && (results[i].Err != nil || results[i].User == nil) {
+			t.Fatalf("item %d: expected success, got %v", i, results[i].Err)
+		}
+		if wantErr != nil && !errors.Is(results[i].Err, wantErr) {
+			t.Fatalf("item %d: expected %v, got %v", i, wantErr, results[i].Err)
+		}
+	}
+	if _, total, _ := svc.List(ctx, core.UserFilter{}, core.UserSort{}, 1, 10); total != 3 {
+		t.Fatalf("expected 3 users after partial batch, have %d", total)
+	}
+	if _, err := svc.Batch(ctx, nil, core.BatchAtomic); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("expected empty batch to be rejected, got %v", err)
+	}
+}
+
+func TestAuditTrailRecordsActorAndDiff(t *testing.T) {
+	repo := core.NewInMemoryUserRepo()
+	svc := core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Audit: true})
+	ctx := core.WithAuditContext(context.Background(), core.AuditContext{Actor: "apikey:test", RequestID: "req-1"})
+	u, err := svc.Create(ctx, "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	email := "ann@example.org"
+	if _, err := svc.Update(ctx, u.ID, nil, &email, nil, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := svc.Update(ctx, u.ID, nil, &email, nil, 1); !errors.Is(err, core.ErrStaleVersion) {
+		t.Fatalf("expected stale version, got %v", err)
+	}
+	if err := svc.Delete(context.Background(), u.ID, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := svc.Purge(ctx, u.ID); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	hist, err := svc.History(ctx, u.ID, 0)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	var actions []core.AuditAction
+	for _, e := range hist {
+		actions = append(actions, e.Action)
+	}
+	if fmt.Sprint(actions) != "[purged deleted updated created]" {
+		t.Fatalf("expected history to survive purge without the failed update, got %v", actions)
+	}
+	del, upd, cre := hist[1], hist[2], hist[3]
+	if del.Actor != core.SystemActor || len(del.Changes) != 1 || del.Changes[0].Field != "deleted_at" || del.Changes[0].Before != nil || del.Changes[0].After == nil {
+		t.Fatalf("unexpected delete entry %+v", del)
+	}
+	if upd.Actor != "apikey:test" || upd.RequestID != "req-1" || len(upd.Changes) != 1 ||
+		*upd.Changes[0].Before != "ann@example.com" || *upd.Changes[0].After != "ann@example.org" {
+		t.Fatalf("unexpected update entry %+v", upd)
+	}
+	if len(cre.Changes) != 3 || cre.Changes[0].Field != "name" || cre.Changes[0].Before != nil || *cre.Changes[0].After != "Ann" {
+		t.Fatalf("unexpected create entry %+v", cre)
+	}
+}
+
+func TestAttributesValidatedMergedAndFiltered(t *testing.T) {
+	ctx := context.Background()
+	schema, err := attrschema.New([]byte(`{
+		"type": "object",
+		"properties": {
+			"department": {"type": "string"},
+			"level": {"type": "integer", "minimum": 1},
+			"prefs": {"type": "object"}
+		},
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	svc := core.NewUserServiceWithOpts(core.NewInMemoryUserRepo(), core.UserServiceOptions{Attributes: schema})
+
+	_, err = svc.Create(ctx, "Bad", "bad@example.com", core.Attributes{"level": 0.0, "shoe": "42"})
+	var attrErr *core.AttributeError
+	if !errors.Is(err, core.ErrValidation) || !errors.As(err, &attrErr) || len(attrErr.Problems) != 2 {
+		t.Fatalf("expected two attribute problems, got %v", err)
+	}
+
+	ann, err := svc.Create(ctx, "Ann", "ann@example.com", core.Attributes{"department": "eng", "level": 3.0, "prefs": map[string]any{"theme": "dark", "tz": "UTC"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	bob, _ := svc.Create(ctx, "Bob", "bob@example.com", nil)
+	if bob.Attributes == nil || len(bob.Attributes) != 0 {
+		t.Fatalf("expected empty attributes, got %v", bob.Attributes)
+	}
+
+	// merge patch: null removes, nested objects merge, anything else replaces
+	u, err := svc.Update(ctx, ann.ID, nil, nil, core.Attributes{"level": nil, "prefs": map[string]any{"tz": nil, "lang": "de"}}, 0)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if fmt.Sprint(u.Attributes) != "map[department:eng prefs:map[lang:de theme:dark]]" {
+		t.Fatalf("unexpected merged attributes %v", u.Attributes)
+	}
+	if _, err := svc.Update(ctx, ann.ID, nil, nil, core.Attributes{"level": "high"}, 0); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("expected the merged result to be validated, got %v", err)
+	}
+
+	_, _ = svc.Update(ctx, bob.ID, nil, nil, core.Attributes{"department": "ops", "level": 2.0}, 0)
+	for filter, want := range map[string][]string{
+		"department=eng":         {"Ann"},
+		"level=2":                {"Bob"},
+		"department=ops,level=3": nil,
+	} {
+		f := core.UserFilter{Attributes: map[string]string{}}
+		for _, kv := range strings.Split(filter, ",") {
+			k, v, _ := strings.Cut(kv, "=")
+			f.Attributes[k] = v
+		}
+		users, _, err := svc.List(ctx, f, core.UserSort{Field: core.SortByName}, 1, 10)
+		if err != nil {
+			t.Fatalf("list %s: %v", filter, err)
+		}
+		var names []string
+		for _, u := range users {
+			names = append(names, u.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(want) {
+			t.Fatalf("filter %s: expected %v, got %v", filter, want, names)
+		}
+	}
+}
+
+func TestStatusTransitionsFollowStateMachine(t *testing.T) {
+	ctx := context.Background()
+	repo := core.NewInMemoryUserRepo()
+	svc := core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Audit: true})
+	ann, _ := svc.Create(ctx, "Ann", "ann@example.com", nil)
+	bob, err := svc.Invite(ctx, "Bob", "bob@example.com", nil)
+	if err != nil || ann.Status != core.StatusActive || bob.Status != core.StatusInvited {
+		t.Fatalf("unexpected initial statuses %q %q (%v)", ann.Status, bob.Status, err)
+	}
+
+	_, err = svc.Transition(ctx, bob.ID, core.StatusLocked, "")
+	var illegal *core.IllegalTransitionError
+	if !errors.As(err, &illegal) || !errors.Is(err, core.ErrConflict) || illegal.From != core.StatusInvited {
+		t.Fatalf("expected illegal transition conflict, got %v", err)
+	}
+	if _, err := svc.Transition(ctx, ann.ID, core.StatusActive, ""); !errors.As(err, &illegal) {
+		t.Fatalf("expected active to active to be rejected, got %v", err)
+	}
+	if _, err := svc.Transition(ctx, ann.ID, "deleted", ""); !errors.Is(err, core.ErrValidation) {
+		t.Fatalf("expected unknown status to be invalid, got %v", err)
+	}
+
+	u, err := svc.Transition(ctx, ann.ID, core.StatusSuspended, "  billing overdue ")
+	if err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+	if u.Status != core.StatusSuspended || u.StatusReason != "billing overdue" || !u.StatusChangedAt.After(ann.StatusChangedAt) || u.Version != ann.Version+1 {
+		t.Fatalf("unexpected suspended user %+v", u)
+	}
+	if u, err = svc.Transition(ctx, ann.ID, core.StatusActive, ""); err != nil || u.StatusReason != "" {
+		t.Fatalf("reactivate: %+v %v", u, err)
+	}
+	_, _ = svc.Transition(ctx, bob.ID, core.StatusSuspended, "")
+
+	hist, _ := svc.History(ctx, ann.ID, 0)
+	if hist[0].Action != "status_changed" || hist[1].Changes[0].Field != "status" || *hist[1].Changes[0].After != "suspended" ||
+		hist[1].Changes[1].Field != "status_reason" || *hist[1].Changes[1].After != "billing overdue" {
+		t.Fatalf("unexpected audit trail %+v", hist[:2])
+	}
+
+	users, _, err := svc.List(ctx, core.UserFilter{Statuses: []core.UserStatus{core.StatusSuspended, core.StatusInvited}}, core.DefaultUserSort, 1, 10)
+	if err != nil || len(users) != 1 || users[0].ID != bob.ID {
+		t.Fatalf("expected only bob to be suspended, got %v %v", users, err)
+	}
+	if err := svc.Delete(ctx, bob.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Transition(ctx, bob.ID, core.StatusActive, ""); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("expected deleted users to be out of reach, got %v", err)
+	}
+}
+
+func TestTenantsAreIsolated(t *testing.T) {
+	repo := core.NewInMemoryUserRepo()
+	c, err := cache.New(cache.Options{MaxCost: 1 << 20, NumCounters: 1000, BufferItems: 64, TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := core.NewCachedUserService(core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Audit: true}), c)
+	acme := core.WithTenant(context.Background(), "acme")
+	globex := core.WithTenant(context.Background(), "globex")
+
+	a, err := svc.Create(acme, "Ann", "ann@example.com", nil)
+	if err != nil || a.TenantID != "acme" {
+		t.Fatalf("create in acme: %+v %v", a, err)
+	}
+	g, err := svc.Create(globex, "Ann", "ANN@example.com", nil)
+	if err != nil || g.TenantID != "globex" {
+		t.Fatalf("emails are unique per tenant only, got %+v %v", g, err)
+	}
+	if _, err := svc.Create(acme, "Ann", "ann@example.com", nil); !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected a conflict within the tenant, got %v", err)
+	}
+	if _, _, err := svc.List(acme, core.UserFilter{}, core.DefaultUserSort, 1, 10); err != nil { // warm acme's list cache
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond) // let the local cache admit the entries
+
+	if _, err := svc.Get(globex, a.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("globex must not read acme's user, got %v", err)
+	}
+	name := "Mallory"
+	if _, err := svc.Update(globex, a.ID, &name, nil, nil, 0); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("globex must not update acme's user, got %v", err)
+	}
+	if _, err := svc.Transition(globex, a.ID, core.StatusSuspended, ""); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("globex must not suspend acme's user, got %v", err)
+	}
+	if err := svc.Delete(globex, a.ID, 0); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("globex must not delete acme's user, got %v", err)
+	}
+	if err := svc.Purge(globex, a.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("globex must not purge acme's user, got %v", err)
+	}
+	users, total, _ := svc.List(globex, core.UserFilter{}, core.DefaultUserSort, 1, 10)
+	if total != 1 || users[0].ID != g.ID {
+		t.Fatalf("globex should list only its own user, got %d %v", total, users)
+	}
+	if hits, _ := svc.Search(globex, "ann", 10); len(hits) != 1 || hits[0].User.ID != g.ID {
+		t.Fatalf("globex should find only its own user, got %v", hits)
+	}
+	if hist, _ := svc.History(globex, a.ID, 0); len(hist) != 0 {
+		t.Fatalf("globex must not see acme's audit trail, got %+v", hist)
+	}
+	if u, err := svc.Get(acme, a.ID); err != nil || u.Name != "Ann" || u.TenantID != "acme" {
+		t.Fatalf("acme's user must be untouched, got %+v %v", u, err)
+	}
+	if hist, _ := svc.History(acme, a.ID, 0); len(hist) != 1 || hist[0].TenantID != "acme" {
+		t.Fatalf("unexpected acme history %+v", hist)
+	}
+	if _, err := svc.Get(context.Background(), a.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("no tenant means the default tenant, got %v", err)
+	}
+}
+
+// rowsOf feeds rows to Import.
+func rowsOf(rows ...core.ImportRow) core.ImportSource {
+	return func() (core.ImportRow, error) {
+		if len(rows) == 0 {
+			return core.ImportRow{}, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}
+}
+
+func TestImportModesReportPerLine(t *testing.T) {
+	ctx := context.Background()
+	svc := core.NewUserServiceWithOpts(core.NewInMemoryUserRepo(), core.UserServiceOptions{Audit: true})
+	ann, err := svc.Create(ctx, "Ann", "ann@example.com", core.Attributes{"team": "core"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	input := func() core.ImportSource {
+		return rowsOf(
+			core.ImportRow{Line: 2, Name: "Bob", Email: "Bob@Example.com"},
+			core.ImportRow{Line: 3, Name: "Nobody", Email: "not-an-email"},
+			core.ImportRow{Line: 4, Name: "Ann B", Email: "ann@example.com", Attributes: core.Attributes{"level": float64(2)}},
+		)
+	}
+	count := func() int {
+		_, total, err := svc.List(ctx, core.UserFilter{}, core.UserSort{}, 1, 100)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		return total
+	}
+
+	// atomic (default): two failing lines, nothing stored
+	rep, err := svc.Import(ctx, input(), core.ImportOptions{})
+	if err != nil {
+		t.Fatalf("atomic import: %v", err)
+	}
+	if rep.Committed || rep.Rows != 3 || rep.Failed != 2 || len(rep.Errors) != 2 || rep.Errors[0].Line != 3 || rep.Errors[1].Line != 4 {
+		t.Fatalf("atomic report: %+v", rep)
+	}
+	if !errors.Is(rep.Errors[0].Err, core.ErrValidation) || !errors.Is(rep.Errors[1].Err, core.ErrConflict) {
+		t.Fatalf("atomic errors: %v, %v", rep.Errors[0].Err, rep.Errors[1].Err)
+	}
+	if count() != 1 {
+		t.Fatal("failed atomic import stored users")
+	}
+
+	// dry run: reports what an upsert would do without storing it
+	rep, err = svc.Import(ctx, input(), core.ImportOptions{Mode: core.BatchPartial, DryRun: true, Upsert: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if rep.Committed || rep.Created != 1 || rep.Updated != 1 || rep.Failed != 1 {
+		t.Fatalf("dry run report: %+v", rep)
+	}
+	if u, _ := svc.Get(ctx, ann.ID); count() != 1 || u.Name != "Ann" {
+		t.Fatal("dry run stored changes")
+	}
+
+	// partial upsert: the good lines are applied, the bad one reported
+	rep, err = svc.Import(ctx, input(), core.ImportOptions{Mode: core.BatchPartial, Upsert: true})
+	if err != nil {
+		t.Fatalf("partial import: %v", err)
+	}
+	if !rep.Committed || rep.Created != 1 || rep.Updated != 1 || rep.Failed != 1 || rep.Errors[0].Line != 3 {
+		t.Fatalf("partial report: %+v", rep)
+	}
+	u, err := svc.Get(ctx, ann.ID)
+	if err != nil || u.Name != "Ann B" || u.Attributes["team"] != "core" || u.Attributes["level"] != float64(2) {
+		t.Fatalf("upserted user: %+v, %v", u, err)
+	}
+	if history, _ := svc.History(ctx, ann.ID, 10); len(history) != 2 {
+		t.Fatalf("expected the upsert to be audited, got %d entries", len(history))
+	}
+
+	var exported []string
+	err = svc.Export(ctx, core.UserFilter{}, core.UserSort{Field: core.SortByEmail}, func(u *core.User) error {
+		exported = append(exported, u.Email)
+		return nil
+	})
+	if err != nil || strings.Join(exported, ",") != "ann@example.com,bob@example.com" {
+		t.Fatalf("export = %v, %v", exported, err)
+	}
+}
+
+type sentToken struct {
+	email, token string
+}
+
+// tokenRecorder captures verification tokens instead of mailing them.
+type tokenRecorder struct{ sent []sentToken }
+
+func (r *tokenRecorder) SendVerification(_ context.Context, u *core.User, token string, _ time.Time) {
+	r.sent = append(r.sent, sentToken{u.Email, token})
+}
+
+func TestEmailVerificationTokens(t *testing.T) {
+	ctx := context.Background()
+	sent := &tokenRecorder{}
+	tokens := core.NewVerificationTokens([]byte("secret"), time.Hour)
+	svc := core.NewUserServiceWithOpts(core.NewInMemoryUserRepo(),
+		core.UserServiceOptions{Audit: true, Verification: tokens, VerificationSender: sent})
+	u, err := svc.Create(ctx, "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if n := len(sent.sent); n != 1 {
+		t.Fatalf("expected one token on create, got %d", n)
+	}
+	first := sent.sent[0].token
+
+	// forged, foreign and other-tenant tokens are rejected
+	other, _ := core.NewVerificationTokens([]byte("other"), time.Hour).Issue(core.DefaultTenant, u.ID, u.Email)
+	foreign, _ := tokens.Issue("acme", u.ID, u.Email)
+	for _, bad := range []string{"", "garbage", first[:len(first)-2] + "xx", other, foreign} {
+		if _, err := svc.VerifyEmail(ctx, bad); !errors.Is(err, core.ErrInvalidVerificationToken) || !errors.Is(err, core.ErrValidation) {
+			t.Fatalf("token %q: expected ErrInvalidVerificationToken, got %v", bad, err)
+		}
+	}
+
+	v, err := svc.VerifyEmail(ctx, first)
+	if err != nil || v.EmailVerifiedAt == nil || v.Version != u.Version+1 {
+		t.Fatalf("verify: %+v, %v", v, err)
+	}
+	if again, err := svc.VerifyEmail(ctx, first); err != nil || !again.EmailVerifiedAt.Equal(*v.EmailVerifiedAt) {
+		t.Fatalf("second verify should be a no-op: %+v, %v", again, err)
+	}
+
+	// a new email resets verification and voids the old token
+	email := "ann@new.example.com"
+	changed, err := svc.Update(ctx, u.ID, nil, &email, nil, 0)
+	if err != nil || changed.EmailVerifiedAt != nil {
+		t.Fatalf("update: %+v, %v", changed, err)
+	}
+	if len(sent.sent) != 2 || sent.sent[1].email != email {
+		t.Fatalf("expected a token for the new email, got %+v", sent.sent)
+	}
+	if _, err := svc.VerifyEmail(ctx, first); !errors.Is(err, core.ErrInvalidVerificationToken) {
+		t.Fatalf("old token after email change: %v", err)
+	}
+	name := "Ann B"
+	if _, err := svc.Update(ctx, u.ID, &name, nil, nil, 0); err != nil || len(sent.sent) != 2 {
+		t.Fatalf("a name change must not send a token: %v, %d sent", err, len(sent.sent))
+	}
+	if v, err := svc.VerifyEmail(ctx, sent.sent[1].token); err != nil || v.EmailVerifiedAt == nil {
+		t.Fatalf("verify new email: %+v, %v", v, err)
+	}
+
+	expired, _ := core.NewVerificationTokens([]byte("secret"), time.Nanosecond).Issue(core.DefaultTenant, u.ID, email)
+	time.Sleep(2 * time.Millisecond)
+	if _, err := svc.VerifyEmail(ctx, expired); !errors.Is(err, core.ErrInvalidVerificationToken) {
+		t.Fatalf("expired token: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/handlers"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+func TestManagedAPIKeys(t *testing.T) {
+	keys := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{})
+	r := chi.NewRouter()
+	r.Use(middleware.APIKeyAuthWithOpts(middleware.APIKeyOptions{
+		Current: []string{"bootstrap"},
+		Tenants: map[string]string{"bootstrap": "acme"},
+		Lookup:  keys,
+	}))
+	handlers.NewAPIKeyHandler(keys).Register(r)
+	r.With(middleware.RequireScope(core.ScopeUsersRead)).Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(core.TenantFrom(r.Context())))
+	})
+	do := func(key, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type keyResp struct {
+		ID         string `json:"id"`
+		Secret     string `json:"secret"`
+		Status     string `json:"status"`
+		Deprecated bool   `json:"deprecated"`
+	}
+	decode := func(w *httptest.ResponseRecorder) keyResp {
+		t.Helper()
+		var k keyResp
+		if err := json.Unmarshal(w.Body.Bytes(), &k); err != nil {
+			t.Fatalf("decode %d %s: %v", w.Code, w.Body.String(), err)
+		}
+		return k
+	}
+
+	w := do("bootstrap", http.MethodPost, "/admin/keys", `{"name":"reporting","scopes":["users:read"]}`)
+	minted := decode(w)
+	if w.Code != http.StatusCreated || minted.Secret == "" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected 201 with secret, got %d %s", w.Code, w.Body.String())
+	}
+	if w := do(minted.Secret, http.MethodGet, "/whoami", ""); w.Code != http.StatusOK || w.Body.String() != "acme" {
+		t.Fatalf("minted key: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(minted.Secret, http.MethodGet, "/admin/keys", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 listing keys without admin scope, got %d", w.Code)
+	}
+	if w := do("bootstrap", http.MethodGet, "/admin/keys/"+minted.ID, ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), minted.Secret) {
+		t.Fatalf("expected 200 without secret, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = do("bootstrap", http.MethodPost, "/admin/keys/"+minted.ID+":rotate", `{"grace":"1h"}`)
+	rotated := decode(w)
+	if w.Code != http.StatusCreated || rotated.Secret == "" || rotated.ID == minted.ID {
+		t.Fatalf("rotate: %d %s", w.Code, w.Body.String())
+	}
+	w = do(minted.Secret, http.MethodGet, "/whoami", "")
+	if w.Code != http.StatusOK || w.Header().Get("Warning") == "" {
+		t.Fatalf("expected rotated-out key to work with a Warning, got %d %q", w.Code, w.Header().Get("Warning"))
+	}
+	if w := do("bootstrap", http.MethodGet, "/admin/keys/"+minted.ID, ""); !decode(w).Deprecated {
+		t.Fatalf("expected old key to be deprecated: %s", w.Body.String())
+	}
+	if w := do("bootstrap", http.MethodPost, "/admin/keys/"+minted.ID+":rotate", ""); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 rotating twice, got %d", w.Code)
+	}
+
+	if w := do("bootstrap", http.MethodPost, "/admin/keys/"+rotated.ID+":revoke", ""); w.Code != http.StatusOK || decode(w).Status != "revoked" {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(rotated.Secret, http.MethodGet, "/whoami", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for revoked key, got %d", w.Code)
+	}
+	if w := do("bootstrap", http.MethodPost, "/admin/keys", `{"name":"x","scopes":[]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without scopes, got %d", w.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/auth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/handlers"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+func TestLoginSessionAndLogout(t *testing.T) {
+	ctx := context.Background()
+	repo := core.NewInMemoryUserRepo()
+	users := core.NewUserService(repo)
+	svc := auth.NewService(users, repo, auth.NewMemorySessionStore(), auth.Options{})
+	u, err := users.Create(ctx, "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	r := chi.NewRouter()
+	r.Use(middleware.SessionAuth(svc))
+	handlers.NewAuthHandler(svc, users).Register(r)
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set(middleware.SessionHeader, token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPut, "/users/"+u.ID.String()+"/password", "", `{"password":"tidal shoe vortex 42"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("set password: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/auth/login", "", `{"email":"ann@example.com","password":"nope nope nope"}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad login: %d", w.Code)
+	}
+	w := do(http.MethodPost, "/auth/login", "", `{"email":"ann@example.com","password":"tidal shoe vortex 42"}`)
+	var login struct {
+		Token string `json:"token"`
+		User  struct {
+			ID uuid.UUID `json:"id"`
+		} `json:"user"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &login) != nil || login.Token == "" || login.User.ID != u.ID {
+		t.Fatalf("login: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodGet, "/auth/me", "", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("me without a session: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/auth/me", "forged", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("me with a forged session: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/auth/me", login.Token, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), u.ID.String()) {
+		t.Fatalf("me: %d %s", w.Code, w.Body.String())
+	}
+	other := uuid.New().String()
+	if w := do(http.MethodPut, "/users/"+other+"/password", login.Token, `{"password":"tidal shoe vortex 43"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("setting another user's password: %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/auth/logout", login.Token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("logout: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/auth/me", login.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("me after logout: %d", w.Code)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hex-zero/MaxwellGoSpine/internal/broker"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/handlers"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+// sseMessage is one parsed event; comments and the retry hint are skipped.
+type sseMessage struct{ id, event, data string }
+
+func readSSE(t *testing.T, sc *bufio.Scanner) sseMessage {
+	t.Helper()
+	var m sseMessage
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if m.event != "" {
+				return m
+			}
+		case strings.HasPrefix(line, "id: "):
+			m.id = line[4:]
+		case strings.HasPrefix(line, "event: "):
+			m.event = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			m.data = line[6:]
+		}
+	}
+	t.Fatalf("stream ended: %v", sc.Err())
+	return m
+}
+
+func TestEventStreamThroughBufferingMiddlewares(t *testing.T) {
+	b := broker.New(broker.Options{})
+	svc := core.NewUserServiceWithOpts(core.NewInMemoryUserRepo(), core.UserServiceOptions{Notifier: b})
+	r := chi.NewRouter()
+	r.Use(middleware.Timeout(50*time.Millisecond, "/users/events"))
+	r.Use(middleware.Gzip(-1))
+	r.Use(middleware.ETag)
+	r.Use(middleware.APIKeyAuth([]string{"k1"}))
+	handlers.NewEventsHandler(b).Register(r)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close) // runs after the streams below are closed
+
+	open := func(query, lastID string) (*http.Response, *bufio.Scanner) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/users/events"+query, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("X-API-Key", "k1")
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req) // negotiates gzip
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp, bufio.NewScanner(resp.Body)
+	}
+
+	resp, sc := open("?types=created,deleted", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" || resp.Header.Get("ETag") != "" {
+		t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Header)
+	}
+	time.Sleep(100 * time.Millisecond) // outlive the Timeout middleware
+	u, _ := svc.Create(context.Background(), "Ann", "ann@example.com", nil)
+	name := "Anna"
+	_, _ = svc.Update(context.Background(), u.ID, &name, nil, nil, 0) // filtered out
+	_ = svc.Delete(context.Background(), u.ID, 0)
+	created, deleted := readSSE(t, sc), readSSE(t, sc)
+	if created.event != "user.created" || !strings.Contains(created.data, `"subject":"`+u.ID.String()+`"`) || deleted.event != "user.deleted" {
+		t.Fatalf("unexpected events %+v %+v", created, deleted)
+	}
+
+	_, sc = open("", created.id)
+	if m := readSSE(t, sc); m.event != "user.updated" || readSSE(t, sc).id != deleted.id {
+		t.Fatalf("expected resume to replay the update and delete, got %+v", m)
+	}
+	_, sc = open("", "1")
+	if m := readSSE(t, sc); m.event != "reset" {
+		t.Fatalf("expected a reset for an unknown position, got %+v", m)
+	}
+}
+
+func TestEventStreamRequiresAcceptAndKnownTypes(t *testing.T) {
+	r := chi.NewRouter()
+	handlers.NewEventsHandler(broker.New(broker.Options{})).Register(r)
+	for _, tc := range []struct {
+		accept, query string
+		want          int
+	}{
+		{"application/json", "", http.StatusNotAcceptable},
+		{"text/event-stream", "?types=exploded", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/users/events"+tc.query, nil)
+		req.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("%s %s: expected %d, got %d", tc.accept, tc.query, tc.want, w.Code)
+		}
+	}
+}
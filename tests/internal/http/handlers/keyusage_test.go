@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/handlers"
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+	"go.uber.org/zap"
+)
+
+func TestKeyUsageReport(t *testing.T) {
+	tracker := keyusage.NewTracker(keyusage.NewMemoryStore(), zap.NewNop(), keyusage.Options{})
+	soon := time.Now().Add(48 * time.Hour)
+	r := chi.NewRouter()
+	r.Use(middleware.APIKeyAuthWithOpts(middleware.APIKeyOptions{
+		Current: []string{"admin", "reporting"},
+		Old:     []string{"legacy"},
+		Scopes:  map[string][]core.Scope{"admin": {core.ScopeAdmin}, "reporting": {core.ScopeUsersRead}, "legacy": {core.ScopeUsersRead}},
+	}))
+	r.Use(middleware.KeyUsage(tracker))
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	handlers.NewKeyUsageHandler(tracker, handlers.KeyUsageHandlerOptions{StaticKeys: []keyusage.KeyInfo{
+		{ID: middleware.KeyID("admin"), TenantID: core.DefaultTenant, Source: "env"},
+		{ID: middleware.KeyID("reporting"), TenantID: core.DefaultTenant, Source: "env", ExpiresAt: &soon},
+		{ID: middleware.KeyID("legacy"), TenantID: core.DefaultTenant, Source: "env", Deprecated: true},
+		{ID: middleware.KeyID("elsewhere"), TenantID: "globex", Source: "env"},
+	}}).Register(r)
+	do := func(key, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("User-Agent", "report-bot/1.0")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 3; i++ {
+		do("legacy", "/users/"+strconv.Itoa(i))
+	}
+	do("reporting", "/users/1")
+	if w := do("reporting", "/admin/keys/usage"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without admin scope, got %d", w.Code)
+	}
+
+	w := do("admin", "/admin/keys/usage")
+	var resp struct {
+		Data []struct {
+			KeyID         string           `json:"key_id"`
+			Deprecated    bool             `json:"deprecated"`
+			ExpiringSoon  bool             `json:"expiring_soon"`
+			Attention     bool             `json:"attention"`
+			Requests      int64            `json:"requests"`
+			Errors        int64            `json:"errors"`
+			LastUserAgent string           `json:"last_user_agent"`
+			Routes        map[string]int64 `json:"routes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("report: %d %s", w.Code, w.Body.String())
+	}
+	if len(resp.Data) != 3 {
+		t.Fatalf("expected the tenant's 3 keys, got %+v", resp.Data)
+	}
+	legacy, reporting, admin := resp.Data[0], resp.Data[1], resp.Data[2]
+	if legacy.KeyID != middleware.KeyID("legacy") || !legacy.Deprecated || !legacy.Attention || legacy.Requests != 3 ||
+		legacy.Routes["GET /users/{id}"] != 3 || legacy.LastUserAgent != "report-bot/1.0" {
+		t.Fatalf("unexpected legacy entry %+v", legacy)
+	}
+	if reporting.KeyID != middleware.KeyID("reporting") || !reporting.ExpiringSoon || reporting.Requests != 2 || reporting.Errors != 1 {
+		t.Fatalf("unexpected reporting entry %+v", reporting)
+	}
+	if admin.KeyID != middleware.KeyID("admin") || admin.Attention {
+		t.Fatalf("unexpected admin entry %+v", admin)
+	}
+}
@@ -2,36 +2,97 @@ package handlers_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
 	"github.com/hex-zero/MaxwellGoSpine/internal/http/handlers"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
-type mockUserSvc struct{ users map[string]*core.User }
+type mockUserSvc struct {
+	users  map[string]*core.User
+	purged []uuid.UUID
+	patch  core.Attributes // attributes passed to the last Update
+	filter core.UserFilter // filter passed to the last List
+}
 
-func (m *mockUserSvc) Create(ctx context.Context, name, email string) (*core.User, error) {
-	u := &core.User{ID: uuid.New(), Name: name, Email: email}
+func (m *mockUserSvc) Create(ctx context.Context, name, email string, attrs core.Attributes) (*core.User, error) {
+	u := &core.User{ID: uuid.New(), Name: name, Email: email, Attributes: attrs}
 	if m.users == nil {
 		m.users = map[string]*core.User{}
 	}
 	m.users[email] = u
 	return u, nil
 }
+func (m *mockUserSvc) Invite(ctx context.Context, name, email string, attrs core.Attributes) (*core.User, error) {
+	return &core.User{ID: uuid.New(), Name: name, Email: email, Status: core.StatusInvited}, nil
+}
+func (m *mockUserSvc) Transition(ctx context.Context, id uuid.UUID, to core.UserStatus, reason string) (*core.User, error) {
+	if to == core.StatusLocked {
+		return nil, &core.IllegalTransitionError{From: core.StatusInvited, To: to}
+	}
+	return &core.User{ID: id, Status: to, StatusReason: reason, Version: 2}, nil
+}
 func (m *mockUserSvc) Get(ctx context.Context, id uuid.UUID) (*core.User, error) {
 	return nil, core.ErrNotFound
 }
-func (m *mockUserSvc) Update(ctx context.Context, id uuid.UUID, name *string, email *string) (*core.User, error) {
-	return nil, core.ErrNotFound
+func (m *mockUserSvc) Update(ctx context.Context, id uuid.UUID, name *string, email *string, attrs core.Attributes, expectedVersion int64) (*core.User, error) {
+	if expectedVersion != 0 && expectedVersion != 3 {
+		return nil, core.ErrStaleVersion
+	}
+	m.patch = attrs
+	u := &core.User{ID: id, Version: 4, Attributes: attrs}
+	if name != nil {
+		u.Name = *name
+	}
+	return u, nil
 }
-func (m *mockUserSvc) Delete(ctx context.Context, id uuid.UUID) error { return core.ErrNotFound }
-func (m *mockUserSvc) List(ctx context.Context, page, pageSize int) ([]*core.User, int, error) {
+func (m *mockUserSvc) Delete(ctx context.Context, id uuid.UUID, expectedVersion int64) error {
+	return core.ErrNotFound
+}
+func (m *mockUserSvc) Restore(ctx context.Context, id uuid.UUID) (*core.User, error) {
+	return &core.User{ID: id, Name: "Restored", Email: "restored@example.com"}, nil
+}
+func (m *mockUserSvc) Purge(ctx context.Context, id uuid.UUID) error {
+	m.purged = append(m.purged, id)
+	return nil
+}
+func (m *mockUserSvc) List(ctx context.Context, f core.UserFilter, s core.UserSort, page, pageSize int) ([]*core.User, int, error) {
+	m.filter = f
 	return nil, 0, nil
 }
+func (m *mockUserSvc) ListAfter(ctx context.Context, f core.UserFilter, s core.UserSort, cursor string, limit int) ([]*core.User, string, error) {
+	return nil, "", nil
+}
+func (m *mockUserSvc) Search(ctx context.Context, query string, limit int) ([]core.SearchHit, error) {
+	return nil, nil
+}
+func (m *mockUserSvc) Batch(ctx context.Context, ops []core.BatchOp, mode core.BatchMode) ([]core.BatchResult, error) {
+	return make([]core.BatchResult, len(ops)), nil
+}
+func (m *mockUserSvc) History(ctx context.Context, id uuid.UUID, limit int) ([]core.AuditEntry, error) {
+	return []core.AuditEntry{}, nil
+}
+func (m *mockUserSvc) Export(ctx context.Context, f core.UserFilter, sort core.UserSort, fn func(*core.User) error) error {
+	return nil
+}
+func (m *mockUserSvc) Import(ctx context.Context, rows core.ImportSource, opts core.ImportOptions) (*core.ImportReport, error) {
+	return &core.ImportReport{}, nil
+}
+func (m *mockUserSvc) VerifyEmail(ctx context.Context, token string) (*core.User, error) {
+	if token != "good-token" {
+		return nil, core.ErrInvalidVerificationToken
+	}
+	now := time.Now()
+	return &core.User{ID: uuid.New(), Name: "Verified", Email: "verified@example.com", EmailVerifiedAt: &now, Version: 2}, nil
+}
 func (m *mockUserSvc) WithTx(ctx context.Context, fn func(context.Context, core.UnitOfWork) error) error {
 	return fn(ctx, nil)
 }
@@ -49,3 +110,347 @@ func TestCreateUser(t *testing.T) {
 		t.Fatalf("expected 201 got %d", w.Code)
 	}
 }
+
+func TestVerifyEmail(t *testing.T) {
+	h := handlers.NewUserHandler(&mockUserSvc{})
+	r := chi.NewRouter()
+	h.Register(r)
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"token":"good-token"}`, http.StatusOK},
+		{`{"token":"forged"}`, http.StatusBadRequest},
+		{`{}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/users/verify", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("%s: expected %d got %d %s", tc.body, tc.want, w.Code, w.Body.String())
+		}
+		if tc.want == http.StatusOK && !strings.Contains(w.Body.String(), `"email_verified_at":"`) {
+			t.Fatalf("expected email_verified_at in %s", w.Body.String())
+		}
+	}
+}
+
+func TestRestoreAndHardDeleteRoutes(t *testing.T) {
+	svc := &mockUserSvc{}
+	h := handlers.NewUserHandler(svc)
+	r := chi.NewRouter()
+	h.Register(r)
+	id := uuid.New()
+
+	req := httptest.NewRequest(http.MethodPost, "/users/"+id.String()+":restore", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), id.String()) {
+		t.Fatalf("expected 200 restoring %s, got %d %s", id, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/users/"+id.String()+"?hard=true", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || len(svc.purged) != 1 || svc.purged[0] != id {
+		t.Fatalf("expected hard delete to purge %s, got %d purged=%v", id, w.Code, svc.purged)
+	}
+}
+
+func TestUpdateHonoursIfMatch(t *testing.T) {
+	r := chi.NewRouter()
+	handlers.NewUserHandlerWithOpts(&mockUserSvc{}, handlers.UserHandlerOptions{RequireIfMatch: true}).Register(r)
+	patch := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/users/"+uuid.NewString(), strings.NewReader(`{"name":"New"}`))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := patch(""); w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("expected 428 without If-Match, got %d", w.Code)
+	}
+	if w := patch(`"v2"`); w.Code != http.StatusPreconditionFailed || w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("expected 412 problem for stale ETag, got %d", w.Code)
+	}
+	if w := patch(`W/"v3"`); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for weak ETag, got %d", w.Code)
+	}
+	w := patch(`"v3"`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"v4"` {
+		t.Fatalf("expected 200 with new ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestBatchModes(t *testing.T) {
+	r := chi.NewRouter()
+	handlers.NewUserHandler(core.NewUserService(core.NewInMemoryUserRepo())).Register(r)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users:batch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	ops := `[{"op":"create","name":"Ann","email":"ann@example.com"},{"op":"create","name":"Dup","email":"ANN@example.com"}]`
+
+	w := post(`{"operations":` + ops + `}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "batch item 1") {
+		t.Fatalf("expected atomic 409 naming item 1, got %d %s", w.Code, w.Body.String())
+	}
+	w = post(`{"mode":"partial","operations":` + ops + `}`)
+	var resp struct {
+		Failed  int `json:"failed"`
+		Results []struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Status int `json:"status"`
+			} `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("partial batch: %d %s", w.Code, w.Body.String())
+	}
+	if resp.Failed != 1 || resp.Results[0].Status != http.StatusCreated || resp.Results[1].Error == nil || resp.Results[1].Error.Status != http.StatusConflict {
+		t.Fatalf("unexpected partial results: %s", w.Body.String())
+	}
+}
+
+func TestHistoryAttributesChangesToAPIKeyAndRequest(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.APIKeyAuth([]string{"k1"}))
+	r.Use(middleware.AuditContext)
+	svc := core.NewUserServiceWithOpts(core.NewInMemoryUserRepo(), core.UserServiceOptions{Audit: true})
+	handlers.NewUserHandler(svc).Register(r)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "k1")
+		req.Header.Set(middleware.RequestIDHeader, "req-"+method)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := do(http.MethodPost, "/users", `{"name":"Ann","email":"ann@example.com"}`)
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, "/users/"+created.ID, `{"email":"ann@example.org"}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/users/"+created.ID+"/history", "")
+	var resp struct {
+		Data []struct {
+			Action    string             `json:"action"`
+			Actor     string             `json:"actor"`
+			RequestID string             `json:"request_id"`
+			Changes   []core.FieldChange `json:"changes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || len(resp.Data) != 2 {
+		t.Fatalf("history: %d %s", w.Code, w.Body.String())
+	}
+	upd := resp.Data[0]
+	if upd.Action != "updated" || upd.Actor != middleware.KeyID("k1") || upd.RequestID != "req-PATCH" {
+		t.Fatalf("unexpected attribution %+v", upd)
+	}
+	if len(upd.Changes) != 1 || upd.Changes[0].Field != "email" || *upd.Changes[0].Before != "ann@example.com" || *upd.Changes[0].After != "ann@example.org" {
+		t.Fatalf("unexpected diff %+v", upd.Changes)
+	}
+	if resp.Data[1].Action != "created" || resp.Data[1].RequestID != "req-POST" {
+		t.Fatalf("unexpected create entry %+v", resp.Data[1])
+	}
+}
+
+func TestAttributesPatchAndFilter(t *testing.T) {
+	svc := &mockUserSvc{}
+	r := chi.NewRouter()
+	handlers.NewUserHandler(svc).Register(r)
+	do := func(method, target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/users", "application/json", `{"name":"Ann","email":"ann@example.com"}`)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"attributes":{}`) {
+		t.Fatalf("expected empty attributes object, got %d %s", w.Code, w.Body.String())
+	}
+	id := "/users/" + uuid.NewString()
+	w = do(http.MethodPatch, id, "application/merge-patch+json", `{"attributes":{"locale":"de","department":null}}`)
+	if w.Code != http.StatusOK || len(svc.patch) != 2 || svc.patch["locale"] != "de" {
+		t.Fatalf("expected patch to reach the service, got %d %v", w.Code, svc.patch)
+	}
+	if v, ok := svc.patch["department"]; !ok || v != nil {
+		t.Fatalf("expected null to be kept as a removal, got %v", svc.patch)
+	}
+	w = do(http.MethodPatch, id, "application/merge-patch+json; charset=utf-8", `{"attributes":{"department":null},"nickname":null}`)
+	if v, ok := svc.patch["department"]; w.Code != http.StatusOK || !ok || v != nil {
+		t.Fatalf("expected a charset parameter to keep merge-patch semantics, got %d %v", w.Code, svc.patch)
+	}
+	if w := do(http.MethodPatch, id, "application/merge-patch+json", `{"name":"Ann"}`); w.Code != http.StatusOK || svc.patch != nil {
+		t.Fatalf("expected absent attributes to stay untouched, got %v", svc.patch)
+	}
+	if w := do(http.MethodPatch, id, "application/merge-patch+json", `{"attributes":null}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for null attributes, got %d", w.Code)
+	}
+
+	if w := do(http.MethodGet, "/users?attr.department=eng&attr.level=3", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("list: %d", w.Code)
+	}
+	if len(svc.filter.Attributes) != 2 || svc.filter.Attributes["department"] != "eng" || svc.filter.Attributes["level"] != "3" {
+		t.Fatalf("unexpected filter %+v", svc.filter)
+	}
+}
+
+func TestStatusActions(t *testing.T) {
+	svc := &mockUserSvc{}
+	r := chi.NewRouter()
+	handlers.NewUserHandler(svc).Register(r)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := do(http.MethodPost, "/users:invite", `{"name":"Ann","email":"ann@example.com"}`); w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"status":"invited"`) {
+		t.Fatalf("invite: %d %s", w.Code, w.Body.String())
+	}
+	id := "/users/" + uuid.NewString()
+	w := do(http.MethodPost, id+":suspend", `{"reason":"billing"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"suspended"`) || !strings.Contains(w.Body.String(), `"status_reason":"billing"`) {
+		t.Fatalf("suspend: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, id+":activate", ""); w.Code != http.StatusOK || w.Header().Get("ETag") != `"v2"` {
+		t.Fatalf("activate without body: %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPost, id+":lock", "")
+	if w.Code != http.StatusConflict || w.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(w.Body.String(), "from invited to locked") {
+		t.Fatalf("expected 409 problem for an illegal transition, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodGet, "/users?status=active,Suspended", ""); w.Code != http.StatusOK || fmt.Sprint(svc.filter.Statuses) != "[active suspended]" {
+		t.Fatalf("unexpected status filter %d %v", w.Code, svc.filter.Statuses)
+	}
+	if w := do(http.MethodGet, "/users?status=gone", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown status, got %d", w.Code)
+	}
+}
+
+func TestExportAndImportRoundTrip(t *testing.T) {
+	svc := core.NewUserService(core.NewInMemoryUserRepo())
+	r := chi.NewRouter()
+	handlers.NewUserHandler(svc).Register(r)
+	do := func(method, target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	csvBody := "\ufeffEmail,name,attributes\n" +
+		"ann@example.com,Ann,\"{\"\"team\"\":\"\"core\"\"}\"\n" +
+		"bad,Nobody,\n" +
+		"bob@example.com,Bob,[1]\n"
+	w := do(http.MethodPost, "/users/import", "text/csv", csvBody)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"line":3,"status":400`) ||
+		!strings.Contains(w.Body.String(), `"line":4,"status":400`) || !strings.Contains(w.Body.String(), `"committed":false`) {
+		t.Fatalf("atomic import with bad lines: %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPost, "/users/import?mode=partial", "text/csv", csvBody)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"created":1,"updated":0,"failed":2`) {
+		t.Fatalf("partial import: %d %s", w.Code, w.Body.String())
+	}
+	ndjson := `{"name":"Bob","email":"bob@example.com"}` + "\n\n" + `{"name":"Ann A","email":"ANN@example.com","attributes":{"level":2}}` + "\n"
+	w = do(http.MethodPost, "/users/import?upsert=true", "application/x-ndjson", ndjson)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"created":1,"updated":1,"failed":0`) {
+		t.Fatalf("ndjson upsert: %d %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/users/export?format=csv&sort=email", "", "")
+	want := "id,name,email,status,attributes,created_at,updated_at,deleted_at,version\n"
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" || !strings.HasPrefix(w.Body.String(), want) {
+		t.Fatalf("csv export: %d %q", w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], `,Ann A,ann@example.com,active,"{""level"":2,""team"":""core""}",`) {
+		t.Fatalf("csv export rows: %q", lines)
+	}
+	w = do(http.MethodGet, "/users/export?email_domain=example.com", "", "")
+	if w.Header().Get("Content-Type") != "application/x-ndjson" || strings.Count(w.Body.String(), "\n") != 2 {
+		t.Fatalf("ndjson export: %q", w.Body.String())
+	}
+	// an export re-imports as is; with upsert every line updates its user
+	w = do(http.MethodPost, "/users/import?format=ndjson&upsert=1&dry_run=true", "", w.Body.String())
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"committed":false,"rows":2,"created":0,"updated":2`) {
+		t.Fatalf("re-import dry run: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodPost, "/users/import", "text/plain", "x"); w.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for an unknown format, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/users/import", "text/csv", "email\nann@example.com\n"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a header without name, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/users/export?format=xml", "", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown export format, got %d", w.Code)
+	}
+}
+
+func TestScopedAPIKeys(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.APIKeyAuthWithOpts(middleware.APIKeyOptions{
+		Current: []string{"reader", "writer", "deleter", "admin", "unlisted"},
+		Scopes: map[string][]core.Scope{
+			"reader":  {core.ScopeUsersRead},
+			"writer":  {core.ScopeUsersRead, core.ScopeUsersWrite},
+			"deleter": {core.ScopeUsersDelete},
+			"admin":   {core.ScopeAdmin},
+		},
+	}))
+	svc := &mockUserSvc{}
+	handlers.NewUserHandler(svc).Register(r)
+	id := uuid.New().String()
+	do := func(key, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	forbidden := func(w *httptest.ResponseRecorder, scope string) {
+		t.Helper()
+		if w.Code != http.StatusForbidden || w.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(w.Body.String(), scope) {
+			t.Fatalf("expected 403 problem naming %s, got %d %s", scope, w.Code, w.Body.String())
+		}
+	}
+
+	if w := do("reader", http.MethodGet, "/users", ""); w.Code != http.StatusOK {
+		t.Fatalf("reader list: %d", w.Code)
+	}
+	forbidden(do("reader", http.MethodPost, "/users", `{"name":"Ann","email":"ann@example.com"}`), "users:write")
+	forbidden(do("reader", http.MethodDelete, "/users/"+id, ""), "users:delete")
+	if w := do("writer", http.MethodPost, "/users", `{"name":"Ann","email":"ann@example.com"}`); w.Code != http.StatusCreated {
+		t.Fatalf("writer create: %d %s", w.Code, w.Body.String())
+	}
+	// a batch is a write, but any delete in it also needs users:delete
+	forbidden(do("writer", http.MethodPost, "/users:batch", `{"operations":[{"op":"delete","id":"`+id+`"}]}`), "users:delete")
+	// purging needs admin beyond users:delete; admin implies every scope
+	forbidden(do("writer", http.MethodDelete, "/users/"+id+"?hard=true", ""), "users:delete")
+	forbidden(do("deleter", http.MethodDelete, "/users/"+id+"?hard=true", ""), "admin")
+	if w := do("admin", http.MethodDelete, "/users/"+id+"?hard=true", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("admin purge: %d %s", w.Code, w.Body.String())
+	}
+	// once scopes are configured, a key left out of them may do nothing
+	forbidden(do("unlisted", http.MethodGet, "/users", ""), "users:read")
+}
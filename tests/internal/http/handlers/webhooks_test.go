@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/hex-zero/MaxwellGoSpine/internal/http/handlers"
+	"github.com/hex-zero/MaxwellGoSpine/internal/webhook"
+)
+
+func TestWebhookCRUD(t *testing.T) {
+	r := chi.NewRouter()
+	handlers.NewWebhookHandler(webhook.NewService(webhook.NewMemoryStore())).Register(r)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/webhooks", `{"url":"ftp://example.com"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for non-http url, got %d", w.Code)
+	}
+	w := do(http.MethodPost, "/webhooks", `{"url":"https://example.com/hook","event_types":["user.created"]}`)
+	var created struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated || created.Secret == "" {
+		t.Fatalf("expected 201 with generated secret, got %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, "/webhooks/"+created.ID, "")
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), created.Secret) {
+		t.Fatalf("expected 200 without secret, got %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPatch, "/webhooks/"+created.ID, `{"active":false,"event_types":["user.deleted"]}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":false`) || !strings.Contains(w.Body.String(), "user.deleted") {
+		t.Fatalf("patch: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, "/webhooks/"+created.ID, `{"event_types":["user.exploded"]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown event type, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/webhooks/"+created.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/webhooks/"+created.ID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", w.Code)
+	}
+}
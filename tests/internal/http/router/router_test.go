@@ -0,0 +1,79 @@
+package router_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/config"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	routerpkg "github.com/hex-zero/MaxwellGoSpine/internal/http/router"
+	"github.com/hex-zero/MaxwellGoSpine/internal/jwtauth"
+	"github.com/hex-zero/MaxwellGoSpine/internal/metrics"
+	"go.uber.org/zap"
+)
+
+var b64 = base64.RawURLEncoding
+
+// jwtOnly builds the router configured with bearer JWTs and no API keys, and returns a valid token for it.
+func jwtOnly(t *testing.T) (http.Handler, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{"kty": "OKP", "kid": "k1", "crv": "Ed25519", "x": b64.EncodeToString(pub)}}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jwtauth.NewJWKS(context.Background(), path, jwtauth.JWKSOptions{})
+	if err != nil {
+		t.Fatalf("jwks: %v", err)
+	}
+	verifier := jwtauth.NewVerifier(keys, jwtauth.VerifierOptions{Issuer: "https://idp.example", Audience: []string{"maxwell-api"}})
+
+	h, _ := json.Marshal(map[string]string{"alg": "EdDSA", "kid": "k1", "typ": "JWT"})
+	p, _ := json.Marshal(map[string]any{"iss": "https://idp.example", "aud": "maxwell-api", "sub": "svc", "exp": time.Now().Add(time.Minute).Unix(), "scope": "users:read"})
+	input := b64.EncodeToString(h) + "." + b64.EncodeToString(p)
+	token := input + "." + b64.EncodeToString(ed25519.Sign(priv, []byte(input)))
+
+	cfg := &config.Config{Env: "prod", JWTJWKS: path, JWTIssuer: "https://idp.example", JWTAudience: []string{"maxwell-api"}}
+	return routerpkg.New(routerpkg.Deps{
+		Logger:   zap.NewNop(),
+		UserSvc:  core.NewUserService(core.NewInMemoryUserRepo()),
+		CFG:      cfg,
+		Registry: metrics.NewRegistry(),
+		JWT:      verifier,
+	}), token
+}
+
+func TestJWTOnlyRequiresCredentials(t *testing.T) {
+	r, token := jwtOnly(t)
+	get := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := get("", ""); code != http.StatusUnauthorized {
+		t.Fatalf("no credentials: got %d, want 401", code)
+	}
+	if code := get("X-API-Key", "anything"); code != http.StatusUnauthorized {
+		t.Fatalf("unknown api key: got %d, want 401", code)
+	}
+	if code := get("Authorization", "Bearer "+token); code != http.StatusOK {
+		t.Fatalf("valid bearer token: got %d, want 200", code)
+	}
+}
@@ -0,0 +1,229 @@
+package idempotency_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/idempotency"
+	"github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+// counter is a handler that answers every request with a new number, so replays are easy to spot.
+type counter struct {
+	calls   atomic.Int64
+	status  int
+	started chan struct{} // if set, signalled when a request arrives
+	release chan struct{} // if set, requests wait for it before answering
+}
+
+func (c *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := c.calls.Add(1)
+	if c.started != nil {
+		c.started <- struct{}{}
+	}
+	if c.release != nil {
+		<-c.release
+	}
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("X-Call", strings.Repeat("i", int(n)))
+	status := c.status
+	if status == 0 {
+		status = http.StatusCreated
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func do(ctx context.Context, h http.Handler, method, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/v1/users", strings.NewReader(body)).WithContext(ctx)
+	if key != "" {
+		req.Header.Set(idempotency.Header, key)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestReplaysStoredResponse(t *testing.T) {
+	c := &counter{}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(c)
+	ctx := context.Background()
+
+	first := do(ctx, h, http.MethodPost, `"k1"`, `{"a":1}`)
+	second := do(ctx, h, http.MethodPost, `"k1"`, `{"a":1}`)
+	if c.calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", c.calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != `{"a":1}` || second.Header().Get("X-Call") != "i" {
+		t.Fatalf("replay = %d %q %q", second.Code, second.Body.String(), second.Header().Get("X-Call"))
+	}
+	if second.Header().Get(idempotency.ReplayedHeader) != "true" || first.Header().Get(idempotency.ReplayedHeader) != "" {
+		t.Fatal("only the replay should be marked as replayed")
+	}
+
+	// a different key, no key, or a safe method always reach the handler
+	do(ctx, h, http.MethodPost, "k2", `{"a":1}`)
+	do(ctx, h, http.MethodPost, "", `{"a":1}`)
+	do(ctx, h, http.MethodGet, "k1", "")
+	if c.calls.Load() != 4 {
+		t.Fatalf("handler ran %d times, want 4", c.calls.Load())
+	}
+}
+
+func TestKeyReusedForDifferentRequestIs422(t *testing.T) {
+	c := &counter{}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(c)
+	ctx := context.Background()
+	do(ctx, h, http.MethodPost, "k", `{"a":1}`)
+	if rr := do(ctx, h, http.MethodPost, "k", `{"a":2}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("different body: status %d, want 422", rr.Code)
+	}
+	if rr := do(ctx, h, http.MethodPatch, "k", `{"a":1}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("different method: status %d, want 422", rr.Code)
+	}
+}
+
+func TestConcurrentDuplicateIs409(t *testing.T) {
+	c := &counter{started: make(chan struct{}, 1), release: make(chan struct{})}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(c)
+	ctx := context.Background()
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- do(ctx, h, http.MethodDelete, "k", "") }()
+	<-c.started
+	if rr := do(ctx, h, http.MethodDelete, "k", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("in-flight duplicate: status %d, want 409", rr.Code)
+	}
+	close(c.release)
+	if rr := <-done; rr.Code != http.StatusCreated {
+		t.Fatalf("first request: status %d", rr.Code)
+	}
+	if rr := do(ctx, h, http.MethodDelete, "k", ""); rr.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Fatal("finished request should be replayed")
+	}
+}
+
+func TestServerErrorsAreNotStored(t *testing.T) {
+	c := &counter{status: http.StatusServiceUnavailable}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(c)
+	ctx := context.Background()
+	do(ctx, h, http.MethodPost, "k", "x")
+	c.status = http.StatusCreated
+	if rr := do(ctx, h, http.MethodPost, "k", "x"); rr.Code != http.StatusCreated || rr.Header().Get(idempotency.ReplayedHeader) != "" {
+		t.Fatalf("retry after 5xx: status %d replayed=%q", rr.Code, rr.Header().Get(idempotency.ReplayedHeader))
+	}
+	if c.calls.Load() != 2 {
+		t.Fatalf("handler ran %d times, want 2", c.calls.Load())
+	}
+}
+
+func TestKeysAreScopedToTheAPIKey(t *testing.T) {
+	c := &counter{}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(c)
+	alice := middleware.WithAPIKeyID(context.Background(), "alice-key")
+	bob := middleware.WithAPIKeyID(context.Background(), "bob-key")
+	do(alice, h, http.MethodPost, "k", `{"a":1}`)
+	if rr := do(bob, h, http.MethodPost, "k", `{"b":2}`); rr.Code != http.StatusCreated {
+		t.Fatalf("same key from another client: status %d, want 201", rr.Code)
+	}
+}
+
+func TestBodySizeIsCapped(t *testing.T) {
+	c := &counter{}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{MaxBody: 8})(c)
+	ctx := context.Background()
+	if rr := do(ctx, h, http.MethodPost, "big", strings.Repeat("x", 9)); rr.Code != http.StatusRequestEntityTooLarge || c.calls.Load() != 0 {
+		t.Fatalf("oversized body: status %d after %d calls, want 413 before the handler", rr.Code, c.calls.Load())
+	}
+	// The counter echoes the body, so a body at the cap gives a response at the cap, which is stored
+	do(ctx, h, http.MethodPost, "fits", strings.Repeat("x", 8))
+	if rr := do(ctx, h, http.MethodPost, "fits", strings.Repeat("x", 8)); rr.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Fatal("expected a response within the cap to be replayed")
+	}
+
+	big := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{MaxBody: 8})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.calls.Add(1)
+		_, _ = io.WriteString(w, "12345")
+		_, _ = io.WriteString(w, "67890")
+	}))
+	before := c.calls.Load()
+	for range 2 {
+		if rr := do(ctx, big, http.MethodPost, "k", ""); rr.Body.String() != "1234567890" || rr.Header().Get(idempotency.ReplayedHeader) != "" {
+			t.Fatalf("oversized response: %q replayed=%q", rr.Body.String(), rr.Header().Get(idempotency.ReplayedHeader))
+		}
+	}
+	if c.calls.Load()-before != 2 {
+		t.Fatal("expected an oversized response not to be stored")
+	}
+}
+
+func TestExemptPathsIgnoreTheKey(t *testing.T) {
+	c := &counter{}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{MaxBody: 8, Exempt: []string{"/v1/users"}})(c)
+	for range 2 {
+		if rr := do(context.Background(), h, http.MethodPost, "k", strings.Repeat("x", 100)); rr.Code != http.StatusCreated {
+			t.Fatalf("exempt path: status %d", rr.Code)
+		}
+	}
+	if c.calls.Load() != 2 {
+		t.Fatalf("handler ran %d times, want 2", c.calls.Load())
+	}
+}
+
+func TestKeysAreScopedToTheSession(t *testing.T) {
+	c := &counter{}
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(c)
+	app := middleware.WithAPIKeyID(context.Background(), "app-key")
+	logout := func(ctx context.Context, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/logout", nil).WithContext(ctx)
+		req.Header.Set(idempotency.Header, "logout-1")
+		req.Header.Set(middleware.SessionHeader, session)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	ann, bob := core.WithEndUser(app, uuid.New()), core.WithEndUser(app, uuid.New())
+	logout(ann, "ann-session")
+	if rr := logout(bob, "bob-session"); rr.Header().Get(idempotency.ReplayedHeader) != "" {
+		t.Fatal("another end user of the same app got a replayed response")
+	}
+	if rr := logout(ann, "ann-other-session"); rr.Header().Get(idempotency.ReplayedHeader) != "" {
+		t.Fatal("another session of the same end user got a replayed response")
+	}
+	if rr := logout(ann, "ann-session"); rr.Header().Get(idempotency.ReplayedHeader) != "true" {
+		t.Fatal("expected a retry in the same session to be replayed")
+	}
+	if c.calls.Load() != 3 {
+		t.Fatalf("handler ran %d times, want 3", c.calls.Load())
+	}
+}
+
+func TestInvalidKeyIs400(t *testing.T) {
+	h := idempotency.Middleware(idempotency.NewMemoryStore(), idempotency.Options{})(&counter{})
+	if rr := do(context.Background(), h, http.MethodPost, strings.Repeat("k", 256), ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rr.Code)
+	}
+}
+
+func TestMemoryStoreExpiresRecords(t *testing.T) {
+	s := idempotency.NewMemoryStore()
+	ctx := context.Background()
+	if _, ok, _ := s.Reserve(ctx, "k", idempotency.Record{Fingerprint: "a"}, 20*time.Millisecond); !ok {
+		t.Fatal("first reservation failed")
+	}
+	if existing, ok, _ := s.Reserve(ctx, "k", idempotency.Record{Fingerprint: "b"}, time.Minute); ok || existing.Fingerprint != "a" {
+		t.Fatal("key should still be reserved")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok, _ := s.Reserve(ctx, "k", idempotency.Record{Fingerprint: "b"}, time.Minute); !ok {
+		t.Fatal("expired key should be reservable again")
+	}
+}
@@ -0,0 +1,346 @@
+package jwtauth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/jwtauth"
+)
+
+var b64 = base64.RawURLEncoding
+
+// signer issues tokens with a locally generated key and describes that key as a JWK.
+type signer struct {
+	kid  string
+	alg  string
+	priv crypto.Signer
+}
+
+func newSigner(t *testing.T, kid, alg string) *signer {
+	t.Helper()
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatalf("generate %s key: %v", alg, err)
+	}
+	return &signer{kid: kid, alg: alg, priv: priv}
+}
+
+func (s *signer) jwk() map[string]string {
+	switch pub := s.priv.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": s.kid, "use": "sig", "alg": "RS256",
+			"n": b64.EncodeToString(pub.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		return map[string]string{"kty": "EC", "kid": s.kid, "crv": "P-256",
+			"x": b64.EncodeToString(pub.X.FillBytes(x)), "y": b64.EncodeToString(pub.Y.FillBytes(y))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": s.kid, "crv": "Ed25519", "x": b64.EncodeToString(pub)}
+	}
+	return nil
+}
+
+func (s *signer) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	p, _ := json.Marshal(claims)
+	input := b64.EncodeToString(h) + "." + b64.EncodeToString(p)
+	var sig []byte
+	var err error
+	switch priv := s.priv.(type) {
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(input))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, sum[:])
+	case *ecdsa.PrivateKey:
+		sum := sha256.Sum256([]byte(input))
+		var r, ss *big.Int
+		r, ss, err = ecdsa.Sign(rand.Reader, priv, sum[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), ss.FillBytes(make([]byte, 32))...)
+		}
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(priv, []byte(input))
+	}
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return input + "." + b64.EncodeToString(sig)
+}
+
+func jwksDoc(signers ...*signer) []byte {
+	keys := []map[string]string{{"kty": "oct", "kid": "ignored", "k": "c2VjcmV0"}} // unusable keys are skipped
+	for _, s := range signers {
+		keys = append(keys, s.jwk())
+	}
+	b, _ := json.Marshal(map[string]any{"keys": keys})
+	return b
+}
+
+func writeJWKS(t *testing.T, signers ...*signer) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksDoc(signers...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss": "https://idp.example", "aud": []string{"other", "maxwell-api"}, "sub": "client-42",
+		"iat": now.Unix(), "nbf": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+		"scope": "users:read users:write", "tenant": "acme",
+	}
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	ctx := context.Background()
+	signers := []*signer{newSigner(t, "rsa", "RS256"), newSigner(t, "ec", "ES256"), newSigner(t, "ed", "EdDSA")}
+	keys, err := jwtauth.NewJWKS(ctx, writeJWKS(t, signers...), jwtauth.JWKSOptions{})
+	if err != nil {
+		t.Fatalf("load JWKS: %v", err)
+	}
+	v := jwtauth.NewVerifier(keys, jwtauth.VerifierOptions{Issuer: "https://idp.example", Audience: []string{"maxwell-api"}})
+	for _, s := range signers {
+		c, err := v.Verify(ctx, s.sign(t, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: %v", s.alg, err)
+		}
+		if c.Subject != "client-42" || c.Tenant != "acme" || !c.HasScope("users:write") || len(c.Scopes) != 2 {
+			t.Fatalf("%s: unexpected claims %+v", s.alg, c)
+		}
+	}
+
+	// a key outside the set, even with a known kid, is rejected
+	stranger := newSigner(t, "ec", "ES256")
+	if _, err := v.Verify(ctx, stranger.sign(t, validClaims())); !errors.Is(err, jwtauth.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for a foreign key, got %v", err)
+	}
+}
+
+func TestVerifyRejectsInvalidClaims(t *testing.T) {
+	ctx := context.Background()
+	s := newSigner(t, "k1", "ES256")
+	keys, err := jwtauth.NewJWKS(ctx, writeJWKS(t, s), jwtauth.JWKSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := jwtauth.NewVerifier(keys, jwtauth.VerifierOptions{Issuer: "https://idp.example", Audience: []string{"maxwell-api"}, Leeway: 30 * time.Second})
+	now := time.Now()
+	cases := map[string]func(c map[string]any){
+		"expired":        func(c map[string]any) { c["exp"] = now.Add(-time.Minute).Unix() },
+		"no exp":         func(c map[string]any) { delete(c, "exp") },
+		"not yet valid":  func(c map[string]any) { c["nbf"] = now.Add(time.Minute).Unix() },
+		"wrong issuer":   func(c map[string]any) { c["iss"] = "https://evil.example" },
+		"wrong audience": func(c map[string]any) { c["aud"] = "other" },
+		"no subject":     func(c map[string]any) { delete(c, "sub") },
+	}
+	for name, mutate := range cases {
+		c := validClaims()
+		mutate(c)
+		if _, err := v.Verify(ctx, s.sign(t, c)); !errors.Is(err, jwtauth.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	// within the leeway, skewed clocks are tolerated
+	c := validClaims()
+	c["exp"], c["nbf"] = now.Add(-10*time.Second).Unix(), now.Add(10*time.Second).Unix()
+	if _, err := v.Verify(ctx, s.sign(t, c)); err != nil {
+		t.Fatalf("expected skew within leeway to pass: %v", err)
+	}
+
+	// "none" and HMAC tokens are refused outright
+	for _, alg := range []string{"none", "HS256"} {
+		h, _ := json.Marshal(map[string]string{"alg": alg, "kid": "k1"})
+		p, _ := json.Marshal(validClaims())
+		token := b64.EncodeToString(h) + "." + b64.EncodeToString(p) + "."
+		if _, err := v.Verify(ctx, token); !errors.Is(err, jwtauth.ErrInvalidToken) {
+			t.Fatalf("alg %s: expected ErrInvalidToken, got %v", alg, err)
+		}
+	}
+	if _, err := v.Verify(ctx, "not.a-token"); !errors.Is(err, jwtauth.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for garbage, got %v", err)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	ctx := context.Background()
+	old, next := newSigner(t, "2024-01", "RS256"), newSigner(t, "2024-02", "EdDSA")
+	var mu sync.Mutex
+	doc, fetches, down := jwksDoc(old), 0, false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		if down {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Write(doc)
+	}))
+	defer srv.Close()
+
+	keys, err := jwtauth.NewJWKS(ctx, srv.URL, jwtauth.JWKSOptions{MinRefreshInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := jwtauth.NewVerifier(keys, jwtauth.VerifierOptions{})
+	if _, err := v.Verify(ctx, old.sign(t, validClaims())); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+	if _, err := v.Verify(ctx, next.sign(t, validClaims())); err == nil {
+		t.Fatal("expected the unpublished key to be rejected")
+	}
+
+	// the provider publishes the new key; a token naming it triggers a reload
+	mu.Lock()
+	doc = jwksDoc(next)
+	mu.Unlock()
+	if _, err := v.Verify(ctx, next.sign(t, validClaims())); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	if _, err := v.Verify(ctx, old.sign(t, validClaims())); err == nil {
+		t.Fatal("expected the retired key to be rejected after rotation")
+	}
+
+	// when a reload fails, the keys already loaded stay in use
+	mu.Lock()
+	down, before := true, fetches
+	mu.Unlock()
+	if _, err := v.Verify(ctx, old.sign(t, validClaims())); err == nil {
+		t.Fatal("expected the retired key to be rejected during an outage")
+	}
+	if _, err := v.Verify(ctx, next.sign(t, validClaims())); err != nil {
+		t.Fatalf("loaded key during outage: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != before+1 {
+		t.Fatalf("expected one failed reload, got %d", fetches-before)
+	}
+}
+
+func TestJWKSSkipsUnusableKeys(t *testing.T) {
+	ctx := context.Background()
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := newSigner(t, "good", "ES256")
+	weakJWK := (&signer{kid: "weak", alg: "RS256", priv: weak}).jwk()
+	offCurve := good.jwk()
+	offCurve["kid"], offCurve["y"] = "off-curve", b64.EncodeToString(make([]byte, 32))
+	write := func(keys ...map[string]string) string {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		b, _ := json.Marshal(map[string]any{"keys": keys})
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	keys, err := jwtauth.NewJWKS(ctx, write(weakJWK, offCurve, good.jwk()), jwtauth.JWKSOptions{})
+	if err != nil {
+		t.Fatalf("a set with one usable key: %v", err)
+	}
+	v := jwtauth.NewVerifier(keys, jwtauth.VerifierOptions{})
+	if _, err := v.Verify(ctx, good.sign(t, validClaims())); err != nil {
+		t.Fatalf("good key beside unusable ones: %v", err)
+	}
+	if _, err := jwtauth.NewJWKS(ctx, write(weakJWK, offCurve), jwtauth.JWKSOptions{}); err == nil {
+		t.Fatal("expected a set of only unusable keys to be an error")
+	}
+}
+
+func TestJWKSReloadDoesNotBlockLoadedKeys(t *testing.T) {
+	old, next := newSigner(t, "2024-01", "EdDSA"), newSigner(t, "2024-02", "EdDSA")
+	var mu sync.Mutex
+	doc, fetches, slow := jwksDoc(old), 0, make(chan struct{})
+	release := sync.OnceFunc(func() { close(slow) })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body := doc
+		fetches++
+		mu.Unlock()
+		if bytes.Equal(body, jwksDoc(old)) {
+			w.Write(body)
+			return
+		}
+		<-slow // the rotated set is slow to arrive
+		w.Write(body)
+	}))
+	defer srv.Close()
+	defer release()
+	keys, err := jwtauth.NewJWKS(context.Background(), srv.URL, jwtauth.JWKSOptions{MinRefreshInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := jwtauth.NewVerifier(keys, jwtauth.VerifierOptions{})
+
+	mu.Lock()
+	doc = jwksDoc(old, next)
+	mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(ctx, next.sign(t, validClaims()))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let the reload start
+
+	verified := make(chan error, 1)
+	go func() {
+		_, err := v.Verify(context.Background(), old.sign(t, validClaims()))
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Fatalf("loaded key during a reload: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("a token with a loaded kid waited for the reload")
+	}
+
+	cancel() // the client that triggered the reload goes away; the reload must still land
+	release()
+	<-done
+	if _, err := v.Verify(context.Background(), next.sign(t, validClaims())); err != nil {
+		t.Fatalf("rotated key after a cancelled trigger: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != 2 {
+		t.Fatalf("expected the initial load and one reload, got %d fetches", fetches)
+	}
+}
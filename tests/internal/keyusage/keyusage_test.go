@@ -0,0 +1,114 @@
+package keyusage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
+	"github.com/hex-zero/MaxwellGoSpine/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// flakyStore fails Add while down, and counts the batches it accepted.
+type flakyStore struct {
+	*keyusage.MemoryStore
+	down    bool
+	batches int
+}
+
+func (s *flakyStore) Add(ctx context.Context, batch []keyusage.Usage) error {
+	if s.down {
+		return errors.New("store down")
+	}
+	s.batches++
+	return s.MemoryStore.Add(ctx, batch)
+}
+
+func TestTrackerBatchesAndRetriesFlushes(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStore{MemoryStore: keyusage.NewMemoryStore()}
+	tr := keyusage.NewTracker(store, zap.NewNop(), keyusage.Options{MaxRoutes: 2})
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tr.Record(keyusage.Event{KeyID: "apikey:a", TenantID: "acme", Route: "GET /v1/users", Status: 200, IP: "10.0.0.1", UserAgent: "old", At: t0})
+	tr.Record(keyusage.Event{KeyID: "apikey:a", TenantID: "acme", Route: "GET /v1/users/{id}", Status: 404, IP: "10.0.0.2", UserAgent: "new", At: t0.Add(time.Second)})
+	tr.Record(keyusage.Event{KeyID: "apikey:a", TenantID: "acme", Route: "DELETE /v1/users/{id}", Status: 204, At: t0})
+	tr.Record(keyusage.Event{KeyID: "apikey:b", TenantID: "globex", Status: 500, At: t0})
+	tr.Record(keyusage.Event{TenantID: "acme", Status: 200, At: t0}) // not key-authenticated
+
+	store.down = true
+	if err := tr.Flush(ctx); err == nil {
+		t.Fatal("expected flush error")
+	}
+	store.down = false
+	tr.Record(keyusage.Event{KeyID: "apikey:a", TenantID: "acme", Route: "GET /v1/users", Status: 200, At: t0})
+	if err := tr.Flush(ctx); err != nil || store.batches != 1 {
+		t.Fatalf("flush: %v, %d batches", err, store.batches)
+	}
+
+	usage, err := store.List(ctx, "acme")
+	if err != nil || len(usage) != 1 {
+		t.Fatalf("list: %+v %v", usage, err)
+	}
+	u := usage[0]
+	if u.Requests != 4 || u.Errors != 1 || u.LastIP != "10.0.0.2" || u.LastUserAgent != "new" || !u.LastUsedAt.Equal(t0.Add(time.Second)) {
+		t.Fatalf("unexpected totals %+v", u)
+	}
+	if u.Routes["GET /v1/users"] != 2 || u.Routes["GET /v1/users/{id}"] != 1 || u.Routes[keyusage.UnmatchedRoute] != 1 {
+		t.Fatalf("expected routes beyond MaxRoutes to count as unmatched, got %v", u.Routes)
+	}
+
+	tr.Record(keyusage.Event{KeyID: "apikey:a", TenantID: "acme", Status: 200, At: t0})
+	usage, _ = tr.Usage(ctx, "acme")
+	if len(usage) != 1 || usage[0].Requests != 5 {
+		t.Fatalf("expected the unflushed request in the report, got %+v", usage)
+	}
+}
+
+func TestMetricKeyLabelsAreBounded(t *testing.T) {
+	reg := metrics.NewRegistry()
+	tr := keyusage.NewTracker(keyusage.NewMemoryStore(), zap.NewNop(), keyusage.Options{MaxMetricKeys: 2, Metrics: reg})
+	for _, key := range []string{"apikey:a", "apikey:b", "apikey:c", "apikey:d", "apikey:a"} {
+		tr.Record(keyusage.Event{KeyID: key, Status: 200, At: time.Now()})
+	}
+	if n := testutil.CollectAndCount(reg.APIKeyRequests); n != 3 {
+		t.Fatalf("expected 3 series (2 keys and other), got %d", n)
+	}
+	if v := testutil.ToFloat64(reg.APIKeyRequests.WithLabelValues(keyusage.OtherKeyLabel, "2xx")); v != 2 {
+		t.Fatalf("expected 2 requests under other, got %v", v)
+	}
+	if v := testutil.ToFloat64(reg.APIKeyRequests.WithLabelValues("apikey:a", "2xx")); v != 2 {
+		t.Fatalf("expected 2 requests for apikey:a, got %v", v)
+	}
+}
+
+func TestReportFlagsDeprecatedAndExpiringKeys(t *testing.T) {
+	now := time.Now()
+	soon, later := now.Add(24*time.Hour), now.Add(90*24*time.Hour)
+	keys := []keyusage.KeyInfo{
+		{ID: "apikey:busy", Source: "managed", ExpiresAt: &later},
+		{ID: "apikey:old", Source: "env", Deprecated: true},
+		{ID: "apikey:soon", Source: "managed", ExpiresAt: &soon},
+		{ID: "apikey:idle", Source: "env"},
+	}
+	usage := []keyusage.Usage{{KeyID: "apikey:busy", Requests: 100}, {KeyID: "apikey:old", Requests: 3}, {KeyID: "apikey:gone", Requests: 7}}
+	report := keyusage.BuildReport(usage, keys, now, 7*24*time.Hour)
+	var order []string
+	for _, e := range report {
+		order = append(order, e.KeyID)
+	}
+	want := []string{"apikey:old", "apikey:soon", "apikey:busy", "apikey:gone", "apikey:idle"}
+	if len(order) != len(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+	if !report[1].ExpiringSoon || report[2].ExpiringSoon || report[3].Key != nil {
+		t.Fatalf("unexpected flags %+v", report)
+	}
+}
@@ -0,0 +1,144 @@
+package mailer_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/mailer"
+	"go.uber.org/zap"
+)
+
+// received is one mail accepted by fakeSMTP.
+type received struct {
+	auth, from, to, data string
+}
+
+// fakeSMTP is a minimal SMTP server on a loopback port; every accepted mail is sent on the returned channel.
+func fakeSMTP(t *testing.T) (string, <-chan received) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan received, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, out)
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func serveSMTP(conn net.Conn, out chan<- received) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	var m received
+	_ = tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-fake\r\n250-8BITMIME\r\n250 AUTH PLAIN")
+		case "AUTH":
+			m.auth = strings.TrimPrefix(arg, "PLAIN ")
+			_ = tp.PrintfLine("235 ok")
+		case "MAIL":
+			m.from = arg
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			m.to = arg
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			b, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(b)
+			out <- m
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 unknown")
+		}
+	}
+}
+
+func TestSMTPMailerSendsToServer(t *testing.T) {
+	addr, inbox := fakeSMTP(t)
+	m, err := mailer.NewSMTPMailer(mailer.SMTPOptions{Addr: addr, From: "no-reply@example.com", Username: "app", Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("new mailer: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = m.Send(ctx, mailer.Message{To: "ann@example.com", Subject: "Grüße", Text: "line one\n.line two\n"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	got := <-inbox
+	if !strings.HasPrefix(got.from, "FROM:<no-reply@example.com>") || !strings.HasPrefix(got.to, "TO:<ann@example.com>") {
+		t.Fatalf("envelope: %+v", got)
+	}
+	if creds, _ := base64.StdEncoding.DecodeString(got.auth); string(creds) != "\x00app\x00s3cret" {
+		t.Fatalf("auth: %q", creds)
+	}
+	for _, want := range []string{"To: ann@example.com\n", "Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=\n", "\nline one\n.line two\n"} {
+		if !strings.Contains(got.data, want) {
+			t.Fatalf("message lacks %q:\n%s", want, got.data)
+		}
+	}
+
+	if err := m.Send(ctx, mailer.Message{To: "ann@example.com\r\nBcc: eve@example.com", Subject: "x"}); err == nil {
+		t.Fatal("expected header injection to be refused")
+	}
+}
+
+func TestUserMailerWritesVerificationLinkToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.ndjson")
+	fm, err := mailer.NewFileMailer(path)
+	if err != nil {
+		t.Fatalf("file mailer: %v", err)
+	}
+	defer fm.Close()
+	v := mailer.NewUserMailer(fm, zap.NewNop(), mailer.UserMailOptions{VerifyURL: "https://app.example.com/verify?lang=en"})
+	u := &core.User{ID: uuid.New(), Name: "Ann", Email: "ann@example.com"}
+	v.SendVerification(context.Background(), u, "tok.en+/", time.Now().Add(time.Hour))
+	v.Wait()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	var msg struct{ To, Subject, Text string }
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() || json.Unmarshal(sc.Bytes(), &msg) != nil {
+		t.Fatalf("expected one JSON line in %s", path)
+	}
+	if msg.To != u.Email || !strings.Contains(msg.Text, "https://app.example.com/verify?lang=en&token=tok.en%2B%2F") {
+		t.Fatalf("unexpected mail: %+v", msg)
+	}
+}
@@ -1,11 +1,13 @@
 package middleware_test
 
 import (
+    "context"
     "net/http"
     "net/http/httptest"
     "testing"
     "time"
 
+    "github.com/hex-zero/MaxwellGoSpine/internal/core"
     appmw "github.com/hex-zero/MaxwellGoSpine/internal/middleware"
 )
 
@@ -84,3 +86,35 @@ func TestAPIKeyAuthExpiry(t *testing.T) {
     h.ServeHTTP(rr, req)
     if rr.Code != http.StatusUnauthorized { t.Fatalf("expected 401 for expired key, got %d", rr.Code) }
 }
+
+func TestAPIKeyAuthScopesRequestsToTenant(t *testing.T) {
+    opts := appmw.APIKeyOptions{Current: []string{"acme-key", "plain-key"}, Old: []string{"old-acme"}, Tenants: map[string]string{"acme-key": "acme", "old-acme": "acme"}}
+    var tenant string
+    h := appmw.APIKeyAuthWithOpts(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { tenant = core.TenantFrom(r.Context()) }))
+    for key, want := range map[string]string{"acme-key": "acme", "old-acme": "acme", "plain-key": core.DefaultTenant} {
+        req, _ := http.NewRequest(http.MethodGet, "/", nil)
+        req.Header.Set("X-API-Key", key)
+        h.ServeHTTP(httptest.NewRecorder(), req)
+        if tenant != want { t.Fatalf("key %s: expected tenant %q, got %q", key, want, tenant) }
+    }
+}
+
+func TestAPIKeyAuthUnlistedKeysGetNoScopesOnceScopesAreSet(t *testing.T) {
+    var scopes []core.Scope
+    var restricted bool
+    handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { scopes, restricted = core.ScopesFrom(r.Context()) })
+    serve := func(opts appmw.APIKeyOptions, key string) {
+        req, _ := http.NewRequest(http.MethodGet, "/", nil)
+        req.Header.Set("X-API-Key", key)
+        appmw.APIKeyAuthWithOpts(opts)(handler).ServeHTTP(httptest.NewRecorder(), req)
+    }
+    serve(appmw.APIKeyOptions{Current: []string{"plain-key"}}, "plain-key")
+    if restricted { t.Fatalf("without API_KEY_SCOPES keys should be unrestricted, got %v", scopes) }
+
+    opts := appmw.APIKeyOptions{Current: []string{"report-key", "plain-key"}, Scopes: map[string][]core.Scope{"report-key": {core.ScopeUsersRead}}}
+    serve(opts, "report-key")
+    if !restricted || len(scopes) != 1 || scopes[0] != core.ScopeUsersRead { t.Fatalf("listed key: expected users:read, got %v", scopes) }
+    serve(opts, "plain-key")
+    if !restricted || len(scopes) != 0 { t.Fatalf("unlisted key: expected no scopes, got restricted=%v %v", restricted, scopes) }
+    if err := core.RequireScope(core.WithScopes(context.Background(), scopes), core.ScopeAdmin); err == nil { t.Fatal("unlisted key must not hold admin") }
+}
@@ -0,0 +1,61 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/jwtauth"
+	appmw "github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+type stubVerifier map[string]*jwtauth.Claims
+
+func (s stubVerifier) Verify(_ context.Context, token string) (*jwtauth.Claims, error) {
+	if c, ok := s[token]; ok {
+		return c, nil
+	}
+	return nil, jwtauth.ErrInvalidToken
+}
+
+func TestBearerAuth(t *testing.T) {
+	v := stubVerifier{
+		"scoped":     {Subject: "svc-a", Tenant: "acme", Scopes: []string{"users:read"}},
+		"untenanted": {Subject: "svc-b"},
+		"bad-tenant": {Subject: "svc-c", Tenant: "Not A Tenant"},
+	}
+	var got *appmw.Principal
+	var tenant, actor string
+	handler := appmw.BearerAuth(v)(appmw.AuditContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, tenant = appmw.PrincipalFrom(r.Context()), core.TenantFrom(r.Context())
+		actor = core.AuditContextFrom(r.Context()).Actor
+	})))
+	serve := func(authz string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authz != "" {
+			req.Header.Set("Authorization", authz)
+		}
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve("bearer scoped"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if got == nil || got.Subject != "svc-a" || !got.HasScope("users:read") || tenant != "acme" || actor != "jwt:svc-a" {
+		t.Fatalf("unexpected principal %+v tenant %q actor %q", got, tenant, actor)
+	}
+	if rr := serve("Bearer untenanted"); rr.Code != http.StatusOK || tenant != core.DefaultTenant {
+		t.Fatalf("expected default tenant, got %d %q", rr.Code, tenant)
+	}
+	for _, authz := range []string{"", "Bearer forged", "Bearer bad-tenant", "ApiKey scoped"} {
+		rr := serve(authz)
+		if rr.Code != http.StatusUnauthorized || !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Fatalf("%q: expected 401 with a Bearer challenge, got %d %q", authz, rr.Code, rr.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
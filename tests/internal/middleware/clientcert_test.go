@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	appmw "github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+func TestClientCertAuth(t *testing.T) {
+	keys := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{})
+	minted, _, err := keys.Mint(core.WithTenant(context.Background(), "globex"), apikey.MintRequest{Name: "billing", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	opts := appmw.APIKeyOptions{
+		Current: []string{"s3cret"},
+		Tenants: map[string]string{"s3cret": "acme"},
+		Scopes:  map[string][]core.Scope{"s3cret": {core.ScopeUsersWrite}},
+		Lookup:  keys,
+	}
+	identities := map[string]string{
+		"URI:spiffe://example.org/billing": "mxk_" + minted.Prefix,
+		"CN:reports":                       appmw.KeyID("s3cret"),
+		"DNS:stale.internal":               appmw.KeyID("gone"),
+	}
+	var got struct {
+		key, tenant string
+		scopes      []core.Scope
+	}
+	h := appmw.ClientCertAuth(opts, identities)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.key, got.tenant = appmw.GetAPIKeyID(r.Context()), core.TenantFrom(r.Context())
+		got.scopes, _ = core.ScopesFrom(r.Context())
+	}))
+	// The TLS handshake is exercised in tests/internal/servertls; here the verified chain is set directly.
+	serve := func(cert *x509.Certificate) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+
+	if w := serve(&x509.Certificate{Subject: pkix.Name{CommonName: "reports"}}); w.Code != http.StatusOK || got.key != appmw.KeyID("s3cret") || got.tenant != "acme" || !slices.Equal(got.scopes, []core.Scope{core.ScopeUsersWrite}) {
+		t.Fatalf("static key: %d %s %+v", w.Code, w.Body.String(), got)
+	}
+	// The URI SAN is more specific than the common name, which maps elsewhere
+	if w := serve(&x509.Certificate{Subject: pkix.Name{CommonName: "reports"}, URIs: []*url.URL{spiffe}}); w.Code != http.StatusOK || got.key != minted.UsageID() || got.tenant != "globex" || !slices.Equal(got.scopes, []core.Scope{core.ScopeUsersRead}) {
+		t.Fatalf("minted key: %d %s %+v", w.Code, w.Body.String(), got)
+	}
+	if w := serve(nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected request without certificate to be rejected, got %d", w.Code)
+	}
+	if w := serve(&x509.Certificate{Subject: pkix.Name{CommonName: "someone"}}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unmapped certificate to be rejected, got %d", w.Code)
+	}
+	if w := serve(&x509.Certificate{DNSNames: []string{"stale.internal"}}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected certificate mapped to an unknown key to be rejected, got %d", w.Code)
+	}
+	if _, err := keys.Revoke(core.WithTenant(context.Background(), "globex"), minted.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if w := serve(&x509.Certificate{URIs: []*url.URL{spiffe}}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected certificate of a revoked key to be rejected, got %d", w.Code)
+	}
+}
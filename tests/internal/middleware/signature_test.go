@@ -0,0 +1,136 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	appmw "github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+	"github.com/hex-zero/MaxwellGoSpine/internal/reqsign"
+)
+
+var testKEK = bytes.Repeat([]byte{7}, 32)
+
+func TestSignatureAuth(t *testing.T) {
+	keys := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{SigningKEK: testKEK})
+	minted, secret, err := keys.Mint(core.WithTenant(context.Background(), "globex"), apikey.MintRequest{Name: "ci", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	opts := appmw.APIKeyOptions{Current: []string{"s3cret"}, Old: []string{"legacy"}, Tenants: map[string]string{"s3cret": "acme"}, Lookup: keys}
+	var got struct{ key, tenant, body string }
+	h := appmw.SignatureAuth(opts, appmw.SignatureOptions{Skew: time.Minute, Nonces: reqsign.NewMemoryNonceStore()})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			got.key, got.tenant, got.body = appmw.GetAPIKeyID(r.Context()), core.TenantFrom(r.Context()), string(b)
+		}))
+	newReq := func(credential, key, body string, at time.Time) *http.Request {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/v1/users?b=2&a=1", strings.NewReader(body))
+		if err := reqsign.Sign(req, credential, reqsign.SigningKey(key), at); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	req := newReq(appmw.KeyID("s3cret"), "s3cret", `{"name":"Ann"}`, time.Now())
+	replay := req.Clone(context.Background())
+	replay.Body = io.NopCloser(strings.NewReader(`{"name":"Ann"}`))
+	if w := serve(req); w.Code != http.StatusOK || got.key != appmw.KeyID("s3cret") || got.tenant != "acme" || got.body != `{"name":"Ann"}` {
+		t.Fatalf("signed request: %d %s %+v", w.Code, w.Body.String(), got)
+	}
+	if w := serve(replay); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "already used") {
+		t.Fatalf("expected replay to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+
+	tampered := newReq(appmw.KeyID("s3cret"), "s3cret", `{"name":"Ann"}`, time.Now())
+	tampered.Body = io.NopCloser(strings.NewReader(`{"name":"Eve"}`))
+	if w := serve(tampered); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected tampered body to be rejected, got %d", w.Code)
+	}
+	moved := newReq(appmw.KeyID("s3cret"), "s3cret", "", time.Now())
+	moved.URL.Path = "/v1/users/purge"
+	if w := serve(moved); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "mismatch") {
+		t.Fatalf("expected changed path to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(newReq(appmw.KeyID("s3cret"), "s3cret", "", time.Now().Add(-2*time.Minute))); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "skew") {
+		t.Fatalf("expected stale request to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(newReq(appmw.KeyID("s3cret"), "wrong", "", time.Now())); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected wrong key to be rejected, got %d", w.Code)
+	}
+	if w := serve(newReq(appmw.KeyID("unknown"), "unknown", "", time.Now())); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected unknown credential to be rejected, got %d", w.Code)
+	}
+
+	if w := serve(newReq(appmw.KeyID("legacy"), "legacy", "", time.Now())); w.Code != http.StatusOK || w.Header().Get("Warning") == "" {
+		t.Fatalf("expected deprecated key to pass with a Warning, got %d", w.Code)
+	}
+	if w := serve(newReq("mxk_"+minted.Prefix, secret, "", time.Now())); w.Code != http.StatusOK || got.key != minted.UsageID() || got.tenant != "globex" {
+		t.Fatalf("minted key: %d %s %+v", w.Code, w.Body.String(), got)
+	}
+	if _, err := keys.Revoke(core.WithTenant(context.Background(), "globex"), minted.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if w := serve(newReq("mxk_"+minted.Prefix, secret, "", time.Now())); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked key to be rejected, got %d", w.Code)
+	}
+}
+
+func TestStoredHashCannotSign(t *testing.T) {
+	ctx := core.WithTenant(context.Background(), "globex")
+	keys := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{SigningKEK: testKEK})
+	minted, secret, err := keys.Mint(ctx, apikey.MintRequest{Name: "ci", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	unsealed := apikey.NewService(apikey.NewMemoryStore(), apikey.Options{})
+	old, oldSecret, err := unsealed.Mint(ctx, apikey.MintRequest{Name: "legacy", Scopes: []core.Scope{core.ScopeUsersRead}})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	serve := func(lookup apikey.Service, credential string, signingKey []byte) *httptest.ResponseRecorder {
+		t.Helper()
+		h := appmw.SignatureAuth(appmw.APIKeyOptions{Lookup: lookup}, appmw.SignatureOptions{Skew: time.Minute, Nonces: reqsign.NewMemoryNonceStore()})(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+		if err := reqsign.Sign(req, credential, signingKey, time.Now()); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// What a copy of api_keys holds: the hex SHA-256 of the secret, and the sealed signing key without the KEK.
+	stored, _ := hex.DecodeString(minted.Hash)
+	if sum := sha256.Sum256([]byte(secret)); !bytes.Equal(stored, sum[:]) {
+		t.Fatal("expected the stored hash to be the SHA-256 of the secret")
+	}
+	for name, key := range map[string][]byte{"hash": stored, "hex hash": []byte(minted.Hash), "sealed": minted.SealedSigningKey} {
+		if w := serve(keys, "mxk_"+minted.Prefix, key); w.Code != http.StatusUnauthorized {
+			t.Fatalf("signing with the stored %s: got %d, want 401", name, w.Code)
+		}
+	}
+	if w := serve(keys, "mxk_"+minted.Prefix, reqsign.SigningKey(secret)); w.Code != http.StatusOK {
+		t.Fatalf("signing with the secret: got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := serve(unsealed, "mxk_"+old.Prefix, reqsign.SigningKey(oldSecret)); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "rotate") {
+		t.Fatalf("expected a key minted without a KEK to be unable to sign, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,46 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	appmw "github.com/hex-zero/MaxwellGoSpine/internal/middleware"
+)
+
+func TestTimeoutExemptsRoutesNotHeaders(t *testing.T) {
+	h := appmw.TimeoutWithOpts(time.Minute, appmw.TimeoutOptions{Exempt: []string{"/v1/users/events"}, WebSocket: []string{"/v1/graphql"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, bounded := r.Context().Deadline(); bounded {
+				w.WriteHeader(http.StatusAccepted)
+			}
+		}))
+	bounded := func(method, path string, header map[string]string) bool {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code == http.StatusAccepted
+	}
+	sse := map[string]string{"Accept": "text/event-stream"}
+	ws := map[string]string{"Upgrade": "websocket", "Connection": "Upgrade"}
+
+	if bounded(http.MethodGet, "/v1/users/events", sse) {
+		t.Fatal("expected the event stream route to be exempt")
+	}
+	if !bounded(http.MethodGet, "/v1/users", sse) {
+		t.Fatal("expected Accept: text/event-stream not to exempt other routes")
+	}
+	if bounded(http.MethodGet, "/v1/graphql", ws) {
+		t.Fatal("expected GraphQL WebSocket upgrades to be exempt")
+	}
+	if !bounded(http.MethodPost, "/v1/graphql", nil) {
+		t.Fatal("expected plain GraphQL requests to be bounded")
+	}
+	if !bounded(http.MethodGet, "/v1/users", ws) {
+		t.Fatal("expected WebSocket headers not to exempt other routes")
+	}
+}
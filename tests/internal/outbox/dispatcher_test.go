@@ -0,0 +1,131 @@
+package outbox_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/outbox"
+	"go.uber.org/zap"
+)
+
+func newEventedService() (core.UserService, *core.InMemoryUserRepo) {
+	repo := core.NewInMemoryUserRepo()
+	return core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Events: true}), repo
+}
+
+func TestDispatcherPublishesCloudEventsInOrder(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newEventedService()
+	u, err := svc.Create(ctx, "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	name := "Ann B"
+	if _, err := svc.Update(ctx, u.ID, &name, nil, nil, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := svc.Delete(ctx, u.ID, 0); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	// a rolled back batch must not leave events behind
+	str := func(s string) *string { return &s }
+	if _, err := svc.Batch(ctx, []core.BatchOp{
+		{Kind: core.BatchCreate, Name: str("Bob"), Email: str("bob@example.com")},
+		{Kind: core.BatchCreate, Name: str("Bob"), Email: str("bob@example.com")},
+	}, core.BatchAtomic); err == nil {
+		t.Fatal("expected duplicate batch to fail")
+	}
+
+	pub := outbox.NewMemoryPublisher()
+	d := outbox.NewDispatcher(repo, pub, zap.NewNop(), outbox.DispatcherOptions{Source: "/test"})
+	n, err := d.DispatchOnce(ctx)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 events dispatched, got %d (%v)", n, err)
+	}
+	events := pub.Events()
+	for i, want := range []string{"com.maxwell.user.created", "com.maxwell.user.updated", "com.maxwell.user.deleted"} {
+		ev := events[i]
+		if ev.Type != want || ev.SpecVersion != "1.0" || ev.Source != "/test" || ev.Subject != u.ID.String() || ev.ID == "" {
+			t.Fatalf("event %d: unexpected envelope %+v", i, ev)
+		}
+	}
+	var data struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(events[1].Data, &data); err != nil || data.Name != "Ann B" {
+		t.Fatalf("expected updated name in data, got %s", events[1].Data)
+	}
+	if n, _ := d.DispatchOnce(ctx); n != 0 {
+		t.Fatalf("delivered events must not be dispatched again, got %d", n)
+	}
+}
+
+type flakyPublisher struct {
+	failFirst bool
+	got       []string
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, ev outbox.CloudEvent) error {
+	if p.failFirst {
+		p.failFirst = false
+		return errors.New("broker down")
+	}
+	p.got = append(p.got, ev.ID)
+	return nil
+}
+
+func TestDispatcherRetriesFailedDelivery(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newEventedService()
+	if _, err := svc.Create(ctx, "Ann", "ann@example.com", nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	pub := &flakyPublisher{failFirst: true}
+	d := outbox.NewDispatcher(repo, pub, zap.NewNop(), outbox.DispatcherOptions{})
+	if n, err := d.DispatchOnce(ctx); err == nil || n != 0 {
+		t.Fatalf("expected failed delivery, got %d (%v)", n, err)
+	}
+	if n, err := d.DispatchOnce(ctx); err != nil || n != 1 || len(pub.got) != 1 {
+		t.Fatalf("expected redelivery, got %d (%v)", n, err)
+	}
+}
+
+func TestFilePublisherWritesNDJSON(t *testing.T) {
+	ctx := context.Background()
+	svc, repo := newEventedService()
+	for _, e := range []string{"a@example.com", "b@example.com"} {
+		if _, err := svc.Create(ctx, "User", e, nil); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	pub, err := outbox.NewFilePublisher(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := outbox.NewDispatcher(repo, pub, zap.NewNop(), outbox.DispatcherOptions{}).DispatchOnce(ctx); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	_ = pub.Close()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	defer f.Close()
+	lines := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); lines++ {
+		var ev outbox.CloudEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil || ev.Type != "com.maxwell.user.created" {
+			t.Fatalf("line %d: %v %s", lines, err, sc.Text())
+		}
+	}
+	if lines != 2 {
+		t.Fatalf("expected 2 lines, got %d", lines)
+	}
+}
@@ -0,0 +1,267 @@
+package servertls_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hex-zero/MaxwellGoSpine/internal/servertls"
+	"go.uber.org/zap"
+)
+
+// testCA issues certificates for the tests, all generated on the fly.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a PEM certificate and key for tmpl, signed by the CA.
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca *testCA) serverCert(t *testing.T, cn string) (certPEM, keyPEM []byte) {
+	return ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+func write(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve runs an HTTPS server on the reloader's config that echoes the verified client certificate's names.
+func serve(t *testing.T, r *servertls.Reloader) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.VerifiedChains) > 0 {
+			for _, n := range servertls.Names(req.TLS.VerifiedChains[0][0]) {
+				io.WriteString(w, n+"\n")
+			}
+		}
+	})}
+	go srv.Serve(tls.NewListener(ln, r.TLSConfig()))
+	t.Cleanup(func() { _ = srv.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+func client(ca *testCA, certs ...tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool, Certificates: certs},
+		DisableKeepAlives: true, // every request handshakes again, and so sees reloads
+	}}
+}
+
+func servedCN(t *testing.T, c *http.Client, addr string) string {
+	t.Helper()
+	resp, err := c.Get(addr)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestReloadSwapsCertificate(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	c, k := ca.serverCert(t, "first")
+	write(t, certFile, c)
+	write(t, keyFile, k)
+
+	r, err := servertls.New(servertls.Options{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	addr, hc := serve(t, r), client(ca)
+	if cn := servedCN(t, hc, addr); cn != "first" {
+		t.Fatalf("expected first certificate, got %q", cn)
+	}
+
+	c, k = ca.serverCert(t, "second")
+	write(t, certFile, c)
+	write(t, keyFile, k)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if cn := servedCN(t, hc, addr); cn != "second" {
+		t.Fatalf("expected reloaded certificate, got %q", cn)
+	}
+
+	write(t, keyFile, []byte("half written"))
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected reload of a broken key to fail")
+	}
+	if cn := servedCN(t, hc, addr); cn != "second" {
+		t.Fatalf("expected the loaded certificate to stay after a failed reload, got %q", cn)
+	}
+}
+
+func TestWatchReloadsChangedFiles(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	c, k := ca.serverCert(t, "first")
+	write(t, certFile, c)
+	write(t, keyFile, k)
+	r, err := servertls.New(servertls.Options{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond, zap.NewNop())
+
+	c, k = ca.serverCert(t, "second")
+	write(t, certFile, c)
+	write(t, keyFile, k)
+	later := time.Now().Add(time.Second) // coarse file system clocks may not tell the writes apart otherwise
+	_ = os.Chtimes(certFile, later, later)
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Certificate().Subject.CommonName != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("watch did not pick up the new certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	ca, rogue := newCA(t), newCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	c, k := ca.serverCert(t, "server")
+	write(t, certFile, c)
+	write(t, keyFile, k)
+	write(t, caFile, ca.pem())
+
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	billing, err := tls.X509KeyPair(ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		URIs:        []*url.URL{spiffe},
+		DNSNames:    []string{"billing.internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	intruder, err := tls.X509KeyPair(rogue.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	optional, err := servertls.New(servertls.Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	addr := serve(t, optional)
+	resp, err := client(ca, billing).Get(addr)
+	if err != nil {
+		t.Fatalf("get with client certificate: %v", err)
+	}
+	if got, want := body(resp), "URI:spiffe://example.org/billing\nDNS:billing.internal\nCN:billing\n"; got != want {
+		t.Fatalf("names: got %q want %q", got, want)
+	}
+	resp, err = client(ca).Get(addr)
+	if err != nil {
+		t.Fatalf("expected optional client auth to accept a client without certificate: %v", err)
+	}
+	if got := body(resp); got != "" {
+		t.Fatalf("expected no verified certificate, got %q", got)
+	}
+	if _, err := client(ca, intruder).Get(addr); err == nil {
+		t.Fatal("expected a certificate from another CA to be rejected")
+	}
+
+	required, err := servertls.New(servertls.Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, RequireClientCert: true})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	addr = serve(t, required)
+	if _, err := client(ca).Get(addr); err == nil {
+		t.Fatal("expected required client auth to reject a client without certificate")
+	}
+	if resp, err := client(ca, billing).Get(addr); err != nil || !strings.HasSuffix(body(resp), "CN:billing\n") {
+		t.Fatalf("expected required client auth to accept the billing certificate: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package postgres_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/apikey"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/storage/postgres"
+)
+
+var apiKeyCols = []string{"id", "tenant_id", "name", "owner", "prefix", "hash", "scopes", "created_at", "expires_at", "revoked_at", "last_used_at", "replaced_by", "signing_key"}
+
+func TestAPIKeyStoreRotateInOneTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := postgres.NewAPIKeyStore(db)
+	now := time.Now().UTC()
+	end := now.Add(time.Hour)
+	next := &apikey.Key{ID: uuid.New(), TenantID: "acme", Name: "ci", Prefix: "0a1b2c3d", Hash: "h2", Scopes: []core.Scope{core.ScopeUsersRead}, CreatedAt: now, SealedSigningKey: []byte("sealed")}
+	old := &apikey.Key{ID: uuid.New(), TenantID: "acme", Name: "ci", Prefix: "4e5f6a7b", Hash: "h1", CreatedAt: now, ExpiresAt: &end, ReplacedBy: &next.ID}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_keys`)).
+		WithArgs(next.ID, "acme", "ci", "", "0a1b2c3d", "h2", `["users:read"]`, now, nil, nil, nil, nil, []byte("sealed")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET expires_at=$2, revoked_at=$3, replaced_by=$4 WHERE id=$1`)).
+		WithArgs(old.ID, &end, nil, &next.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := store.Rotate(context.Background(), old, next); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_keys WHERE prefix=$1`)).WithArgs("0a1b2c3d").
+		WillReturnRows(sqlmock.NewRows(apiKeyCols).
+			AddRow(next.ID, "acme", "ci", "", "0a1b2c3d", "h2", []byte(`["users:read"]`), now, nil, nil, nil, nil, []byte("sealed")))
+	got, err := store.GetByPrefix(context.Background(), "0a1b2c3d")
+	if err != nil || got.ID != next.ID || len(got.Scopes) != 1 || got.ExpiresAt != nil || got.ReplacedBy != nil || string(got.SealedSigningKey) != "sealed" {
+		t.Fatalf("get by prefix: %+v %v", got, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package postgres_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hex-zero/MaxwellGoSpine/internal/keyusage"
+	"github.com/hex-zero/MaxwellGoSpine/internal/storage/postgres"
+)
+
+func TestKeyUsageStoreAddsBatchInOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := postgres.NewKeyUsageStore(db)
+	at := time.Now().UTC()
+	batch := []keyusage.Usage{
+		{KeyID: "apikey:b", TenantID: "acme", Requests: 1, LastUsedAt: at, Routes: map[string]int64{"GET /v1/users": 1}},
+		{KeyID: "apikey:a", TenantID: "acme", Requests: 3, Errors: 1, LastUsedAt: at, LastIP: "10.0.0.1",
+			Routes: map[string]int64{"POST /v1/users": 1, "GET /v1/users": 2}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_key_usage`)).
+		WithArgs("acme", "apikey:a", int64(3), int64(1), at, "10.0.0.1", "").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_key_route_usage`)).
+		WithArgs("acme", "apikey:a", "GET /v1/users", int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_key_route_usage`)).
+		WithArgs("acme", "apikey:a", "POST /v1/users", int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_key_usage`)).
+		WithArgs("acme", "apikey:b", int64(1), int64(0), at, "", "").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO api_key_route_usage`)).
+		WithArgs("acme", "apikey:b", "GET /v1/users", int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := store.Add(context.Background(), batch); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_key_usage WHERE tenant_id=$1`)).WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "requests", "errors", "last_used_at", "last_ip", "last_user_agent"}).
+			AddRow("apikey:a", int64(3), int64(1), at, "10.0.0.1", ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_key_route_usage WHERE tenant_id=$1`)).WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"key_id", "route", "requests"}).AddRow("apikey:a", "GET /v1/users", int64(2)))
+	usage, err := store.List(context.Background(), "acme")
+	if err != nil || len(usage) != 1 || usage[0].Requests != 3 || usage[0].Routes["GET /v1/users"] != 2 {
+		t.Fatalf("list: %+v %v", usage, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
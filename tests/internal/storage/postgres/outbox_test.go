@@ -0,0 +1,96 @@
+package postgres_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/storage/postgres"
+)
+
+func TestCreateWritesEventInSameTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	svc := core.NewUserServiceWithOpts(postgres.NewUserRepo(db), core.UserServiceOptions{Events: true})
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config`)).WithArgs("acme").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_events`)).
+		WithArgs(sqlmock.AnyArg(), "user.created", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "acme").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if _, err := svc.Create(core.WithTenant(context.Background(), "acme"), "Ann", "ann@example.com", nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUpdateWritesAuditEntryInSameTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	svc := core.NewUserServiceWithOpts(postgres.NewUserRepo(db), core.UserServiceOptions{Audit: true})
+	id := uuid.New()
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config`)).WithArgs(core.DefaultTenant).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT`)).WithArgs(id, core.DefaultTenant).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version", "attributes", "status", "status_changed_at", "status_reason", "tenant_id", "email_verified_at"}).
+			AddRow(id, "Ann", "ann@example.com", now, now, nil, int64(1), []byte(`{}`), "active", now, "", core.DefaultTenant, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(sqlmock.AnyArg(), id, "updated", "apikey:test", "req-1",
+			`[{"field":"name","before":"Ann","after":"Anna"}]`, sqlmock.AnyArg(), core.DefaultTenant).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	ctx := core.WithAuditContext(context.Background(), core.AuditContext{Actor: "apikey:test", RequestID: "req-1"})
+	name := "Anna"
+	if _, err := svc.Update(ctx, id, &name, nil, nil, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestOutboxStoreClaimsWithSkipLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	store := postgres.NewOutboxStore(db)
+	id, userID := uuid.New(), uuid.New()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE SKIP LOCKED`)).WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "id", "type", "user_id", "payload", "occurred_at", "tenant_id"}).
+			AddRow(int64(7), id, "user.deleted", userID, []byte("null"), time.Now(), "acme"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_events SET published_at=now() WHERE seq = ANY($1::bigint[])`)).
+		WithArgs("{7}").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	var got []core.UserEvent
+	n, err := store.ProcessEvents(context.Background(), 10, func(_ context.Context, events []core.UserEvent) (int, error) {
+		got = events
+		return len(events), nil
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("process: %d %v", n, err)
+	}
+	if got[0].ID != id || got[0].Type != core.UserDeleted || got[0].UserID != userID || got[0].TenantID != "acme" || got[0].User != nil {
+		t.Fatalf("unexpected event %+v", got[0])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
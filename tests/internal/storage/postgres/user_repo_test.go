@@ -2,10 +2,12 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
 	"github.com/hex-zero/MaxwellGoSpine/internal/storage/postgres"
+	"github.com/jackc/pgx/v5/pgconn"
 	"regexp"
 	"testing"
 	"time"
@@ -19,12 +21,206 @@ func TestUserRepoCreate(t *testing.T) {
 	defer db.Close()
 	repo := postgres.NewUserRepo(db)
 	u := &core.User{ID: uuid.New(), Name: "John", Email: "john@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (id, name, email, created_at, updated_at) VALUES ($1,$2,$3,$4,$5)`)).
-		WithArgs(u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt).
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (id, name, email, created_at, updated_at, attributes, status, status_changed_at, tenant_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`)).
+		WithArgs(u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt, "{}", core.StatusActive, u.CreatedAt, "acme").
 		WillReturnResult(sqlmock.NewResult(0, 1))
-	if err := repo.Create(context.Background(), u); err != nil {
+	if err := repo.Create(core.WithTenant(context.Background(), "acme"), u); err != nil {
 		t.Fatalf("create: %v", err)
 	}
+	if u.TenantID != "acme" {
+		t.Fatalf("expected the tenant to be stamped, got %q", u.TenantID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoListAfter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	last := &core.User{ID: uuid.New(), CreatedAt: time.Now().UTC()}
+	after := core.CursorFor(last, core.DefaultUserSort)
+	rows := sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version", "attributes", "status", "status_changed_at", "status_reason", "tenant_id", "email_verified_at"}).
+		AddRow(uuid.New(), "Ann", "ann@example.com", last.CreatedAt.Add(-time.Minute), last.CreatedAt, nil, 1, []byte(`{"team":"core"}`), "suspended", last.CreatedAt, "billing", "default", last.CreatedAt)
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE tenant_id = $1 AND deleted_at IS NULL AND (created_at, id) < ($2, $3) ORDER BY created_at DESC, id DESC LIMIT $4`)).
+		WithArgs(core.DefaultTenant, last.CreatedAt, last.ID, 11).
+		WillReturnRows(rows)
+	users, err := repo.ListAfter(context.Background(), core.UserFilter{}, core.DefaultUserSort, after, 11)
+	if err != nil {
+		t.Fatalf("list after: %v", err)
+	}
+	if len(users) != 1 || users[0].Name != "Ann" || users[0].Attributes["team"] != "core" || users[0].Status != core.StatusSuspended {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoListFiltered(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	since := time.Now().Add(-time.Hour)
+	f := core.UserFilter{NamePrefix: "50%_off", EmailDomain: "acme.io", UpdatedAfter: &since}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users WHERE tenant_id = $1 AND deleted_at IS NULL AND name ILIKE $2 AND email LIKE $3 AND updated_at >= $4 ORDER BY name ASC, id ASC LIMIT $5 OFFSET $6`)).
+		WithArgs(core.DefaultTenant, `50\%\_off%`, "%@acme.io", since, 10, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version", "attributes", "status", "status_changed_at", "status_reason", "tenant_id", "email_verified_at"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM users WHERE tenant_id = $1 AND deleted_at IS NULL AND name ILIKE $2 AND email LIKE $3 AND updated_at >= $4`)).
+		WithArgs(core.DefaultTenant, `50\%\_off%`, "%@acme.io", since).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(12))
+	_, total, err := repo.List(context.Background(), f, core.UserSort{Field: core.SortByName}, 2, 10)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if total != 12 {
+		t.Fatalf("expected total 12, got %d", total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoListByAttributes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	// keys are bound, never spliced, and ordered so the statement text is stable
+	f := core.UserFilter{Attributes: map[string]string{"locale": "de", "dept'; --": "x"}}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users WHERE tenant_id = $1 AND deleted_at IS NULL AND attributes->>$2 = $3 AND attributes->>$4 = $5 ORDER BY`)).
+		WithArgs(core.DefaultTenant, "dept'; --", "x", "locale", "de", 20, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version", "attributes", "status", "status_changed_at", "status_reason", "tenant_id", "email_verified_at"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM users WHERE tenant_id = $1 AND deleted_at IS NULL AND attributes->>$2 = $3 AND attributes->>$4 = $5`)).
+		WithArgs(core.DefaultTenant, "dept'; --", "x", "locale", "de").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	if _, _, err := repo.List(context.Background(), f, core.DefaultUserSort, 1, 20); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoCreateDuplicateEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	u := &core.User{ID: uuid.New(), Name: "John", Email: "john@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users`)).
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "uq_users_tenant_email_live"})
+	err = repo.Create(context.Background(), u)
+	var conflict *core.ConflictError
+	if !errors.As(err, &conflict) || conflict.Field != "email" || !errors.Is(err, core.ErrConflict) {
+		t.Fatalf("expected email conflict, got %v", err)
+	}
+}
+
+func TestUserRepoListByStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	f := core.UserFilter{Statuses: []core.UserStatus{core.StatusSuspended, core.StatusLocked}}
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users WHERE tenant_id = $1 AND deleted_at IS NULL AND status = ANY($2::text[]) ORDER BY created_at DESC, id DESC LIMIT $3`)).
+		WithArgs(core.DefaultTenant, "{suspended,locked}", 21).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version", "attributes", "status", "status_changed_at", "status_reason", "tenant_id", "email_verified_at"}))
+	if _, err := repo.ListAfter(context.Background(), f, core.DefaultUserSort, nil, 21); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoStreamUsersReadsThroughCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	now := time.Now().UTC()
+	cols := []string{"id", "name", "email", "created_at", "updated_at", "deleted_at", "version", "attributes", "status", "status_changed_at", "status_reason", "tenant_id", "email_verified_at"}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config`)).WithArgs("acme").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SET TRANSACTION READ ONLY`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DECLARE user_export NO SCROLL CURSOR FOR SELECT id, name, email, created_at, updated_at, deleted_at, version, attributes, status, status_changed_at, status_reason, tenant_id, email_verified_at FROM users WHERE tenant_id = $1 AND deleted_at IS NULL AND email LIKE $2 ORDER BY email ASC, id ASC`)).
+		WithArgs("acme", "%@acme.io").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`FETCH FORWARD 500 FROM user_export`)).
+		WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(uuid.New(), "Ann", "ann@acme.io", now, now, nil, 1, []byte(`{}`), "active", now, "", "acme", nil).
+			AddRow(uuid.New(), "Bob", "bob@acme.io", now, now, nil, 3, []byte(`{}`), "locked", now, "", "acme", nil))
+	mock.ExpectRollback()
+
+	var names []string
+	err = repo.StreamUsers(core.WithTenant(context.Background(), "acme"), core.UserFilter{EmailDomain: "acme.io"}, core.UserSort{Field: core.SortByEmail},
+		func(u *core.User) error {
+			names = append(names, u.Name)
+			return nil
+		})
+	if err != nil || len(names) != 2 || names[1] != "Bob" {
+		t.Fatalf("stream = %v, %v", names, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoGetByEmail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM users WHERE tenant_id=$1 AND lower(email)=$2 AND deleted_at IS NULL`)).
+		WithArgs(core.DefaultTenant, "ann@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if _, err := repo.GetByEmail(context.Background(), "ann@example.com"); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoPasswordHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	ctx := core.WithTenant(context.Background(), "acme")
+	id := uuid.New()
+	mock.ExpectQuery(regexp.QuoteMeta(`LEFT JOIN user_credentials c ON c.user_id=u.id`)).
+		WithArgs(id, "acme").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow(""))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_credentials (user_id, tenant_id, password_hash, updated_at)`)).
+		WithArgs(id, "acme", "$argon2id$hash", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	if hash, err := repo.PasswordHash(ctx, id); err != nil || hash != "" {
+		t.Fatalf("password hash = %q, %v", hash, err)
+	}
+	// no live user of the tenant: nothing is inserted
+	if err := repo.SetPasswordHash(ctx, id, "$argon2id$hash"); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expect: %v", err)
 	}
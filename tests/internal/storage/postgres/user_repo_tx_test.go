@@ -2,6 +2,7 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
 	"github.com/hex-zero/MaxwellGoSpine/internal/core"
@@ -18,16 +19,18 @@ func TestUserRepoTxCreate(t *testing.T) {
 	}
 	defer db.Close()
 	repo := postgres.NewUserRepo(db)
-	ctx := context.Background()
+	ctx := core.WithTenant(context.Background(), "acme")
 	mock.ExpectBegin()
+	// row-level security confines the transaction to the tenant
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config('app.tenant_id', $1, true)`)).WithArgs("acme").WillReturnResult(sqlmock.NewResult(0, 0))
 	uow, err := repo.BeginTx(ctx)
 	if err != nil {
 		t.Fatalf("begin: %v", err)
 	}
 	txRepo := uow.UserRepo()
 	u := &core.User{ID: uuid.New(), Name: "Tx", Email: "tx@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (id, name, email, created_at, updated_at) VALUES ($1,$2,$3,$4,$5)`)).
-		WithArgs(u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (id, name, email, created_at, updated_at, attributes, status, status_changed_at, tenant_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`)).
+		WithArgs(u.ID, u.Name, u.Email, u.CreatedAt, u.UpdatedAt, "{}", core.StatusActive, u.CreatedAt, "acme").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 	if err := txRepo.Create(ctx, u); err != nil {
 		t.Fatalf("create tx: %v", err)
@@ -48,12 +51,72 @@ func TestUserRepoSoftDelete(t *testing.T) {
 	defer db.Close()
 	repo := postgres.NewUserRepo(db)
 	id := uuid.New()
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET deleted_at=$2 WHERE id=$1 AND deleted_at IS NULL`)).
-		WithArgs(id, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
-	if err := repo.Delete(context.Background(), id); err != nil {
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET deleted_at=$2 WHERE id=$1 AND tenant_id=$3 AND deleted_at IS NULL`)).
+		WithArgs(id, sqlmock.AnyArg(), core.DefaultTenant).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := repo.Delete(context.Background(), id, 0); err != nil {
 		t.Fatalf("soft delete: %v", err)
 	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expect: %v", err)
 	}
 }
+
+func TestUserRepoUpdateStaleVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	u := &core.User{ID: uuid.New(), Name: "Ann", Email: "ann@example.com", UpdatedAt: time.Now(), Version: 3}
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET name=$2, email=$3, updated_at=$4, attributes=$6, status=$7, status_changed_at=$8, status_reason=$9, email_verified_at=$11 WHERE id=$1 AND tenant_id=$10 AND version=$5 AND deleted_at IS NULL`)).
+		WithArgs(u.ID, u.Name, u.Email, u.UpdatedAt, int64(3), "{}", core.StatusActive, u.CreatedAt, "", core.DefaultTenant, nil).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM users WHERE id=$1 AND tenant_id=$2 AND deleted_at IS NULL)`)).
+		WithArgs(u.ID, core.DefaultTenant).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	if err := repo.Update(context.Background(), u); !errors.Is(err, core.ErrStaleVersion) {
+		t.Fatalf("expected stale version, got %v", err)
+	}
+	if u.Version != 3 {
+		t.Fatalf("version must not advance on conflict, got %d", u.Version)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
+
+func TestUserRepoTxCreateManyIsOneStatement(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+	repo := postgres.NewUserRepo(db)
+	ctx := context.Background()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT set_config`)).WithArgs(core.DefaultTenant).WillReturnResult(sqlmock.NewResult(0, 0))
+	uow, err := repo.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	now := time.Now()
+	a := &core.User{ID: uuid.New(), Name: "A", Email: "a@example.com", CreatedAt: now, UpdatedAt: now}
+	b := &core.User{ID: uuid.New(), Name: "B", Email: "b@example.com", CreatedAt: now, UpdatedAt: now}
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (id, name, email, created_at, updated_at, attributes, status, status_changed_at, tenant_id) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9),($10,$11,$12,$13,$14,$15,$16,$17,$18)`)).
+		WithArgs(a.ID, a.Name, a.Email, a.CreatedAt, a.UpdatedAt, "{}", core.StatusActive, a.CreatedAt, core.DefaultTenant,
+			b.ID, b.Name, b.Email, b.CreatedAt, b.UpdatedAt, "{}", core.StatusActive, b.CreatedAt, core.DefaultTenant).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	bc, ok := uow.UserRepo().(core.BatchCreator)
+	if !ok {
+		t.Fatal("tx repo should implement core.BatchCreator")
+	}
+	if err := bc.CreateMany(ctx, []*core.User{a, b}); err != nil {
+		t.Fatalf("create many: %v", err)
+	}
+	if err := uow.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expect: %v", err)
+	}
+}
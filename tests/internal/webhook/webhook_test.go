@@ -0,0 +1,330 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hex-zero/MaxwellGoSpine/internal/core"
+	"github.com/hex-zero/MaxwellGoSpine/internal/outbox"
+	"github.com/hex-zero/MaxwellGoSpine/internal/webhook"
+	"go.uber.org/zap"
+)
+
+// receiver is an httptest endpoint that verifies signatures and answers with the queued status codes.
+type receiver struct {
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	events   []outbox.CloudEvent
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := webhook.Verify(rc.secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now()); err != nil {
+		rc.t.Errorf("signature: %v", err)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	if status < 300 {
+		var ev outbox.CloudEvent
+		_ = json.Unmarshal(body, &ev)
+		rc.events = append(rc.events, ev)
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte("ack"))
+}
+
+func TestUserMutationsAreDeliveredSignedWithRetries(t *testing.T) {
+	ctx := context.Background()
+	const secret = "0123456789abcdef0123"
+	rc := &receiver{t: t, secret: secret, statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	repo := core.NewInMemoryUserRepo()
+	users := core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Events: true})
+	store := webhook.NewMemoryStore()
+	hooks := webhook.NewService(store)
+	sub, err := hooks.Create(ctx, srv.URL, secret, []core.UserEventType{core.UserCreated})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	u, err := users.Create(ctx, "Ann", "ann@example.com", nil)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := users.Delete(ctx, u.ID, 0); err != nil { // not subscribed
+		t.Fatalf("delete user: %v", err)
+	}
+	if _, err := outbox.NewDispatcher(repo, webhook.NewPublisher(store), zap.NewNop(), outbox.DispatcherOptions{}).DispatchOnce(ctx); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	worker := webhook.NewWorker(store, zap.NewNop(), webhook.WorkerOptions{BaseBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, AllowPrivate: true})
+	if n, err := worker.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("first attempt: %d %v", n, err)
+	}
+	ds, _ := hooks.Deliveries(ctx, sub.ID, 10)
+	if len(ds) != 1 || ds[0].Status != webhook.DeliveryPending || ds[0].Attempts != 1 {
+		t.Fatalf("expected one pending delivery after a 500, got %+v", ds)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n, err := worker.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("retry: %d %v", n, err)
+	}
+	d, log, err := hooks.Delivery(ctx, sub.ID, ds[0].ID)
+	if err != nil || d.Status != webhook.DeliverySucceeded || len(log) != 2 {
+		t.Fatalf("expected success after retry with 2 logged attempts, got %+v %d %v", d, len(log), err)
+	}
+	if log[0].StatusCode != http.StatusInternalServerError || log[1].StatusCode != http.StatusOK || log[1].ResponseBody != "ack" {
+		t.Fatalf("unexpected delivery log %+v", log)
+	}
+	if len(rc.events) != 1 || rc.events[0].Type != "com.maxwell.user.created" || rc.events[0].Subject != u.ID.String() {
+		t.Fatalf("unexpected received events %+v", rc.events)
+	}
+
+	if _, err := hooks.Redeliver(ctx, sub.ID, d.ID); err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	if n, _ := worker.DeliverDue(ctx); n != 1 || len(rc.events) != 2 {
+		t.Fatalf("expected manual redelivery to be sent, got %d claimed, %d received", n, len(rc.events))
+	}
+}
+
+func TestBackoffGrowsWithJitterAndCap(t *testing.T) {
+	base, max := time.Second, 10*time.Second
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 5: max, 20: max} {
+		for i := 0; i < 50; i++ {
+			if got := webhook.Backoff(attempt, base, max); got < want/2 || got > want {
+				t.Fatalf("attempt %d: backoff %v outside [%v, %v]", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestVerifyRejectsTamperingAndReplays(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"1"}`)
+	sig := webhook.Sign("secret", now, body)
+	if err := webhook.Verify("secret", sig, body, time.Minute, now); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := webhook.Verify("secret", sig, []byte(`{"id":"2"}`), time.Minute, now); err == nil {
+		t.Fatal("tampered body accepted")
+	}
+	if err := webhook.Verify("secret", sig, body, time.Minute, now.Add(10*time.Minute)); err == nil {
+		t.Fatal("stale timestamp accepted")
+	}
+}
+
+func TestSubscriptionsAreTenantScoped(t *testing.T) {
+	acme := core.WithTenant(context.Background(), "acme")
+	globex := core.WithTenant(context.Background(), "globex")
+	repo := core.NewInMemoryUserRepo()
+	users := core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Events: true})
+	store := webhook.NewMemoryStore()
+	hooks := webhook.NewService(store)
+	subA, err := hooks.Create(acme, "https://acme.example/hook", "", nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	subG, _ := hooks.Create(globex, "https://globex.example/hook", "", nil)
+
+	if _, err := hooks.Get(globex, subA.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("globex must not see acme's subscription, got %v", err)
+	}
+	if err := hooks.Delete(globex, subA.ID); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("globex must not delete acme's subscription, got %v", err)
+	}
+	if subs, _ := hooks.List(globex); len(subs) != 1 || subs[0].ID != subG.ID {
+		t.Fatalf("globex should list only its subscription, got %+v", subs)
+	}
+
+	if _, err := users.Create(acme, "Ann", "ann@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.NewDispatcher(repo, webhook.NewPublisher(store), zap.NewNop(), outbox.DispatcherOptions{}).DispatchOnce(context.Background()); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if ds, _ := hooks.Deliveries(acme, subA.ID, 10); len(ds) != 1 {
+		t.Fatalf("acme's subscription should get acme's event, got %d deliveries", len(ds))
+	}
+	if ds, _ := hooks.Deliveries(globex, subG.ID, 10); len(ds) != 0 {
+		t.Fatalf("globex's subscription must not get acme's event, got %d deliveries", len(ds))
+	}
+}
+
+// flakyStore fails lookups of one subscription, as when it is deleted after its deliveries were claimed.
+type flakyStore struct {
+	*webhook.MemoryStore
+	broken uuid.UUID
+}
+
+func (s *flakyStore) GetSubscription(ctx context.Context, id uuid.UUID) (*webhook.Subscription, error) {
+	if id == s.broken {
+		return nil, errors.New("connection reset")
+	}
+	return s.MemoryStore.GetSubscription(ctx, id)
+}
+
+func TestDeliveryErrorsDoNotStrandTheBatch(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{t: t, secret: "0123456789abcdef0123"}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	repo := core.NewInMemoryUserRepo()
+	users := core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Events: true})
+	store := &flakyStore{MemoryStore: webhook.NewMemoryStore()}
+	hooks := webhook.NewService(store)
+	broken, err := hooks.Create(ctx, srv.URL, rc.secret, nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	working, err := hooks.Create(ctx, srv.URL, rc.secret, nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	store.broken = broken.ID
+	if _, err := users.Create(ctx, "Ann", "ann@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.NewDispatcher(repo, webhook.NewPublisher(store), zap.NewNop(), outbox.DispatcherOptions{}).DispatchOnce(ctx); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+
+	worker := webhook.NewWorker(store, zap.NewNop(), webhook.WorkerOptions{AllowPrivate: true})
+	if n, err := worker.DeliverDue(ctx); err != nil || n != 2 {
+		t.Fatalf("deliver: %d %v", n, err)
+	}
+	if ds, _ := hooks.Deliveries(ctx, working.ID, 10); len(ds) != 1 || ds[0].Status != webhook.DeliverySucceeded {
+		t.Fatalf("expected the other subscription's delivery to be sent, got %+v", ds)
+	}
+}
+
+func TestDeactivatedSubscriptionsStopPendingDeliveries(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{t: t, secret: "0123456789abcdef0123"}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	repo := core.NewInMemoryUserRepo()
+	users := core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Events: true})
+	store := webhook.NewMemoryStore()
+	hooks := webhook.NewService(store)
+	sub, err := hooks.Create(ctx, srv.URL, rc.secret, nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if _, err := users.Create(ctx, "Ann", "ann@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.NewDispatcher(repo, webhook.NewPublisher(store), zap.NewNop(), outbox.DispatcherOptions{}).DispatchOnce(ctx); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	inactive := false
+	if _, err := hooks.Update(ctx, sub.ID, webhook.SubscriptionPatch{Active: &inactive}); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+
+	worker := webhook.NewWorker(store, zap.NewNop(), webhook.WorkerOptions{AllowPrivate: true})
+	if n, err := worker.DeliverDue(ctx); err != nil || n != 1 {
+		t.Fatalf("deliver: %d %v", n, err)
+	}
+	rc.mu.Lock()
+	received := len(rc.events)
+	rc.mu.Unlock()
+	ds, _ := hooks.Deliveries(ctx, sub.ID, 10)
+	if received != 0 || len(ds) != 1 || ds[0].Status != webhook.DeliveryFailed {
+		t.Fatalf("expected the pending delivery to fail unsent, got %d received, %+v", received, ds)
+	}
+	if n, _ := worker.DeliverDue(ctx); n != 0 {
+		t.Fatalf("expected no retries of the stopped delivery, got %d claimed", n)
+	}
+}
+
+func TestDeliveriesRefusePrivateAddressesAndRedirects(t *testing.T) {
+	ctx := context.Background()
+	var internal atomic.Int32
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internal.Add(1)
+		_, _ = w.Write([]byte("instance credentials"))
+	}))
+	defer metadata.Close()
+	redirector := httptest.NewServer(http.RedirectHandler(metadata.URL, http.StatusFound))
+	defer redirector.Close()
+
+	repo := core.NewInMemoryUserRepo()
+	users := core.NewUserServiceWithOpts(repo, core.UserServiceOptions{Events: true})
+	store := webhook.NewMemoryStore()
+	hooks := webhook.NewService(store)
+	direct, err := hooks.Create(ctx, metadata.URL, "", nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	redirected, err := hooks.Create(ctx, redirector.URL, "", nil)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if _, err := users.Create(ctx, "Ann", "ann@example.com", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.NewDispatcher(repo, webhook.NewPublisher(store), zap.NewNop(), outbox.DispatcherOptions{}).DispatchOnce(ctx); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	lastAttempt := func(sub uuid.UUID) webhook.Attempt {
+		t.Helper()
+		ds, _ := hooks.Deliveries(ctx, sub, 10)
+		if len(ds) != 1 {
+			t.Fatalf("expected one delivery, got %d", len(ds))
+		}
+		_, log, err := hooks.Delivery(ctx, sub, ds[0].ID)
+		if err != nil || len(log) == 0 {
+			t.Fatalf("delivery log: %v %v", log, err)
+		}
+		return log[len(log)-1]
+	}
+
+	// the default worker refuses the loopback receivers outright
+	if _, err := webhook.NewWorker(store, zap.NewNop(), webhook.WorkerOptions{}).DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a := lastAttempt(direct.ID); a.StatusCode != 0 || !strings.Contains(a.Error, "not a public address") {
+		t.Fatalf("expected a loopback destination to be refused, got %+v", a)
+	}
+	if internal.Load() != 0 {
+		t.Fatal("the internal service was reached")
+	}
+
+	// even where private addresses are allowed, a redirect is recorded rather than followed
+	for _, sub := range []uuid.UUID{direct.ID, redirected.ID} {
+		ds, _ := hooks.Deliveries(ctx, sub, 10)
+		if _, err := hooks.Redeliver(ctx, sub, ds[0].ID); err != nil {
+			t.Fatalf("redeliver: %v", err)
+		}
+	}
+	if _, err := webhook.NewWorker(store, zap.NewNop(), webhook.WorkerOptions{AllowPrivate: true}).DeliverDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a := lastAttempt(redirected.ID); a.StatusCode != http.StatusFound || strings.Contains(a.ResponseBody, "credentials") {
+		t.Fatalf("expected the redirect itself to be logged, got %+v", a)
+	}
+	if n := internal.Load(); n != 1 {
+		t.Fatalf("expected only the direct delivery to reach the receiver, got %d requests", n)
+	}
+}